@@ -0,0 +1,129 @@
+package access
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/proxy"
+)
+
+// Structures used to serialize data:
+type Access struct {
+	// Networks (CIDR) or IPs allowed, taking precedence over the denied ones
+	Allow []string `json:"allow"`
+	// Networks (CIDR) or IPs denied
+	Deny []string `json:"deny"`
+	// Action applied to the denied sources: drop (default) or tarpit
+	Action string `json:"action"`
+	// Time the tarpitted connections are kept open (e.g., 1m)
+	TarpitDelay string `json:"tarpit_delay"`
+}
+
+// Owner of an access list: the global access list or a proxy
+type Accessible interface {
+	GetAccess() proxy.AccessRules
+	SetAccess(rules proxy.AccessRules) error
+}
+
+// Function that returns the access list targeted by a request
+type AccessResolver func(ctx *gin.Context) (Accessible, error)
+
+// Routes
+var (
+	// Routes of the global access list
+	accessRoutes = []api.Route{
+		api.NewRoute("", "GET", GetAccess(globalAccess)),
+		api.NewRoute("", "PUT", SetAccess(globalAccess)),
+	}
+)
+
+// Routers
+var (
+	// Global access list
+	AccessRouter = api.NewRouter("access/", accessRoutes, nil)
+)
+
+// Returns the access list shared by all the proxies
+func globalAccess(ctx *gin.Context) (Accessible, error) {
+	return proxy.GlobalAccess, nil
+}
+
+func NewAccess(rules proxy.AccessRules) *Access {
+	access := &Access{
+		Allow:  []string{},
+		Deny:   []string{},
+		Action: rules.Action,
+	}
+
+	for _, network := range rules.Allow {
+		access.Allow = append(access.Allow, network.String())
+	}
+	for _, network := range rules.Deny {
+		access.Deny = append(access.Deny, network.String())
+	}
+	if rules.TarpitDelay > 0 {
+		access.TarpitDelay = rules.TarpitDelay.String()
+	}
+	return access
+}
+
+// Returns the rules of the input
+func (a Access) Parse() (rules proxy.AccessRules, err error) {
+	rules.Action = a.Action
+
+	if rules.Allow, err = proxy.ParseNetworks(a.Allow); err != nil {
+		return
+	}
+	if rules.Deny, err = proxy.ParseNetworks(a.Deny); err != nil {
+		return
+	}
+	if a.TarpitDelay != "" {
+		rules.TarpitDelay, err = time.ParseDuration(a.TarpitDelay)
+	}
+	return
+}
+
+// GET the access list
+func GetAccess(resolve AccessResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		accessible, err := resolve(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, NewAccess(accessible.GetAccess()))
+	}
+}
+
+// PUT the access list, replacing the networks allowed and denied
+func SetAccess(resolve AccessResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input Access
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		rules, err := input.Parse()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		accessible, err := resolve(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := accessible.SetAccess(rules); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, NewAccess(accessible.GetAccess()))
+	}
+}
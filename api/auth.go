@@ -0,0 +1,117 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/internal/auth"
+)
+
+const (
+	// Key of the client authenticated in the context of the request
+	PrincipalKey = "principal"
+	// Header with an API key, alternative to the bearer token
+	apiKeyHeader = "X-API-Key"
+	// Query parameter with the token, only accepted by the routes that can not set headers
+	tokenParam = "token"
+)
+
+// Returns the token of the request, given either as a bearer token or in the API key header
+func GetToken(ctx *gin.Context) string {
+	if header := ctx.GetHeader("Authorization"); strings.HasPrefix(header, "Bearer ") {
+		return strings.TrimSpace(strings.TrimPrefix(header, "Bearer "))
+	}
+
+	return ctx.GetHeader(apiKeyHeader)
+}
+
+// Handler that authenticates the client and checks that its role allows to use the route.
+// Every request is allowed while the authentication is disabled
+func Authorize(role auth.Role) gin.HandlerFunc {
+	return authorize(role, false)
+}
+
+// Same as Authorize, also accepting the token in the `token` query parameter,
+// e.g. for the event streams, which can not set headers in the browsers
+func AuthorizeQuery(role auth.Role) gin.HandlerFunc {
+	return authorize(role, true)
+}
+
+func authorize(role auth.Role, query bool) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		if role == auth.PublicRole || !auth.Auth.Enabled() {
+			ctx.Next()
+			return
+		}
+
+		token := GetToken(ctx)
+		if token == "" && query {
+			token = ctx.Query(tokenParam)
+		}
+
+		principal, err := auth.Auth.Authenticate(token)
+		if err != nil && ctx.Request.TLS != nil {
+			// Clients may be authenticated by their certificate instead
+			principal, err = auth.Auth.AuthenticateCertificate(ctx.Request.TLS)
+		}
+		if err != nil {
+			ctx.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+
+		if !principal.Role.Allows(role) {
+			ctx.AbortWithStatusJSON(http.StatusForbidden, gin.H{"error": "the role of the client does not allow this action"})
+			return
+		}
+
+		ctx.Set(PrincipalKey, principal)
+		ctx.Next()
+	}
+}
+
+// Returns the path with the value of the token in the query redacted, to be logged
+func RedactToken(path string) string {
+	i := strings.IndexByte(path, '?')
+	if i < 0 {
+		return path
+	}
+
+	query, err := url.ParseQuery(path[i+1:])
+	if err != nil {
+		// Do not log a query that can not be parsed, it may contain the token anyway
+		return path[:i]
+	}
+	if _, ok := query[tokenParam]; !ok {
+		return path
+	}
+
+	query.Set(tokenParam, "REDACTED")
+	return path[:i+1] + query.Encode()
+}
+
+// Formatter of the requests logged, in the default format of gin without the tokens
+func LogFormatter(param gin.LogFormatterParams) string {
+	var statusColor, methodColor, resetColor string
+	if param.IsOutputColor() {
+		statusColor = param.StatusCodeColor()
+		methodColor = param.MethodColor()
+		resetColor = param.ResetColor()
+	}
+
+	if param.Latency > time.Minute {
+		param.Latency = param.Latency.Truncate(time.Second)
+	}
+	return fmt.Sprintf("[GIN] %v |%s %3d %s| %13v | %15s |%s %-7s %s %#v\n%s",
+		param.TimeStamp.Format("2006/01/02 - 15:04:05"),
+		statusColor, param.StatusCode, resetColor,
+		param.Latency,
+		param.ClientIP,
+		methodColor, param.Method, resetColor,
+		RedactToken(param.Path),
+		param.ErrorMessage,
+	)
+}
@@ -0,0 +1,103 @@
+package auth
+
+import (
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/auth"
+)
+
+// Structures used to serialize data:
+type Login struct {
+	Username string `json:"username" binding:"required"`
+	Password string `json:"password" binding:"required"`
+}
+
+type GetSession struct {
+	Token   string    `json:"token"`
+	Name    string    `json:"name"`
+	Role    auth.Role `json:"role"`
+	Expires time.Time `json:"expires"`
+}
+
+type GetPrincipal struct {
+	Name string    `json:"name"`
+	Role auth.Role `json:"role"`
+	// Whether the API requires authentication
+	Enabled bool `json:"enabled"`
+}
+
+// Routes
+var (
+	// Routes of the authentication
+	authRoutes = []api.Route{
+		// POST the credentials of a user to get a session token
+		api.NewRoute("login", "POST", login).WithRole(auth.PublicRole),
+		// POST to close the session of the token used
+		api.NewRoute("logout", "POST", logout).WithRole(auth.ReadRole),
+		// GET the client authenticated
+		api.NewRoute("me", "GET", me),
+	}
+)
+
+// Routers
+var (
+	// Authentication
+	AuthRouter = api.NewRouter("auth/", authRoutes, nil)
+)
+
+// POST the credentials of a user, returns a session token used as a bearer token
+func login(ctx *gin.Context) {
+	var input Login
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Back off by the address of the connection, the forwarded headers can be set by anyone
+	client := ctx.RemoteIP()
+
+	session, err := auth.Auth.Login(input.Username, input.Password, client)
+	if errors.Is(err, auth.ErrTooManyAttempts) {
+		retry := int(math.Ceil(auth.Auth.GetBackoff(client).Seconds()))
+		ctx.Header("Retry-After", strconv.Itoa(retry))
+		ctx.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		ctx.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, GetSession{
+		Token:   session.Token,
+		Name:    session.Principal.Name,
+		Role:    session.Principal.Role,
+		Expires: session.Expires,
+	})
+}
+
+// POST to close the session of the token used in the request
+func logout(ctx *gin.Context) {
+	auth.Auth.Logout(api.GetToken(ctx))
+	ctx.JSON(http.StatusOK, gin.H{"success": "Logged out"})
+}
+
+// GET the client authenticated, anyone is an admin while the authentication is disabled
+func me(ctx *gin.Context) {
+	principal := &auth.Principal{Name: "anonymous", Role: auth.AdminRole}
+	if value, ok := ctx.Get(api.PrincipalKey); ok {
+		principal = value.(*auth.Principal)
+	}
+
+	ctx.JSON(http.StatusOK, GetPrincipal{
+		Name:    principal.Name,
+		Role:    principal.Role,
+		Enabled: auth.Auth.Enabled(),
+	})
+}
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/config"
+)
+
+// Routes
+var (
+	// Routes of the configuration
+	configRoutes = []api.Route{
+		// GET the running state as a configuration file
+		api.NewRoute("", "GET", exportConfig),
+	}
+)
+
+// Routers
+var (
+	// Configuration
+	ConfigRouter = api.NewRouter("config/", configRoutes, nil)
+)
+
+// GET the services, proxies and middlewares running in the format of the configuration file
+func exportConfig(ctx *gin.Context) {
+	data, err := config.Export().Marshal()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Header("Content-Disposition", `attachment; filename="riotpot.yaml"`)
+	ctx.Data(http.StatusOK, "application/x-yaml; charset=utf-8", data)
+}
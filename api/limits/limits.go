@@ -0,0 +1,135 @@
+package limits
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/proxy"
+)
+
+// Structures used to serialize data:
+type Limits struct {
+	// Maximum number of sessions open at the same time
+	MaxSessions int `json:"max_sessions"`
+	// Maximum number of connections of a source IP within the window (e.g., 1m)
+	MaxPerSource int    `json:"max_per_source"`
+	Window       string `json:"window"`
+	// Maximum duration of a session (e.g., 10m) and bytes relayed in both directions
+	MaxDuration string `json:"max_duration"`
+	MaxBytes    int64  `json:"max_bytes"`
+}
+
+// Owner of a set of limits: the global limiter or a proxy
+type Limited interface {
+	GetLimits() proxy.Limits
+	SetLimits(limits proxy.Limits) error
+}
+
+// Function that returns the limits targeted by a request
+type LimitsResolver func(ctx *gin.Context) (Limited, error)
+
+// Routes
+var (
+	// Routes of the global limits
+	limitsRoutes = []api.Route{
+		api.NewRoute("", "GET", GetLimits(globalLimits)),
+		api.NewRoute("", "PUT", SetLimits(globalLimits)),
+	}
+)
+
+// Routers
+var (
+	// Global limits
+	LimitsRouter = api.NewRouter("limits/", limitsRoutes, nil)
+)
+
+// Returns the limits shared by all the proxies
+func globalLimits(ctx *gin.Context) (Limited, error) {
+	return proxy.GlobalLimiter, nil
+}
+
+// Format a duration, empty when the limit is disabled
+func formatDuration(d time.Duration) string {
+	if d == 0 {
+		return ""
+	}
+	return d.String()
+}
+
+// Parse a duration, zero when empty
+func parseDuration(value string) (d time.Duration, err error) {
+	if value == "" {
+		return
+	}
+	return time.ParseDuration(value)
+}
+
+func NewLimits(limits proxy.Limits) *Limits {
+	return &Limits{
+		MaxSessions:  limits.MaxSessions,
+		MaxPerSource: limits.MaxPerSource,
+		Window:       formatDuration(limits.Window),
+		MaxDuration:  formatDuration(limits.MaxDuration),
+		MaxBytes:     limits.MaxBytes,
+	}
+}
+
+// Returns the limits of the input
+func (l Limits) Parse() (limits proxy.Limits, err error) {
+	limits = proxy.Limits{
+		MaxSessions:  l.MaxSessions,
+		MaxPerSource: l.MaxPerSource,
+		MaxBytes:     l.MaxBytes,
+	}
+
+	if limits.Window, err = parseDuration(l.Window); err != nil {
+		return
+	}
+	limits.MaxDuration, err = parseDuration(l.MaxDuration)
+	return
+}
+
+// GET the limits
+func GetLimits(resolve LimitsResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		limited, err := resolve(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, NewLimits(limited.GetLimits()))
+	}
+}
+
+// PUT the limits, the fields left out disable their limit
+func SetLimits(resolve LimitsResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input Limits
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		limits, err := input.Parse()
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		limited, err := resolve(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		if err := limited.SetLimits(limits); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, NewLimits(limited.GetLimits()))
+	}
+}
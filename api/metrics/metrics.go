@@ -0,0 +1,49 @@
+package metrics
+
+import (
+	"crypto/subtle"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/auth"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/metrics"
+)
+
+// Routes
+var (
+	// Routes of the metrics
+	metricsRoutes = []api.Route{
+		// GET the metrics, authorized by the scrape token or as any other route of the API
+		api.NewRoute("", "GET", authorizeScrape, getMetrics).WithRole(auth.PublicRole),
+	}
+)
+
+// Routers
+var (
+	// Metrics router, served in the root of the API server as expected by Prometheus
+	MetricsRouter = api.NewRouter("metrics", metricsRoutes, nil)
+)
+
+var (
+	// Authorization of the clients without the scrape token
+	authorizeReader = api.Authorize(auth.ReadRole)
+	// Handler writing the metrics of the application
+	metricsHandler = metrics.Handler()
+)
+
+// Let the requests with the scrape token through, the rest need the read role
+func authorizeScrape(ctx *gin.Context) {
+	token := globals.MetricsToken
+	if token != "" && subtle.ConstantTimeCompare([]byte(api.GetToken(ctx)), []byte(token)) == 1 {
+		ctx.Next()
+		return
+	}
+
+	authorizeReader(ctx)
+}
+
+// GET the metrics in the Prometheus text format
+func getMetrics(ctx *gin.Context) {
+	metricsHandler.ServeHTTP(ctx.Writer, ctx.Request)
+}
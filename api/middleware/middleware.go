@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/proxy"
+)
+
+// Structures used to serialize data:
+type GetMiddleware struct {
+	Name     string `json:"name"`
+	Priority int    `json:"priority"`
+	Enabled  bool   `json:"enabled"`
+}
+
+type PatchMiddleware struct {
+	Priority *int  `json:"priority"`
+	Enabled  *bool `json:"enabled"`
+}
+
+// Function that returns the chain of middlewares targeted by a request
+type ChainResolver func(ctx *gin.Context) (proxy.MiddlewareManager, error)
+
+// Routes
+var (
+	// Routes of the global chain of middlewares
+	middlewaresRoutes = []api.Route{
+		api.NewRoute("", "GET", GetChain(globalChain)),
+		api.NewRoute("/:name", "GET", GetChainMiddleware(globalChain)),
+		api.NewRoute("/:name", "PATCH", PatchChainMiddleware(globalChain)),
+	}
+)
+
+// Routers
+var (
+	// Global middlewares
+	MiddlewaresRouter = api.NewRouter("middlewares/", middlewaresRoutes, nil)
+)
+
+// Returns the chain of middlewares applied by every proxy
+func globalChain(ctx *gin.Context) (proxy.MiddlewareManager, error) {
+	return proxy.Middlewares, nil
+}
+
+func NewMiddleware(item proxy.ChainItem) *GetMiddleware {
+	return &GetMiddleware{
+		Name:     item.Middleware.GetName(),
+		Priority: item.Priority,
+		Enabled:  item.Enabled,
+	}
+}
+
+// GET the middlewares of a chain, in the order in which they are applied
+func GetChain(resolve ChainResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		chain, err := resolve(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		casted := []GetMiddleware{}
+		for _, item := range chain.GetMiddlewares() {
+			casted = append(casted, *NewMiddleware(item))
+		}
+
+		ctx.JSON(http.StatusOK, casted)
+	}
+}
+
+// GET a middleware of a chain by its name
+func GetChainMiddleware(resolve ChainResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		chain, err := resolve(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item, err := chain.GetMiddleware(ctx.Param("name"))
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, NewMiddleware(item))
+	}
+}
+
+// PATCH a middleware of a chain
+// Can update:
+// priority and enabled
+func PatchChainMiddleware(resolve ChainResolver) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		var input PatchMiddleware
+		if err := ctx.ShouldBindJSON(&input); err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		chain, err := resolve(ctx)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		name := ctx.Param("name")
+		if input.Priority != nil {
+			if err := chain.SetPriority(name, *input.Priority); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if input.Enabled != nil {
+			if err := chain.SetEnabled(name, *input.Enabled); err != nil {
+				ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		item, err := chain.GetMiddleware(name)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		ctx.JSON(http.StatusOK, NewMiddleware(item))
+	}
+}
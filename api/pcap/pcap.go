@@ -0,0 +1,77 @@
+package pcap
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/pcap"
+)
+
+// Structures used to serialize data:
+type Retention struct {
+	// Maximum number of files kept for each proxy, the oldest are removed first
+	MaxFiles int `json:"max_files"`
+	// Time after which the files are removed (e.g., 168h)
+	Retention string `json:"retention"`
+}
+
+// Routes
+var (
+	// Routes of the retention of the capture files
+	pcapRoutes = []api.Route{
+		api.NewRoute("", "GET", getRetention),
+		api.NewRoute("", "PUT", setRetention),
+	}
+)
+
+// Routers
+var (
+	// Capture files of the proxies
+	PcapRouter = api.NewRouter("pcap/", pcapRoutes, nil)
+)
+
+func NewRetention(retention pcap.Retention) *Retention {
+	r := &Retention{MaxFiles: retention.MaxFiles}
+	if retention.MaxAge > 0 {
+		r.Retention = retention.MaxAge.String()
+	}
+	return r
+}
+
+// Returns the retention of the input
+func (r Retention) Parse() (retention pcap.Retention, err error) {
+	retention.MaxFiles = r.MaxFiles
+	if r.Retention != "" {
+		retention.MaxAge, err = time.ParseDuration(r.Retention)
+	}
+	return
+}
+
+// GET the retention of the capture files
+func getRetention(ctx *gin.Context) {
+	ctx.JSON(http.StatusOK, NewRetention(pcap.GlobalRetention.GetRetention()))
+}
+
+// PUT the retention of the capture files, the fields left out keep every file
+func setRetention(ctx *gin.Context) {
+	var input Retention
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	retention, err := input.Parse()
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := pcap.GlobalRetention.SetRetention(retention); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewRetention(pcap.GlobalRetention.GetRetention()))
+}
@@ -1,11 +1,16 @@
 package proxy
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/riotpot/api"
+	"github.com/riotpot/api/access"
+	"github.com/riotpot/api/limits"
+	"github.com/riotpot/api/middleware"
 	"github.com/riotpot/api/service"
 	"github.com/riotpot/internal/globals"
 	"github.com/riotpot/internal/proxy"
@@ -19,6 +24,8 @@ type GetProxy struct {
 	Port    int                 `json:"port"`
 	Network string              `json:"network"`
 	Status  string              `json:"status"`
+	Capture bool                `json:"capture"`
+	Pcap    bool                `json:"pcap"`
 	Service *service.GetService `json:"service"`
 }
 
@@ -42,6 +49,105 @@ type ChangeProxyPort struct {
 	Port int `json:"port" binding:"required"`
 }
 
+type ChangeProxyCapture struct {
+	// Pointer to accept `false` as a valid value
+	Capture *bool `json:"capture" binding:"required"`
+}
+
+type ChangeProxyPcap struct {
+	// Pointer to accept `false` as a valid value
+	Pcap *bool `json:"pcap" binding:"required"`
+}
+
+type GetPcapFile struct {
+	Name     string    `json:"name"`
+	Size     int64     `json:"size"`
+	Modified time.Time `json:"modified"`
+}
+
+type GetRoutingRule struct {
+	Name      string              `json:"name"`
+	Sources   []string            `json:"sources"`
+	Prefix    string              `json:"prefix,omitempty"`
+	Window    string              `json:"window,omitempty"`
+	MinVisits int                 `json:"min_visits"`
+	Service   *service.GetService `json:"service"`
+}
+
+type CreateRoutingRule struct {
+	Name      string   `json:"name" binding:"required"`
+	Sources   []string `json:"sources"`
+	Prefix    string   `json:"prefix"`
+	Window    string   `json:"window"`
+	MinVisits int      `json:"min_visits"`
+	// ID of the service
+	Service string `json:"service" binding:"required"`
+}
+
+type GetSniffer struct {
+	Timeout  string                         `json:"timeout"`
+	Services map[string]*service.GetService `json:"services"`
+}
+
+type PatchSniffer struct {
+	Timeout string `json:"timeout" binding:"required"`
+}
+
+type SetSnifferService struct {
+	// ID of the service
+	Service string `json:"service" binding:"required"`
+}
+
+type GetDownPolicy struct {
+	Action   string              `json:"action"`
+	Fallback *service.GetService `json:"fallback,omitempty"`
+	Banner   string              `json:"banner,omitempty"`
+}
+
+type SetDownPolicy struct {
+	// Action when the service is down: reject, fallback or banner
+	Action string `json:"action" binding:"required"`
+	// ID of the service used by the fallback action
+	Fallback string `json:"fallback"`
+	// Banner sent by the banner action
+	Banner string `json:"banner"`
+}
+
+type SetFailover struct {
+	// IDs of the services, in the order they are dialed
+	Services []string `json:"services"`
+}
+
+type GetAttempt struct {
+	ServiceID string    `json:"service_id"`
+	Service   string    `json:"service"`
+	Time      time.Time `json:"time"`
+	Duration  string    `json:"duration"`
+	Error     string    `json:"error,omitempty"`
+}
+
+type GetSession struct {
+	ID     string `json:"id"`
+	Client string `json:"client"`
+	// Country (ISO code) and autonomous system of the client
+	Country     string     `json:"country,omitempty"`
+	ASN         uint       `json:"asn,omitempty"`
+	ASOrg       string     `json:"as_org,omitempty"`
+	Start       time.Time  `json:"start"`
+	End         *time.Time `json:"end"`
+	BytesIn     int64      `json:"bytes_in"`
+	BytesOut    int64      `json:"bytes_out"`
+	Active      bool       `json:"active"`
+	CloseReason string     `json:"close_reason,omitempty"`
+	// Name of the service that served the session
+	Service  string       `json:"service,omitempty"`
+	Attempts []GetAttempt `json:"attempts"`
+}
+
+type QuerySessions struct {
+	Active bool `form:"active"`
+}
+
 // Routes
 var (
 
@@ -60,6 +166,29 @@ var (
 		api.NewRoute("", "DELETE", delProxy),
 		api.NewRoute("/port", "POST", changeProxyPort),
 		api.NewRoute("/status", "POST", changeProxyStatus),
+		api.NewRoute("/capture", "POST", changeProxyCapture),
+		api.NewRoute("/pcap", "GET", getProxyPcapFiles),
+		api.NewRoute("/pcap", "POST", changeProxyPcap),
+		api.NewRoute("/pcap/:file", "GET", downloadProxyPcapFile),
+		api.NewRoute("/sessions", "GET", getProxySessions),
+		api.NewRoute("/routes", "GET", getProxyRoutes),
+		api.NewRoute("/routes", "POST", createProxyRoute),
+		api.NewRoute("/routes/:name", "DELETE", delProxyRoute),
+		api.NewRoute("/down", "GET", getProxyDownPolicy),
+		api.NewRoute("/down", "PUT", setProxyDownPolicy),
+		api.NewRoute("/failover", "GET", getProxyFailover),
+		api.NewRoute("/failover", "PUT", setProxyFailover),
+		api.NewRoute("/limits", "GET", limits.GetLimits(proxyLimits)),
+		api.NewRoute("/limits", "PUT", limits.SetLimits(proxyLimits)),
+		api.NewRoute("/access", "GET", access.GetAccess(proxyAccess)),
+		api.NewRoute("/access", "PUT", access.SetAccess(proxyAccess)),
+		api.NewRoute("/sniffer", "GET", getProxySniffer),
+		api.NewRoute("/sniffer", "PATCH", patchProxySniffer),
+		api.NewRoute("/sniffer/:protocol", "PUT", setProxySnifferService),
+		api.NewRoute("/sniffer/:protocol", "DELETE", delProxySnifferService),
+		api.NewRoute("/middlewares", "GET", middleware.GetChain(proxyChain)),
+		api.NewRoute("/middlewares/:name", "GET", middleware.GetChainMiddleware(proxyChain)),
+		api.NewRoute("/middlewares/:name", "PATCH", middleware.PatchChainMiddleware(proxyChain)),
 	}
 )
 
@@ -70,6 +199,27 @@ var (
 	ProxyRouter   = api.NewRouter(":id/", proxyRoutes, []api.Router{service.ServiceRouter})
 )
 
+// Returns the proxy in the path, owner of its limits
+func proxyLimits(ctx *gin.Context) (limits.Limited, error) {
+	return proxy.Proxies.GetProxy(ctx.Param("id"))
+}
+
+// Returns the proxy in the path, owner of its access list
+func proxyAccess(ctx *gin.Context) (access.Accessible, error) {
+	return proxy.Proxies.GetProxy(ctx.Param("id"))
+}
+
+// Returns the chain of middlewares of the proxy in the path
+func proxyChain(ctx *gin.Context) (chain proxy.MiddlewareManager, err error) {
+	pe, err := proxy.Proxies.GetProxy(ctx.Param("id"))
+	if err != nil {
+		return
+	}
+
+	chain = pe.GetMiddlewares()
+	return
+}
+
 func NewProxy(px proxy.Proxy) *GetProxy {
 	serv := service.NewService(px.GetService())
 
@@ -78,10 +228,104 @@ func NewProxy(px proxy.Proxy) *GetProxy {
 		Port:    px.GetPort(),
 		Network: px.GetNetwork().String(),
 		Status:  px.GetStatus().String(),
+		Capture: px.IsCapturing(),
+		Pcap:    px.IsPcapEnabled(),
 		Service: serv,
 	}
 }
 
+func NewRoutingRule(rule proxy.RoutingRule) *GetRoutingRule {
+	ret := &GetRoutingRule{
+		Name:      rule.Name,
+		Sources:   []string{},
+		Prefix:    string(rule.Prefix),
+		MinVisits: rule.MinVisits,
+		Service:   service.NewService(rule.Service),
+	}
+
+	for _, network := range rule.Sources {
+		ret.Sources = append(ret.Sources, network.String())
+	}
+
+	if rule.Window != nil {
+		ret.Window = rule.Window.String()
+	}
+
+	return ret
+}
+
+func NewSniffer(sniffer *proxy.Sniffer) *GetSniffer {
+	ret := &GetSniffer{
+		Timeout:  sniffer.GetTimeout().String(),
+		Services: make(map[string]*service.GetService),
+	}
+
+	for _, protocol := range sniffer.GetProtocols() {
+		serv, _ := sniffer.GetService(protocol)
+		ret.Services[protocol] = service.NewService(serv)
+	}
+
+	return ret
+}
+
+func NewDownPolicy(policy proxy.DownPolicy) *GetDownPolicy {
+	ret := &GetDownPolicy{
+		Action: string(policy.Action),
+		Banner: policy.Banner,
+	}
+
+	if policy.Action == proxy.FallbackAction {
+		serv, _ := services.Services.GetService(policy.Fallback)
+		ret.Fallback = service.NewService(serv)
+	}
+
+	return ret
+}
+
+func NewFailover(chain []services.Service) []*service.GetService {
+	ret := []*service.GetService{}
+	for _, serv := range chain {
+		ret = append(ret, service.NewService(serv))
+	}
+	return ret
+}
+
+func NewSession(session *proxy.Session) *GetSession {
+	ret := &GetSession{
+		ID:          session.GetID(),
+		Client:      session.GetClient().String(),
+		Start:       session.GetStart(),
+		BytesIn:     session.GetBytesIn(),
+		BytesOut:    session.GetBytesOut(),
+		Active:      session.IsActive(),
+		CloseReason: session.GetCloseReason(),
+		Attempts:    []GetAttempt{},
+	}
+
+	location := session.GetLocation()
+	ret.Country, ret.ASN, ret.ASOrg = location.Country, location.ASN, location.ASOrg
+
+	for _, attempt := range session.GetAttempts() {
+		ret.Attempts = append(ret.Attempts, GetAttempt{
+			ServiceID: attempt.ServiceID,
+			Service:   attempt.Service,
+			Time:      attempt.Time,
+			Duration:  attempt.Duration.String(),
+			Error:     attempt.Error,
+		})
+	}
+
+	if served, ok := session.GetServedBy(); ok {
+		ret.Service = served.Service
+	}
+
+	if end := session.GetEnd(); !end.IsZero() {
+		ret.End = &end
+	}
+
+	return ret
+}
+
 // TODO [7/17/2022]: Add filters to this method
 // GET proxies registered
 // Contains a filter to get proxies by port
@@ -197,6 +441,10 @@ func delProxy(ctx *gin.Context) {
 	id := ctx.Param("id")
 
 	err := proxy.Proxies.DeleteProxy(id)
+	if errors.Is(err, services.ErrServiceInUse) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -278,3 +526,446 @@ func changeProxyPort(ctx *gin.Context) {
 	pr := NewProxy(pe)
 	ctx.JSON(http.StatusOK, pr)
 }
+
+// POST request to enable or disable the capture of the sessions of the proxy
+func changeProxyCapture(ctx *gin.Context) {
+	var input ChangeProxyCapture
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the proxy to update
+	id := ctx.Param("id")
+	pe, err := proxy.Proxies.GetProxy(id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Only the streams relayed by TCP proxies can be captured
+	if pe.GetNetwork() != globals.TCP {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "capture is only supported in tcp proxies"})
+		return
+	}
+
+	pe.SetCapture(*input.Capture)
+
+	// Serialize the proxy and send it as a response
+	pr := NewProxy(pe)
+	ctx.JSON(http.StatusOK, pr)
+}
+
+// POST request to enable or disable writing the traffic of the proxy in pcapng files
+func changeProxyPcap(ctx *gin.Context) {
+	var input ChangeProxyPcap
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Get the proxy to update
+	id := ctx.Param("id")
+	pe, err := proxy.Proxies.GetProxy(id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := pe.SetPcap(*input.Pcap); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Serialize the proxy and send it as a response
+	pr := NewProxy(pe)
+	ctx.JSON(http.StatusOK, pr)
+}
+
+// GET the pcapng files written by the proxy
+func getProxyPcapFiles(ctx *gin.Context) {
+	id := ctx.Param("id")
+	pe, err := proxy.Proxies.GetProxy(id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	files, err := pe.GetPcapFiles()
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	casted := []GetPcapFile{}
+	for _, file := range files {
+		casted = append(casted, GetPcapFile{
+			Name:     file.Name,
+			Size:     file.Size,
+			Modified: file.ModTime,
+		})
+	}
+
+	ctx.JSON(http.StatusOK, casted)
+}
+
+// GET (download) a pcapng file written by the proxy
+func downloadProxyPcapFile(ctx *gin.Context) {
+	id := ctx.Param("id")
+	pe, err := proxy.Proxies.GetProxy(id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	name := ctx.Param("file")
+	path, err := pe.GetPcapFile(name)
+	if err != nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.FileAttachment(path, name)
+}
+
+// GET the routing rules of the proxy, in the order in which they are evaluated
+func getProxyRoutes(ctx *gin.Context) {
+	id := ctx.Param("id")
+	pe, err := proxy.Proxies.GetProxy(id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The router is only registered with the first rule
+	router, err := proxy.LookupRouter(pe)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	casted := []GetRoutingRule{}
+	if router != nil {
+		for _, rule := range router.GetRules() {
+			casted = append(casted, *NewRoutingRule(rule))
+		}
+	}
+
+	ctx.JSON(http.StatusOK, casted)
+}
+
+// POST a routing rule at the end of the rules of the proxy
+func createProxyRoute(ctx *gin.Context) {
+	var input CreateRoutingRule
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := ctx.Param("id")
+	pe, err := proxy.Proxies.GetProxy(id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serv, err := services.Services.GetService(input.Service)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sources, err := proxy.ParseNetworks(input.Sources)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	rule := proxy.RoutingRule{
+		Name:      input.Name,
+		Sources:   sources,
+		Prefix:    []byte(input.Prefix),
+		MinVisits: input.MinVisits,
+		Service:   serv,
+	}
+
+	if input.Window != "" {
+		window, err := proxy.ParseTimeWindow(input.Window)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		rule.Window = &window
+	}
+
+	router, err := proxy.GetRouter(pe)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := router.AddRule(rule); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewRoutingRule(rule))
+}
+
+// DELETE a routing rule of the proxy
+func delProxyRoute(ctx *gin.Context) {
+	id := ctx.Param("id")
+	pe, err := proxy.Proxies.GetProxy(id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	router, err := proxy.LookupRouter(pe)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	if router == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "the proxy has no routing rules"})
+		return
+	}
+
+	if err := router.RemoveRule(ctx.Param("name")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, gin.H{"success": "Route deleted"})
+}
+
+// GET the behaviour of the proxy when its service is down
+func getProxyDownPolicy(ctx *gin.Context) {
+	pe, err := proxy.Proxies.GetProxy(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewDownPolicy(pe.GetDownPolicy()))
+}
+
+// PUT the behaviour of the proxy when its service is down
+func setProxyDownPolicy(ctx *gin.Context) {
+	var input SetDownPolicy
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	action, err := proxy.ParseDownAction(input.Action)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pe, err := proxy.Proxies.GetProxy(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	policy := proxy.DownPolicy{
+		Action:   action,
+		Fallback: input.Fallback,
+		Banner:   input.Banner,
+	}
+	if err := pe.SetDownPolicy(policy); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewDownPolicy(pe.GetDownPolicy()))
+}
+
+// GET the services dialed when the service of the proxy can not be reached
+func getProxyFailover(ctx *gin.Context) {
+	pe, err := proxy.Proxies.GetProxy(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewFailover(pe.GetFailover()))
+}
+
+// PUT the services dialed when the service of the proxy can not be reached
+func setProxyFailover(ctx *gin.Context) {
+	var input SetFailover
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	pe, err := proxy.Proxies.GetProxy(ctx.Param("id"))
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	chain := []services.Service{}
+	for _, id := range input.Services {
+		serv, err := services.Services.GetService(id)
+		if err != nil {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		chain = append(chain, serv)
+	}
+
+	if err := pe.SetFailover(chain); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewFailover(pe.GetFailover()))
+}
+
+// Returns the sniffer of the proxy in the path, registering a new one if it does not have any
+func proxySniffer(ctx *gin.Context) (sniffer *proxy.Sniffer, err error) {
+	pe, err := proxy.Proxies.GetProxy(ctx.Param("id"))
+	if err != nil {
+		return
+	}
+
+	return proxy.GetSniffer(pe)
+}
+
+// Returns the sniffer of the proxy in the path, nil if it does not have any
+func lookupProxySniffer(ctx *gin.Context) (sniffer *proxy.Sniffer, err error) {
+	pe, err := proxy.Proxies.GetProxy(ctx.Param("id"))
+	if err != nil {
+		return
+	}
+
+	return proxy.LookupSniffer(pe)
+}
+
+// GET the services of the protocols detected by the sniffer of the proxy
+func getProxySniffer(ctx *gin.Context) {
+	sniffer, err := lookupProxySniffer(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The sniffer is only registered once it is changed, until then it has the default settings
+	if sniffer == nil {
+		sniffer = proxy.NewSniffer(proxy.SnifferName)
+	}
+
+	ctx.JSON(http.StatusOK, NewSniffer(sniffer))
+}
+
+// PATCH the time the sniffer waits for the first bytes of the clients
+func patchProxySniffer(ctx *gin.Context) {
+	var input PatchSniffer
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	timeout, err := time.ParseDuration(input.Timeout)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if timeout <= 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": "the timeout of the sniffer must be positive"})
+		return
+	}
+
+	sniffer, err := proxySniffer(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := sniffer.SetTimeout(timeout); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewSniffer(sniffer))
+}
+
+// PUT the service of a protocol detected by the sniffer
+func setProxySnifferService(ctx *gin.Context) {
+	var input SetSnifferService
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	serv, err := services.Services.GetService(input.Service)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	sniffer, err := proxySniffer(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := sniffer.SetService(ctx.Param("protocol"), serv); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewSniffer(sniffer))
+}
+
+// DELETE the service of a protocol detected by the sniffer
+func delProxySnifferService(ctx *gin.Context) {
+	sniffer, err := lookupProxySniffer(ctx)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if sniffer == nil {
+		ctx.JSON(http.StatusNotFound, gin.H{"error": "the proxy has no sniffer"})
+		return
+	}
+
+	if err := sniffer.RemoveService(ctx.Param("protocol")); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewSniffer(sniffer))
+}
+
+// GET the sessions of the proxy
+// Contains a filter to get only the active sessions
+func getProxySessions(ctx *gin.Context) {
+	var input QuerySessions
+	if err := ctx.ShouldBindQuery(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := ctx.Param("id")
+	pe, err := proxy.Proxies.GetProxy(id)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	casted := []GetSession{}
+	for _, session := range pe.GetSessions() {
+		if input.Active && !session.IsActive() {
+			continue
+		}
+
+		casted = append(casted, *NewSession(session))
+	}
+
+	ctx.JSON(http.StatusOK, casted)
+}
@@ -0,0 +1,152 @@
+package record
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/intel"
+	"github.com/riotpot/internal/store"
+)
+
+const (
+	// Number of records returned when the query does not include a limit
+	defaultLimit = 100
+)
+
+// Structures used to serialize data:
+type QueryRecords struct {
+	Kind       string `form:"kind"`
+	ProxyID    string `form:"proxy"`
+	ServiceID  string `form:"service"`
+	RemoteAddr string `form:"remote"`
+	Country    string `form:"country"`
+	ASN        uint   `form:"asn"`
+	Since      string `form:"since"`
+	Until      string `form:"until"`
+	Limit      int    `form:"limit"`
+}
+
+type QueryExport struct {
+	QueryRecords
+	// Format of the export: stix (default) or misp
+	Format string `form:"format"`
+}
+
+// Routes
+var (
+	// General routes for the records
+	recordsRoutes = []api.Route{
+		// GET the records stored
+		api.NewRoute("", "GET", getRecords),
+		// GET the indicators aggregated from the records, as STIX or MISP
+		api.NewRoute("export", "GET", exportRecords),
+	}
+)
+
+// Routers
+var (
+	// Records
+	RecordsRouter = api.NewRouter("records/", recordsRoutes, nil)
+)
+
+// Parse a time from the query, using the RFC3339 format
+func parseTime(value string) (t time.Time, err error) {
+	if value == "" {
+		return
+	}
+
+	return time.Parse(time.RFC3339, value)
+}
+
+// Returns the filter of the query. The limit is only applied when given
+func parseFilter(input QueryRecords) (filter store.Filter, err error) {
+	since, err := parseTime(input.Since)
+	if err != nil {
+		return
+	}
+
+	until, err := parseTime(input.Until)
+	if err != nil {
+		return
+	}
+
+	filter = store.Filter{
+		Kind:       events.Kind(input.Kind),
+		ProxyID:    input.ProxyID,
+		ServiceID:  input.ServiceID,
+		RemoteAddr: input.RemoteAddr,
+		Country:    strings.ToUpper(input.Country),
+		ASN:        input.ASN,
+		Since:      since,
+		Until:      until,
+		Limit:      input.Limit,
+	}
+	return
+}
+
+// GET the records stored
+// Contains filters to get the records by kind, proxy, service, remote address, country, ASN and time
+func getRecords(ctx *gin.Context) {
+	var input QueryRecords
+	if err := ctx.ShouldBindQuery(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := parseFilter(input)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if filter.Limit <= 0 {
+		filter.Limit = defaultLimit
+	}
+
+	records, err := store.Records.Query(filter)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, records)
+}
+
+// GET the indicators aggregated from the records matching the filters, as a STIX 2.1 bundle or a MISP event
+func exportRecords(ctx *gin.Context) {
+	var input QueryExport
+	if err := ctx.ShouldBindQuery(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	format, err := intel.ParseFormat(input.Format)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filter, err := parseFilter(input.QueryRecords)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	records, err := store.Records.Query(filter)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	data, err := intel.Export(intel.Aggregate(records), format)
+	if err != nil {
+		ctx.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	ctx.Data(http.StatusOK, format.ContentType(), data)
+}
@@ -1,7 +1,10 @@
 package api
 
 import (
+	"net/http"
+
 	"github.com/gin-gonic/gin"
+	"github.com/riotpot/internal/auth"
 )
 
 // Router interface
@@ -46,7 +49,14 @@ func (r *AbstractRouter) Routes() []Route {
 func (r *AbstractRouter) addHandlers(parentGroup *gin.RouterGroup) *gin.RouterGroup {
 	// Iterate the routes and add the handlers registered in the
 	for _, route := range r.Routes() {
-		parentGroup.Handle(route.Method(), route.Path(), route.Handlers()...)
+		// Check the role of the client before handling the request
+		authorize := Authorize(route.Role())
+		if route.AcceptsQueryToken() {
+			authorize = AuthorizeQuery(route.Role())
+		}
+
+		handlers := append(gin.HandlersChain{authorize}, route.Handlers()...)
+		parentGroup.Handle(route.Method(), route.Path(), handlers...)
 	}
 
 	return parentGroup
@@ -92,13 +102,20 @@ type Route interface {
 	Path() string
 	// Method used for the path
 	Method() string
+	// Role required to use the route
+	Role() auth.Role
+	// Whether the token can be given in the query of the route
+	AcceptsQueryToken() bool
 }
 
 type AbstractRoute struct {
 	Route
 	path     string
 	method   string
+	role     auth.Role
 	handlers gin.HandlersChain
+	// Whether the token is accepted in the query
+	queryToken bool
 }
 
 func (ar *AbstractRoute) Path() string {
@@ -109,14 +126,42 @@ func (ar *AbstractRoute) Method() string {
 	return ar.method
 }
 
+func (ar *AbstractRoute) Role() auth.Role {
+	return ar.role
+}
+
 func (ar *AbstractRoute) Handlers() gin.HandlersChain {
 	return ar.handlers
 }
 
+func (ar *AbstractRoute) AcceptsQueryToken() bool {
+	return ar.queryToken
+}
+
+// Set the role required to use the route
+func (ar *AbstractRoute) WithRole(role auth.Role) *AbstractRoute {
+	ar.role = role
+	return ar
+}
+
+// Accept the token in the `token` query parameter, for the clients that can not set headers.
+// The token may end up in the logs of the proxies in between, so it is kept to the routes that need it
+func (ar *AbstractRoute) WithQueryToken() *AbstractRoute {
+	ar.queryToken = true
+	return ar
+}
+
+// Create a new route. Reading (GET) requires the read role, and any other method the admin role
 func NewRoute(path string, method string, handlers ...gin.HandlerFunc) *AbstractRoute {
+	role := auth.AdminRole
+	if method == http.MethodGet || method == http.MethodHead {
+		role = auth.ReadRole
+	}
+
 	return &AbstractRoute{
 		path:     path,
 		method:   method,
+		role:     role,
 		handlers: handlers,
 	}
 }
@@ -1,6 +1,7 @@
 package service
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 
@@ -21,6 +22,10 @@ type GetService struct {
 	Network     string `json:"network"`
 	Locked      bool   `json:"locked"`
 	Interaction string `json:"interaction"`
+	// Result of the last health check
+	Health *services.HealthStatus `json:"health,omitempty"`
+	// Whether the plugin is running, empty for the external services
+	Status string `json:"status,omitempty"`
 }
 
 type CreateService struct {
@@ -37,6 +42,10 @@ type PatchService struct {
 	Host string `json:"host" binding:"required"`
 }
 
+type ChangeServiceStatus struct {
+	Status string `json:"status" binding:"required"`
+}
+
 type ServiceProxy struct {
 	ID      string      `json:"id" binding:"required" gorm:"primary_key"`
 	Port    int         `json:"port"`
@@ -61,6 +70,8 @@ var (
 		api.NewRoute("", "GET", getService),
 		api.NewRoute("", "PATCH", patchService),
 		api.NewRoute("", "DELETE", delService),
+		api.NewRoute("/status", "POST", changeServiceStatus),
+		api.NewRoute("/restart", "POST", restartService),
 
 		// Get information about all the proxies this service is handling
 		//api.NewRoute("proxies/", "GET", getServiceProxies),
@@ -84,6 +95,14 @@ func NewService(serv services.Service) (sv *GetService) {
 			Network:     serv.GetNetwork().String(),
 			Interaction: serv.GetInteraction().String(),
 		}
+
+		// The plugins are not checked, they are either running or stopped
+		if plugin, ok := serv.(services.PluginService); ok {
+			sv.Status = plugin.GetStatus().String()
+		} else {
+			health := services.HealthChecks.GetHealth(serv.GetID())
+			sv.Health = &health
+		}
 	}
 	return
 }
@@ -244,21 +263,83 @@ func patchService(ctx *gin.Context) {
 		return
 	}
 
+	// Plugins listen in the address of the service, they must restart to use the new one
+	moved := validPort != sv.GetPort() || input.Host != sv.GetHost()
+
 	// Set the values
 	sv.SetPort(validPort)
 	sv.SetName(validName)
 	sv.SetHost(input.Host)
 	//sv.SetLocked(input.Locked)
 
+	if plugin, ok := sv.(services.PluginService); ok && moved && plugin.GetStatus() == globals.RunningStatus {
+		if _, errs := services.Services.Restart(id); len(errs) > 0 {
+			ctx.JSON(http.StatusBadRequest, gin.H{"error": errs[0].Error()})
+			return
+		}
+	}
+
 	// Serialize the service and send it as a response
 	ret := NewService(sv)
 	ctx.JSON(http.StatusOK, ret)
 }
 
+// POST request to start or stop a plugin service
+func changeServiceStatus(ctx *gin.Context) {
+	var input ChangeServiceStatus
+	if err := ctx.ShouldBindJSON(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	status, err := globals.ParseStatus(input.Status)
+	if err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	id := ctx.Param("id")
+
+	var errs []error
+	switch status {
+	case globals.RunningStatus:
+		_, errs = services.Services.Start(id)
+	case globals.StoppedStatus:
+		_, errs = services.Services.Stop(id)
+	default:
+		errs = []error{fmt.Errorf("status not allowed")}
+	}
+
+	if len(errs) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": errs[0].Error()})
+		return
+	}
+
+	sv, _ := services.Services.GetService(id)
+	ctx.JSON(http.StatusOK, NewService(sv))
+}
+
+// POST request to restart a plugin service
+func restartService(ctx *gin.Context) {
+	id := ctx.Param("id")
+
+	servs, errs := services.Services.Restart(id)
+	if len(errs) > 0 {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": errs[0].Error()})
+		return
+	}
+
+	ctx.JSON(http.StatusOK, NewService(servs[0]))
+}
+
 func delService(ctx *gin.Context) {
 	id := ctx.Param("id")
 
 	err := services.Services.DeleteService(id)
+	if errors.Is(err, services.ErrServiceInUse) {
+		ctx.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
 	if err != nil {
 		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/events"
+)
+
+const (
+	// Name of the server-sent events with the changes of the proxies and services.
+	// The attack events are sent with the name of their kind (e.g., connection or credential)
+	ChangeEvent = "change"
+	// Number of events queued for a client. The events are dropped while the queue is full
+	queueSize = 256
+	// Interval between the comments sent to keep the connection open
+	keepAliveInterval = 15 * time.Second
+)
+
+// Structures used to serialize data:
+type QueryStream struct {
+	// Names of the events to receive, all of them when empty
+	Kinds []string `form:"kind"`
+}
+
+// Routes
+var (
+	// Routes of the live feed
+	streamRoutes = []api.Route{
+		// GET the server-sent events. The browsers can not set headers in the event sources
+		api.NewRoute("", "GET", getStream).WithQueryToken(),
+	}
+)
+
+// Routers
+var (
+	// Live feed
+	StreamRouter = api.NewRouter("stream/", streamRoutes, nil)
+)
+
+// Server-sent event queued for a client
+type message struct {
+	name string
+	data interface{}
+}
+
+// GET a stream of server-sent events with the changes of the proxies and services,
+// and the attack events observed, as they happen
+func getStream(ctx *gin.Context) {
+	var input QueryStream
+	if err := ctx.ShouldBindQuery(&input); err != nil {
+		ctx.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Returns whether the client wants the events with the name
+	wanted := func(name string) bool {
+		if len(input.Kinds) == 0 {
+			return true
+		}
+		for _, kind := range input.Kinds {
+			if kind == name {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Queue the events without blocking the publishers, slow clients miss events instead
+	queue := make(chan message, queueSize)
+	push := func(name string, data interface{}) {
+		if !wanted(name) {
+			return
+		}
+
+		select {
+		case queue <- message{name: name, data: data}:
+		default:
+		}
+	}
+
+	unsubscribeEvents := events.Events.Subscribe(events.EmitterFunc(func(event *events.Event) {
+		push(string(event.Kind), event)
+	}))
+	defer unsubscribeEvents()
+
+	unsubscribeChanges := events.Changes.Subscribe(events.NotifierFunc(func(change *events.Change) {
+		push(ChangeEvent, change)
+	}))
+	defer unsubscribeChanges()
+
+	ticker := time.NewTicker(keepAliveInterval)
+	defer ticker.Stop()
+
+	ctx.Header("Content-Type", "text/event-stream")
+	ctx.Header("Cache-Control", "no-cache")
+	ctx.Header("Connection", "keep-alive")
+	// Disable the buffering of reverse proxies
+	ctx.Header("X-Accel-Buffering", "no")
+
+	// Send the headers right away, so the client knows the stream is open
+	ctx.Status(http.StatusOK)
+	ctx.Writer.Flush()
+
+	ctx.Stream(func(w io.Writer) bool {
+		select {
+		case msg := <-queue:
+			ctx.SSEvent(msg.name, msg.data)
+		case <-ticker.C:
+			// Comments are ignored by the clients
+			if _, err := io.WriteString(w, ": keep-alive\n\n"); err != nil {
+				return false
+			}
+		case <-ctx.Request.Context().Done():
+			return false
+		}
+		return true
+	})
+}
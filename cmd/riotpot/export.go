@@ -0,0 +1,83 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/intel"
+	"github.com/riotpot/internal/logger"
+	"github.com/riotpot/internal/store"
+)
+
+// Export the indicators aggregated from the stored records as a STIX 2.1 bundle or a MISP event.
+// The embedded store can not be opened while RIoTPot is running, use the API instead.
+// Usage: riotpot export [flags]
+func Export(args []string) {
+	flags := flag.NewFlagSet("export", flag.ExitOnError)
+	format := flags.String("format", string(intel.STIXFormat), "Format of the export: stix or misp")
+	kind := flags.String("kind", "", "Only aggregate the records of this kind")
+	since := flags.String("since", "", "Only aggregate the records since this time (RFC3339)")
+	until := flags.String("until", "", "Only aggregate the records until this time (RFC3339)")
+	output := flags.String("output", "", "File where the export is written, the standard output when empty")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: riotpot export [flags]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	f, err := intel.ParseFormat(*format)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Invalid format")
+	}
+
+	filter := store.Filter{Kind: events.Kind(*kind)}
+	if *since != "" {
+		if filter.Since, err = time.Parse(time.RFC3339, *since); err != nil {
+			logger.Log.Fatal().Err(err).Msg("Invalid start time")
+		}
+	}
+	if *until != "" {
+		if filter.Until, err = time.Parse(time.RFC3339, *until); err != nil {
+			logger.Log.Fatal().Err(err).Msg("Invalid end time")
+		}
+	}
+
+	backend, err := store.ParseBackend(globals.DbBackend)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Unknown store backend")
+	}
+	if err := store.Records.Open(backend); err != nil {
+		logger.Log.Fatal().Err(err).Msg("Could not open the store, use the API while RIoTPot is running")
+	}
+	defer store.Records.Close()
+
+	records, err := store.Records.Query(filter)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Could not query the records")
+	}
+
+	data, err := intel.Export(intel.Aggregate(records), f)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Could not export the indicators")
+	}
+	data = append(data, '\n')
+
+	if *output == "" {
+		os.Stdout.Write(data)
+		return
+	}
+
+	if err := os.WriteFile(*output, data, 0644); err != nil {
+		logger.Log.Fatal().Err(err).Msg("Could not write the export")
+	}
+}
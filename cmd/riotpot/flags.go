@@ -5,8 +5,12 @@ This package determines the flags set in the environment
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
+	"net"
+	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
@@ -14,11 +18,29 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/rakyll/statik/fs"
 	"github.com/riotpot/api"
+	"github.com/riotpot/api/access"
+	apiauth "github.com/riotpot/api/auth"
+	apiconfig "github.com/riotpot/api/config"
+	"github.com/riotpot/api/limits"
+	"github.com/riotpot/api/metrics"
+	"github.com/riotpot/api/middleware"
+	apipcap "github.com/riotpot/api/pcap"
 	"github.com/riotpot/api/proxy"
+	"github.com/riotpot/api/record"
 	"github.com/riotpot/api/service"
+	"github.com/riotpot/api/stream"
+	"github.com/riotpot/internal/auth"
+	"github.com/riotpot/internal/certs"
+	"github.com/riotpot/internal/config"
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/geoip"
 	"github.com/riotpot/internal/globals"
 	"github.com/riotpot/internal/logger"
+	"github.com/riotpot/internal/pcap"
 	"github.com/riotpot/internal/plugins"
+	"github.com/riotpot/internal/services"
+	"github.com/riotpot/internal/sinks"
+	"github.com/riotpot/internal/store"
 	"github.com/riotpot/ui"
 	"github.com/rs/zerolog"
 
@@ -34,6 +56,22 @@ var (
 		proxy.ProxiesRouter,
 		// Services router
 		service.ServicesRouter,
+		// Records router
+		record.RecordsRouter,
+		// Global middlewares router
+		middleware.MiddlewaresRouter,
+		// Configuration router
+		apiconfig.ConfigRouter,
+		// Live feed router
+		stream.StreamRouter,
+		// Authentication router
+		apiauth.AuthRouter,
+		// Global limits router
+		limits.LimitsRouter,
+		// Global access list router
+		access.AccessRouter,
+		// Retention of the capture files router
+		apipcap.PcapRouter,
 	}
 )
 
@@ -44,20 +82,26 @@ var (
 	//						  embeded ui ->  |---------------||------------------------------------------| <- separated ui (debug)
 	allowedHosts = flag.String("whitelist", "http://localhost,http://localhost:3000,http://127.0.0.1:3000", "List of allowed hosts to contact the API")
 	loadUi       = flag.Bool("ui", true, "Whether to start the UI")
+	storeRecords = flag.Bool("store", true, "Whether to store the records of the attacks")
+	persistState = flag.Bool("state", true, "Whether to restore the proxies and services saved in the state file, and save them on change")
+	configPath   = flag.String("config", "", "Path to a YAML configuration file with the services, proxies and settings to load")
+	useTLS       = flag.Bool("tls", false, "Whether to serve the API and the UI over TLS")
+	geoipPaths   = flag.String("geoip", globals.GeoIPDatabases, "Comma-separated paths of the GeoIP databases (MaxMind DB format) to tag the clients with their country and ASN")
 )
 
 func setupApi(allowedHosts []string) *gin.Engine {
-	// Create a router
-	router := gin.Default()
+	// Create a router, logging the requests without the tokens given in the query
+	router := gin.New()
+	router.Use(gin.LoggerWithConfig(gin.LoggerConfig{Formatter: api.LogFormatter}), gin.Recovery())
 
 	// - PUT and PATCH methods
-	// - Origin header
+	// - Origin and authentication headers
 	// - Credentials share
 	// - Preflight requests cached for 12 hours
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     allowedHosts,
 		AllowMethods:     []string{"OPTIONS", "PUT", "PATCH", "GET", "DELETE"},
-		AllowHeaders:     []string{"Content-Type", "Content-Length", "Origin"},
+		AllowHeaders:     []string{"Content-Type", "Content-Length", "Origin", "Authorization", "X-API-Key"},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
@@ -78,20 +122,273 @@ func setupApi(allowedHosts []string) *gin.Engine {
 	// Serve the Swagger UI files in the root of the api
 	api.StaticFS("swagger", statikFS)
 
+	// Serve the metrics outside of the api, in the path scraped by Prometheus
+	metrics.MetricsRouter.AddToGroup(&router.RouterGroup)
+
 	return router
 }
 
+// Apply the settings of the configuration file.
+// The flags set in the command line take precedence over the file
+func applySettings(cfg *config.Config) {
+	values := map[string]string{}
+	if cfg.Plugins != nil {
+		values["plugins"] = strconv.FormatBool(*cfg.Plugins)
+	}
+	if cfg.Store != nil {
+		values["store"] = strconv.FormatBool(*cfg.Store)
+	}
+	if cfg.GeoIP != nil && len(cfg.GeoIP.Databases) > 0 {
+		values["geoip"] = strings.Join(cfg.GeoIP.Databases, ",")
+	}
+	if cfg.ShutdownTimeout != "" {
+		globals.ShutdownTimeout = cfg.ShutdownTimeout
+	}
+
+	if cfg.API != nil {
+		if cfg.API.Enabled != nil {
+			values["api"] = strconv.FormatBool(*cfg.API.Enabled)
+		}
+		if cfg.API.UI != nil {
+			values["ui"] = strconv.FormatBool(*cfg.API.UI)
+		}
+		if len(cfg.API.Whitelist) > 0 {
+			values["whitelist"] = strings.Join(cfg.API.Whitelist, ",")
+		}
+
+		if cfg.API.Host != "" {
+			globals.ApiHost = cfg.API.Host
+		}
+		if cfg.API.Port != 0 {
+			globals.ApiPort = strconv.Itoa(cfg.API.Port)
+		}
+		if cfg.API.MetricsToken != "" {
+			globals.MetricsToken = cfg.API.MetricsToken
+		}
+
+		if cfg.API.TLS != nil {
+			applyTLSSettings(cfg.API.TLS, values)
+		}
+
+		if cfg.API.Auth != nil {
+			for _, err := range config.ApplyAuth(cfg.API.Auth, auth.Auth) {
+				logger.Log.Fatal().Err(err).Msg("Invalid authentication settings in the configuration")
+			}
+		}
+	}
+
+	// Remove the flags set in the command line
+	flag.Visit(func(f *flag.Flag) {
+		delete(values, f.Name)
+	})
+
+	for name, value := range values {
+		if err := flag.Set(name, value); err != nil {
+			logger.Log.Fatal().Err(err).Msgf("Invalid value for %s in the configuration", name)
+		}
+	}
+
+	if cfg.Logging != nil && cfg.Logging.Level != "" {
+		level, err := zerolog.ParseLevel(cfg.Logging.Level)
+		if err != nil {
+			logger.Log.Fatal().Err(err).Msg("Invalid logging level in the configuration")
+		}
+		zerolog.SetGlobalLevel(level)
+	}
+
+	if len(cfg.Sinks) > 0 {
+		for _, err := range config.ApplySinks(cfg.Sinks, sinks.Sinks) {
+			logger.Log.Fatal().Err(err).Msg("Invalid sink in the configuration")
+		}
+
+		// Ship the events and the logs, the sinks are closed with the events bus on shutdown
+		events.Events.Subscribe(sinks.Sinks)
+		logger.Log.AddWriter(sinks.Sinks)
+	}
+
+	if cfg.HPFeeds != nil {
+		publisher, err := config.NewPublisher(cfg.HPFeeds)
+		if err != nil {
+			logger.Log.Fatal().Err(err).Msg("Invalid hpfeeds settings in the configuration")
+		}
+
+		// The publisher is closed with the events bus on shutdown
+		events.Events.Subscribe(publisher)
+	}
+}
+
+// Apply the TLS settings of the configuration file
+func applyTLSSettings(cfg *config.TLS, values map[string]string) {
+	if cfg.Enabled != nil {
+		values["tls"] = strconv.FormatBool(*cfg.Enabled)
+	}
+	if cfg.Cert != "" {
+		globals.TLSCert = cfg.Cert
+	}
+	if cfg.Key != "" {
+		globals.TLSKey = cfg.Key
+	}
+	if cfg.ClientCA != "" {
+		globals.TLSClientCA = cfg.ClientCA
+	}
+
+	if cfg.ClientRole != "" {
+		if err := auth.Auth.SetCertificateRole(auth.Role(cfg.ClientRole)); err != nil {
+			logger.Log.Fatal().Err(err).Msg("Invalid role of the TLS clients in the configuration")
+		}
+	}
+}
+
+// Set up the authentication of the API from the environment
+func setupAuth() {
+	ttl, err := time.ParseDuration(globals.ApiSessionTTL)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Invalid time to live of the sessions")
+	}
+	auth.Auth.SetSessionTTL(ttl)
+
+	if globals.ApiKey != "" {
+		if err := auth.Auth.AddKey("environment", globals.ApiKey, auth.AdminRole); err != nil {
+			logger.Log.Fatal().Err(err).Msg("Invalid API key")
+		}
+	}
+}
+
+// Set up the retention of the capture files from the environment
+func setupPcap() {
+	maxFiles, err := strconv.Atoi(globals.PcapMaxFiles)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Invalid maximum number of capture files")
+	}
+
+	maxAge, err := time.ParseDuration(globals.PcapRetention)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Invalid retention time of the capture files")
+	}
+
+	if err := pcap.GlobalRetention.SetRetention(pcap.Retention{MaxFiles: maxFiles, MaxAge: maxAge}); err != nil {
+		logger.Log.Fatal().Err(err).Msg("Invalid retention of the capture files")
+	}
+}
+
+// Load the GeoIP databases of the flag, the environment or the configuration
+func setupGeoIP() {
+	paths := []string{}
+	for _, path := range strings.Split(*geoipPaths, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			paths = append(paths, path)
+		}
+	}
+	if len(paths) == 0 {
+		return
+	}
+
+	if err := geoip.GeoIP.Load(paths...); err != nil {
+		logger.Log.Fatal().Err(err).Msg("Could not load the GeoIP databases")
+	}
+
+	// Tag the events with the location of the client, once attributed to the client behind the proxy
+	events.Events.Enrich(geoip.GeoIP.Enrich)
+}
+
 func ParseFlags() {
+	flag.Parse()
+
+	// Set up the authentication before the configuration, which may add more keys and users
+	setupAuth()
+	// The configuration may replace the retention of the capture files
+	setupPcap()
+
+	// Load the configuration file before anything else is set up
+	var cfg *config.Config
+	if *configPath != "" {
+		var err error
+		cfg, err = config.Load(*configPath)
+		if err != nil {
+			logger.Log.Fatal().Err(err).Msg("Could not load the configuration file")
+		}
+
+		applySettings(cfg)
+	}
+
+	// The databases may be set in the configuration
+	setupGeoIP()
+
 	// Set the logging level to debug
 	if *debug {
 		zerolog.SetGlobalLevel(zerolog.DebugLevel)
 	}
 
+	shutdownTimeout, err := time.ParseDuration(globals.ShutdownTimeout)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Invalid timeout to drain the sessions on shutdown")
+	}
+	d := &daemon{}
+
+	// Open the store before anything can generate records
+	if *storeRecords {
+		backend, err := store.ParseBackend(globals.DbBackend)
+		if err != nil {
+			logger.Log.Fatal().Err(err).Msg("Unknown store backend")
+		}
+
+		if err := store.Records.Open(backend); err != nil {
+			logger.Log.Error().Err(err).Msg("Could not open the store, records will not be saved")
+		}
+
+		// Save every event published
+		events.Events.Subscribe(store.Records)
+	}
+
 	// Load the plugins
 	if *loadPlugins {
 		plugins.LoadPlugins()
 	}
 
+	// Register the services and proxies of the configuration, once the plugins are available
+	if cfg != nil {
+		for _, err := range config.Apply(cfg) {
+			logger.Log.Error().Err(err).Msg("Could not apply the configuration")
+		}
+	}
+
+	// Restore the state of the last run, which takes precedence over the configuration
+	if *persistState {
+		interval, err := time.ParseDuration(globals.StateInterval)
+		if err != nil {
+			logger.Log.Fatal().Err(err).Msg("Invalid interval to save the state")
+		}
+
+		state := config.NewState(globals.StatePath)
+		for _, err := range state.Restore() {
+			logger.Log.Error().Err(err).Msg("Could not restore the state")
+		}
+
+		d.stopState, d.stateDone = make(chan struct{}), make(chan struct{})
+		go func() {
+			defer close(d.stateDone)
+			state.Watch(interval, d.stopState)
+		}()
+	}
+
+	// Check the health of the external services periodically
+	healthInterval, err := time.ParseDuration(globals.HealthInterval)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Invalid interval of the health checks")
+	}
+
+	healthTimeout, err := time.ParseDuration(globals.HealthTimeout)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Invalid timeout of the health checks")
+	}
+
+	services.HealthChecks.SetTimeout(healthTimeout)
+	d.stopHealth = make(chan struct{})
+	go services.HealthChecks.Run(healthInterval, d.stopHealth)
+
+	// Errors of the API, which stop the daemon
+	failed := make(chan error, 1)
+
 	// Starts the API
 	if *runApi {
 		// Serve the API
@@ -103,7 +400,41 @@ func ParseFlags() {
 			ui.AddRoutes(router)
 		}
 
-		apiAddress := fmt.Sprintf("%s:%s", globals.ApiHost, globals.ApiPort)
-		router.Run(apiAddress)
+		// The requests are cancelled on shutdown, so the live feeds do not hold it
+		requests, cancel := context.WithCancel(context.Background())
+		server := &http.Server{
+			Addr:        fmt.Sprintf("%s:%s", globals.ApiHost, globals.ApiPort),
+			Handler:     router,
+			BaseContext: func(net.Listener) context.Context { return requests },
+		}
+		d.server, d.cancelRequests = server, cancel
+
+		serve := server.ListenAndServe
+		if *useTLS {
+			tlsConfig, err := certs.NewTLSConfig(certs.Options{
+				Cert:     globals.TLSCert,
+				Key:      globals.TLSKey,
+				ClientCA: globals.TLSClientCA,
+				Dir:      globals.TLSDir,
+				Hosts:    []string{globals.ApiHost, "localhost", "127.0.0.1", "::1"},
+			})
+			if err != nil {
+				logger.Log.Fatal().Err(err).Msg("Could not set up the TLS of the API")
+			}
+			server.TLSConfig = tlsConfig
+
+			serve = func() error { return server.ListenAndServeTLS("", "") }
+		}
+
+		logger.Log.Info().Str("address", server.Addr).Bool("tls", *useTLS).Bool("mtls", *useTLS && globals.TLSClientCA != "").Msg("Serving the API")
+		go func() {
+			if err := serve(); err != nil && err != http.ErrServerClosed {
+				failed <- err
+			}
+		}()
 	}
+
+	// Run until the process is asked to stop
+	d.wait(failed)
+	d.shutdown(shutdownTimeout)
 }
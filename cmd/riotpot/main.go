@@ -3,12 +3,30 @@ package main
 
 import (
 	"fmt"
+	"os"
 )
 
 // `main` starts all the submodules containing the emulator services.
 // It is the first function called when the application is run.
 // It also acts as an orchestrator, which dictates the functioning of the application.
 func main() {
+	// Run the subcommands instead of the honeypot.
+	// They only print their own output, so it can be piped (e.g., the exports)
+	if len(os.Args) > 1 && os.Args[1] == "replay" {
+		Replay(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "passwd" {
+		Passwd(os.Args[2:])
+		return
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == "export" {
+		Export(os.Args[2:])
+		return
+	}
+
 	// Say Hi, don't be rude!
 	fmt.Println("░▒▓███ RIoIPot ███▓▒░")
 
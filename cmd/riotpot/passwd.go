@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/riotpot/internal/auth"
+	"github.com/riotpot/internal/logger"
+)
+
+// Print the hash of a password, to add a user in the configuration file.
+// The password is read from the standard input when it is not given.
+// Usage: riotpot passwd [password]
+func Passwd(args []string) {
+	flags := flag.NewFlagSet("passwd", flag.ExitOnError)
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: riotpot passwd [password]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() > 1 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	password := flags.Arg(0)
+	if password == "" {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			logger.Log.Fatal().Err(err).Msg("Could not read the password")
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+
+	hash, err := auth.HashPassword(password)
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Could not hash the password")
+	}
+
+	fmt.Println(hash)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/riotpot/internal/capture"
+	"github.com/riotpot/internal/logger"
+)
+
+// Replay the client stream of a transcript against a service.
+// Usage: riotpot replay [flags] <transcript> <address>
+func Replay(args []string) {
+	flags := flag.NewFlagSet("replay", flag.ExitOnError)
+	network := flags.String("network", "", "Network used to reach the service, defaults to the one of the transcript")
+	speed := flags.Float64("speed", 1, "Speed factor applied to the original timing, 0 sends the messages without delay")
+	timeout := flags.Duration("timeout", capture.DefaultReplayTimeout, "Time to wait for the responses after the last message")
+	quiet := flags.Bool("quiet", false, "Do not print the responses of the service")
+
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: riotpot replay [flags] <transcript> <address>\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	if flags.NArg() != 2 {
+		flags.Usage()
+		os.Exit(2)
+	}
+
+	transcript, err := capture.Load(flags.Arg(0))
+	if err != nil {
+		logger.Log.Fatal().Err(err).Msg("Could not load the transcript")
+	}
+
+	opts := capture.ReplayOptions{
+		Network: *network,
+		Address: flags.Arg(1),
+		Speed:   *speed,
+		Timeout: *timeout,
+	}
+	if !*quiet {
+		opts.Output = os.Stdout
+	}
+
+	if err := capture.Replay(transcript, opts); err != nil {
+		logger.Log.Fatal().Err(err).Msg("Could not replay the transcript")
+	}
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/logger"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+)
+
+// Parts of the daemon running in the background, stopped in order on shutdown
+type daemon struct {
+	// Server of the API, nil when disabled
+	server *http.Server
+	// Cancels the requests still open in the API, e.g. the live feeds
+	cancelRequests context.CancelFunc
+
+	// Stops the watcher of the state, which saves it one last time, and is closed once it returns
+	stopState chan struct{}
+	stateDone chan struct{}
+	// Stops the health checks
+	stopHealth chan struct{}
+}
+
+// Block until the process is asked to stop (SIGINT or SIGTERM), or the API fails
+func (d *daemon) wait(failed <-chan error) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGINT, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	select {
+	case sig := <-signals:
+		logger.Log.Info().Str("signal", sig.String()).Msg("Shutting down")
+	case err := <-failed:
+		logger.Log.Error().Err(err).Msg("Could not serve the API, shutting down")
+	}
+}
+
+// Stop the daemon in order. The state is saved first, so the proxies that are running now start
+// on the next boot. Then the API stops taking changes, the proxies stop accepting connections
+// and drain their sessions, the plugins are stopped, and the sinks of the events flush what they
+// buffered. The API, the proxies and the plugins share the timeout, each stage gets the time left
+func (d *daemon) shutdown(timeout time.Duration) {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	// Time left until the deadline of the shutdown
+	remaining := func() time.Duration {
+		deadline, _ := ctx.Deadline()
+		return time.Until(deadline)
+	}
+
+	if d.stopState != nil {
+		close(d.stopState)
+		<-d.stateDone
+	}
+
+	if d.stopHealth != nil {
+		close(d.stopHealth)
+	}
+
+	if d.server != nil {
+		d.cancelRequests()
+
+		if err := d.server.Shutdown(ctx); err != nil {
+			logger.Log.Warn().Err(err).Msg("Could not stop the API gracefully")
+			d.server.Close()
+		}
+	}
+
+	for _, err := range proxy.Proxies.Shutdown(remaining()) {
+		logger.Log.Warn().Err(err).Msg("Could not stop the proxy gracefully")
+	}
+
+	for _, err := range services.Services.Shutdown(remaining()) {
+		logger.Log.Warn().Err(err).Msg("Could not stop the plugin gracefully")
+	}
+
+	for _, err := range events.Events.Close() {
+		logger.Log.Warn().Err(err).Msg("Could not flush the events")
+	}
+
+	logger.Log.Info().Msg("Stopped")
+}
@@ -0,0 +1,420 @@
+/*
+This package implements the authentication of the API clients, either with static API keys
+or with the sessions of the local users, and the roles that determine what they can do
+*/
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	// Authenticator of the API
+	Auth = NewAuthenticator(12 * time.Hour)
+)
+
+var (
+	// The token is missing, unknown or expired
+	ErrUnauthenticated = errors.New("authentication required")
+	// The username or the password are wrong
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	// The client failed to log in too many times and has to wait before trying again
+	ErrTooManyAttempts = errors.New("too many failed logins, try again later")
+)
+
+const (
+	// Failed logins of a client allowed before it has to wait between attempts
+	loginAttempts = 5
+	// Time waited after the allowed attempts, doubled with every failure
+	loginBackoff    = time.Second
+	maxLoginBackoff = 5 * time.Minute
+	// Time after the last failure in which the failures of a client are forgotten
+	loginFailuresTTL = 15 * time.Minute
+)
+
+var (
+	// Hash compared when the user does not exist, so the response takes as long as for a real user.
+	// It is generated on the first login
+	dummyHash     []byte
+	dummyHashOnce sync.Once
+)
+
+type Role string
+
+// Roles of the API clients
+const (
+	// Role of the routes anyone can use, e.g. the login
+	PublicRole Role = "public"
+	// Role allowed to read the proxies, services and records
+	ReadRole Role = "read"
+	// Role allowed to change anything
+	AdminRole Role = "admin"
+)
+
+// Level of each role, a role allows everything allowed to the lower levels
+var roleLevels = map[Role]int{
+	PublicRole: 0,
+	ReadRole:   1,
+	AdminRole:  2,
+}
+
+// Returns whether the role is allowed to use the routes that require the given role
+func (r Role) Allows(required Role) bool {
+	return roleLevels[r] >= roleLevels[required]
+}
+
+func ParseRole(role string) (r Role, err error) {
+	switch Role(role) {
+	case ReadRole, AdminRole:
+		r = Role(role)
+	default:
+		err = fmt.Errorf("invalid role: %s", role)
+	}
+	return
+}
+
+// Client authenticated in the API
+type Principal struct {
+	// Name of the API key or the user
+	Name string `json:"name"`
+	Role Role   `json:"role"`
+}
+
+// Session of a user logged in
+type Session struct {
+	Token     string     `json:"token"`
+	Principal *Principal `json:"principal"`
+	Expires   time.Time  `json:"expires"`
+}
+
+// Failed logins of a client
+type failures struct {
+	count int
+	last  time.Time
+	// Time until which the client can not log in
+	until time.Time
+}
+
+// Local user account
+type user struct {
+	hash []byte
+	role Role
+}
+
+// Authenticator of the API clients
+type Authenticator struct {
+	mu sync.RWMutex
+
+	// Principals of the API keys, by their key
+	keys map[string]*Principal
+	// Users by their username
+	users map[string]*user
+	// Sessions of the users logged in, by their token
+	sessions map[string]*Session
+	// Failed logins, by client
+	failures map[string]*failures
+	// Time after which the sessions expire
+	ttl time.Duration
+	// Role of the clients presenting a certificate verified with mutual TLS.
+	// When empty, the certificates do not authenticate the clients
+	certRole Role
+}
+
+// Returns whether the API requires authentication, i.e. there is any key or user
+func (a *Authenticator) Enabled() bool {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	return len(a.keys) > 0 || len(a.users) > 0
+}
+
+// Add a static API key
+func (a *Authenticator) AddKey(name string, key string, role Role) (err error) {
+	if key == "" {
+		err = fmt.Errorf("empty key: %s", name)
+		return
+	}
+
+	if _, err = ParseRole(string(role)); err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.keys[key]; ok {
+		err = fmt.Errorf("key already registered: %s", name)
+		return
+	}
+
+	a.keys[key] = &Principal{Name: name, Role: role}
+	return
+}
+
+// Add a local user with the bcrypt hash of its password
+func (a *Authenticator) AddUser(username string, hash string, role Role) (err error) {
+	if username == "" {
+		err = fmt.Errorf("empty username")
+		return
+	}
+
+	if _, err = bcrypt.Cost([]byte(hash)); err != nil {
+		err = fmt.Errorf("invalid password hash for %s: %w", username, err)
+		return
+	}
+
+	if _, err = ParseRole(string(role)); err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if _, ok := a.users[username]; ok {
+		err = fmt.Errorf("user already registered: %s", username)
+		return
+	}
+
+	a.users[username] = &user{hash: []byte(hash), role: role}
+	return
+}
+
+// Remove an API key
+func (a *Authenticator) RemoveKey(key string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.keys, key)
+}
+
+// Remove a user and close its sessions
+func (a *Authenticator) RemoveUser(username string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.users, username)
+	for token, session := range a.sessions {
+		if session.Principal.Name == username {
+			delete(a.sessions, token)
+		}
+	}
+}
+
+// Set the time after which the sessions expire
+func (a *Authenticator) SetSessionTTL(ttl time.Duration) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.ttl = ttl
+}
+
+// Returns the time the client has to wait before trying to log in again
+func (a *Authenticator) GetBackoff(client string) (wait time.Duration) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	if f, ok := a.failures[client]; ok {
+		if wait = time.Until(f.until); wait < 0 {
+			wait = 0
+		}
+	}
+	return
+}
+
+// Count a failed login of the client, delaying its next attempts once it used the allowed ones
+func (a *Authenticator) fail(client string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	now := time.Now()
+	for c, f := range a.failures {
+		if now.Sub(f.last) > loginFailuresTTL {
+			delete(a.failures, c)
+		}
+	}
+
+	f, ok := a.failures[client]
+	if !ok {
+		f = &failures{}
+		a.failures[client] = f
+	}
+	f.count++
+	f.last = now
+
+	if f.count >= loginAttempts {
+		backoff := maxLoginBackoff
+		if shift := f.count - loginAttempts; shift < 16 {
+			if d := loginBackoff << uint(shift); d < maxLoginBackoff {
+				backoff = d
+			}
+		}
+		f.until = now.Add(backoff)
+	}
+}
+
+// Log in a user from a client (e.g., its IP), returning a new session.
+// The clients failing too many times have to wait, longer with every failure
+func (a *Authenticator) Login(username string, password string, client string) (session *Session, err error) {
+	if a.GetBackoff(client) > 0 {
+		err = ErrTooManyAttempts
+		return
+	}
+
+	a.mu.RLock()
+	u, ok := a.users[username]
+	a.mu.RUnlock()
+
+	var hash []byte
+	if ok {
+		hash = u.hash
+	} else {
+		dummyHashOnce.Do(func() {
+			dummyHash, _ = bcrypt.GenerateFromPassword([]byte("riotpot"), bcrypt.DefaultCost)
+		})
+		hash = dummyHash
+	}
+
+	if err = bcrypt.CompareHashAndPassword(hash, []byte(password)); err != nil || !ok {
+		a.fail(client)
+		err = ErrInvalidCredentials
+		return
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.prune()
+	delete(a.failures, client)
+
+	session = &Session{
+		Token:     token,
+		Principal: &Principal{Name: username, Role: u.role},
+		Expires:   time.Now().Add(a.ttl),
+	}
+	a.sessions[token] = session
+	return
+}
+
+// Close the session of the token, if there is any
+func (a *Authenticator) Logout(token string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	delete(a.sessions, token)
+}
+
+// Returns the client of an API key or a session token
+func (a *Authenticator) Authenticate(token string) (principal *Principal, err error) {
+	if token == "" {
+		err = ErrUnauthenticated
+		return
+	}
+
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+
+	// Compare the keys in constant time, so they can not be guessed from the response time
+	for key, p := range a.keys {
+		if subtle.ConstantTimeCompare([]byte(key), []byte(token)) == 1 {
+			principal = p
+			return
+		}
+	}
+
+	session, ok := a.sessions[token]
+	if !ok || time.Now().After(session.Expires) {
+		err = ErrUnauthenticated
+		return
+	}
+
+	principal = session.Principal
+	return
+}
+
+// Set the role of the clients authenticated with a certificate verified with mutual TLS
+func (a *Authenticator) SetCertificateRole(role Role) (err error) {
+	if _, err = ParseRole(string(role)); err != nil {
+		return
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	a.certRole = role
+	return
+}
+
+// Returns the client of a connection in where the client presented a verified certificate.
+// The client is named after the common name of the certificate
+func (a *Authenticator) AuthenticateCertificate(state *tls.ConnectionState) (principal *Principal, err error) {
+	a.mu.RLock()
+	role := a.certRole
+	a.mu.RUnlock()
+
+	if role == "" || state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+		err = ErrUnauthenticated
+		return
+	}
+
+	principal = &Principal{
+		Name: state.VerifiedChains[0][0].Subject.CommonName,
+		Role: role,
+	}
+	return
+}
+
+// Remove the expired sessions. Must be called with the lock held
+func (a *Authenticator) prune() {
+	now := time.Now()
+	for token, session := range a.sessions {
+		if now.After(session.Expires) {
+			delete(a.sessions, token)
+		}
+	}
+}
+
+// Returns the bcrypt hash of a password, as expected in the users of the configuration
+func HashPassword(password string) (hash string, err error) {
+	b, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return
+	}
+
+	hash = string(b)
+	return
+}
+
+// Returns a new random token
+func newToken() (token string, err error) {
+	b := make([]byte, 32)
+	if _, err = rand.Read(b); err != nil {
+		return
+	}
+
+	token = hex.EncodeToString(b)
+	return
+}
+
+func NewAuthenticator(ttl time.Duration) *Authenticator {
+	return &Authenticator{
+		keys:     make(map[string]*Principal),
+		users:    make(map[string]*user),
+		sessions: make(map[string]*Session),
+		failures: make(map[string]*failures),
+		ttl:      ttl,
+	}
+}
@@ -0,0 +1,87 @@
+package capture
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// Time waited for the responses of the service after sending the last message
+	DefaultReplayTimeout = 2 * time.Second
+)
+
+// Options to replay a transcript
+type ReplayOptions struct {
+	// Network and address of the service. The network defaults to the one in the transcript
+	Network string
+	Address string
+	// Speed factor applied to the original timing. Zero or less sends the messages without delay
+	Speed float64
+	// Time waited for the responses after the last message
+	Timeout time.Duration
+	// Writer in where the responses of the service are written
+	Output io.Writer
+}
+
+// Replay the messages sent by the client in the transcript against a service
+func Replay(transcript *Transcript, opts ReplayOptions) (err error) {
+	network := opts.Network
+	if network == "" {
+		network = transcript.Header.Network
+	}
+	if network == "" {
+		network = "tcp"
+	}
+
+	timeout := opts.Timeout
+	if timeout <= 0 {
+		timeout = DefaultReplayTimeout
+	}
+
+	output := opts.Output
+	if output == nil {
+		output = io.Discard
+	}
+
+	conn, err := net.DialTimeout(network, opts.Address, timeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	// Read the responses while the messages are sent
+	received := make(chan error, 1)
+	go func() {
+		_, err := io.Copy(output, conn)
+		received <- err
+	}()
+
+	start := time.Now()
+	for _, frame := range transcript.Frames {
+		if frame.Direction != Input {
+			continue
+		}
+
+		// Keep the timing of the original session
+		if opts.Speed > 0 {
+			at := start.Add(time.Duration(float64(frame.Offset) / opts.Speed))
+			time.Sleep(time.Until(at))
+		}
+
+		if _, err = conn.Write(frame.Data); err != nil {
+			return
+		}
+	}
+
+	// Give the service some time to answer the last message
+	conn.SetReadDeadline(time.Now().Add(timeout))
+
+	err = <-received
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = nil
+	}
+	return
+}
@@ -0,0 +1,203 @@
+/*
+This package implements the capture of the streams relayed by the proxies into transcripts,
+and their replay against a service.
+
+A transcript is a file of JSON lines, similar to the asciinema format.
+The first line is a header with the information about the session, and each of the following
+lines is a frame: an array with the seconds elapsed since the start of the session, the direction
+of the message ("i" from the client, "o" to the client) and the message encoded in base64.
+
+	{"version":1,"session_id":"...","client":"10.0.0.1:4321","timestamp":"..."}
+	[0.000213,"i","SGkgdGhlcmUhCg=="]
+	[0.001021,"o","SGkgdGhlcmUhCg=="]
+*/
+package capture
+
+import (
+	"bufio"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+const (
+	// Version of the transcript format
+	Version = 1
+	// Extension of the transcript files
+	Extension = ".cast"
+)
+
+type Direction string
+
+const (
+	// Message sent by the client
+	Input Direction = "i"
+	// Message sent to the client
+	Output Direction = "o"
+)
+
+// Header of the transcript
+type Header struct {
+	Version   int       `json:"version"`
+	ProxyID   string    `json:"proxy_id,omitempty"`
+	SessionID string    `json:"session_id,omitempty"`
+	Network   string    `json:"network,omitempty"`
+	Client    string    `json:"client,omitempty"`
+	Service   string    `json:"service,omitempty"`
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// Message captured in a transcript
+type Frame struct {
+	// Time elapsed since the start of the session
+	Offset    time.Duration
+	Direction Direction
+	Data      []byte
+}
+
+func (f Frame) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{
+		f.Offset.Seconds(),
+		f.Direction,
+		base64.StdEncoding.EncodeToString(f.Data),
+	})
+}
+
+func (f *Frame) UnmarshalJSON(b []byte) (err error) {
+	var (
+		offset    float64
+		direction string
+		data      string
+	)
+
+	values := []interface{}{&offset, &direction, &data}
+	if err = json.Unmarshal(b, &values); err != nil {
+		return
+	}
+
+	f.Offset = time.Duration(offset * float64(time.Second))
+	f.Direction = Direction(direction)
+	f.Data, err = base64.StdEncoding.DecodeString(data)
+	return
+}
+
+// Transcript loaded from a file
+type Transcript struct {
+	Header Header
+	Frames []Frame
+}
+
+// Load a transcript from a file
+func Load(path string) (transcript *Transcript, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer f.Close()
+
+	transcript = &Transcript{}
+
+	scanner := bufio.NewScanner(f)
+	// Frames may be larger than the default buffer
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+
+	if !scanner.Scan() {
+		err = fmt.Errorf("empty transcript")
+		return
+	}
+
+	if err = json.Unmarshal(scanner.Bytes(), &transcript.Header); err != nil {
+		return
+	}
+
+	if transcript.Header.Version != Version {
+		err = fmt.Errorf("unsupported transcript version %d", transcript.Header.Version)
+		return
+	}
+
+	for scanner.Scan() {
+		var frame Frame
+		if err = json.Unmarshal(scanner.Bytes(), &frame); err != nil {
+			return
+		}
+		transcript.Frames = append(transcript.Frames, frame)
+	}
+
+	err = scanner.Err()
+	return
+}
+
+// Records the messages of a session into a transcript file
+type Recorder struct {
+	mu    sync.Mutex
+	file  *os.File
+	start time.Time
+	enc   *json.Encoder
+}
+
+// Write a message in the transcript
+func (r *Recorder) Write(direction Direction, data []byte) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.enc.Encode(Frame{
+		Offset:    time.Since(r.start),
+		Direction: direction,
+		Data:      data,
+	})
+}
+
+// Returns a function to record the messages of one direction
+func (r *Recorder) Observer(direction Direction) func(p []byte) {
+	return func(p []byte) {
+		r.Write(direction, p)
+	}
+}
+
+func (r *Recorder) GetPath() string {
+	return r.file.Name()
+}
+
+func (r *Recorder) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.file.Close()
+}
+
+// Create a new recorder that stores the transcript in the directory.
+// The name of the file includes the start time and the session
+func NewRecorder(dir string, header Header) (r *Recorder, err error) {
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return
+	}
+
+	header.Version = Version
+	if header.Timestamp.IsZero() {
+		header.Timestamp = time.Now()
+	}
+
+	name := fmt.Sprintf("%s_%s%s", header.Timestamp.UTC().Format("20060102T150405.000000000"), header.SessionID, Extension)
+	file, err := os.OpenFile(filepath.Join(dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0640)
+	if err != nil {
+		return
+	}
+
+	r = &Recorder{
+		file:  file,
+		start: header.Timestamp,
+		enc:   json.NewEncoder(file),
+	}
+
+	// The header goes in the first line
+	if err = r.enc.Encode(header); err != nil {
+		file.Close()
+		r = nil
+	}
+
+	return
+}
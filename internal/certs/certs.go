@@ -0,0 +1,115 @@
+/*
+This package sets up the TLS of the API, either with the certificate given or with a
+self-signed certificate, and optionally requires the clients to present a certificate
+*/
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/riotpot/internal/plugins"
+)
+
+const (
+	// Names of the self-signed certificate and key files
+	SelfSignedCert = "riotpot.crt"
+	SelfSignedKey  = "riotpot.key"
+	// Time the self-signed certificates are valid
+	selfSignedValidity = 365 * 24 * time.Hour
+)
+
+// Options of the TLS of the API
+type Options struct {
+	// Certificate and key files. A self-signed certificate is used when empty
+	Cert string
+	Key  string
+	// Certificates of the authorities of the clients, the clients must present
+	// a certificate signed by one of them when set
+	ClientCA string
+	// Directory in where the self-signed certificate is kept
+	Dir string
+	// Names and IPs in the self-signed certificate
+	Hosts []string
+}
+
+// Returns the self-signed certificate and key files kept in the directory,
+// generating them if they do not exist or expired
+func SelfSigned(dir string, hosts []string) (cert string, key string, err error) {
+	cert = filepath.Join(dir, SelfSignedCert)
+	key = filepath.Join(dir, SelfSignedKey)
+
+	if pair, err := tls.LoadX509KeyPair(cert, key); err == nil {
+		if leaf, err := x509.ParseCertificate(pair.Certificate[0]); err == nil && time.Now().Before(leaf.NotAfter) {
+			return cert, key, nil
+		}
+	}
+
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	// Reuse the key generation of the plugins
+	privateKey := plugins.NewPrivateKey(plugins.LiteKey)
+	certPEM, err := plugins.NewSelfSignedCertificate(privateKey, hosts, selfSignedValidity)
+	if err != nil {
+		return
+	}
+
+	if err = os.WriteFile(key, privateKey.GetPEM(), 0600); err != nil {
+		return
+	}
+
+	err = os.WriteFile(cert, certPEM, 0644)
+	return
+}
+
+// Returns the TLS configuration of the API
+func NewTLSConfig(opts Options) (config *tls.Config, err error) {
+	cert, key := opts.Cert, opts.Key
+	if cert == "" || key == "" {
+		if cert != "" || key != "" {
+			err = fmt.Errorf("both the certificate and the key are required")
+			return
+		}
+
+		cert, key, err = SelfSigned(opts.Dir, opts.Hosts)
+		if err != nil {
+			return
+		}
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return
+	}
+
+	config = &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	// Require the certificate of the clients (i.e., mutual TLS)
+	if opts.ClientCA != "" {
+		var data []byte
+		data, err = os.ReadFile(opts.ClientCA)
+		if err != nil {
+			return
+		}
+
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(data) {
+			err = fmt.Errorf("no certificates found in %s", opts.ClientCA)
+			return
+		}
+
+		config.ClientCAs = pool
+		config.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+
+	return
+}
@@ -0,0 +1,590 @@
+package config
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/pcap"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/riotpot/internal/validators"
+)
+
+// Returns a registered service by its name
+func getService(name string) (service services.Service, err error) {
+	for _, s := range services.Services.GetServices() {
+		if s.GetName() == name {
+			service = s
+			return
+		}
+	}
+
+	err = fmt.Errorf("service %s not found", name)
+	return
+}
+
+// Apply the services, proxies and middlewares of the configuration to the managers.
+// Services and proxies already registered are updated instead of created again.
+// Returns the errors found, the rest of the configuration is still applied
+func Apply(cfg *Config) (errs []error) {
+	for _, s := range cfg.Services {
+		if err := applyService(s); err != nil {
+			errs = append(errs, fmt.Errorf("service %s: %w", s.Name, err))
+		}
+	}
+
+	errs = append(errs, applyMiddlewares(proxy.Middlewares, cfg.Middlewares)...)
+
+	if cfg.Limits != nil {
+		if err := applyLimits(proxy.GlobalLimiter, *cfg.Limits); err != nil {
+			errs = append(errs, fmt.Errorf("limits: %w", err))
+		}
+	}
+
+	if cfg.Access != nil {
+		rules, err := parseAccess(*cfg.Access)
+		if err == nil {
+			err = proxy.GlobalAccess.SetAccess(rules)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("access: %w", err))
+		}
+	}
+
+	if cfg.Pcap != nil {
+		if err := applyPcap(pcap.GlobalRetention, *cfg.Pcap); err != nil {
+			errs = append(errs, fmt.Errorf("pcap: %w", err))
+		}
+	}
+
+	for _, p := range cfg.Proxies {
+		for _, err := range applyProxy(p) {
+			errs = append(errs, fmt.Errorf("proxy %s/%d: %w", p.Network, p.Port, err))
+		}
+	}
+
+	return
+}
+
+// Create the service, or update the host and port of the service with the same name
+func applyService(s Service) (err error) {
+	if service, e := getService(s.Name); e == nil {
+		return updateService(service, s)
+	}
+
+	network, err := globals.ParseNetwork(s.Network)
+	if err != nil {
+		return
+	}
+
+	interaction := globals.High
+	if s.Interaction != "" {
+		if interaction, err = globals.ParseInteraction(s.Interaction); err != nil {
+			return
+		}
+	}
+
+	if err = validators.ValidatePortNumber(s.Port); err != nil {
+		return
+	}
+
+	// Keep the ID of the service, if any, before registering it
+	service := services.NewService(s.Name, s.Port, network, s.Host, interaction)
+	if s.ID != "" {
+		if err = service.SetID(s.ID); err != nil {
+			return
+		}
+	}
+
+	_, err = services.Services.RegisterService(service)
+	return
+}
+
+// Change the host and port of a registered service. The plugins listen on their own port, so they are left as they are
+func updateService(service services.Service, s Service) (err error) {
+	if _, ok := service.(services.PluginService); ok {
+		return
+	}
+
+	if s.Port != service.GetPort() {
+		if _, err = service.SetPort(s.Port); err != nil {
+			return
+		}
+	}
+	if s.Host != "" && s.Host != service.GetHost() {
+		service.SetHost(s.Host)
+	}
+	return
+}
+
+// Change the priority and state of the middlewares registered in a chain
+func applyMiddlewares(chain proxy.MiddlewareManager, middlewares []Middleware) (errs []error) {
+	for _, m := range middlewares {
+		if m.Priority != nil {
+			if err := chain.SetPriority(m.Name, *m.Priority); err != nil {
+				errs = append(errs, fmt.Errorf("middleware %s: %w", m.Name, err))
+				continue
+			}
+		}
+
+		if m.Enabled != nil {
+			if err := chain.SetEnabled(m.Name, *m.Enabled); err != nil {
+				errs = append(errs, fmt.Errorf("middleware %s: %w", m.Name, err))
+			}
+		}
+	}
+
+	return
+}
+
+// Create or update the proxy, and start or stop it as set in the configuration
+func applyProxy(p Proxy) (errs []error) {
+	network, err := globals.ParseNetwork(p.Network)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	pe, err := proxy.Proxies.GetProxyFromParams(network, p.Port)
+	if err != nil {
+		if err = validators.ValidatePortNumber(p.Port); err != nil {
+			errs = append(errs, err)
+			return
+		}
+
+		if pe, err = newProxy(network, p.Port, p.ID); err != nil {
+			errs = append(errs, err)
+			return
+		}
+	}
+
+	if p.Service != "" {
+		service, err := getService(p.Service)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			pe.SetService(service)
+		}
+	}
+
+	pe.SetCapture(p.Capture)
+	if err := pe.SetPcap(p.Pcap); err != nil {
+		errs = append(errs, err)
+	}
+
+	for _, r := range p.Routes {
+		if err := applyRoute(pe, r); err != nil {
+			errs = append(errs, fmt.Errorf("route %s: %w", r.Name, err))
+		}
+	}
+
+	if p.Sniffer != nil {
+		errs = append(errs, applySniffer(pe, *p.Sniffer)...)
+	}
+
+	if len(p.Failover) > 0 {
+		if err := applyFailover(pe, p.Failover); err != nil {
+			errs = append(errs, fmt.Errorf("failover: %w", err))
+		}
+	}
+
+	if p.Down != nil {
+		if err := applyDown(pe, *p.Down); err != nil {
+			errs = append(errs, fmt.Errorf("down: %w", err))
+		}
+	}
+
+	if p.Limits != nil {
+		if err := applyLimits(pe, *p.Limits); err != nil {
+			errs = append(errs, fmt.Errorf("limits: %w", err))
+		}
+	}
+
+	if p.Access != nil {
+		rules, err := parseAccess(*p.Access)
+		if err == nil {
+			err = pe.SetAccess(rules)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("access: %w", err))
+		}
+	}
+
+	// The router and the sniffer are registered on demand, so their settings can be applied
+	for _, m := range p.Middlewares {
+		switch m.Name {
+		case proxy.RouterName:
+			proxy.GetRouter(pe)
+		case proxy.SnifferName:
+			proxy.GetSniffer(pe)
+		}
+	}
+	errs = append(errs, applyMiddlewares(pe.GetMiddlewares(), p.Middlewares)...)
+
+	running := pe.GetStatus() == globals.RunningStatus
+	switch {
+	case p.Running && !running:
+		if err := pe.Start(); err != nil {
+			errs = append(errs, err)
+		}
+	case !p.Running && running:
+		if err := pe.Stop(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return
+}
+
+// Create a proxy and register it, keeping its ID if any
+func newProxy(network globals.Network, port int, id string) (pe proxy.Proxy, err error) {
+	pe, err = proxy.NewProxyEndpoint(port, network)
+	if err != nil {
+		return
+	}
+
+	if r, ok := pe.(interface{ SetID(id string) error }); ok && id != "" {
+		if err = r.SetID(id); err != nil {
+			return
+		}
+	}
+
+	return proxy.Proxies.AddProxy(pe)
+}
+
+// Add a routing rule to the proxy, unless there is a rule with the same name
+func applyRoute(pe proxy.Proxy, r Route) (err error) {
+	router, err := proxy.GetRouter(pe)
+	if err != nil {
+		return
+	}
+
+	for _, rule := range router.GetRules() {
+		if rule.Name == r.Name {
+			return
+		}
+	}
+
+	service, err := getService(r.Service)
+	if err != nil {
+		return
+	}
+
+	sources, err := proxy.ParseNetworks(r.Sources)
+	if err != nil {
+		return
+	}
+
+	rule := proxy.RoutingRule{
+		Name:      r.Name,
+		Sources:   sources,
+		Prefix:    []byte(r.Prefix),
+		MinVisits: r.MinVisits,
+		Service:   service,
+	}
+
+	if r.Window != "" {
+		window, e := proxy.ParseTimeWindow(r.Window)
+		if e != nil {
+			err = e
+			return
+		}
+		rule.Window = &window
+	}
+
+	return router.AddRule(rule)
+}
+
+// Set the timeout and the services of the sniffer of the proxy
+func applySniffer(pe proxy.Proxy, s Sniffer) (errs []error) {
+	sniffer, err := proxy.GetSniffer(pe)
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	if s.Timeout != "" {
+		timeout, err := time.ParseDuration(s.Timeout)
+		if err == nil {
+			err = sniffer.SetTimeout(timeout)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sniffer: %w", err))
+		}
+	}
+
+	for protocol, name := range s.Services {
+		service, err := getService(name)
+		if err == nil {
+			err = sniffer.SetService(protocol, service)
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sniffer %s: %w", protocol, err))
+		}
+	}
+
+	return
+}
+
+// Set the chain of services dialed when the service of the proxy can not be reached
+func applyFailover(pe proxy.Proxy, names []string) (err error) {
+	chain := []services.Service{}
+	for _, name := range names {
+		service, err := getService(name)
+		if err != nil {
+			return err
+		}
+		chain = append(chain, service)
+	}
+
+	return pe.SetFailover(chain)
+}
+
+// Set the behaviour of the proxy when its service is down
+func applyDown(pe proxy.Proxy, d Down) (err error) {
+	action, err := proxy.ParseDownAction(d.Action)
+	if err != nil {
+		return
+	}
+
+	policy := proxy.DownPolicy{
+		Action: action,
+		Banner: d.Banner,
+	}
+
+	if action == proxy.FallbackAction {
+		service, err := getService(d.Fallback)
+		if err != nil {
+			return err
+		}
+		policy.Fallback = service.GetID()
+	}
+
+	return pe.SetDownPolicy(policy)
+}
+
+// Set the limits of the proxy, or the global limits
+func applyLimits(limited interface{ SetLimits(proxy.Limits) error }, l Limits) (err error) {
+	limits := proxy.Limits{
+		MaxSessions:  l.MaxSessions,
+		MaxPerSource: l.MaxPerSource,
+		MaxBytes:     l.MaxBytes,
+	}
+
+	if limits.Window, err = parseOptionalDuration(l.Window); err != nil {
+		return
+	}
+	if limits.MaxDuration, err = parseOptionalDuration(l.MaxDuration); err != nil {
+		return
+	}
+
+	return limited.SetLimits(limits)
+}
+
+// Returns the limits as a configuration, nil when every limit is disabled
+func exportLimits(limits proxy.Limits) *Limits {
+	if limits == (proxy.Limits{}) {
+		return nil
+	}
+
+	l := &Limits{
+		MaxSessions:  limits.MaxSessions,
+		MaxPerSource: limits.MaxPerSource,
+		MaxBytes:     limits.MaxBytes,
+	}
+	if limits.Window > 0 {
+		l.Window = limits.Window.String()
+	}
+	if limits.MaxDuration > 0 {
+		l.MaxDuration = limits.MaxDuration.String()
+	}
+	return l
+}
+
+// Set the retention of the capture files
+func applyPcap(policy *pcap.RetentionPolicy, p Pcap) (err error) {
+	retention := pcap.Retention{MaxFiles: p.MaxFiles}
+	if retention.MaxAge, err = parseOptionalDuration(p.Retention); err != nil {
+		return
+	}
+
+	return policy.SetRetention(retention)
+}
+
+// Returns the retention as a configuration, nil when every file is kept
+func exportPcap(retention pcap.Retention) *Pcap {
+	if retention == (pcap.Retention{}) {
+		return nil
+	}
+
+	p := &Pcap{MaxFiles: retention.MaxFiles}
+	if retention.MaxAge > 0 {
+		p.Retention = retention.MaxAge.String()
+	}
+	return p
+}
+
+// Returns the rules of an access list
+func parseAccess(a Access) (rules proxy.AccessRules, err error) {
+	rules.Action = a.Action
+
+	if rules.Allow, err = proxy.ParseNetworks(a.Allow); err != nil {
+		return
+	}
+	if rules.Deny, err = proxy.ParseNetworks(a.Deny); err != nil {
+		return
+	}
+	rules.TarpitDelay, err = parseOptionalDuration(a.TarpitDelay)
+	return
+}
+
+// Returns the access list as a configuration, nil when it does not allow or deny any source
+func exportAccess(rules proxy.AccessRules) *Access {
+	if len(rules.Allow) == 0 && len(rules.Deny) == 0 {
+		return nil
+	}
+
+	a := &Access{Action: rules.Action}
+	for _, network := range rules.Allow {
+		a.Allow = append(a.Allow, network.String())
+	}
+	for _, network := range rules.Deny {
+		a.Deny = append(a.Deny, network.String())
+	}
+	if rules.Action == proxy.TarpitAccess {
+		a.TarpitDelay = rules.TarpitDelay.String()
+	}
+	return a
+}
+
+// Returns the current state of the managers as a configuration.
+// The plugin services are not included, as they are loaded on their own
+func Export() (cfg *Config) {
+	cfg = &Config{
+		API: &API{
+			Host: globals.ApiHost,
+		},
+		Services:    []Service{},
+		Proxies:     []Proxy{},
+		Middlewares: exportMiddlewares(proxy.Middlewares),
+		Limits:      exportLimits(proxy.GlobalLimiter.GetLimits()),
+		Access:      exportAccess(proxy.GlobalAccess.GetAccess()),
+		Pcap:        exportPcap(pcap.GlobalRetention.GetRetention()),
+	}
+	cfg.API.Port, _ = strconv.Atoi(globals.ApiPort)
+
+	for _, s := range services.Services.GetServices() {
+		if _, ok := s.(services.PluginService); ok {
+			continue
+		}
+
+		cfg.Services = append(cfg.Services, Service{
+			ID:          s.GetID(),
+			Name:        s.GetName(),
+			Host:        s.GetHost(),
+			Port:        s.GetPort(),
+			Network:     s.GetNetwork().String(),
+			Interaction: s.GetInteraction().String(),
+		})
+	}
+
+	for _, pe := range proxy.Proxies.GetProxies() {
+		cfg.Proxies = append(cfg.Proxies, exportProxy(pe))
+	}
+
+	return
+}
+
+func exportMiddlewares(chain proxy.MiddlewareManager) (middlewares []Middleware) {
+	for _, item := range chain.GetMiddlewares() {
+		item := item
+		middlewares = append(middlewares, Middleware{
+			Name:     item.Middleware.GetName(),
+			Priority: &item.Priority,
+			Enabled:  &item.Enabled,
+		})
+	}
+	return
+}
+
+func exportProxy(pe proxy.Proxy) (p Proxy) {
+	p = Proxy{
+		ID:          pe.GetID(),
+		Port:        pe.GetPort(),
+		Network:     pe.GetNetwork().String(),
+		Running:     pe.GetStatus() == globals.RunningStatus,
+		Capture:     pe.IsCapturing(),
+		Pcap:        pe.IsPcapEnabled(),
+		Middlewares: exportMiddlewares(pe.GetMiddlewares()),
+		Limits:      exportLimits(pe.GetLimits()),
+		Access:      exportAccess(pe.GetAccess()),
+	}
+
+	if service := pe.GetService(); service != nil {
+		p.Service = service.GetName()
+	}
+
+	for _, service := range pe.GetFailover() {
+		p.Failover = append(p.Failover, service.GetName())
+	}
+
+	// The default behaviour is left out
+	if policy := pe.GetDownPolicy(); policy.Action != proxy.RejectAction {
+		p.Down = &Down{
+			Action: string(policy.Action),
+			Banner: policy.Banner,
+		}
+
+		if fallback, err := services.Services.GetService(policy.Fallback); err == nil {
+			p.Down.Fallback = fallback.GetName()
+		}
+	}
+
+	// Look for the router and the sniffer without registering them
+	chain := pe.GetMiddlewares()
+
+	if item, err := chain.GetMiddleware(proxy.RouterName); err == nil {
+		if router, ok := item.Middleware.(*proxy.Router); ok {
+			for _, rule := range router.GetRules() {
+				p.Routes = append(p.Routes, exportRoute(rule))
+			}
+		}
+	}
+
+	if item, err := chain.GetMiddleware(proxy.SnifferName); err == nil {
+		if sniffer, ok := item.Middleware.(*proxy.Sniffer); ok {
+			p.Sniffer = &Sniffer{
+				Timeout:  sniffer.GetTimeout().String(),
+				Services: make(map[string]string),
+			}
+
+			for _, protocol := range sniffer.GetProtocols() {
+				service, _ := sniffer.GetService(protocol)
+				p.Sniffer.Services[protocol] = service.GetName()
+			}
+		}
+	}
+
+	return
+}
+
+func exportRoute(rule proxy.RoutingRule) (r Route) {
+	r = Route{
+		Name:      rule.Name,
+		Prefix:    string(rule.Prefix),
+		MinVisits: rule.MinVisits,
+		Service:   rule.Service.GetName(),
+	}
+
+	for _, network := range rule.Sources {
+		r.Sources = append(r.Sources, network.String())
+	}
+
+	if rule.Window != nil {
+		r.Window = rule.Window.String()
+	}
+
+	return
+}
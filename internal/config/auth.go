@@ -0,0 +1,41 @@
+package config
+
+import (
+	"time"
+
+	"github.com/riotpot/internal/auth"
+)
+
+// Register the API keys and users of the configuration in the authenticator
+func ApplyAuth(cfg *Auth, authenticator *auth.Authenticator) (errs []error) {
+	if cfg.SessionTTL != "" {
+		ttl, err := time.ParseDuration(cfg.SessionTTL)
+		if err != nil {
+			errs = append(errs, err)
+		} else {
+			authenticator.SetSessionTTL(ttl)
+		}
+	}
+
+	for _, key := range cfg.Keys {
+		if err := authenticator.AddKey(key.Name, key.Key, parseRole(key.Role)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	for _, user := range cfg.Users {
+		if err := authenticator.AddUser(user.Username, user.Password, parseRole(user.Role)); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	return
+}
+
+// Returns the role, read by default. Invalid roles are reported when registered
+func parseRole(role string) auth.Role {
+	if role == "" {
+		return auth.ReadRole
+	}
+	return auth.Role(role)
+}
@@ -0,0 +1,299 @@
+// This package implements the configuration file used to deploy the honeypot declaratively.
+// The file declares the services, proxies and middlewares loaded at startup, and the settings
+// of the API and the logging
+package config
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Configuration of the honeypot.
+// The fields left empty keep the value set in the command line or the environment
+type Config struct {
+	API     *API     `yaml:"api,omitempty"`
+	Logging *Logging `yaml:"logging,omitempty"`
+	// Whether to load the low-interaction honeypot plugins
+	Plugins *bool `yaml:"plugins,omitempty"`
+	// Whether to store the records of the attacks
+	Store *bool `yaml:"store,omitempty"`
+	// Time to wait for the sessions to finish on shutdown, e.g. 30s
+	ShutdownTimeout string `yaml:"shutdown_timeout,omitempty"`
+
+	Services []Service `yaml:"services,omitempty"`
+	Proxies  []Proxy   `yaml:"proxies,omitempty"`
+	// Settings of the middlewares in the global chain
+	Middlewares []Middleware `yaml:"middlewares,omitempty"`
+	// Limits shared by all the proxies
+	Limits *Limits `yaml:"limits,omitempty"`
+	// Sources allowed and denied by all the proxies
+	Access *Access `yaml:"access,omitempty"`
+	// Capture files kept for each proxy
+	Pcap *Pcap `yaml:"pcap,omitempty"`
+	// Databases used to tag the clients with their country and ASN
+	GeoIP *GeoIP `yaml:"geoip,omitempty"`
+	// Destinations of the attack events and the logs
+	Sinks []Sink `yaml:"sinks,omitempty"`
+	// Broker publishing the attack events over hpfeeds
+	HPFeeds *HPFeeds `yaml:"hpfeeds,omitempty"`
+}
+
+type API struct {
+	// Whether to start the API
+	Enabled *bool  `yaml:"enabled,omitempty"`
+	Host    string `yaml:"host,omitempty"`
+	Port    int    `yaml:"port,omitempty"`
+	// List of allowed hosts to contact the API
+	Whitelist []string `yaml:"whitelist,omitempty"`
+	// Whether to serve the UI
+	UI *bool `yaml:"ui,omitempty"`
+	// Authentication of the clients, the API is open while there are no keys or users
+	Auth *Auth `yaml:"auth,omitempty"`
+	TLS  *TLS  `yaml:"tls,omitempty"`
+	// Token that allows Prometheus to scrape the metrics without the credentials of the API
+	MetricsToken string `yaml:"metrics_token,omitempty"`
+}
+
+// TLS of the API and the UI
+type TLS struct {
+	// Whether to serve the API over TLS
+	Enabled *bool `yaml:"enabled,omitempty"`
+	// Certificate and key files, a self-signed certificate is generated when empty
+	Cert string `yaml:"cert,omitempty"`
+	Key  string `yaml:"key,omitempty"`
+	// Certificates of the authorities of the clients, enables mutual TLS
+	ClientCA string `yaml:"client_ca,omitempty"`
+	// Role of the clients authenticated with their certificate (read or admin).
+	// When empty, the clients must authenticate with a token as well
+	ClientRole string `yaml:"client_role,omitempty"`
+}
+
+type Auth struct {
+	Keys  []APIKey `yaml:"keys,omitempty"`
+	Users []User   `yaml:"users,omitempty"`
+	// Time after which the sessions of the users expire (e.g., 12h)
+	SessionTTL string `yaml:"session_ttl,omitempty"`
+}
+
+// Static API key
+type APIKey struct {
+	Name string `yaml:"name"`
+	Key  string `yaml:"key"`
+	// Role of the key (read or admin), read by default
+	Role string `yaml:"role,omitempty"`
+}
+
+// Local user account
+type User struct {
+	Username string `yaml:"username"`
+	// Bcrypt hash of the password, as printed by `riotpot passwd`
+	Password string `yaml:"password"`
+	// Role of the user (read or admin), read by default
+	Role string `yaml:"role,omitempty"`
+}
+
+type Logging struct {
+	// Level of the logs (e.g., debug, info, warn or error)
+	Level string `yaml:"level,omitempty"`
+}
+
+// Destination of the attack events and the logs
+type Sink struct {
+	// Name of the sink, the type is used when empty
+	Name string `yaml:"name,omitempty"`
+	// Type of the sink: file, syslog or webhook
+	Type string `yaml:"type"`
+	// Kinds of entries shipped (connection, credential, command, message or log).
+	// Every attack event when empty
+	Kinds []string `yaml:"kinds,omitempty"`
+
+	// Path of the JSON-lines file
+	Path string `yaml:"path,omitempty"`
+	// Size in bytes after which the file is rotated
+	MaxSize int64 `yaml:"max_size,omitempty"`
+	// Time after which the rotated files are removed, e.g. 168h
+	MaxAge string `yaml:"max_age,omitempty"`
+	// Number of rotated files kept
+	MaxFiles int `yaml:"max_files,omitempty"`
+
+	// Network (udp or tcp) and address of the syslog server
+	Network string `yaml:"network,omitempty"`
+	Address string `yaml:"address,omitempty"`
+	// Syslog facility, local0 by default
+	Facility string `yaml:"facility,omitempty"`
+
+	// URL of the webhook and the headers of its requests
+	URL     string            `yaml:"url,omitempty"`
+	Headers map[string]string `yaml:"headers,omitempty"`
+	// Number of entries sent in each request
+	BatchSize int `yaml:"batch_size,omitempty"`
+	// Time to wait for a batch to fill before sending it, e.g. 5s
+	Interval string `yaml:"interval,omitempty"`
+	// Attempts to send a batch after the first one fails
+	Retries int `yaml:"retries,omitempty"`
+}
+
+// Connection to an hpfeeds broker
+type HPFeeds struct {
+	Host   string `yaml:"host"`
+	Port   int    `yaml:"port"`
+	Ident  string `yaml:"ident"`
+	Secret string `yaml:"secret"`
+	// Channels receiving the events, every event is published in `riotpot.events` when empty
+	Channels []HPFeedsChannel `yaml:"channels,omitempty"`
+	// Time to wait before reconnecting (e.g., 1s), doubled after each failure up to max_backoff
+	Backoff    string `yaml:"backoff,omitempty"`
+	MaxBackoff string `yaml:"max_backoff,omitempty"`
+}
+
+// Channel of the hpfeeds broker
+type HPFeedsChannel struct {
+	Name string `yaml:"name"`
+	// Kinds of events published (connection, credential, command or message), every event when empty
+	Kinds []string `yaml:"kinds,omitempty"`
+}
+
+// Service reachable in a host and port, e.g. a high-interaction honeypot.
+// The plugins are loaded on their own, but proxies can still refer to them by name
+type Service struct {
+	// ID kept to restore the service, a new one is generated when empty
+	ID          string `yaml:"id,omitempty"`
+	Name        string `yaml:"name"`
+	Host        string `yaml:"host"`
+	Port        int    `yaml:"port"`
+	Network     string `yaml:"network"`
+	Interaction string `yaml:"interaction,omitempty"`
+}
+
+type Proxy struct {
+	// ID kept to restore the proxy, a new one is generated when empty
+	ID      string `yaml:"id,omitempty"`
+	Port    int    `yaml:"port"`
+	Network string `yaml:"network"`
+	// Name of the service relayed by the proxy
+	Service string `yaml:"service,omitempty"`
+	// Whether the proxy runs, a running proxy is stopped when false
+	Running bool `yaml:"running"`
+	// Whether to capture the sessions into transcripts
+	Capture bool `yaml:"capture,omitempty"`
+	// Whether to write the traffic in pcapng files
+	Pcap bool `yaml:"pcap,omitempty"`
+
+	Routes  []Route  `yaml:"routes,omitempty"`
+	Sniffer *Sniffer `yaml:"sniffer,omitempty"`
+	// Names of the services dialed, in order, when the service can not be reached
+	Failover []string `yaml:"failover,omitempty"`
+	// Behaviour when the service is down
+	Down *Down `yaml:"down,omitempty"`
+	// Limits of the connections of the proxy, applied along the global limits
+	Limits *Limits `yaml:"limits,omitempty"`
+	// Sources allowed and denied by the proxy, checked after the global access list
+	Access *Access `yaml:"access,omitempty"`
+	// Settings of the middlewares in the chain of the proxy
+	Middlewares []Middleware `yaml:"middlewares,omitempty"`
+}
+
+// Behaviour of a proxy when its service is down
+type Down struct {
+	// Action taken: reject (default), fallback or banner
+	Action string `yaml:"action"`
+	// Name of the service used by the fallback action
+	Fallback string `yaml:"fallback,omitempty"`
+	// Banner sent by the banner action
+	Banner string `yaml:"banner,omitempty"`
+}
+
+// Limits of the connections relayed, the fields left empty disable their limit
+type Limits struct {
+	// Maximum number of sessions open at the same time
+	MaxSessions int `yaml:"max_sessions,omitempty"`
+	// Maximum number of connections of a source IP within the window (e.g., 1m)
+	MaxPerSource int    `yaml:"max_per_source,omitempty"`
+	Window       string `yaml:"window,omitempty"`
+	// Maximum duration of a session (e.g., 10m) and bytes relayed in both directions
+	MaxDuration string `yaml:"max_duration,omitempty"`
+	MaxBytes    int64  `yaml:"max_bytes,omitempty"`
+}
+
+// Access list of the sources, as networks in CIDR notation or single IPs.
+// The allowed networks take precedence over the denied ones
+type Access struct {
+	Allow []string `yaml:"allow,omitempty"`
+	Deny  []string `yaml:"deny,omitempty"`
+	// Action applied to the denied sources: drop (default) or tarpit
+	Action string `yaml:"action,omitempty"`
+	// Time the tarpitted connections are kept open, e.g. 1m
+	TarpitDelay string `yaml:"tarpit_delay,omitempty"`
+}
+
+// Retention of the capture files of the proxies
+type Pcap struct {
+	// Maximum number of files kept for each proxy, the oldest are removed first
+	MaxFiles int `yaml:"max_files,omitempty"`
+	// Time after which the files are removed, e.g. 168h
+	Retention string `yaml:"retention,omitempty"`
+}
+
+// Databases in the MaxMind DB format, e.g. GeoLite2-Country and GeoLite2-ASN.
+// The fields found in the first databases are kept
+type GeoIP struct {
+	Databases []string `yaml:"databases"`
+}
+
+// Settings of a middleware registered in a chain
+type Middleware struct {
+	Name     string `yaml:"name"`
+	Priority *int   `yaml:"priority,omitempty"`
+	Enabled  *bool  `yaml:"enabled,omitempty"`
+}
+
+// Routing rule of a proxy
+type Route struct {
+	Name      string   `yaml:"name"`
+	Sources   []string `yaml:"sources,omitempty"`
+	Prefix    string   `yaml:"prefix,omitempty"`
+	Window    string   `yaml:"window,omitempty"`
+	MinVisits int      `yaml:"min_visits,omitempty"`
+	// Name of the service
+	Service string `yaml:"service"`
+}
+
+// Protocol sniffing of a proxy
+type Sniffer struct {
+	Timeout string `yaml:"timeout,omitempty"`
+	// Name of the service of each protocol
+	Services map[string]string `yaml:"services,omitempty"`
+}
+
+// Parse a configuration in YAML format. Unknown fields are considered errors
+func Parse(data []byte) (cfg *Config, err error) {
+	cfg = &Config{}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+
+	// An empty file is a valid configuration
+	if err = decoder.Decode(cfg); errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return
+}
+
+// Load the configuration from a file
+func Load(path string) (cfg *Config, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	return Parse(data)
+}
+
+// Returns the configuration in YAML format
+func (c *Config) Marshal() ([]byte, error) {
+	return yaml.Marshal(c)
+}
@@ -0,0 +1,35 @@
+package config
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/hpfeeds"
+)
+
+// Create the publisher of the events in the hpfeeds broker of the configuration
+func NewPublisher(cfg *HPFeeds) (publisher *hpfeeds.Publisher, err error) {
+	options := hpfeeds.Options{
+		Address: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.Port)),
+		Ident:   cfg.Ident,
+		Secret:  cfg.Secret,
+	}
+
+	if options.Backoff, err = parseOptionalDuration(cfg.Backoff); err != nil {
+		return
+	}
+	if options.MaxBackoff, err = parseOptionalDuration(cfg.MaxBackoff); err != nil {
+		return
+	}
+
+	for _, c := range cfg.Channels {
+		channel := hpfeeds.Channel{Name: c.Name}
+		for _, kind := range c.Kinds {
+			channel.Kinds = append(channel.Kinds, events.Kind(kind))
+		}
+		options.Channels = append(options.Channels, channel)
+	}
+
+	return hpfeeds.NewPublisher(options)
+}
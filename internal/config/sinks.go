@@ -0,0 +1,69 @@
+package config
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/riotpot/internal/sinks"
+)
+
+// Register the sinks of the configuration in the manager
+func ApplySinks(cfg []Sink, manager *sinks.Manager) (errs []error) {
+	for _, s := range cfg {
+		sink, err := newSink(s)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("sink %s: %w", sinkName(s), err))
+			continue
+		}
+
+		if err = manager.Add(sinkName(s), sink, s.Kinds...); err != nil {
+			sink.Close()
+			errs = append(errs, err)
+		}
+	}
+
+	return
+}
+
+// Returns the name of the sink, its type when empty
+func sinkName(s Sink) string {
+	if s.Name == "" {
+		return s.Type
+	}
+	return s.Name
+}
+
+// Create the sink of the type
+func newSink(s Sink) (sink sinks.Sink, err error) {
+	switch s.Type {
+	case "file":
+		var maxAge time.Duration
+		if maxAge, err = parseOptionalDuration(s.MaxAge); err != nil {
+			return
+		}
+		return sinks.NewFileSink(s.Path, s.MaxSize, maxAge, s.MaxFiles)
+	case "syslog":
+		return sinks.NewSyslogSink(s.Network, s.Address, s.Facility)
+	case "webhook":
+		options := sinks.WebhookOptions{
+			BatchSize: s.BatchSize,
+			Retries:   s.Retries,
+			Headers:   s.Headers,
+		}
+		if options.Interval, err = parseOptionalDuration(s.Interval); err != nil {
+			return
+		}
+		return sinks.NewWebhookSink(s.URL, options)
+	default:
+		err = fmt.Errorf("unknown type of sink: %s", s.Type)
+	}
+	return
+}
+
+// Parse a duration, zero when empty
+func parseOptionalDuration(value string) (d time.Duration, err error) {
+	if value == "" {
+		return
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,124 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	lr "github.com/riotpot/internal/logger"
+)
+
+// Snapshots of the running state, saved in a file in the format of the configuration.
+// The proxies and services are restored from the file on boot, with the same IDs,
+// and the proxies that were running are started again
+type State struct {
+	mu sync.Mutex
+
+	// Path to the file
+	path string
+	// Last state saved, to write the file only when the state changes
+	last []byte
+}
+
+// Save the running state, if it changed since the last time
+func (s *State) Save() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, err := Export().Marshal()
+	if err != nil || bytes.Equal(data, s.last) {
+		return
+	}
+
+	// Write a temporary file and replace the previous one, so the state is never half written
+	dir := filepath.Dir(s.path)
+	if err = os.MkdirAll(dir, 0755); err != nil {
+		return
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(s.path)+".*")
+	if err != nil {
+		return
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		return
+	}
+
+	if err = tmp.Sync(); err != nil {
+		tmp.Close()
+		return
+	}
+
+	if err = tmp.Close(); err != nil {
+		return
+	}
+
+	if err = os.Rename(tmp.Name(), s.path); err != nil {
+		return
+	}
+
+	s.last = data
+	return
+}
+
+// Restore the state saved in the file, if there is any
+func (s *State) Restore() (errs []error) {
+	cfg, err := Load(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return
+	}
+	if err != nil {
+		errs = append(errs, err)
+		return
+	}
+
+	return Apply(cfg)
+}
+
+// Save the state whenever a proxy or service changes, and every interval for the rest of changes
+// (e.g. routes and middlewares), until the channel is closed. The state is saved once more before returning
+func (s *State) Watch(interval time.Duration, stop <-chan struct{}) {
+	// Signal the changes without blocking the managers
+	changed := make(chan struct{}, 1)
+	unsubscribe := events.Changes.Subscribe(events.NotifierFunc(func(change *events.Change) {
+		select {
+		case changed <- struct{}{}:
+		default:
+		}
+	}))
+	defer unsubscribe()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	save := func() {
+		if err := s.Save(); err != nil {
+			lr.Log.Error().Err(err).Str("path", s.path).Msg("Could not save the state")
+		}
+	}
+
+	for {
+		select {
+		case <-changed:
+			save()
+		case <-ticker.C:
+			save()
+		case <-stop:
+			save()
+			return
+		}
+	}
+}
+
+func NewState(path string) *State {
+	return &State{
+		path: path,
+	}
+}
@@ -0,0 +1,104 @@
+package events
+
+import (
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+var (
+	// Bus used by the managers to notify the changes of the proxies and services
+	Changes = NewChangeBus()
+)
+
+type ChangeKind string
+
+// Kinds of changes
+const (
+	CreatedChange ChangeKind = "created"
+	UpdatedChange ChangeKind = "updated"
+	DeletedChange ChangeKind = "deleted"
+	StartedChange ChangeKind = "started"
+	StoppedChange ChangeKind = "stopped"
+)
+
+type Resource string
+
+// Resources that notify their changes
+const (
+	ProxyResource   Resource = "proxy"
+	ServiceResource Resource = "service"
+)
+
+// Change in the lifecycle of a proxy or a service
+type Change struct {
+	ID        string     `json:"id"`
+	Timestamp time.Time  `json:"timestamp"`
+	Kind      ChangeKind `json:"kind"`
+	// Resource changed and its ID
+	Resource   Resource `json:"resource"`
+	ResourceID string   `json:"resource_id"`
+}
+
+func NewChange(kind ChangeKind, resource Resource, id string) *Change {
+	return &Change{
+		ID:         uuid.NewString(),
+		Timestamp:  time.Now(),
+		Kind:       kind,
+		Resource:   resource,
+		ResourceID: id,
+	}
+}
+
+// Interface used to notify changes
+type Notifier interface {
+	Notify(change *Change)
+}
+
+// Function adapter to use ordinary functions as notifiers
+type NotifierFunc func(change *Change)
+
+func (f NotifierFunc) Notify(change *Change) {
+	f(change)
+}
+
+// Notifier that passes the changes to every subscriber.
+// The subscribers are called synchronously, so they should not block
+type ChangeBus struct {
+	mu sync.RWMutex
+	// Subscribers registered by their ID
+	subscribers map[string]Notifier
+}
+
+// Notify the change to every subscriber
+func (b *ChangeBus) Notify(change *Change) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, subscriber := range b.subscribers {
+		subscriber.Notify(change)
+	}
+}
+
+// Subscribe to the changes notified in the bus.
+// Returns a function to cancel the subscription
+func (b *ChangeBus) Subscribe(notifier Notifier) (unsubscribe func()) {
+	id := uuid.NewString()
+
+	b.mu.Lock()
+	b.subscribers[id] = notifier
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		delete(b.subscribers, id)
+		b.mu.Unlock()
+	}
+}
+
+func NewChangeBus() *ChangeBus {
+	return &ChangeBus{
+		subscribers: make(map[string]Notifier),
+	}
+}
@@ -0,0 +1,242 @@
+/*
+This package implements the attack events shared by the proxies and services, and
+the emitters used to publish them
+*/
+package events
+
+import (
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	lr "github.com/riotpot/internal/logger"
+)
+
+var (
+	// Bus used by the application to publish the events
+	Events = NewBus()
+)
+
+type Kind string
+
+// Kinds of events
+const (
+	// Event of a connection made to a proxy
+	ConnectionKind Kind = "connection"
+	// Event of a pair of credentials used against a service
+	CredentialKind Kind = "credential"
+	// Event of a command introduced in a (fake) shell
+	CommandKind Kind = "command"
+	// Event of a protocol message received by a service
+	MessageKind Kind = "message"
+)
+
+// Attack event observed by a proxy or a service
+type Event struct {
+	ID        string    `json:"id"`
+	Timestamp time.Time `json:"timestamp"`
+	// Proxy, session and service that observed the event
+	ProxyID   string `json:"proxy_id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	ServiceID string `json:"service_id,omitempty"`
+	Service   string `json:"service,omitempty"`
+	// Addresses of the connection
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	LocalAddr  string `json:"local_addr,omitempty"`
+	// Network (tcp, udp) and application protocol of the connection
+	Network  string `json:"network,omitempty"`
+	Protocol string `json:"protocol,omitempty"`
+	// Country (ISO code) and autonomous system of the client, when the GeoIP databases are loaded
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+	// Kind of event and its content
+	Kind    Kind    `json:"kind"`
+	Payload Payload `json:"payload,omitempty"`
+}
+
+// Create a new event with the addresses of a connection.
+// The kind of event is given by the payload
+func NewEvent(remote net.Addr, local net.Addr, payload Payload) *Event {
+	event := &Event{
+		ID:        uuid.NewString(),
+		Timestamp: time.Now(),
+		Kind:      payload.Kind(),
+		Payload:   payload,
+	}
+
+	if remote != nil {
+		event.RemoteAddr = remote.String()
+		event.Network = remote.Network()
+	}
+
+	if local != nil {
+		event.LocalAddr = local.String()
+	}
+
+	return event
+}
+
+// Interface used to publish events
+type Emitter interface {
+	Emit(event *Event)
+}
+
+// Function adapter to use ordinary functions as emitters
+type EmitterFunc func(event *Event)
+
+func (f EmitterFunc) Emit(event *Event) {
+	f(event)
+}
+
+// Function that adds information to an event before it is published
+type Enricher func(event *Event)
+
+const (
+	// Number of events queued for each subscriber before they are dropped
+	subscriberQueueSize = 1024
+)
+
+// Subscriber of a bus, receiving the events from its own queue and worker
+// so a slow subscriber does not block the publishers nor the other subscribers
+type subscription struct {
+	emitter Emitter
+	queue   chan *Event
+	// Closed once the worker delivered every event queued
+	done chan struct{}
+	// Events dropped because the queue was full
+	dropped int64
+	// Whether the drops were logged since the queue was last empty
+	reported int32
+}
+
+// Deliver the events queued until the queue is closed
+func (s *subscription) run() {
+	defer close(s.done)
+
+	for event := range s.queue {
+		s.emitter.Emit(event)
+		if len(s.queue) == 0 {
+			atomic.StoreInt32(&s.reported, 0)
+		}
+	}
+}
+
+// Stop receiving events and wait until the events queued are delivered
+func (s *subscription) stop() {
+	close(s.queue)
+	<-s.done
+}
+
+// Emitter that publishes the events to every subscriber
+type Bus struct {
+	mu sync.RWMutex
+	// Subscribers registered by their ID
+	subscribers map[string]*subscription
+	// Enrichers applied to every event, in order
+	enrichers []Enricher
+	// Events dropped by the subscribers removed
+	dropped int64
+}
+
+// Publish the event to every subscriber without waiting for them.
+// The event is dropped for the subscribers with a full queue
+func (b *Bus) Emit(event *Event) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for _, enrich := range b.enrichers {
+		enrich(event)
+	}
+
+	for _, s := range b.subscribers {
+		select {
+		case s.queue <- event:
+		default:
+			atomic.AddInt64(&s.dropped, 1)
+			if atomic.CompareAndSwapInt32(&s.reported, 0, 1) {
+				lr.Log.Warn().Str("kind", string(event.Kind)).Msgf("Events dropped, the subscriber is too slow (%T)", s.emitter)
+			}
+		}
+	}
+}
+
+// Subscribe to the events published in the bus.
+// Returns a function to cancel the subscription, which waits for the events queued to be delivered
+func (b *Bus) Subscribe(emitter Emitter) (unsubscribe func()) {
+	id := uuid.NewString()
+	s := &subscription{
+		emitter: emitter,
+		queue:   make(chan *Event, subscriberQueueSize),
+		done:    make(chan struct{}),
+	}
+	go s.run()
+
+	b.mu.Lock()
+	b.subscribers[id] = s
+	b.mu.Unlock()
+
+	return func() {
+		b.mu.Lock()
+		s, ok := b.subscribers[id]
+		if ok {
+			delete(b.subscribers, id)
+			atomic.AddInt64(&b.dropped, atomic.LoadInt64(&s.dropped))
+		}
+		b.mu.Unlock()
+
+		if ok {
+			s.stop()
+		}
+	}
+}
+
+// Returns the number of events dropped by the subscribers, because their queue was full
+func (b *Bus) GetDropped() (dropped int64) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	dropped = atomic.LoadInt64(&b.dropped)
+	for _, s := range b.subscribers {
+		dropped += atomic.LoadInt64(&s.dropped)
+	}
+	return
+}
+
+// Close the subscribers that hold resources (e.g. files or connections), once they received
+// the events queued, and remove every subscriber so the later events are dropped
+func (b *Bus) Close() (errs []error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	for id, s := range b.subscribers {
+		s.stop()
+		atomic.AddInt64(&b.dropped, atomic.LoadInt64(&s.dropped))
+
+		if closer, ok := s.emitter.(io.Closer); ok {
+			if err := closer.Close(); err != nil {
+				errs = append(errs, err)
+			}
+		}
+		delete(b.subscribers, id)
+	}
+
+	return
+}
+
+// Add an enricher applied to the events before publishing them
+func (b *Bus) Enrich(enricher Enricher) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.enrichers = append(b.enrichers, enricher)
+}
+
+func NewBus() *Bus {
+	return &Bus{
+		subscribers: make(map[string]*subscription),
+	}
+}
@@ -0,0 +1,16 @@
+package events
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/riotpot/internal/metrics"
+)
+
+// Metrics of the events published
+var (
+	_ = metrics.Factory.NewCounterFunc(prometheus.CounterOpts{
+		Name: "riotpot_events_dropped_total",
+		Help: "Number of events dropped because a subscriber (e.g. the store or a sink) was too slow",
+	}, func() float64 {
+		return float64(Events.GetDropped())
+	})
+)
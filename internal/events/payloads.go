@@ -0,0 +1,93 @@
+package events
+
+// Content of an event. Each payload determines the kind of the event
+type Payload interface {
+	Kind() Kind
+}
+
+// Connection made to a proxy
+type Connection struct{}
+
+func (p *Connection) Kind() Kind {
+	return ConnectionKind
+}
+
+// Pair of credentials used to log into a service
+type Credentials struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	// Client or software used, if known
+	Client string `json:"client,omitempty"`
+}
+
+func (p *Credentials) Kind() Kind {
+	return CredentialKind
+}
+
+// Command introduced in a shell
+type Command struct {
+	Username string `json:"username,omitempty"`
+	Input    string `json:"input"`
+}
+
+func (p *Command) Kind() Kind {
+	return CommandKind
+}
+
+// MQTT packet received by the broker
+type MQTTPacket struct {
+	Type     string   `json:"type"`
+	ClientID string   `json:"client_id,omitempty"`
+	Topic    string   `json:"topic,omitempty"`
+	Topics   []string `json:"topics,omitempty"`
+	Data     []byte   `json:"data,omitempty"`
+}
+
+func (p *MQTTPacket) Kind() Kind {
+	return MessageKind
+}
+
+// Modbus request received by the server
+type ModbusRequest struct {
+	Function uint8  `json:"function"`
+	Write    bool   `json:"write"`
+	Address  uint16 `json:"address"`
+	Quantity uint16 `json:"quantity"`
+	// Raw values written, only for write requests
+	Values []byte `json:"values,omitempty"`
+}
+
+func (p *ModbusRequest) Kind() Kind {
+	return MessageKind
+}
+
+// CoAP request received by the server
+type CoAPRequest struct {
+	Code    string `json:"code"`
+	Path    string `json:"path"`
+	Payload []byte `json:"payload,omitempty"`
+}
+
+func (p *CoAPRequest) Kind() Kind {
+	return MessageKind
+}
+
+// HTTP request received by the server
+type HTTPRequest struct {
+	Method    string `json:"method"`
+	Path      string `json:"path"`
+	UserAgent string `json:"user_agent,omitempty"`
+}
+
+func (p *HTTPRequest) Kind() Kind {
+	return MessageKind
+}
+
+// Raw message received by a service
+type Raw struct {
+	Data []byte `json:"data"`
+}
+
+func (p *Raw) Kind() Kind {
+	return MessageKind
+}
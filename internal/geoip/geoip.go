@@ -0,0 +1,143 @@
+package geoip
+
+import (
+	"net"
+	"sync"
+
+	"github.com/riotpot/internal/events"
+)
+
+var (
+	// Exportable locator of the clients.
+	// It is empty until the databases are loaded from the configuration
+	GeoIP = NewLocator()
+)
+
+// Country and autonomous system of an IP
+type Location struct {
+	// ISO 3166-1 alpha-2 code of the country
+	Country string
+	// Number and organization of the autonomous system
+	ASN   uint
+	ASOrg string
+}
+
+func (l Location) IsEmpty() bool {
+	return l.Country == "" && l.ASN == 0 && l.ASOrg == ""
+}
+
+// Locator of the IPs in a number of databases, e.g., a country and an ASN database.
+// The fields found in the first databases are kept
+type Locator struct {
+	mu        sync.RWMutex
+	databases []*Reader
+}
+
+// Replace the databases with the ones in the paths
+func (l *Locator) Load(paths ...string) (err error) {
+	databases := make([]*Reader, 0, len(paths))
+	for _, path := range paths {
+		db, e := Open(path)
+		if e != nil {
+			return e
+		}
+		databases = append(databases, db)
+	}
+
+	l.SetDatabases(databases...)
+	return
+}
+
+// Replace the databases
+func (l *Locator) SetDatabases(databases ...*Reader) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.databases = databases
+}
+
+// Returns whether there are databases to locate the IPs
+func (l *Locator) IsEnabled() bool {
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	return len(l.databases) > 0
+}
+
+// Returns the location of the IP, empty if it is not in the databases
+func (l *Locator) Locate(ip net.IP) (location Location) {
+	if ip == nil {
+		return
+	}
+
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+
+	for _, db := range l.databases {
+		value, err := db.Lookup(ip)
+		if err != nil || value == nil {
+			continue
+		}
+
+		m, ok := value.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		// GeoIP2 and GeoLite2 country and city databases
+		if location.Country == "" {
+			location.Country = countryCode(m)
+		}
+
+		// GeoIP2 and GeoLite2 ASN databases
+		if location.ASN == 0 {
+			if asn, ok := m["autonomous_system_number"].(uint64); ok {
+				location.ASN = uint(asn)
+			}
+		}
+		if location.ASOrg == "" {
+			location.ASOrg, _ = m["autonomous_system_organization"].(string)
+		}
+	}
+	return
+}
+
+// Returns the ISO code of the country of the record, or the registered country when missing
+func countryCode(m map[string]interface{}) string {
+	for _, key := range []string{"country", "registered_country"} {
+		country, ok := m[key].(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if code, ok := country["iso_code"].(string); ok && code != "" {
+			return code
+		}
+	}
+	return ""
+}
+
+// Returns the location of the host in an address (host:port), empty if it is not an IP
+func (l *Locator) LocateAddr(addr string) Location {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	return l.Locate(net.ParseIP(host))
+}
+
+// Enricher adding the location of the client to the events
+func (l *Locator) Enrich(event *events.Event) {
+	if event.RemoteAddr == "" || event.Country != "" || event.ASN != 0 || !l.IsEnabled() {
+		return
+	}
+
+	location := l.LocateAddr(event.RemoteAddr)
+	event.Country = location.Country
+	event.ASN = location.ASN
+	event.ASOrg = location.ASOrg
+}
+
+func NewLocator() *Locator {
+	return &Locator{}
+}
@@ -0,0 +1,61 @@
+package geoip
+
+import (
+	"net"
+	"os"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Metadata of a database
+type Metadata struct {
+	DatabaseType string
+	IPVersion    uint
+	NodeCount    uint
+	RecordSize   uint
+	BuildEpoch   uint
+}
+
+// Reader of the databases in the MaxMind DB format (e.g., GeoLite2-Country and GeoLite2-ASN).
+// The whole database is kept in memory
+type Reader struct {
+	db *maxminddb.Reader
+}
+
+// Returns the metadata of the database
+func (r *Reader) GetMetadata() Metadata {
+	m := r.db.Metadata
+	return Metadata{
+		DatabaseType: m.DatabaseType,
+		IPVersion:    m.IPVersion,
+		NodeCount:    m.NodeCount,
+		RecordSize:   m.RecordSize,
+		BuildEpoch:   m.BuildEpoch,
+	}
+}
+
+// Returns the data of the IP in the database, nil when the IP is not found
+func (r *Reader) Lookup(ip net.IP) (value interface{}, err error) {
+	err = r.db.Lookup(ip, &value)
+	return
+}
+
+// Parse a database in the MaxMind DB format
+func NewReader(buf []byte) (r *Reader, err error) {
+	db, err := maxminddb.FromBytes(buf)
+	if err != nil {
+		return
+	}
+
+	return &Reader{db: db}, nil
+}
+
+// Open a database in the MaxMind DB format
+func Open(path string) (r *Reader, err error) {
+	buf, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+
+	return NewReader(buf)
+}
@@ -142,10 +142,32 @@ var (
 	ApiHost string = environ.Getenv("API_HOST", "localhost")
 	// Port in where the API is listening
 	ApiPort string = environ.Getenv("API_PORT", "2022")
+	// API key with the admin role. The API requires authentication once a key or user is set
+	ApiKey string = environ.Getenv("API_KEY", "")
+	// Time after which the sessions of the users logged in expire
+	ApiSessionTTL string = environ.Getenv("API_SESSION_TTL", "12h")
+	// Token that allows Prometheus to scrape the metrics without the credentials of the API
+	MetricsToken string = environ.Getenv("METRICS_TOKEN", "")
+)
+
+// TLS
+var (
+	// Certificate and key files used to serve the API over TLS.
+	// A self-signed certificate is generated when they are not set
+	TLSCert string = environ.Getenv("TLS_CERT", "")
+	TLSKey  string = environ.Getenv("TLS_KEY", "")
+	// Certificates of the authorities of the API clients, enables mutual TLS when set
+	TLSClientCA string = environ.Getenv("TLS_CLIENT_CA", "")
+	// Directory in where the self-signed certificate is kept between restarts
+	TLSDir string = environ.Getenv("TLS_DIR", "certs")
 )
 
 // Database
 var (
+	// Backend used to store the records (bolt or postgres)
+	DbBackend string = environ.Getenv("DB_BACKEND", "bolt")
+	// Path to the embedded database file
+	DbPath string = environ.Getenv("DB_PATH", "riotpot.db")
 	// Database username
 	DbUsername string = environ.Getenv("DB_USER", "username")
 	// Database user password
@@ -157,3 +179,52 @@ var (
 	// Database name of the targeted database
 	DbName string = environ.Getenv("DB_Name", "db")
 )
+
+// Capture
+var (
+	// Directory in where the transcripts of the captured sessions are stored
+	CaptureDir string = environ.Getenv("CAPTURE_DIR", "captures")
+)
+
+// PCAP
+var (
+	// Directory in where the pcapng files of the proxies are stored
+	PcapDir string = environ.Getenv("PCAP_DIR", "pcaps")
+	// Size (bytes) after which the pcapng files are rotated
+	PcapMaxSize string = environ.Getenv("PCAP_MAX_SIZE", "104857600")
+	// Age after which the pcapng files are rotated
+	PcapMaxAge string = environ.Getenv("PCAP_MAX_AGE", "1h")
+	// Number of pcapng files kept for each proxy, the oldest are removed first. Zero keeps every file
+	PcapMaxFiles string = environ.Getenv("PCAP_MAX_FILES", "0")
+	// Time after which the pcapng files are removed. Zero keeps the files
+	PcapRetention string = environ.Getenv("PCAP_RETENTION", "0")
+)
+
+// GeoIP
+var (
+	// Comma-separated paths of the databases in the MaxMind DB format (e.g., GeoLite2-Country and GeoLite2-ASN)
+	// used to tag the clients with their country and autonomous system. Empty disables the lookups
+	GeoIPDatabases string = environ.Getenv("GEOIP_DATABASES", "")
+)
+
+// State
+var (
+	// File in where the state of the proxies and services is saved, to restore it on boot
+	StatePath string = environ.Getenv("STATE_PATH", "riotpot.state.yaml")
+	// Interval between the checks of changes in the state
+	StateInterval string = environ.Getenv("STATE_INTERVAL", "5s")
+)
+
+// Shutdown
+var (
+	// Time to wait for the sessions of the proxies and the plugins to finish on shutdown
+	ShutdownTimeout string = environ.Getenv("SHUTDOWN_TIMEOUT", "30s")
+)
+
+// Health checks
+var (
+	// Interval between the health checks of the external services
+	HealthInterval string = environ.Getenv("HEALTH_INTERVAL", "10s")
+	// Time to wait for the services to answer the health checks
+	HealthTimeout string = environ.Getenv("HEALTH_TIMEOUT", "2s")
+)
@@ -0,0 +1,143 @@
+package hpfeeds
+
+import (
+	"crypto/sha1"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// Opcodes of the messages
+const (
+	ErrorOp     byte = 0
+	InfoOp      byte = 1
+	AuthOp      byte = 2
+	PublishOp   byte = 3
+	SubscribeOp byte = 4
+)
+
+const (
+	// Size of the header: the length (uint32) and the opcode
+	headerSize = 5
+	// Maximum size of a message accepted from the broker
+	maxMessageSize = 1 << 20
+)
+
+// Message of the hpfeeds protocol. In the wire, it is preceded by its length
+// including the header (uint32, big endian) and the opcode
+type Message struct {
+	Opcode  byte
+	Payload []byte
+}
+
+// Read a message from the reader
+func ReadMessage(r io.Reader) (msg Message, err error) {
+	header := make([]byte, headerSize)
+	if _, err = io.ReadFull(r, header); err != nil {
+		return
+	}
+
+	length := binary.BigEndian.Uint32(header)
+	if length < headerSize || length > maxMessageSize {
+		err = fmt.Errorf("invalid length of the message: %d", length)
+		return
+	}
+
+	msg.Opcode = header[4]
+	msg.Payload = make([]byte, length-headerSize)
+	_, err = io.ReadFull(r, msg.Payload)
+	return
+}
+
+// Write the message in the writer
+func WriteMessage(w io.Writer, msg Message) (err error) {
+	data := make([]byte, headerSize, headerSize+len(msg.Payload))
+	binary.BigEndian.PutUint32(data, uint32(headerSize+len(msg.Payload)))
+	data[4] = msg.Opcode
+
+	_, err = w.Write(append(data, msg.Payload...))
+	return
+}
+
+// Append a string preceded by its length (uint8)
+func appendString(data []byte, value string) ([]byte, error) {
+	if len(value) > 255 {
+		return nil, fmt.Errorf("string too long: %d bytes", len(value))
+	}
+	return append(append(data, byte(len(value))), value...), nil
+}
+
+// Read a string preceded by its length (uint8), returning the rest of the data
+func readString(data []byte) (value string, rest []byte, err error) {
+	if len(data) < 1 || len(data) < 1+int(data[0]) {
+		err = fmt.Errorf("truncated string")
+		return
+	}
+
+	return string(data[1 : 1+data[0]]), data[1+data[0]:], nil
+}
+
+// Returns the hash proving the secret: SHA-1 of the nonce followed by the secret
+func AuthHash(nonce []byte, secret string) []byte {
+	hash := sha1.Sum(append(append([]byte{}, nonce...), secret...))
+	return hash[:]
+}
+
+// Create the message sent by the broker on connect, with its name and the nonce of the authentication
+func NewInfo(name string, nonce []byte) (msg Message, err error) {
+	payload, err := appendString(nil, name)
+	if err != nil {
+		return
+	}
+
+	return Message{Opcode: InfoOp, Payload: append(payload, nonce...)}, nil
+}
+
+// Parse the name of the broker and the nonce of an info message
+func ParseInfo(payload []byte) (name string, nonce []byte, err error) {
+	name, nonce, err = readString(payload)
+	return
+}
+
+// Create the message authenticating the ident with the secret
+func NewAuth(ident string, secret string, nonce []byte) (msg Message, err error) {
+	payload, err := appendString(nil, ident)
+	if err != nil {
+		return
+	}
+
+	return Message{Opcode: AuthOp, Payload: append(payload, AuthHash(nonce, secret)...)}, nil
+}
+
+// Parse the ident and the hash of an auth message
+func ParseAuth(payload []byte) (ident string, hash []byte, err error) {
+	ident, hash, err = readString(payload)
+	if err == nil && len(hash) != sha1.Size {
+		err = fmt.Errorf("invalid size of the hash: %d", len(hash))
+	}
+	return
+}
+
+// Create the message publishing the data in the channel
+func NewPublish(ident string, channel string, data []byte) (msg Message, err error) {
+	payload, err := appendString(nil, ident)
+	if err != nil {
+		return
+	}
+
+	if payload, err = appendString(payload, channel); err != nil {
+		return
+	}
+
+	return Message{Opcode: PublishOp, Payload: append(payload, data...)}, nil
+}
+
+// Parse the ident, the channel and the data of a publish message
+func ParsePublish(payload []byte) (ident string, channel string, data []byte, err error) {
+	if ident, payload, err = readString(payload); err != nil {
+		return
+	}
+
+	channel, data, err = readString(payload)
+	return
+}
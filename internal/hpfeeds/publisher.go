@@ -0,0 +1,360 @@
+/*
+This package publishes the attack events to an hpfeeds broker, the protocol used by most
+honeynet infrastructure to collect the data of the honeypots
+*/
+package hpfeeds
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/logger"
+)
+
+const (
+	// Channel of the events when none is set
+	DefaultChannel = "riotpot.events"
+
+	// Time to wait for the broker to connect and send its info
+	handshakeTimeout = 10 * time.Second
+	// Time to wait for the messages queued to be written on close
+	flushTimeout = 5 * time.Second
+)
+
+// Channel receiving the events of the given kinds, every event when empty
+type Channel struct {
+	Name  string
+	Kinds []events.Kind
+}
+
+// Whether the channel receives the events of the kind
+func (c *Channel) Accepts(kind events.Kind) bool {
+	if len(c.Kinds) == 0 {
+		return true
+	}
+
+	for _, k := range c.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Options of a publisher. The fields left empty take the default values
+type Options struct {
+	// Address of the broker, host:port
+	Address string
+	Ident   string
+	Secret  string
+	// Channels receiving the events, every event is published in `riotpot.events` when empty
+	Channels []Channel
+	// Time to wait before reconnecting, doubled after each failure up to the maximum.
+	// 1s and 1m by default
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+	// Maximum number of messages waiting to be published, the later are dropped. 10000 by default
+	QueueSize int
+}
+
+// Publisher of the events in an hpfeeds broker. It is an emitter of the events bus.
+// The publisher reconnects on its own when the connection is lost, keeping the messages
+// queued meanwhile
+type Publisher struct {
+	options Options
+
+	queue chan Message
+	// Message that could not be written, published again once reconnected
+	pending *Message
+
+	mu        sync.Mutex
+	connected bool
+	published int
+	dropped   int
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// Whether the publisher is connected to the broker
+func (p *Publisher) IsConnected() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.connected
+}
+
+// Returns the number of messages published and dropped because the queue was full
+func (p *Publisher) GetCounts() (published int, dropped int) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.published, p.dropped
+}
+
+// Queue the event in the channels accepting its kind
+func (p *Publisher) Emit(event *events.Event) {
+	var data []byte
+
+	for _, channel := range p.options.Channels {
+		if !channel.Accepts(event.Kind) {
+			continue
+		}
+
+		if data == nil {
+			var err error
+			if data, err = json.Marshal(event); err != nil {
+				logger.Log.Warn().Err(err).Msg("Could not encode the event for hpfeeds")
+				return
+			}
+		}
+
+		// The ident and channels are validated when the publisher is created
+		msg, _ := NewPublish(p.options.Ident, channel.Name, data)
+
+		select {
+		case p.queue <- msg:
+		default:
+			p.mu.Lock()
+			p.dropped++
+			p.mu.Unlock()
+		}
+	}
+}
+
+// Connect and authenticate in the broker
+func (p *Publisher) connect() (conn net.Conn, err error) {
+	dialer := &net.Dialer{Timeout: handshakeTimeout}
+	if conn, err = dialer.DialContext(p.ctx, "tcp", p.options.Address); err != nil {
+		return
+	}
+
+	defer func() {
+		if err != nil {
+			conn.Close()
+		}
+	}()
+
+	conn.SetDeadline(time.Now().Add(handshakeTimeout))
+
+	info, err := ReadMessage(conn)
+	if err != nil {
+		return
+	}
+	if info.Opcode != InfoOp {
+		err = fmt.Errorf("unexpected message from the broker: opcode %d", info.Opcode)
+		return
+	}
+
+	name, nonce, err := ParseInfo(info.Payload)
+	if err != nil {
+		return
+	}
+
+	auth, err := NewAuth(p.options.Ident, p.options.Secret, nonce)
+	if err != nil {
+		return
+	}
+	if err = WriteMessage(conn, auth); err != nil {
+		return
+	}
+
+	conn.SetDeadline(time.Time{})
+	logger.Log.Info().Str("broker", name).Str("address", p.options.Address).Msg("Connected to the hpfeeds broker")
+	return
+}
+
+// Read the messages of the broker until the connection is closed. The broker
+// does not answer the publications, it only reports the errors (e.g., a wrong secret)
+func (p *Publisher) read(conn net.Conn, errc chan<- error) {
+	for {
+		msg, err := ReadMessage(conn)
+		if err != nil {
+			errc <- err
+			return
+		}
+
+		if msg.Opcode == ErrorOp {
+			logger.Log.Warn().Str("error", string(msg.Payload)).Msg("Error reported by the hpfeeds broker")
+		}
+	}
+}
+
+// Write a message, keeping it to publish again when it fails
+func (p *Publisher) write(conn net.Conn, msg Message) (err error) {
+	if err = WriteMessage(conn, msg); err != nil {
+		p.pending = &msg
+		return
+	}
+
+	p.mu.Lock()
+	p.published++
+	p.mu.Unlock()
+	return
+}
+
+// Publish the messages queued until the connection fails or the publisher is closed
+func (p *Publisher) publish(conn net.Conn) (err error) {
+	errc := make(chan error, 1)
+	go p.read(conn, errc)
+
+	if p.pending != nil {
+		msg := *p.pending
+		p.pending = nil
+		if err = p.write(conn, msg); err != nil {
+			return
+		}
+	}
+
+	for {
+		select {
+		case msg := <-p.queue:
+			if err = p.write(conn, msg); err != nil {
+				return
+			}
+		case err = <-errc:
+			return
+		case <-p.ctx.Done():
+			return p.flush(conn)
+		}
+	}
+}
+
+// Write the messages queued before closing
+func (p *Publisher) flush(conn net.Conn) (err error) {
+	conn.SetWriteDeadline(time.Now().Add(flushTimeout))
+
+	for {
+		select {
+		case msg := <-p.queue:
+			if err = p.write(conn, msg); err != nil {
+				return
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *Publisher) setConnected(connected bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.connected = connected
+}
+
+// Keep the publisher connected, waiting longer after each failure to connect
+func (p *Publisher) run() {
+	defer close(p.done)
+
+	backoff := p.options.Backoff
+	for {
+		conn, err := p.connect()
+		if err == nil {
+			connected := time.Now()
+
+			p.setConnected(true)
+			err = p.publish(conn)
+			p.setConnected(false)
+			conn.Close()
+
+			// The broker closes the connection right away when the authentication fails,
+			// so the backoff is only reset once the connection was stable
+			if time.Since(connected) > backoff {
+				backoff = p.options.Backoff
+			}
+		}
+
+		if p.ctx.Err() != nil {
+			return
+		}
+		logger.Log.Warn().Err(err).Str("address", p.options.Address).Dur("retry", backoff).Msg("Lost the connection to the hpfeeds broker")
+
+		select {
+		case <-time.After(backoff):
+		case <-p.ctx.Done():
+			return
+		}
+
+		if backoff *= 2; backoff > p.options.MaxBackoff {
+			backoff = p.options.MaxBackoff
+		}
+	}
+}
+
+// Publish the messages queued, if connected, and disconnect from the broker
+func (p *Publisher) Close() (err error) {
+	p.cancel()
+	<-p.done
+	return
+}
+
+// Check the kind of events is known
+func validateKind(kind events.Kind) (err error) {
+	switch kind {
+	case events.ConnectionKind, events.CredentialKind, events.CommandKind, events.MessageKind:
+	default:
+		err = fmt.Errorf("unknown kind of events: %s", kind)
+	}
+	return
+}
+
+// Create a publisher connected to the broker in the background
+func NewPublisher(options Options) (p *Publisher, err error) {
+	if options.Address == "" || options.Ident == "" || options.Secret == "" {
+		err = fmt.Errorf("the address of the broker, the ident and the secret are required")
+		return
+	}
+
+	if len(options.Channels) == 0 {
+		options.Channels = []Channel{{Name: DefaultChannel}}
+	}
+
+	// Check the ident and the channels fit in the messages
+	for _, channel := range options.Channels {
+		if _, err = NewPublish(options.Ident, channel.Name, nil); err != nil {
+			return
+		}
+		if channel.Name == "" {
+			err = fmt.Errorf("the name of the channel is required")
+			return
+		}
+
+		for _, kind := range channel.Kinds {
+			if err = validateKind(kind); err != nil {
+				return
+			}
+		}
+	}
+
+	if options.Backoff <= 0 {
+		options.Backoff = time.Second
+	}
+	if options.MaxBackoff < options.Backoff {
+		options.MaxBackoff = time.Minute
+		if options.MaxBackoff < options.Backoff {
+			options.MaxBackoff = options.Backoff
+		}
+	}
+	if options.QueueSize <= 0 {
+		options.QueueSize = 10000
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p = &Publisher{
+		options: options,
+		queue:   make(chan Message, options.QueueSize),
+		ctx:     ctx,
+		cancel:  cancel,
+		done:    make(chan struct{}),
+	}
+
+	go p.run()
+	return
+}
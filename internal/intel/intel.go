@@ -0,0 +1,241 @@
+/*
+This package aggregates the stored events into indicators (attacker IPs, credentials tried,
+URLs downloaded from the shells and MQTT topics abused) and exports them to the formats
+consumed by threat intelligence platforms: STIX 2.1 bundles and MISP events
+*/
+package intel
+
+import (
+	"fmt"
+	"net"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/store"
+)
+
+type IndicatorType string
+
+// Types of indicators
+const (
+	// Address of an attacker
+	IPIndicator IndicatorType = "ip"
+	// Pair of credentials used against a service
+	CredentialIndicator IndicatorType = "credential"
+	// URL found in a shell command, e.g. downloaded with wget or curl
+	URLIndicator IndicatorType = "url"
+	// Topic published or subscribed to in the MQTT broker
+	TopicIndicator IndicatorType = "mqtt-topic"
+)
+
+// Order of the types in the reports
+var indicatorTypes = []IndicatorType{IPIndicator, CredentialIndicator, URLIndicator, TopicIndicator}
+
+// URLs in the shell commands, up to the first space, quote or shell operator
+var urlPattern = regexp.MustCompile(`(?i)\b(?:https?|ftp|tftp)://[^\s'"<>|;&` + "`" + `]+`)
+
+// Indicator observed in the events
+type Indicator struct {
+	Type  IndicatorType `json:"type"`
+	Value string        `json:"value"`
+	// Username and password of the credentials
+	Username string `json:"username,omitempty"`
+	Password string `json:"password,omitempty"`
+	// Time of the first and last events, and number of events where it was observed
+	FirstSeen time.Time `json:"first_seen"`
+	LastSeen  time.Time `json:"last_seen"`
+	Count     int       `json:"count"`
+	// Services that observed it
+	Services []string `json:"services,omitempty"`
+}
+
+// Add an observation of the indicator
+func (i *Indicator) observe(record *store.Record) {
+	if i.Count == 0 || record.Timestamp.Before(i.FirstSeen) {
+		i.FirstSeen = record.Timestamp
+	}
+	if record.Timestamp.After(i.LastSeen) {
+		i.LastSeen = record.Timestamp
+	}
+	i.Count++
+
+	service := record.Service
+	if service == "" {
+		service = record.Protocol
+	}
+	if service == "" {
+		return
+	}
+
+	for _, s := range i.Services {
+		if s == service {
+			return
+		}
+	}
+	i.Services = append(i.Services, service)
+}
+
+// Indicators aggregated from the events
+type Report struct {
+	Created    time.Time    `json:"created"`
+	Indicators []*Indicator `json:"indicators"`
+}
+
+// Aggregate the records into indicators, ordered by type and first observation
+func Aggregate(records []*store.Record) *Report {
+	indicators := map[string]*Indicator{}
+
+	add := func(record *store.Record, indicator Indicator) {
+		key := string(indicator.Type) + "|" + indicator.Value
+		if _, ok := indicators[key]; !ok {
+			indicators[key] = &indicator
+		}
+		indicators[key].observe(record)
+	}
+
+	for _, record := range records {
+		if ip := remoteIP(record.RemoteAddr); ip != "" {
+			add(record, Indicator{Type: IPIndicator, Value: ip})
+		}
+
+		switch record.Kind {
+		case events.CredentialKind:
+			username, password := stringField(record.Data, "username"), stringField(record.Data, "password")
+			add(record, Indicator{
+				Type:     CredentialIndicator,
+				Value:    username + ":" + password,
+				Username: username,
+				Password: password,
+			})
+		case events.CommandKind:
+			for _, url := range urlPattern.FindAllString(stringField(record.Data, "input"), -1) {
+				add(record, Indicator{Type: URLIndicator, Value: url})
+			}
+		case events.MessageKind:
+			for _, topic := range mqttTopics(record.Data) {
+				add(record, Indicator{Type: TopicIndicator, Value: topic})
+			}
+		}
+	}
+
+	report := &Report{
+		Created:    time.Now().UTC(),
+		Indicators: make([]*Indicator, 0, len(indicators)),
+	}
+	for _, indicator := range indicators {
+		report.Indicators = append(report.Indicators, indicator)
+	}
+
+	order := map[IndicatorType]int{}
+	for i, t := range indicatorTypes {
+		order[t] = i
+	}
+
+	sort.Slice(report.Indicators, func(i, j int) bool {
+		a, b := report.Indicators[i], report.Indicators[j]
+		switch {
+		case a.Type != b.Type:
+			return order[a.Type] < order[b.Type]
+		case !a.FirstSeen.Equal(b.FirstSeen):
+			return a.FirstSeen.Before(b.FirstSeen)
+		default:
+			return a.Value < b.Value
+		}
+	})
+
+	return report
+}
+
+// Returns the IP of the remote address, empty if it is not valid
+func remoteIP(addr string) string {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		host = addr
+	}
+
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return ""
+	}
+	return ip.String()
+}
+
+// Returns the field of the data if it is a string
+func stringField(data map[string]interface{}, key string) string {
+	value, _ := data[key].(string)
+	return value
+}
+
+// Returns the topics of an MQTT packet, none for the other messages
+func mqttTopics(data map[string]interface{}) (topics []string) {
+	// Only the MQTT packets have a type along the topics
+	if stringField(data, "type") == "" {
+		return
+	}
+
+	if topic := stringField(data, "topic"); topic != "" {
+		topics = append(topics, topic)
+	}
+
+	list, _ := data["topics"].([]interface{})
+	for _, t := range list {
+		if topic, ok := t.(string); ok && topic != "" {
+			topics = append(topics, topic)
+		}
+	}
+	return
+}
+
+// Describe the observations of the indicator
+func (i *Indicator) describe() string {
+	description := fmt.Sprintf("Observed %d times by RIoTPot between %s and %s", i.Count, i.FirstSeen.UTC().Format(time.RFC3339), i.LastSeen.UTC().Format(time.RFC3339))
+	if len(i.Services) > 0 {
+		description += " in " + strings.Join(i.Services, ", ")
+	}
+	return description
+}
+
+type Format string
+
+// Formats of the exports
+const (
+	STIXFormat Format = "stix"
+	MISPFormat Format = "misp"
+)
+
+// Parse the format of an export, STIX by default
+func ParseFormat(format string) (f Format, err error) {
+	switch Format(strings.ToLower(format)) {
+	case "", STIXFormat:
+		f = STIXFormat
+	case MISPFormat:
+		f = MISPFormat
+	default:
+		err = fmt.Errorf("unknown export format: %s", format)
+	}
+	return
+}
+
+// Export the report in the format
+func Export(report *Report, format Format) (data []byte, err error) {
+	switch format {
+	case STIXFormat:
+		return ExportSTIX(report)
+	case MISPFormat:
+		return ExportMISP(report)
+	default:
+		err = fmt.Errorf("unknown export format: %s", format)
+	}
+	return
+}
+
+// Returns the media type of the exports in the format
+func (f Format) ContentType() string {
+	if f == STIXFormat {
+		return "application/stix+json;version=2.1"
+	}
+	return "application/json"
+}
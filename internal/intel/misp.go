@@ -0,0 +1,121 @@
+package intel
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// Format of the first and last seen times, in UTC with microseconds
+	mispTime = "2006-01-02T15:04:05.000000Z"
+)
+
+type mispExport struct {
+	Event mispEvent `json:"Event"`
+}
+
+type mispEvent struct {
+	UUID      string `json:"uuid"`
+	Info      string `json:"info"`
+	Date      string `json:"date"`
+	Timestamp string `json:"timestamp"`
+	// Low threat level (3), analysis completed (2) and shared with the organisation only (0)
+	ThreatLevelID string          `json:"threat_level_id"`
+	Analysis      string          `json:"analysis"`
+	Distribution  string          `json:"distribution"`
+	Attribute     []mispAttribute `json:"Attribute"`
+	Object        []mispObject    `json:"Object"`
+	Tag           []mispTag       `json:"Tag"`
+}
+
+type mispAttribute struct {
+	UUID           string `json:"uuid"`
+	Type           string `json:"type"`
+	Category       string `json:"category"`
+	ObjectRelation string `json:"object_relation,omitempty"`
+	Value          string `json:"value"`
+	ToIDS          bool   `json:"to_ids"`
+	Comment        string `json:"comment,omitempty"`
+	FirstSeen      string `json:"first_seen,omitempty"`
+	LastSeen       string `json:"last_seen,omitempty"`
+}
+
+type mispObject struct {
+	UUID         string          `json:"uuid"`
+	Name         string          `json:"name"`
+	MetaCategory string          `json:"meta-category"`
+	Comment      string          `json:"comment,omitempty"`
+	FirstSeen    string          `json:"first_seen,omitempty"`
+	LastSeen     string          `json:"last_seen,omitempty"`
+	Attribute    []mispAttribute `json:"Attribute"`
+}
+
+type mispTag struct {
+	Name string `json:"name"`
+}
+
+// Returns the deterministic UUID of a value of the indicator
+func (i *Indicator) uuid(value string) string {
+	return uuid.NewSHA1(namespace, []byte(string(i.Type)+"|"+i.Value+"|"+value)).String()
+}
+
+// Returns the attribute of the indicator with the type and category given
+func (i *Indicator) mispAttribute(kind string, category string, value string, toIDS bool) mispAttribute {
+	return mispAttribute{
+		UUID:      i.uuid(kind),
+		Type:      kind,
+		Category:  category,
+		Value:     value,
+		ToIDS:     toIDS,
+		Comment:   i.describe(),
+		FirstSeen: i.FirstSeen.UTC().Format(mispTime),
+		LastSeen:  i.LastSeen.UTC().Format(mispTime),
+	}
+}
+
+// Export the report as a MISP event. The credentials are exported as `credential` objects,
+// and the rest of the indicators as attributes
+func ExportMISP(report *Report) ([]byte, error) {
+	event := mispEvent{
+		UUID:          uuid.NewString(),
+		Info:          "RIoTPot observed indicators",
+		Date:          report.Created.UTC().Format("2006-01-02"),
+		Timestamp:     strconv.FormatInt(report.Created.Unix(), 10),
+		ThreatLevelID: "3",
+		Analysis:      "2",
+		Distribution:  "0",
+		Attribute:     []mispAttribute{},
+		Object:        []mispObject{},
+		Tag:           []mispTag{{Name: "riotpot"}},
+	}
+
+	for _, indicator := range report.Indicators {
+		switch indicator.Type {
+		case IPIndicator:
+			event.Attribute = append(event.Attribute, indicator.mispAttribute("ip-src", "Network activity", indicator.Value, true))
+		case URLIndicator:
+			event.Attribute = append(event.Attribute, indicator.mispAttribute("url", "Payload delivery", indicator.Value, true))
+		case TopicIndicator:
+			event.Attribute = append(event.Attribute, indicator.mispAttribute("text", "Network activity", indicator.Value, false))
+		case CredentialIndicator:
+			username := indicator.mispAttribute("text", "Other", indicator.Username, false)
+			username.UUID, username.ObjectRelation = indicator.uuid("username"), "username"
+			password := indicator.mispAttribute("text", "Other", indicator.Password, false)
+			password.UUID, password.ObjectRelation = indicator.uuid("password"), "password"
+
+			event.Object = append(event.Object, mispObject{
+				UUID:         indicator.uuid("credential"),
+				Name:         "credential",
+				MetaCategory: "misc",
+				Comment:      indicator.describe(),
+				FirstSeen:    indicator.FirstSeen.UTC().Format(mispTime),
+				LastSeen:     indicator.LastSeen.UTC().Format(mispTime),
+				Attribute:    []mispAttribute{username, password},
+			})
+		}
+	}
+
+	return json.MarshalIndent(mispExport{Event: event}, "", "  ")
+}
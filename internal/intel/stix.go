@@ -0,0 +1,122 @@
+package intel
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+const (
+	stixVersion = "2.1"
+	// Format of the timestamps, in UTC with milliseconds
+	stixTime = "2006-01-02T15:04:05.000Z"
+)
+
+var (
+	// Namespace of the deterministic IDs, so an indicator keeps its ID between exports
+	namespace = uuid.NewSHA1(uuid.NameSpaceURL, []byte("riotpot"))
+
+	// Identity of RIoTPot, creator of the indicators
+	identityID = "identity--" + uuid.NewSHA1(namespace, []byte("identity")).String()
+)
+
+type stixBundle struct {
+	Type    string        `json:"type"`
+	ID      string        `json:"id"`
+	Objects []interface{} `json:"objects"`
+}
+
+type stixIdentity struct {
+	Type          string `json:"type"`
+	SpecVersion   string `json:"spec_version"`
+	ID            string `json:"id"`
+	Created       string `json:"created"`
+	Modified      string `json:"modified"`
+	Name          string `json:"name"`
+	IdentityClass string `json:"identity_class"`
+}
+
+type stixIndicator struct {
+	Type           string   `json:"type"`
+	SpecVersion    string   `json:"spec_version"`
+	ID             string   `json:"id"`
+	CreatedByRef   string   `json:"created_by_ref"`
+	Created        string   `json:"created"`
+	Modified       string   `json:"modified"`
+	Name           string   `json:"name"`
+	Description    string   `json:"description"`
+	IndicatorTypes []string `json:"indicator_types"`
+	Pattern        string   `json:"pattern"`
+	PatternType    string   `json:"pattern_type"`
+	ValidFrom      string   `json:"valid_from"`
+	Labels         []string `json:"labels"`
+}
+
+// Quote a value of a STIX pattern
+func quote(value string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+// Returns the name and the STIX pattern of the indicator
+func (i *Indicator) stixPattern() (name string, pattern string) {
+	switch i.Type {
+	case IPIndicator:
+		object := "ipv4-addr"
+		if ip := net.ParseIP(i.Value); ip != nil && ip.To4() == nil {
+			object = "ipv6-addr"
+		}
+		return "Attacker IP " + i.Value, fmt.Sprintf("[%s:value = %s]", object, quote(i.Value))
+	case CredentialIndicator:
+		return "Credentials tried " + i.Value, fmt.Sprintf("[user-account:account_login = %s AND user-account:credential = %s]", quote(i.Username), quote(i.Password))
+	case URLIndicator:
+		return "URL downloaded " + i.Value, fmt.Sprintf("[url:value = %s]", quote(i.Value))
+	default:
+		// There is no STIX object for the topics, so a custom one is used
+		return "MQTT topic abused " + i.Value, fmt.Sprintf("[x-riotpot-mqtt-topic:value = %s]", quote(i.Value))
+	}
+}
+
+// Export the report as a STIX 2.1 bundle, with an indicator for each of them
+func ExportSTIX(report *Report) ([]byte, error) {
+	created := report.Created.UTC().Format(stixTime)
+
+	bundle := stixBundle{
+		Type: "bundle",
+		ID:   "bundle--" + uuid.NewString(),
+		Objects: []interface{}{
+			stixIdentity{
+				Type:          "identity",
+				SpecVersion:   stixVersion,
+				ID:            identityID,
+				Created:       created,
+				Modified:      created,
+				Name:          "RIoTPot",
+				IdentityClass: "system",
+			},
+		},
+	}
+
+	for _, indicator := range report.Indicators {
+		name, pattern := indicator.stixPattern()
+		bundle.Objects = append(bundle.Objects, stixIndicator{
+			Type:           "indicator",
+			SpecVersion:    stixVersion,
+			ID:             "indicator--" + uuid.NewSHA1(namespace, []byte(string(indicator.Type)+"|"+indicator.Value)).String(),
+			CreatedByRef:   identityID,
+			Created:        indicator.FirstSeen.UTC().Format(stixTime),
+			Modified:       indicator.LastSeen.UTC().Format(stixTime),
+			Name:           name,
+			Description:    indicator.describe(),
+			IndicatorTypes: []string{"malicious-activity"},
+			Pattern:        pattern,
+			PatternType:    "stix",
+			ValidFrom:      indicator.FirstSeen.UTC().Format(stixTime),
+			Labels:         []string{"riotpot", string(indicator.Type)},
+		})
+	}
+
+	return json.MarshalIndent(bundle, "", "  ")
+}
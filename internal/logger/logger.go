@@ -24,7 +24,7 @@ func New(logLevel zerolog.Level) *Logger {
 	// Create the logger with a timestamp
 	logger := zerolog.New(os.Stderr).With().Timestamp().Logger()
 
-	return &Logger{logger: &logger}
+	return &Logger{logger: &logger, out: os.Stderr}
 }
 
 // Create a new console
@@ -34,7 +34,7 @@ func NewConsole(logLevel zerolog.Level) *Logger {
 
 	// Create a new console with a timestamp
 	logger := zerolog.New(os.Stdout).With().Timestamp().Logger()
-	return &Logger{logger: &logger}
+	return &Logger{logger: &logger, out: os.Stdout}
 }
 
 // Implementation of a Zerolog logger
@@ -42,6 +42,7 @@ func NewConsole(logLevel zerolog.Level) *Logger {
 // https://github.com/learning-cloud-native-go/myapp/blob/step-6/util/logger/logger.go
 type Logger struct {
 	logger *zerolog.Logger
+	out    io.Writer
 }
 
 // Output duplicates the global logger and sets w as its output.
@@ -49,6 +50,17 @@ func (l *Logger) Output(w io.Writer) zerolog.Logger {
 	return l.logger.Output(w)
 }
 
+// AddWriter writes the logs in w as well as in the current output.
+// It must be called before the logger is shared between goroutines.
+func (l *Logger) AddWriter(w io.Writer) {
+	if l.out != nil {
+		w = zerolog.MultiLevelWriter(l.out, w)
+	}
+	l.out = w
+	logger := l.logger.Output(l.out)
+	l.logger = &logger
+}
+
 // With creates a child logger with the field added to its context.
 func (l *Logger) With() zerolog.Context {
 	return l.logger.With()
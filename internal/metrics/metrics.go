@@ -0,0 +1,54 @@
+/*
+This package keeps the registry of the metrics of the application, and exposes them
+in the text format scraped by Prometheus
+*/
+package metrics
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/common/expfmt"
+)
+
+var (
+	// Registry of the metrics exposed by the application
+	Metrics = NewRegistry()
+	// Factory of the metrics registered in the registry of the application,
+	// meant to declare them once, in package variables
+	Factory = promauto.With(Metrics)
+)
+
+// Create a new registry with the metrics of the Go runtime and the process
+func NewRegistry() *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	return registry
+}
+
+// Returns the handler serving the metrics of the registry
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Metrics, promhttp.HandlerOpts{})
+}
+
+// Write the metrics of the registry in the text format
+func Write(w io.Writer) (err error) {
+	families, err := Metrics.Gather()
+	if err != nil {
+		return
+	}
+
+	for _, family := range families {
+		if _, err = expfmt.MetricFamilyToText(w, family); err != nil {
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,288 @@
+package pcap
+
+import (
+	"encoding/binary"
+	"math/rand"
+	"net"
+	"strconv"
+	"sync"
+	"sync/atomic"
+)
+
+const (
+	// IP protocol numbers
+	protocolTCP uint8 = 6
+	protocolUDP uint8 = 17
+
+	// Ethernet types
+	etherTypeIPv4 uint16 = 0x0800
+	etherTypeIPv6 uint16 = 0x86DD
+
+	// TCP flags
+	flagFIN uint8 = 0x01
+	flagSYN uint8 = 0x02
+	flagPSH uint8 = 0x08
+	flagACK uint8 = 0x10
+
+	// Maximum payload of the TCP segments synthesized
+	maxSegmentSize = 1460
+	// Maximum payload of a UDP datagram
+	maxDatagramSize = 65507
+)
+
+var (
+	// Locally administered MAC addresses of the client and the proxy
+	clientMAC = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x01}
+	proxyMAC  = net.HardwareAddr{0x02, 0x00, 0x00, 0x00, 0x00, 0x02}
+
+	// Identification of the IPv4 packets
+	ipID uint32
+)
+
+// Returns the IP and port of an address
+func endpoint(addr net.Addr) (ip net.IP, port int) {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP, a.Port
+	case *net.UDPAddr:
+		return a.IP, a.Port
+	}
+
+	if addr == nil {
+		return
+	}
+
+	host, p, err := net.SplitHostPort(addr.String())
+	if err != nil {
+		return
+	}
+	ip = net.ParseIP(host)
+	port, _ = strconv.Atoi(p)
+	return
+}
+
+// Returns both IPs in the same family. Missing or unspecified IPs are set to the loopback
+func family(src, dst net.IP) (net.IP, net.IP, bool) {
+	if src == nil || src.IsUnspecified() {
+		src = net.IPv4(127, 0, 0, 1)
+	}
+	if dst == nil || dst.IsUnspecified() {
+		dst = net.IPv4(127, 0, 0, 1)
+	}
+
+	if src.To4() != nil && dst.To4() != nil {
+		return src.To4(), dst.To4(), true
+	}
+
+	return src.To16(), dst.To16(), false
+}
+
+// Internet checksum of the data
+func checksum(data []byte, initial uint32) uint16 {
+	sum := initial
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// Build an Ethernet frame containing an IP packet with the transport segment.
+// The checksum of the segment is calculated using the IP pseudo-header
+func buildFrame(src, dst net.IP, fromClient bool, protocol uint8, segment []byte) []byte {
+	src, dst, v4 := family(src, dst)
+
+	// Pseudo-header used in the checksum of the segment
+	var pseudo []byte
+	pseudo = append(pseudo, src...)
+	pseudo = append(pseudo, dst...)
+	if v4 {
+		pseudo = append(pseudo, 0, protocol, byte(len(segment)>>8), byte(len(segment)))
+	} else {
+		pseudo = append(pseudo, byte(len(segment)>>24), byte(len(segment)>>16), byte(len(segment)>>8), byte(len(segment)), 0, 0, 0, protocol)
+	}
+
+	var initial uint32
+	for i := 0; i < len(pseudo); i += 2 {
+		initial += uint32(binary.BigEndian.Uint16(pseudo[i:]))
+	}
+
+	offset := 16
+	if protocol == protocolUDP {
+		offset = 6
+	}
+	sum := checksum(segment, initial)
+	if sum == 0 && protocol == protocolUDP {
+		sum = 0xffff
+	}
+	binary.BigEndian.PutUint16(segment[offset:], sum)
+
+	// Ethernet header
+	frame := make([]byte, 14, 14+40+len(segment))
+	if fromClient {
+		copy(frame[0:], proxyMAC)
+		copy(frame[6:], clientMAC)
+	} else {
+		copy(frame[0:], clientMAC)
+		copy(frame[6:], proxyMAC)
+	}
+
+	if v4 {
+		binary.BigEndian.PutUint16(frame[12:], etherTypeIPv4)
+
+		header := make([]byte, 20)
+		header[0] = 0x45
+		binary.BigEndian.PutUint16(header[2:], uint16(20+len(segment)))
+		binary.BigEndian.PutUint16(header[4:], uint16(atomic.AddUint32(&ipID, 1)))
+		// Do not fragment
+		binary.BigEndian.PutUint16(header[6:], 0x4000)
+		header[8] = 64
+		header[9] = protocol
+		copy(header[12:], src)
+		copy(header[16:], dst)
+		binary.BigEndian.PutUint16(header[10:], checksum(header, 0))
+
+		frame = append(frame, header...)
+	} else {
+		binary.BigEndian.PutUint16(frame[12:], etherTypeIPv6)
+
+		header := make([]byte, 40)
+		header[0] = 0x60
+		binary.BigEndian.PutUint16(header[4:], uint16(len(segment)))
+		header[6] = protocol
+		header[7] = 64
+		copy(header[8:], src)
+		copy(header[24:], dst)
+
+		frame = append(frame, header...)
+	}
+
+	return append(frame, segment...)
+}
+
+// Build a frame with a UDP datagram between two addresses.
+// Payloads larger than a datagram are truncated
+func UDPDatagram(src, dst net.Addr, fromClient bool, payload []byte) []byte {
+	if len(payload) > maxDatagramSize {
+		payload = payload[:maxDatagramSize]
+	}
+
+	srcIP, srcPort := endpoint(src)
+	dstIP, dstPort := endpoint(dst)
+
+	segment := make([]byte, 8, 8+len(payload))
+	binary.BigEndian.PutUint16(segment[0:], uint16(srcPort))
+	binary.BigEndian.PutUint16(segment[2:], uint16(dstPort))
+	binary.BigEndian.PutUint16(segment[4:], uint16(8+len(payload)))
+	segment = append(segment, payload...)
+
+	return buildFrame(srcIP, dstIP, fromClient, protocolUDP, segment)
+}
+
+// TCP connection between a client and the proxy.
+// It keeps the sequence numbers of both sides to synthesize the segments of the stream
+type TCPStream struct {
+	mu sync.Mutex
+
+	clientIP   net.IP
+	clientPort int
+	proxyIP    net.IP
+	proxyPort  int
+
+	// Next sequence number of each side
+	clientSeq uint32
+	proxySeq  uint32
+}
+
+// Build a segment from one of the sides, acknowledging everything received from the other
+func (s *TCPStream) segment(fromClient bool, flags uint8, payload []byte) []byte {
+	var (
+		srcIP, dstIP     = s.clientIP, s.proxyIP
+		srcPort, dstPort = s.clientPort, s.proxyPort
+		seq, ack         = &s.clientSeq, s.proxySeq
+	)
+	if !fromClient {
+		srcIP, dstIP = s.proxyIP, s.clientIP
+		srcPort, dstPort = s.proxyPort, s.clientPort
+		seq, ack = &s.proxySeq, s.clientSeq
+	}
+
+	segment := make([]byte, 20, 20+len(payload))
+	binary.BigEndian.PutUint16(segment[0:], uint16(srcPort))
+	binary.BigEndian.PutUint16(segment[2:], uint16(dstPort))
+	binary.BigEndian.PutUint32(segment[4:], *seq)
+	if flags&flagACK != 0 {
+		binary.BigEndian.PutUint32(segment[8:], ack)
+	}
+	// Header length of 5 words
+	segment[12] = 5 << 4
+	segment[13] = flags
+	binary.BigEndian.PutUint16(segment[14:], 0xffff)
+	segment = append(segment, payload...)
+
+	// SYN and FIN count as one byte
+	*seq += uint32(len(payload))
+	if flags&(flagSYN|flagFIN) != 0 {
+		*seq++
+	}
+
+	return buildFrame(srcIP, dstIP, fromClient, protocolTCP, segment)
+}
+
+// Frames of the three-way handshake
+func (s *TCPStream) Open() [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return [][]byte{
+		s.segment(true, flagSYN, nil),
+		s.segment(false, flagSYN|flagACK, nil),
+		s.segment(true, flagACK, nil),
+	}
+}
+
+// Frames with the payload sent by one of the sides, split in segments
+func (s *TCPStream) Data(fromClient bool, payload []byte) (frames [][]byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for len(payload) > 0 {
+		n := len(payload)
+		if n > maxSegmentSize {
+			n = maxSegmentSize
+		}
+
+		frames = append(frames, s.segment(fromClient, flagPSH|flagACK, payload[:n]))
+		payload = payload[n:]
+	}
+	return
+}
+
+// Frames of the termination of the connection, started by one of the sides
+func (s *TCPStream) Close(fromClient bool) [][]byte {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return [][]byte{
+		s.segment(fromClient, flagFIN|flagACK, nil),
+		s.segment(!fromClient, flagFIN|flagACK, nil),
+		s.segment(fromClient, flagACK, nil),
+	}
+}
+
+// Create a stream between the client and the proxy with random initial sequence numbers
+func NewTCPStream(client, proxy net.Addr) *TCPStream {
+	s := &TCPStream{
+		clientSeq: rand.Uint32(),
+		proxySeq:  rand.Uint32(),
+	}
+
+	s.clientIP, s.clientPort = endpoint(client)
+	s.proxyIP, s.proxyPort = endpoint(proxy)
+	return s
+}
@@ -0,0 +1,104 @@
+/*
+This package writes the traffic relayed by the proxies in pcapng files.
+The proxies only see the payloads exchanged with the clients, so the Ethernet, IP, TCP and UDP
+headers are synthesized from the payloads and the endpoints of the connections.
+*/
+package pcap
+
+import (
+	"io"
+	"time"
+)
+
+// Identifiers and sizes of the pcapng format
+const (
+	sectionHeaderBlock   uint32 = 0x0A0D0D0A
+	interfaceBlock       uint32 = 0x00000001
+	enhancedPacketBlock  uint32 = 0x00000006
+	byteOrderMagic       uint32 = 0x1A2B3C4D
+	linkTypeEthernet     uint16 = 1
+	sectionLengthUnknown uint64 = 0xFFFFFFFFFFFFFFFF
+	pcapngMajorVersion   uint16 = 1
+	pcapngMinorVersion   uint16 = 0
+	enhancedPacketHeader        = 28
+	blockTrailer                = 4
+)
+
+// Append little endian integers to a slice
+func appendUint16(b []byte, v uint16) []byte {
+	return append(b, byte(v), byte(v>>8))
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v), byte(v>>8), byte(v>>16), byte(v>>24))
+}
+
+func appendUint64(b []byte, v uint64) []byte {
+	return appendUint32(appendUint32(b, uint32(v)), uint32(v>>32))
+}
+
+// Writer of a pcapng section with a single Ethernet interface.
+// Timestamps use the default resolution of microseconds
+type Writer struct {
+	w io.Writer
+}
+
+// Write a block with its type, length and body padded to 32 bits
+func (pw *Writer) writeBlock(blockType uint32, body []byte) (n int, err error) {
+	padding := (4 - len(body)%4) % 4
+	length := uint32(8 + len(body) + padding + blockTrailer)
+
+	block := make([]byte, 0, length)
+	block = appendUint32(block, blockType)
+	block = appendUint32(block, length)
+	block = append(block, body...)
+	block = append(block, make([]byte, padding)...)
+	block = appendUint32(block, length)
+
+	return pw.w.Write(block)
+}
+
+// Write an Ethernet frame captured at the given time.
+// Returns the number of bytes written in the file
+func (pw *Writer) WritePacket(ts time.Time, frame []byte) (n int, err error) {
+	micros := uint64(ts.UnixMicro())
+
+	body := make([]byte, 0, enhancedPacketHeader-8+len(frame))
+	// Interface ID
+	body = appendUint32(body, 0)
+	body = appendUint32(body, uint32(micros>>32))
+	body = appendUint32(body, uint32(micros))
+	// Captured and original lengths
+	body = appendUint32(body, uint32(len(frame)))
+	body = appendUint32(body, uint32(len(frame)))
+	body = append(body, frame...)
+
+	return pw.writeBlock(enhancedPacketBlock, body)
+}
+
+// Create a new writer, writing the section header and the interface description.
+// Returns the writer and the number of bytes written
+func NewWriter(w io.Writer) (pw *Writer, n int, err error) {
+	pw = &Writer{w: w}
+
+	shb := make([]byte, 0, 16)
+	shb = appendUint32(shb, byteOrderMagic)
+	shb = appendUint16(shb, pcapngMajorVersion)
+	shb = appendUint16(shb, pcapngMinorVersion)
+	shb = appendUint64(shb, sectionLengthUnknown)
+
+	if n, err = pw.writeBlock(sectionHeaderBlock, shb); err != nil {
+		return
+	}
+
+	idb := make([]byte, 0, 8)
+	idb = appendUint16(idb, linkTypeEthernet)
+	// Reserved
+	idb = appendUint16(idb, 0)
+	// Snapshot length, no limit
+	idb = appendUint32(idb, 0)
+
+	m, err := pw.writeBlock(interfaceBlock, idb)
+	n += m
+	return
+}
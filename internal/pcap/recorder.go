@@ -0,0 +1,191 @@
+package pcap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// Extension of the capture files
+	Extension = ".pcapng"
+)
+
+// Capture file stored in a directory
+type File struct {
+	Name    string
+	Size    int64
+	ModTime time.Time
+}
+
+// Returns the capture files stored in the directory, sorted by name (i.e., creation time)
+func Files(dir string) (files []File, err error) {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return []File{}, nil
+	}
+	if err != nil {
+		return
+	}
+
+	files = []File{}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), Extension) {
+			continue
+		}
+
+		info, err := entry.Info()
+		if err != nil {
+			continue
+		}
+
+		files = append(files, File{
+			Name:    entry.Name(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].Name < files[j].Name
+	})
+	return
+}
+
+// Returns the path to a capture file in the directory.
+// The name can not point outside of the directory
+func FilePath(dir string, name string) (path string, err error) {
+	if name != filepath.Base(name) || !strings.HasSuffix(name, Extension) {
+		err = fmt.Errorf("invalid capture file name")
+		return
+	}
+
+	path = filepath.Join(dir, name)
+	if _, err = os.Stat(path); err != nil {
+		err = fmt.Errorf("capture file not found")
+	}
+	return
+}
+
+// Writes the frames in pcapng files, rotating them by size and age
+type Recorder struct {
+	mu sync.Mutex
+
+	dir string
+	// Rotate the file after reaching the size (bytes) or age. Zero disables the rotation
+	maxSize int64
+	maxAge  time.Duration
+	// Files kept in the directory, pruned every time a file is opened
+	retention *RetentionPolicy
+
+	file   *os.File
+	writer *Writer
+	size   int64
+	opened time.Time
+	closed bool
+}
+
+// Open a new capture file in the directory
+func (r *Recorder) open() (err error) {
+	now := time.Now()
+	name := now.UTC().Format("20060102T150405.000000000") + Extension
+
+	file, err := os.OpenFile(filepath.Join(r.dir, name), os.O_CREATE|os.O_WRONLY|os.O_EXCL, 0640)
+	if err != nil {
+		return
+	}
+
+	writer, n, err := NewWriter(file)
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	r.file = file
+	r.writer = writer
+	r.size = int64(n)
+	r.opened = now
+
+	// The captures are best effort, a file that can not be removed is retried on the next rotation
+	Prune(r.dir, r.retention.GetRetention(), name)
+	return
+}
+
+// Close the current file and open a new one when the limits are reached
+func (r *Recorder) rotate() (err error) {
+	if r.file != nil {
+		full := r.maxSize > 0 && r.size >= r.maxSize
+		old := r.maxAge > 0 && time.Since(r.opened) >= r.maxAge
+		if !full && !old {
+			return
+		}
+
+		r.file.Close()
+		r.file = nil
+	}
+
+	return r.open()
+}
+
+// Write the frames captured at the given time
+func (r *Recorder) Write(ts time.Time, frames ...[]byte) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.closed {
+		return fmt.Errorf("recorder closed")
+	}
+
+	for _, frame := range frames {
+		if err = r.rotate(); err != nil {
+			return
+		}
+
+		n, err := r.writer.WritePacket(ts, frame)
+		r.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+
+	return
+}
+
+func (r *Recorder) GetDir() string {
+	return r.dir
+}
+
+func (r *Recorder) Close() (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.closed = true
+	if r.file != nil {
+		err = r.file.Close()
+		r.file = nil
+	}
+	return
+}
+
+// Create a new recorder storing the capture files in the directory, kept by the global retention
+func NewRecorder(dir string, maxSize int64, maxAge time.Duration) (r *Recorder, err error) {
+	if err = os.MkdirAll(dir, 0750); err != nil {
+		return
+	}
+
+	r = &Recorder{
+		dir:       dir,
+		maxSize:   maxSize,
+		maxAge:    maxAge,
+		retention: GlobalRetention,
+	}
+
+	if err = r.open(); err != nil {
+		r = nil
+	}
+	return
+}
@@ -0,0 +1,101 @@
+package pcap
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+)
+
+var (
+	// Retention of the capture files of every recorder, applied when the files rotate
+	GlobalRetention = NewRetentionPolicy()
+)
+
+// Capture files kept in each directory. Zero disables a limit
+type Retention struct {
+	// Maximum number of files, the oldest ones are removed first
+	MaxFiles int
+	// Time after which the files are removed
+	MaxAge time.Duration
+}
+
+func (r Retention) Validate() (err error) {
+	switch {
+	case r.MaxFiles < 0:
+		err = fmt.Errorf("the maximum number of files can not be negative")
+	case r.MaxAge < 0:
+		err = fmt.Errorf("the retention time can not be negative")
+	}
+	return
+}
+
+// Retention shared by the recorders, which may change while they write
+type RetentionPolicy struct {
+	mu        sync.RWMutex
+	retention Retention
+}
+
+func (p *RetentionPolicy) GetRetention() Retention {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	return p.retention
+}
+
+// Set the retention, applied the next time the files rotate
+func (p *RetentionPolicy) SetRetention(retention Retention) (err error) {
+	if err = retention.Validate(); err != nil {
+		return
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.retention = retention
+	return
+}
+
+func NewRetentionPolicy() *RetentionPolicy {
+	return &RetentionPolicy{}
+}
+
+// Remove the capture files of the directory beyond the retention, except the file in use.
+// The names of the files start with the time they were opened, so the oldest are sorted first
+func Prune(dir string, retention Retention, current string) (err error) {
+	files, err := Files(dir)
+	if err != nil {
+		return
+	}
+
+	kept := []File{}
+	for _, file := range files {
+		if file.Name != current && retention.MaxAge > 0 && time.Since(file.ModTime) > retention.MaxAge {
+			if e := os.Remove(filepath.Join(dir, file.Name)); e != nil && err == nil {
+				err = e
+			}
+			continue
+		}
+		kept = append(kept, file)
+	}
+
+	if retention.MaxFiles <= 0 {
+		return
+	}
+
+	excess := len(kept) - retention.MaxFiles
+	for _, file := range kept {
+		if excess <= 0 {
+			break
+		}
+		if file.Name == current {
+			continue
+		}
+		if e := os.Remove(filepath.Join(dir, file.Name)); e != nil && err == nil {
+			err = e
+		}
+		excess--
+	}
+	return
+}
@@ -4,7 +4,11 @@ import (
 	"crypto/rand"
 	"crypto/rsa"
 	"crypto/x509"
+	"crypto/x509/pkix"
 	"encoding/pem"
+	"math/big"
+	"net"
+	"time"
 
 	"github.com/riotpot/internal/logger"
 )
@@ -59,6 +63,10 @@ func (k *PrivateKey) SetKey(key *rsa.PrivateKey) {
 	k.priv = key
 }
 
+func (k *PrivateKey) GetKey() *rsa.PrivateKey {
+	return k.priv
+}
+
 // Function to Generate and store a private RSA key and PEM
 func (k *PrivateKey) Generate(size KeySize) (cert []byte) {
 	reader := rand.Reader
@@ -89,3 +97,42 @@ func NewPrivateKey(size KeySize) *PrivateKey {
 	k.Generate(size)
 	return k
 }
+
+// Generate a self-signed certificate for the key, valid for the hosts (names or IPs) given.
+// Returns the certificate in PEM format
+func NewSelfSignedCertificate(key *PrivateKey, hosts []string, validity time.Duration) (cert []byte, err error) {
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return
+	}
+
+	now := time.Now()
+	template := &x509.Certificate{
+		SerialNumber: serial,
+		Subject: pkix.Name{
+			Organization: []string{"RIoTPot"},
+			CommonName:   "riotpot",
+		},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(validity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+	}
+
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else if host != "" {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.GetKey().PublicKey, key.GetKey())
+	if err != nil {
+		return
+	}
+
+	cert = pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	return
+}
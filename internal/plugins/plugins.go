@@ -88,7 +88,8 @@ func LoadPlugins() (errors []error) {
 	for _, service := range plugins {
 		px, err := proxy.Proxies.CreateProxy(service.GetNetwork(), service.GetPort()-pluginOffset)
 		if err != nil {
-			logger.Log.Error().Err(err)
+			logger.Log.Error().Err(err).Str("service", service.GetName()).Msg("Could not create the proxy of the plugin")
+			continue
 		}
 
 		// Add the service to the proxy
@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	lr "github.com/riotpot/internal/logger"
+)
+
+var (
+	// Access list shared by all the proxies, applied before the access list of each proxy
+	GlobalAccess = NewAccessList()
+)
+
+// Actions applied to the connections of the denied sources
+const (
+	// Close the connection as soon as it is accepted
+	DropAccess = "drop"
+	// Keep the connection open without answering until the tarpit delay, then close it.
+	// The datagrams of the UDP clients are dropped
+	TarpitAccess = "tarpit"
+)
+
+const (
+	// Time the tarpitted connections are kept open when the rules do not set it
+	defaultTarpitDelay = time.Minute
+	// Maximum number of connections held in the tarpits at the same time.
+	// The connections beyond it are dropped, so the tarpits can not exhaust the descriptors
+	maxTarpitted = 1024
+)
+
+var (
+	// Connections held in the tarpits of every proxy
+	tarpitted int64
+)
+
+// Rules of an access list. The allowed networks take precedence over the denied ones,
+// so parts of a denied network can be let through
+type AccessRules struct {
+	Allow []*net.IPNet
+	Deny  []*net.IPNet
+	// Action applied to the denied sources, drop by default
+	Action string
+	// Time the tarpitted connections are kept open
+	TarpitDelay time.Duration
+}
+
+func (r AccessRules) Validate() (err error) {
+	switch {
+	case r.Action != "" && r.Action != DropAccess && r.Action != TarpitAccess:
+		err = fmt.Errorf("unknown access action: %s", r.Action)
+	case r.TarpitDelay < 0:
+		err = fmt.Errorf("the tarpit delay can not be negative")
+	}
+	return
+}
+
+// Returns whether the IP is in any of the networks
+func containsIP(networks []*net.IPNet, ip net.IP) bool {
+	for _, network := range networks {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// List of the sources allowed and denied to reach the services
+type AccessList struct {
+	mu    sync.RWMutex
+	rules AccessRules
+}
+
+func (al *AccessList) GetAccess() AccessRules {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+
+	return al.rules
+}
+
+// Set the rules, applied to the connections accepted from now on
+func (al *AccessList) SetAccess(rules AccessRules) (err error) {
+	if err = rules.Validate(); err != nil {
+		return
+	}
+
+	if rules.Action == "" {
+		rules.Action = DropAccess
+	}
+	if rules.Action == TarpitAccess && rules.TarpitDelay == 0 {
+		rules.TarpitDelay = defaultTarpitDelay
+	}
+
+	al.mu.Lock()
+	defer al.mu.Unlock()
+
+	al.rules = rules
+	return
+}
+
+// Check the IP against the rules. Returns the action applied when the IP is denied
+func (al *AccessList) Check(ip net.IP) (action string, denied bool) {
+	al.mu.RLock()
+	defer al.mu.RUnlock()
+
+	if ip == nil || containsIP(al.rules.Allow, ip) || !containsIP(al.rules.Deny, ip) {
+		return
+	}
+
+	action = al.rules.Action
+	if action == "" {
+		action = DropAccess
+	}
+	return action, true
+}
+
+func NewAccessList() *AccessList {
+	return &AccessList{
+		rules: AccessRules{Action: DropAccess},
+	}
+}
+
+// Returns the rules of the access list of the proxy
+func (pe *AbstractProxy) GetAccess() AccessRules {
+	return pe.access.GetAccess()
+}
+
+// Set the rules of the access list of the proxy, applied after the global access list
+func (pe *AbstractProxy) SetAccess(rules AccessRules) (err error) {
+	if err = pe.access.SetAccess(rules); err != nil {
+		return
+	}
+
+	pe.notify(events.UpdatedChange)
+	return
+}
+
+// Check the client against the global access list and the access list of the proxy.
+// Returns the action and the tarpit delay of the list denying the client, if any
+func (pe *AbstractProxy) checkAccess(client net.Addr) (action string, delay time.Duration, denied bool) {
+	ip := addrIP(client)
+
+	list := GlobalAccess
+	if action, denied = list.Check(ip); !denied {
+		list = pe.access
+		if action, denied = list.Check(ip); !denied {
+			return
+		}
+	}
+
+	countDenied(pe, action)
+	lr.Log.Debug().Str("proxy", pe.GetID()).Str("client", client.String()).Str("action", action).Msg("Connection denied by the access list")
+
+	return action, list.GetAccess().TarpitDelay, true
+}
+
+// Keep the connection open without reading from it until the delay passes or the proxy stops.
+// The connection is dropped right away when the tarpits are full
+func tarpit(conn net.Conn, delay time.Duration, stop chan struct{}) {
+	defer conn.Close()
+
+	if atomic.AddInt64(&tarpitted, 1) > maxTarpitted {
+		atomic.AddInt64(&tarpitted, -1)
+		return
+	}
+	defer atomic.AddInt64(&tarpitted, -1)
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+
+	select {
+	case <-timer.C:
+	case <-stop:
+	}
+}
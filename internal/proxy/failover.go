@@ -0,0 +1,90 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	lr "github.com/riotpot/internal/logger"
+	"github.com/riotpot/internal/services"
+)
+
+// Returns the chain of services dialed, in order, when the service of the proxy can not be reached
+func (pe *AbstractProxy) GetFailover() []services.Service {
+	pe.mu.RLock()
+	defer pe.mu.RUnlock()
+
+	return append([]services.Service{}, pe.failover...)
+}
+
+// Set the chain of services dialed when the service of the proxy can not be reached.
+// The services must use the network of the proxy, and appear only once
+func (pe *AbstractProxy) SetFailover(chain []services.Service) (err error) {
+	seen := make(map[string]bool)
+	for _, service := range chain {
+		if service == nil {
+			return fmt.Errorf("service not found")
+		}
+
+		if service.GetNetwork() != pe.GetNetwork() {
+			return fmt.Errorf("service %s does not use the network of the proxy", service.GetName())
+		}
+
+		if seen[service.GetID()] {
+			return fmt.Errorf("service %s is repeated", service.GetName())
+		}
+		seen[service.GetID()] = true
+	}
+
+	pe.mu.Lock()
+	pe.failover = append([]services.Service{}, chain...)
+	pe.mu.Unlock()
+
+	pe.notify(events.UpdatedChange)
+	return
+}
+
+// Dial the service of the flow and, if it fails, the services of the failover chain in order.
+// Every attempt is recorded in the session, and the flow is pointed to the service that answered
+func (pe *AbstractProxy) dialChain(flow *Flow) (server net.Conn) {
+	candidates := append([]services.Service{flow.Service}, pe.GetFailover()...)
+
+	tried := make(map[string]bool)
+	for _, service := range candidates {
+		if tried[service.GetID()] {
+			continue
+		}
+		tried[service.GetID()] = true
+
+		if server = pe.dialAttempt(flow, service); server != nil {
+			if service.GetID() != flow.Service.GetID() {
+				lr.Log.Info().Str("proxy", pe.GetID()).Str("service", service.GetName()).Msg("Session relayed to a failover service")
+			}
+
+			flow.Service = service
+			return
+		}
+	}
+
+	return
+}
+
+// Dial a service, recording the attempt in the session of the flow
+func (pe *AbstractProxy) dialAttempt(flow *Flow, service services.Service) (server net.Conn) {
+	attempt := Attempt{
+		ServiceID: service.GetID(),
+		Service:   service.GetName(),
+		Time:      time.Now(),
+	}
+
+	server, err := dialHealthy(pe.GetNetwork(), service)
+	attempt.Duration = time.Since(attempt.Time)
+	if err != nil {
+		attempt.Error = err.Error()
+		flow.metrics.dialFailed(service.GetName())
+	}
+
+	flow.Session.AddAttempt(attempt)
+	return
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+	lr "github.com/riotpot/internal/logger"
+	"github.com/riotpot/internal/services"
+)
+
+type DownAction string
+
+// Actions of a proxy when its service is down
+const (
+	// Close the connection, the default
+	RejectAction DownAction = "reject"
+	// Relay the connection to another service
+	FallbackAction DownAction = "fallback"
+	// Send a canned banner to the client and close the connection
+	BannerAction DownAction = "banner"
+)
+
+func ParseDownAction(action string) (a DownAction, err error) {
+	switch DownAction(action) {
+	case RejectAction, FallbackAction, BannerAction:
+		a = DownAction(action)
+	case "":
+		a = RejectAction
+	default:
+		err = fmt.Errorf("invalid action: %s", action)
+	}
+	return
+}
+
+// Behaviour of a proxy when its service is down, i.e. the health checks
+// found it down or it could not be reached
+type DownPolicy struct {
+	Action DownAction
+	// ID of the service used by the fallback action
+	Fallback string
+	// Banner sent by the banner action
+	Banner string
+}
+
+// Validate the policy of a proxy using the network, the fallback service must be registered
+// and use the same network
+func (dp DownPolicy) Validate(network globals.Network) (err error) {
+	if _, err = ParseDownAction(string(dp.Action)); err != nil {
+		return
+	}
+
+	if dp.Action != FallbackAction {
+		return
+	}
+
+	service, err := services.Services.GetService(dp.Fallback)
+	if err != nil {
+		return
+	}
+
+	if service.GetNetwork() != network {
+		err = fmt.Errorf("service %s does not use the network of the proxy", service.GetName())
+	}
+	return
+}
+
+// Returns the policy applied when the service is down
+func (pe *AbstractProxy) GetDownPolicy() DownPolicy {
+	pe.mu.RLock()
+	defer pe.mu.RUnlock()
+
+	return pe.downPolicy
+}
+
+// Set the policy applied when the service is down
+func (pe *AbstractProxy) SetDownPolicy(policy DownPolicy) (err error) {
+	if policy.Action == "" {
+		policy.Action = RejectAction
+	}
+
+	if err = policy.Validate(pe.GetNetwork()); err != nil {
+		return
+	}
+
+	pe.mu.Lock()
+	pe.downPolicy = policy
+	pe.mu.Unlock()
+
+	pe.notify(events.UpdatedChange)
+	return
+}
+
+// Connect to the service of the flow or, if it can not be reached, to its failover chain.
+// When none of them answers, the down policy of the proxy is applied: the flow is relayed
+// to the fallback service, or the banner is sent to the client.
+// Returns nil when the flow must be closed
+func (pe *AbstractProxy) dialService(flow *Flow) (server net.Conn, reason string) {
+	if server = pe.dialChain(flow); server != nil {
+		return
+	}
+	reason = DialFailedReason
+
+	policy := pe.GetDownPolicy()
+	switch policy.Action {
+	case FallbackAction:
+		fallback, err := services.Services.GetService(policy.Fallback)
+		if err != nil || fallback.GetID() == flow.Service.GetID() {
+			break
+		}
+
+		if server = pe.dialAttempt(flow, fallback); server != nil {
+			flow.Service = fallback
+		}
+	case BannerAction:
+		if _, err := flow.Conn.Write([]byte(policy.Banner)); err != nil {
+			lr.Log.Warn().Err(err).Str("proxy", pe.GetID()).Msg("Could not send the banner")
+		}
+		reason = BannerReason
+	}
+
+	return
+}
+
+// Connect to a service, failing right away if the health checks found it down
+func dialHealthy(network globals.Network, service services.Service) (conn net.Conn, err error) {
+	if services.HealthChecks.IsDown(service.GetID()) {
+		err = fmt.Errorf("service down")
+		return
+	}
+
+	return net.DialTimeout(network.String(), service.GetAddress(), 1*time.Second)
+}
@@ -0,0 +1,323 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	lr "github.com/riotpot/internal/logger"
+)
+
+var (
+	// Limits shared by all the proxies, applied along the limits of each proxy
+	GlobalLimiter = NewLimiter()
+)
+
+// Limits exceeded by the connections, used to label the rejections
+const (
+	// Too many sessions open at the same time
+	SessionsLimit = "sessions"
+	// Too many connections of the same source within the window
+	RateLimit = "rate"
+	// Session open for too long
+	DurationLimit = "duration"
+	// Too many bytes relayed in a session
+	BytesLimit = "bytes"
+)
+
+// Limits of the connections relayed. Zero disables each limit
+type Limits struct {
+	// Maximum number of sessions open at the same time
+	MaxSessions int
+	// Maximum number of connections of a source IP within the window
+	MaxPerSource int
+	Window       time.Duration
+	// Maximum duration of a session and bytes relayed in both directions
+	MaxDuration time.Duration
+	MaxBytes    int64
+}
+
+func (l Limits) Validate() (err error) {
+	switch {
+	case l.MaxSessions < 0, l.MaxPerSource < 0, l.Window < 0, l.MaxDuration < 0, l.MaxBytes < 0:
+		err = fmt.Errorf("the limits can not be negative")
+	case l.MaxPerSource > 0 && l.Window == 0:
+		err = fmt.Errorf("the window of the connections per source is required")
+	}
+	return
+}
+
+// Connections of a source within the window
+type sourceWindow struct {
+	times []time.Time
+	// Whether the rejection of the source was logged
+	reported bool
+}
+
+// Limiter of the sessions open and the connections per source.
+// The connections must be admitted before dialing the service
+type Limiter struct {
+	mu     sync.Mutex
+	limits Limits
+
+	// Sessions admitted and not released yet
+	active int
+	// Whether the sessions reached the maximum since the last rejection was logged
+	capped bool
+
+	sources   map[string]*sourceWindow
+	lastPrune time.Time
+}
+
+func (l *Limiter) GetLimits() Limits {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.limits
+}
+
+// Set the limits. The sessions already open are not affected, but the connections
+// counted per source are forgotten when their limit changes
+func (l *Limiter) SetLimits(limits Limits) (err error) {
+	if err = limits.Validate(); err != nil {
+		return
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if limits.MaxPerSource != l.limits.MaxPerSource || limits.Window != l.limits.Window {
+		l.sources = make(map[string]*sourceWindow)
+	}
+	l.limits = limits
+	return
+}
+
+// Returns the number of sessions admitted and not released yet
+func (l *Limiter) GetActive() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	return l.active
+}
+
+// Remove the connections of the sources older than the window
+func (l *Limiter) prune(now time.Time) {
+	window := l.limits.Window
+
+	for ip, source := range l.sources {
+		i := 0
+		for i < len(source.times) && now.Sub(source.times[i]) >= window {
+			i++
+		}
+		source.times = source.times[i:]
+
+		if len(source.times) == 0 {
+			delete(l.sources, ip)
+		}
+	}
+	l.lastPrune = now
+}
+
+// Admit a connection of the source IP. Returns the function releasing the session,
+// or the limit exceeded and whether the rejection must be reported, i.e. it is the
+// first one since the limit was reached
+func (l *Limiter) Admit(ip string) (release func(), limit string, report bool) {
+	release, _, limit, report = l.admit(ip)
+	return
+}
+
+// Admit a connection of the source IP. Besides the function releasing the session, returns the
+// function rolling the admission back when a later limiter rejects the connection: the session
+// is released and the connection is no longer counted in the window of the source
+func (l *Limiter) admit(ip string) (release func(), rollback func(), limit string, report bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.limits.MaxSessions > 0 && l.active >= l.limits.MaxSessions {
+		report, l.capped = !l.capped, true
+		return nil, nil, SessionsLimit, report
+	}
+
+	var (
+		now     time.Time
+		counted bool
+	)
+	if l.limits.MaxPerSource > 0 {
+		now = time.Now()
+		if now.Sub(l.lastPrune) >= l.limits.Window {
+			l.prune(now)
+		}
+
+		source, ok := l.sources[ip]
+		if !ok {
+			source = &sourceWindow{}
+			l.sources[ip] = source
+		}
+
+		// Forget the connections out of the window
+		i := 0
+		for i < len(source.times) && now.Sub(source.times[i]) >= l.limits.Window {
+			i++
+		}
+		source.times = source.times[i:]
+		if len(source.times) == 0 {
+			source.reported = false
+		}
+
+		if len(source.times) >= l.limits.MaxPerSource {
+			report, source.reported = !source.reported, true
+			return nil, nil, RateLimit, report
+		}
+		source.times = append(source.times, now)
+		counted = true
+	}
+
+	l.active++
+
+	var once sync.Once
+	release = func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.free()
+		})
+	}
+	rollback = func() {
+		once.Do(func() {
+			l.mu.Lock()
+			defer l.mu.Unlock()
+
+			l.free()
+			if counted {
+				l.forget(ip, now)
+			}
+		})
+	}
+	return
+}
+
+// Release a session. The mutex must be held
+func (l *Limiter) free() {
+	l.active--
+	if l.limits.MaxSessions == 0 || l.active < l.limits.MaxSessions {
+		l.capped = false
+	}
+}
+
+// Remove a connection from the window of the source, unless the window was reset meanwhile.
+// The mutex must be held
+func (l *Limiter) forget(ip string, at time.Time) {
+	source, ok := l.sources[ip]
+	if !ok {
+		return
+	}
+
+	for i := len(source.times) - 1; i >= 0; i-- {
+		if source.times[i].Equal(at) {
+			source.times = append(source.times[:i], source.times[i+1:]...)
+			break
+		}
+	}
+	if len(source.times) == 0 {
+		delete(l.sources, ip)
+	}
+}
+
+func NewLimiter() *Limiter {
+	return &Limiter{
+		sources: make(map[string]*sourceWindow),
+	}
+}
+
+// Returns the limits of the proxy
+func (pe *AbstractProxy) GetLimits() Limits {
+	return pe.limiter.GetLimits()
+}
+
+// Set the limits of the proxy, applied along the global limits
+func (pe *AbstractProxy) SetLimits(limits Limits) (err error) {
+	if err = pe.limiter.SetLimits(limits); err != nil {
+		return
+	}
+
+	pe.notify(events.UpdatedChange)
+	return
+}
+
+// Admit a connection of the client in the global limits and the limits of the proxy.
+// The rejections are counted, and logged once each time a limit is reached
+func (pe *AbstractProxy) admit(client net.Addr) (release func(), ok bool) {
+	ip := client.String()
+	if host, _, err := net.SplitHostPort(ip); err == nil {
+		ip = host
+	}
+
+	releaseGlobal, rollbackGlobal, limit, report := GlobalLimiter.admit(ip)
+	if releaseGlobal != nil {
+		var releaseProxy func()
+		if releaseProxy, limit, report = pe.limiter.Admit(ip); releaseProxy != nil {
+			return func() {
+				releaseProxy()
+				releaseGlobal()
+			}, true
+		}
+		// The connection rejected by the proxy does not count in the global limits of the source
+		rollbackGlobal()
+	}
+
+	countLimited(pe, limit)
+	if report {
+		lr.Log.Warn().Str("proxy", pe.GetID()).Str("client", ip).Str("limit", limit).Msg("Connections rejected by the limits of the proxy")
+	}
+	return
+}
+
+// Returns the lowest of the limits, ignoring the disabled (zero) ones
+func lowest(a int64, b int64) int64 {
+	if a == 0 || (b != 0 && b < a) {
+		return b
+	}
+	return a
+}
+
+// Close the session once it is open for longer than the maximum duration, or relays more
+// bytes than the maximum. Returns the observer counting the bytes relayed, nil when the
+// bytes are not limited, and the function to call once the session is closed
+func (pe *AbstractProxy) limitSession(flow *Flow, server net.Conn) (observer func(p []byte), done func()) {
+	proxyLimits, globalLimits := pe.GetLimits(), GlobalLimiter.GetLimits()
+	maxDuration := time.Duration(lowest(int64(proxyLimits.MaxDuration), int64(globalLimits.MaxDuration)))
+	maxBytes := lowest(proxyLimits.MaxBytes, globalLimits.MaxBytes)
+
+	var once sync.Once
+	exceeded := func(limit string, reason string) {
+		once.Do(func() {
+			flow.Session.SetCloseReason(reason)
+			flow.Conn.Close()
+			server.Close()
+
+			countLimited(pe, limit)
+			lr.Log.Info().Str("proxy", pe.GetID()).Str("session", flow.Session.GetID()).Str("limit", limit).Msg("Session closed by the limits of the proxy")
+		})
+	}
+
+	done = func() {}
+	if maxDuration > 0 {
+		timer := time.AfterFunc(maxDuration, func() { exceeded(DurationLimit, DurationLimitReason) })
+		done = func() { timer.Stop() }
+	}
+
+	if maxBytes > 0 {
+		var relayed int64
+		observer = func(p []byte) {
+			if atomic.AddInt64(&relayed, int64(len(p))) > maxBytes {
+				exceeded(BytesLimit, BytesLimitReason)
+			}
+		}
+	}
+	return
+}
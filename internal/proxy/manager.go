@@ -5,7 +5,10 @@ package proxy
 
 import (
 	"fmt"
+	"sync"
+	"time"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	"github.com/riotpot/internal/services"
 )
@@ -15,12 +18,63 @@ var (
 	Proxies = NewProxyManager()
 )
 
+func init() {
+	// Keep the services referenced by the proxies from being deleted
+	services.Services.AddReferences(serviceReferences)
+}
+
+// Returns the references of the registered proxies to a service: failover chains, routing rules,
+// sniffer targets, fallback services and the service served by the proxy. The proxy being deleted,
+// which deletes its own service, does not keep it
+func serviceReferences(id string) (references []string) {
+	for _, pe := range Proxies.GetProxies() {
+		if Proxies.isDeleting(pe.GetID()) {
+			continue
+		}
+
+		name := fmt.Sprintf("proxy %d/%s", pe.GetPort(), pe.GetNetwork())
+
+		if service := pe.GetService(); service != nil && service.GetID() == id {
+			references = append(references, name+" (service)")
+		}
+
+		for _, service := range pe.GetFailover() {
+			if service.GetID() == id {
+				references = append(references, name+" (failover)")
+			}
+		}
+
+		if router, _ := LookupRouter(pe); router != nil {
+			for _, rule := range router.GetRules() {
+				if rule.Service != nil && rule.Service.GetID() == id {
+					references = append(references, fmt.Sprintf("%s (routing rule %s)", name, rule.Name))
+				}
+			}
+		}
+
+		if sniffer, _ := LookupSniffer(pe); sniffer != nil {
+			for _, protocol := range sniffer.GetProtocols() {
+				if service, ok := sniffer.GetService(protocol); ok && service.GetID() == id {
+					references = append(references, fmt.Sprintf("%s (sniffer %s)", name, protocol))
+				}
+			}
+		}
+
+		if policy := pe.GetDownPolicy(); policy.Action == FallbackAction && policy.Fallback == id {
+			references = append(references, name+" (fallback)")
+		}
+	}
+	return
+}
+
 // Interface for the proxy manager
 type ProxyManager interface {
 	// Get all the proxies registered
 	GetProxies() []Proxy
 	// Create a new proxy and add it to the manager
-	CreateProxy(protocol string, port int) (Proxy, error)
+	CreateProxy(network globals.Network, port int) (Proxy, error)
+	// Register a proxy created elsewhere
+	AddProxy(pe Proxy) (Proxy, error)
 
 	// Methods for proxies the using ID field
 	GetProxy(id string) (Proxy, error)
@@ -28,125 +82,214 @@ type ProxyManager interface {
 	DeleteProxy(id string) error
 
 	// Wrapper method to find a proxy using the port and protocol
-	GetProxyFromParams(network string, port int)
+	GetProxyFromParams(network globals.Network, port int) (Proxy, error)
 
 	// Set the service for a proxy
 	SetService(port int, service services.Service) (pe Proxy, err error)
+
+	// Stop every running proxy, draining their sessions for up to the timeout
+	Shutdown(timeout time.Duration) []error
 }
 
-// Simple implementation of the proxy manager
-// This manager has access to the proxy endpoints registered. However, it does not observe newly
-//
+// Simple implementation of the proxy manager.
+// The proxies are kept in a registry by their ID, and every change is notified
 type ProxyManagerItem struct {
 	ProxyManager
 
-	// List of proxy endpoints registered in the manager
-	proxies []Proxy
+	mu sync.RWMutex
+	// Proxy endpoints registered in the manager by their ID
+	proxies map[string]Proxy
+	// IDs of the proxies, in the order in which they were registered
+	order []string
+	// IDs of the proxies whose service is being deleted along with them
+	deleting map[string]bool
 
 	// Instance of the middleware manager
 	middlewares *MiddlewareManagerItem
+	// Notifier of the changes of the proxies
+	changes events.Notifier
+}
+
+// Notify a change of a proxy
+func (pm *ProxyManagerItem) notify(kind events.ChangeKind, id string) {
+	pm.changes.Notify(events.NewChange(kind, events.ProxyResource, id))
+}
+
+// Returns the proxy using the port and network. Must be called with the lock held
+func (pm *ProxyManagerItem) find(network globals.Network, port int) Proxy {
+	for _, proxy := range pm.proxies {
+		if proxy.GetPort() == port && proxy.GetNetwork() == network {
+			return proxy
+		}
+	}
+	return nil
 }
 
 // Create a new proxy and add it to the manager
 func (pm *ProxyManagerItem) CreateProxy(network globals.Network, port int) (pe Proxy, err error) {
+	// Create the proxy
+	pe, err = NewProxyEndpoint(port, network)
+	if err != nil {
+		return
+	}
 
-	// Check if there is another proxy with the same port
-	if proxy, _ := pm.GetProxyFromParams(network, port); proxy != nil {
+	return pm.AddProxy(pe)
+}
+
+// Register a proxy if its ID, port and network are not taken
+func (pm *ProxyManagerItem) AddProxy(px Proxy) (pe Proxy, err error) {
+	pm.mu.Lock()
+
+	if _, ok := pm.proxies[px.GetID()]; ok {
+		pm.mu.Unlock()
 		err = fmt.Errorf("proxy already registered")
 		return
 	}
 
-	// Create the proxy
-	pe, err = NewProxyEndpoint(port, network)
-	if err != nil {
+	// Check if there is another proxy with the same port
+	if pm.find(px.GetNetwork(), px.GetPort()) != nil {
+		pm.mu.Unlock()
+		err = fmt.Errorf("proxy already registered")
 		return
 	}
 
-	// Append the proxy to the list
-	pm.proxies = append(pm.proxies, pe)
+	if n, ok := px.(notifiable); ok {
+		n.setNotifier(pm.changes)
+	}
+
+	pm.proxies[px.GetID()] = px
+	pm.order = append(pm.order, px.GetID())
+	pm.mu.Unlock()
+
+	pm.notify(events.CreatedChange, px.GetID())
+	pe = px
 	return
 }
 
 func (pm *ProxyManagerItem) GetProxy(id string) (pe Proxy, err error) {
-	// Get all the proxies registered
-	proxies := pm.GetProxies()
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 
-	for _, proxy := range proxies {
-		if proxy.GetID() == id {
-			pe = proxy
-			return
-		}
+	pe, ok := pm.proxies[id]
+	if !ok {
+		err = fmt.Errorf("proxy not found")
 	}
-
-	err = fmt.Errorf("proxy not found")
 	return
 }
 
+// Replace the proxy registered with the same ID
 func (pm *ProxyManagerItem) SetProxy(px Proxy) (pe Proxy, err error) {
-	// Get all the proxies registered
-	proxies := pm.GetProxies()
+	pm.mu.Lock()
 
-	for ind, proxy := range proxies {
-		if proxy.GetID() == px.GetID() {
-			// Replace the index of the proxy with the new one
-			proxies[ind] = px
-			pm.proxies = proxies
-			return
-		}
+	if _, ok := pm.proxies[px.GetID()]; !ok {
+		pm.mu.Unlock()
+		err = fmt.Errorf("proxy not found")
+		return
 	}
 
-	err = fmt.Errorf("proxy not found")
+	if n, ok := px.(notifiable); ok {
+		n.setNotifier(pm.changes)
+	}
+
+	pm.proxies[px.GetID()] = px
+	pm.mu.Unlock()
+
+	pm.notify(events.UpdatedChange, px.GetID())
+	pe = px
 	return
 }
 
 // Delete a proxy from teh registered list using the ID
 func (pm *ProxyManagerItem) DeleteProxy(id string) (err error) {
-	// Get all the proxies registered
-	proxies := pm.GetProxies()
-
-	for ind, proxy := range proxies {
-		if proxy.GetID() == id {
-			// Attempt to remove the service and the proxy if the service is not locked
-			service := proxy.GetService()
-			if service != nil {
-				// Delete the service or return the error.
-				// An error may occur if the service could not be found or is locked!
-				err = services.Services.DeleteService(service.GetID())
-				if err != nil {
-					return
-				}
-			}
-
-			// Stop the proxy, just in case
-			proxy.Stop()
-			// Remove it from the slice by replacing it with the last item from the slice,
-			// and reducing the slice by 1 element
-			lastInd := len(proxies) - 1
+	proxy, err := pm.GetProxy(id)
+	if err != nil {
+		return
+	}
 
-			proxies[ind] = proxies[lastInd]
-			pm.proxies = proxies[:lastInd]
+	// Attempt to remove the service and the proxy if the service is not locked
+	service := proxy.GetService()
+	if service != nil {
+		// The proxy does not keep its own service while it is being deleted
+		pm.setDeleting(id, true)
+		defer pm.setDeleting(id, false)
+
+		// Delete the service or return the error.
+		// An error may occur if the service could not be found, is locked or is referenced
+		// by another proxy!
+		err = services.Services.DeleteService(service.GetID())
+		if err != nil {
 			return
 		}
 	}
+
+	pm.mu.Lock()
+	if _, ok := pm.proxies[id]; !ok {
+		pm.mu.Unlock()
+		err = fmt.Errorf("proxy not found")
+		return
+	}
+
+	delete(pm.proxies, id)
+	for ind, pid := range pm.order {
+		if pid == id {
+			pm.order = append(pm.order[:ind], pm.order[ind+1:]...)
+			break
+		}
+	}
+	pm.mu.Unlock()
+
+	// Stop the proxy, just in case
+	proxy.Stop()
+	// Close the pcapng file, the files written are kept
+	proxy.SetPcap(false)
+	// Remove the metrics of the proxy
+	forgetMetrics(id)
+
+	pm.notify(events.DeletedChange, id)
 	return
 }
 
-func (pm *ProxyManagerItem) GetProxies() []Proxy {
-	return pm.proxies
+// Mark or unmark a proxy as being deleted
+func (pm *ProxyManagerItem) setDeleting(id string, deleting bool) {
+	pm.mu.Lock()
+	defer pm.mu.Unlock()
+
+	if deleting {
+		pm.deleting[id] = true
+	} else {
+		delete(pm.deleting, id)
+	}
+}
+
+// Whether the proxy is being deleted
+func (pm *ProxyManagerItem) isDeleting(id string) bool {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	return pm.deleting[id]
+}
+
+// Returns the proxies registered, in the order in which they were registered
+func (pm *ProxyManagerItem) GetProxies() (proxies []Proxy) {
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
+
+	proxies = make([]Proxy, 0, len(pm.order))
+	for _, id := range pm.order {
+		proxies = append(proxies, pm.proxies[id])
+	}
+	return
 }
 
 // Returns a proxy by the port number
 func (pm *ProxyManagerItem) GetProxyFromParams(network globals.Network, port int) (pe Proxy, err error) {
-	// Iterate the proxies registered, and if the proxy using the given port is found, return it
-	for _, proxy := range pm.proxies {
-		if proxy.GetPort() == port && proxy.GetNetwork() == network {
-			pe = proxy
-			return
-		}
-	}
+	pm.mu.RLock()
+	defer pm.mu.RUnlock()
 
 	// If the proxy was not foun, send an error
-	err = fmt.Errorf("proxy not found")
+	if pe = pm.find(network, port); pe == nil {
+		err = fmt.Errorf("proxy not found")
+	}
 	return
 }
 
@@ -168,6 +311,9 @@ func (pm *ProxyManagerItem) SetService(port int, service services.Service) (pe P
 func NewProxyManager() *ProxyManagerItem {
 	return &ProxyManagerItem{
 		middlewares: Middlewares,
-		proxies:     make([]Proxy, 0),
+		proxies:     make(map[string]Proxy),
+		order:       make([]string, 0),
+		deleting:    make(map[string]bool),
+		changes:     events.Changes,
 	}
 }
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/metrics"
+)
+
+// Metrics of the proxies, labelled by the ID, network and port of the proxy
+var (
+	activeConnections = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "riotpot_proxy_connections_active",
+		Help: "Number of connections being relayed by the proxy",
+	}, []string{"proxy", "network", "port"})
+	totalConnections = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "riotpot_proxy_connections_total",
+		Help: "Number of connections accepted by the proxy",
+	}, []string{"proxy", "network", "port"})
+	relayedBytes = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "riotpot_proxy_bytes_total",
+		Help: "Number of bytes relayed by the proxy, received from (in) and sent to (out) the clients",
+	}, []string{"proxy", "network", "port", "direction"})
+	dialFailures = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "riotpot_proxy_dial_failures_total",
+		Help: "Number of times the proxy could not reach the service",
+	}, []string{"proxy", "network", "port", "service"})
+	limitedConnections = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "riotpot_proxy_limited_total",
+		Help: "Number of connections rejected or sessions closed by the limits of the proxy",
+	}, []string{"proxy", "network", "port", "limit"})
+	deniedConnections = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "riotpot_proxy_denied_total",
+		Help: "Number of connections denied by the access lists, dropped or tarpitted",
+	}, []string{"proxy", "network", "port", "action"})
+
+	// Status of the proxies, collected from the manager
+	proxyUp = prometheus.NewDesc("riotpot_proxy_up",
+		"Whether the proxy is running (1) or not (0)", []string{"proxy", "network", "port", "service"}, nil)
+)
+
+// Metrics of the services behind the proxies, labelled by the name of the service
+var (
+	serviceActiveConnections = metrics.Factory.NewGaugeVec(prometheus.GaugeOpts{
+		Name: "riotpot_service_connections_active",
+		Help: "Number of connections being relayed to the service",
+	}, []string{"service"})
+	serviceTotalConnections = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "riotpot_service_connections_total",
+		Help: "Number of connections relayed to the service",
+	}, []string{"service"})
+)
+
+func init() {
+	metrics.Metrics.MustRegister(statusCollector{})
+}
+
+// Values of the metrics of a connection, labelled when the connection is accepted
+// so the values stay consistent if the proxy changes in the meantime
+type connMetrics struct {
+	labels []string
+	active prometheus.Gauge
+}
+
+// Count a new connection accepted by the proxy
+func newConnMetrics(pe Proxy) (m *connMetrics) {
+	m = &connMetrics{
+		labels: []string{pe.GetID(), pe.GetNetwork().String(), strconv.Itoa(pe.GetPort())},
+	}
+
+	totalConnections.WithLabelValues(m.labels...).Inc()
+	m.active = activeConnections.WithLabelValues(m.labels...)
+	m.active.Inc()
+	return
+}
+
+// Returns the labels of the connection followed by the extra values
+func (m *connMetrics) labelsWith(values ...string) []string {
+	return append(append([]string{}, m.labels...), values...)
+}
+
+// Observers counting the bytes relayed in each direction
+func (m *connMetrics) observers() (inbound func(p []byte), outbound func(p []byte)) {
+	in := relayedBytes.WithLabelValues(m.labelsWith("in")...)
+	out := relayedBytes.WithLabelValues(m.labelsWith("out")...)
+
+	inbound = func(p []byte) { in.Add(float64(len(p))) }
+	outbound = func(p []byte) { out.Add(float64(len(p))) }
+	return
+}
+
+// Count a failed attempt to reach the service
+func (m *connMetrics) dialFailed(service string) {
+	dialFailures.WithLabelValues(m.labelsWith(service)...).Inc()
+}
+
+// Count the connection as relayed to the service until the returned function is called
+func (m *connMetrics) relay(service string) (done func()) {
+	serviceTotalConnections.WithLabelValues(service).Inc()
+	active := serviceActiveConnections.WithLabelValues(service)
+	active.Inc()
+
+	return active.Dec
+}
+
+// Count a connection rejected, or a session closed, by a limit
+func countLimited(pe Proxy, limit string) {
+	limitedConnections.WithLabelValues(pe.GetID(), pe.GetNetwork().String(), strconv.Itoa(pe.GetPort()), limit).Inc()
+}
+
+// Count a connection denied by an access list
+func countDenied(pe Proxy, action string) {
+	deniedConnections.WithLabelValues(pe.GetID(), pe.GetNetwork().String(), strconv.Itoa(pe.GetPort()), action).Inc()
+}
+
+// Count the connection as closed
+func (m *connMetrics) close() {
+	m.active.Dec()
+}
+
+// Remove the metrics of a deleted proxy
+func forgetMetrics(id string) {
+	labels := prometheus.Labels{"proxy": id}
+	activeConnections.DeletePartialMatch(labels)
+	totalConnections.DeletePartialMatch(labels)
+	relayedBytes.DeletePartialMatch(labels)
+	dialFailures.DeletePartialMatch(labels)
+	limitedConnections.DeletePartialMatch(labels)
+	deniedConnections.DeletePartialMatch(labels)
+}
+
+// Collector of the status of the proxies registered
+type statusCollector struct{}
+
+func (statusCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- proxyUp
+}
+
+func (statusCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, pe := range Proxies.GetProxies() {
+		service := ""
+		if s := pe.GetService(); s != nil {
+			service = s.GetName()
+		}
+
+		value := 0.0
+		if pe.GetStatus() == globals.RunningStatus {
+			value = 1
+		}
+
+		ch <- prometheus.MustNewConstMetric(proxyUp, prometheus.GaugeValue, value,
+			pe.GetID(), pe.GetNetwork().String(), strconv.Itoa(pe.GetPort()), service)
+	}
+}
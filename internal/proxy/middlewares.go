@@ -3,62 +3,304 @@ package proxy
 import (
 	"fmt"
 	"net"
+	"sort"
+	"sync"
+
+	"github.com/riotpot/internal/services"
 )
 
 var (
-	// Exportable middlewares manager
+	// Exportable middlewares manager.
+	// The middlewares registered here are applied by every proxy
 	Middlewares = NewMiddlewareManager()
 )
 
-// Use this interface to create new middlewares that include the `handle` function
+type Action int8
+
+// Actions decided by the middlewares for a flow
+const (
+	// Continue with the next middleware
+	Allow Action = iota
+	// Close the connection without reaching any service
+	Deny
+	// Relay the connection to the service set in the flow, skipping the rest of middlewares
+	Redirect
+
+	AllowValue    = "allow"
+	DenyValue     = "deny"
+	RedirectValue = "redirect"
+)
+
+func (a Action) String() string {
+	switch a {
+	case Allow:
+		return AllowValue
+	case Deny:
+		return DenyValue
+	case Redirect:
+		return RedirectValue
+	}
+
+	return fmt.Sprintf("%d", a)
+}
+
+// Connection handled by the middlewares of a proxy
+type Flow struct {
+	// Connection with the client. Middlewares may replace it with a wrapper
+	Conn net.Conn
+	// Proxy that accepted the connection
+	Proxy Proxy
+	// Session of the connection
+	Session *Session
+	// Service the connection is relayed to. Defaults to the service of the proxy
+	Service services.Service
+
+	// Middlewares observing the bytes of the flow
+	observers []Observer
+	// Metrics of the connection
+	metrics *connMetrics
+}
+
+// Returns the functions to observe the bytes relayed in one direction of the flow
+func (f *Flow) observe(fromClient bool) (observers []func(p []byte)) {
+	if f.metrics != nil {
+		inbound, outbound := f.metrics.observers()
+		if fromClient {
+			observers = append(observers, inbound)
+		} else {
+			observers = append(observers, outbound)
+		}
+	}
+
+	for _, observer := range f.observers {
+		observer := observer
+		observers = append(observers, func(p []byte) {
+			observer.Observe(f, fromClient, p)
+		})
+	}
+	return
+}
+
+func NewFlow(conn net.Conn, proxy Proxy, session *Session) *Flow {
+	return &Flow{
+		Conn:    conn,
+		Proxy:   proxy,
+		Session: session,
+		Service: proxy.GetService(),
+	}
+}
+
+// Use this interface to create new middlewares
 type Middleware interface {
-	// Handle a connection, do something to it
-	handle(conn net.Conn) (net.Conn, error)
+	// Unique name of the middleware in a chain
+	GetName() string
+	// Handle a flow before the connection with the service is made.
+	// The middleware may wrap the connection or change the service of the flow
+	Handle(flow *Flow) (Action, error)
+}
+
+// Middlewares implementing this interface observe the bytes relayed in the flows they allowed
+type Observer interface {
+	// Observe the bytes received from the client, or sent to it
+	Observe(flow *Flow, fromClient bool, p []byte)
+}
+
+// Middleware registered in a chain
+type ChainItem struct {
+	Middleware Middleware
+	// Middlewares with lower priority are applied first
+	Priority int
+	Enabled  bool
 }
 
 type MiddlewareManager interface {
-	// Apply all the registered middlewares having the connection in consideration
-	Apply(conn net.Conn) (ret net.Conn, err error)
-	// Register a new middleware
-	Register(middleware Middleware) (Middleware, error)
+	// Apply all the enabled middlewares to the flow
+	Apply(flow *Flow) (Action, error)
+	// Register a new middleware with a priority
+	Register(middleware Middleware, priority int) (Middleware, error)
+	// Remove a middleware by its name
+	Unregister(name string) error
+	// Returns the middlewares registered, in the order in which they are applied
+	GetMiddlewares() []ChainItem
+	GetMiddleware(name string) (ChainItem, error)
+	// Enable or disable a middleware
+	SetEnabled(name string, enabled bool) error
+	// Change the priority of a middleware
+	SetPriority(name string, priority int) error
 }
 
+// Chain of middlewares
 type MiddlewareManagerItem struct {
 	MiddlewareManager
 
-	// List of middlewares
-	middlewares []Middleware
+	mu sync.RWMutex
+	// List of middlewares, sorted by priority
+	middlewares []*ChainItem
 }
 
-// Register a middleware
-func (mm *MiddlewareManagerItem) Register(middleware Middleware) (mid Middleware, err error) {
-	// Iterate the registered middlewares
+// Sort the middlewares by priority, keeping the order of registration for the same priority
+func (mm *MiddlewareManagerItem) sort() {
+	sort.SliceStable(mm.middlewares, func(i, j int) bool {
+		return mm.middlewares[i].Priority < mm.middlewares[j].Priority
+	})
+}
+
+func (mm *MiddlewareManagerItem) get(name string) (item *ChainItem, err error) {
 	for _, md := range mm.middlewares {
-		if md == middleware {
-			err = fmt.Errorf("middleware already registered")
+		if md.Middleware.GetName() == name {
+			item = md
 			return
 		}
 	}
 
+	err = fmt.Errorf("middleware not found")
+	return
+}
+
+// Register a middleware, enabled by default
+func (mm *MiddlewareManagerItem) Register(middleware Middleware, priority int) (mid Middleware, err error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	// Iterate the registered middlewares
+	if _, e := mm.get(middleware.GetName()); e == nil {
+		err = fmt.Errorf("middleware already registered")
+		return
+	}
+
 	// Append the middleware to the list of registered middlewares
-	mm.middlewares = append(mm.middlewares, middleware)
+	mm.middlewares = append(mm.middlewares, &ChainItem{
+		Middleware: middleware,
+		Priority:   priority,
+		Enabled:    true,
+	})
+	mm.sort()
 	mid = middleware
 
 	return
 }
 
-// Apply each middleware to the connection
-func (mm *MiddlewareManagerItem) Apply(conn net.Conn) (ret net.Conn, err error) {
-	for _, middleware := range mm.middlewares {
-		ret, err = middleware.handle(conn)
+func (mm *MiddlewareManagerItem) Unregister(name string) (err error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	for ind, md := range mm.middlewares {
+		if md.Middleware.GetName() == name {
+			mm.middlewares = append(mm.middlewares[:ind], mm.middlewares[ind+1:]...)
+			return
+		}
+	}
+
+	err = fmt.Errorf("middleware not found")
+	return
+}
+
+func (mm *MiddlewareManagerItem) GetMiddlewares() (items []ChainItem) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	items = make([]ChainItem, 0, len(mm.middlewares))
+	for _, md := range mm.middlewares {
+		items = append(items, *md)
+	}
+	return
+}
+
+func (mm *MiddlewareManagerItem) GetMiddleware(name string) (item ChainItem, err error) {
+	mm.mu.RLock()
+	defer mm.mu.RUnlock()
+
+	md, err := mm.get(name)
+	if err != nil {
+		return
+	}
+
+	item = *md
+	return
+}
+
+func (mm *MiddlewareManagerItem) SetEnabled(name string, enabled bool) (err error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	md, err := mm.get(name)
+	if err != nil {
+		return
+	}
+
+	md.Enabled = enabled
+	return
+}
+
+func (mm *MiddlewareManagerItem) SetPriority(name string, priority int) (err error) {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	md, err := mm.get(name)
+	if err != nil {
+		return
+	}
+
+	md.Priority = priority
+	mm.sort()
+	return
+}
+
+// Apply each enabled middleware to the flow
+func (mm *MiddlewareManagerItem) Apply(flow *Flow) (Action, error) {
+	return applyChains(flow, mm)
+}
+
+// Apply the enabled middlewares of several chains to the flow, sorted by their priority.
+// The middlewares are applied until one of them denies or redirects the flow
+func applyChains(flow *Flow, chains ...MiddlewareManager) (action Action, err error) {
+	items := []ChainItem{}
+	for _, chain := range chains {
+		for _, item := range chain.GetMiddlewares() {
+			if item.Enabled {
+				items = append(items, item)
+			}
+		}
+	}
+
+	// The chains are already sorted, this merges them keeping the order of the chains
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].Priority < items[j].Priority
+	})
+
+	for _, item := range items {
+		action, err = item.Middleware.Handle(flow)
+		if err != nil {
+			action = Deny
+			err = fmt.Errorf("middleware %s: %w", item.Middleware.GetName(), err)
+			return
+		}
+
+		if observer, ok := item.Middleware.(Observer); ok && action != Deny {
+			flow.observers = append(flow.observers, observer)
+		}
+
+		switch action {
+		case Allow:
+			continue
+		case Redirect:
+			if flow.Service == nil {
+				err = fmt.Errorf("middleware %s: redirect without service", item.Middleware.GetName())
+				action = Deny
+			}
+			return
+		default:
+			return
+		}
 	}
 
+	action = Allow
 	return
 }
 
 func NewMiddlewareManager() *MiddlewareManagerItem {
 	return &MiddlewareManagerItem{
 		// Create a slice of size 0 for the middlewares
-		middlewares: make([]Middleware, 0),
+		middlewares: make([]*ChainItem, 0),
 	}
 }
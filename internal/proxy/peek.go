@@ -0,0 +1,106 @@
+package proxy
+
+import (
+	"errors"
+	"io"
+	"net"
+	"os"
+	"time"
+)
+
+const (
+	// Size of the buffer used to peek, large enough for a whole datagram
+	peekBufferSize = 64 * 1024
+)
+
+// Connection that keeps the first bytes sent by the client, so the middlewares can inspect
+// them before the connection is relayed. The bytes peeked are read again by the relay,
+// keeping the boundaries of the original reads (i.e., datagrams are not merged nor split)
+type PeekConn struct {
+	net.Conn
+
+	// Reads peeked and not consumed yet
+	chunks [][]byte
+}
+
+// Returns all the bytes peeked and not consumed
+func (c *PeekConn) buffered() (buf []byte) {
+	for _, chunk := range c.chunks {
+		buf = append(buf, chunk...)
+	}
+	return
+}
+
+// Returns up to n bytes sent by the client without consuming them.
+// It waits until n bytes are received or the timeout expires, returning the bytes received so far.
+// Neither a timeout nor the end of the stream are considered errors
+func (c *PeekConn) Peek(n int, timeout time.Duration) ([]byte, error) {
+	return c.PeekUntil(n, timeout, nil)
+}
+
+// Like Peek, but it also stops waiting once the bytes received are enough for the function given
+func (c *PeekConn) PeekUntil(n int, timeout time.Duration, enough func(peeked []byte) bool) (peeked []byte, err error) {
+	peeked = c.buffered()
+	done := func() bool {
+		return len(peeked) >= n || (enough != nil && len(peeked) > 0 && enough(peeked))
+	}
+
+	if !done() {
+		c.Conn.SetReadDeadline(time.Now().Add(timeout))
+		defer c.Conn.SetReadDeadline(time.Time{})
+
+		for !done() {
+			tmp := make([]byte, peekBufferSize)
+			m, e := c.Conn.Read(tmp)
+			if m > 0 {
+				c.chunks = append(c.chunks, tmp[:m])
+				peeked = append(peeked, tmp[:m]...)
+			}
+
+			if e != nil {
+				// The bytes received are still relayed after a timeout or the end of the stream
+				if !errors.Is(e, os.ErrDeadlineExceeded) && !errors.Is(e, io.EOF) {
+					err = e
+				}
+				break
+			}
+		}
+	}
+
+	if len(peeked) > n {
+		peeked = peeked[:n]
+	}
+	return
+}
+
+// Read the bytes peeked first, one read at a time, and then from the connection
+func (c *PeekConn) Read(p []byte) (n int, err error) {
+	if len(c.chunks) > 0 {
+		n = copy(p, c.chunks[0])
+		c.chunks[0] = c.chunks[0][n:]
+		if len(c.chunks[0]) == 0 {
+			c.chunks = c.chunks[1:]
+		}
+		return
+	}
+
+	return c.Conn.Read(p)
+}
+
+// Close the writing side of the connection, if supported
+func (c *PeekConn) CloseWrite() error {
+	if cw, ok := c.Conn.(interface{ CloseWrite() error }); ok {
+		return cw.CloseWrite()
+	}
+	return nil
+}
+
+// Returns the connection as a peek connection, wrapping it if needed.
+// The same wrapper is shared by all the middlewares of a flow
+func NewPeekConn(conn net.Conn) *PeekConn {
+	if pc, ok := conn.(*PeekConn); ok {
+		return pc
+	}
+
+	return &PeekConn{Conn: conn}
+}
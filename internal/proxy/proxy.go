@@ -2,10 +2,20 @@ package proxy
 
 import (
 	"fmt"
+	"net"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/google/uuid"
+	"github.com/riotpot/internal/capture"
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
+	lr "github.com/riotpot/internal/logger"
+	"github.com/riotpot/internal/pcap"
 	"github.com/riotpot/internal/services"
 	"github.com/riotpot/internal/validators"
 )
@@ -15,6 +25,8 @@ type Proxy interface {
 	// Start and stop
 	Start() error
 	Stop() error
+	// Stop accepting connections and drain the sessions for up to the timeout
+	Shutdown(timeout time.Duration) error
 
 	// Getters
 	GetID() string
@@ -22,10 +34,27 @@ type Proxy interface {
 	GetNetwork() globals.Network
 	GetStatus() globals.Status
 	GetService() services.Service
+	GetMiddlewares() MiddlewareManager
+	GetSessions() []*Session
+	GetSession(id string) (*Session, error)
+	IsCapturing() bool
+	IsPcapEnabled() bool
+	GetDownPolicy() DownPolicy
+	GetFailover() []services.Service
+	GetLimits() Limits
+	GetAccess() AccessRules
+	GetPcapFiles() ([]pcap.File, error)
+	GetPcapFile(name string) (string, error)
 
 	// Setters
 	SetPort(port int) int
 	SetService(service services.Service) services.Service
+	SetCapture(capture bool)
+	SetPcap(enabled bool) error
+	SetDownPolicy(policy DownPolicy) error
+	SetFailover(chain []services.Service) error
+	SetLimits(limits Limits) error
+	SetAccess(rules AccessRules) error
 }
 
 // Abstraction of the proxy endpoint
@@ -36,66 +65,152 @@ type AbstractProxy struct {
 	// ID of the proxy
 	id uuid.UUID
 
-	// Port in where the proxy will listen
+	// Port in where the proxy will listen, guarded by the mutex
 	port int
 	// Protocol meant for this proxy
 	network globals.Network
 
 	// Create a channel to stop the proxy gracefully
-	// This channel is also used to guess if the proxy is running
+	// This channel is also used to guess if the proxy is running. Guarded by the mutex
 	stop chan struct{}
 
-	// Pointer to the slice of middlewares for the proxies
-	// All the proxies should apply and share the same middlewares
-	// Perhaps this can be changed in the future given the need to apply middlewares per proxy
+	// Chain of middlewares shared by all the proxies
+	globalMiddlewares *MiddlewareManagerItem
+	// Chain of middlewares of this proxy, merged with the global chain by priority
 	middlewares *MiddlewareManagerItem
 
-	// Service to proxy
+	// Service to proxy, guarded by the mutex
 	service services.Service
 
 	// Waiting group for the server
 	wg sync.WaitGroup
 
-	// Generic listener
+	// Generic listener, guarded by the mutex
 	listener interface{ Close() error }
+
+	// Emitter used to publish the events observed
+	emitter events.Emitter
+
+	// Table of sessions handled by the proxy
+	sessions *SessionTable
+
+	// Whether the sessions are captured into transcripts (1) or not (0)
+	capture int32
+
+	// Mutex for the fields changed while the proxy is running
+	mu sync.RWMutex
+	// Recorder of the traffic in pcapng files, nil when disabled
+	pcapRecorder *pcap.Recorder
+	// Notifier of the changes, set when the proxy is registered in a manager
+	notifier events.Notifier
+	// Behaviour when the service is down
+	downPolicy DownPolicy
+	// Services dialed in order when the service can not be reached
+	failover []services.Service
+
+	// Limits of the connections of this proxy, applied along the global limits
+	limiter *Limiter
+	// Sources allowed and denied by this proxy, checked after the global access list
+	access *AccessList
+
+	// Connections being relayed, closed when draining the proxy times out
+	connsMu sync.Mutex
+	conns   map[net.Conn]struct{}
+}
+
+// Proxies that notify their changes once registered in a manager
+type notifiable interface {
+	setNotifier(notifier events.Notifier)
+}
+
+func (pe *AbstractProxy) setNotifier(notifier events.Notifier) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	pe.notifier = notifier
+}
+
+// Notify a change of the proxy
+func (pe *AbstractProxy) notify(kind events.ChangeKind) {
+	pe.mu.RLock()
+	notifier := pe.notifier
+	pe.mu.RUnlock()
+
+	if notifier != nil {
+		notifier.Notify(events.NewChange(kind, events.ProxyResource, pe.GetID()))
+	}
+}
+
+// Returns whether the proxy is running. The caller holds the mutex
+func (pe *AbstractProxy) running() bool {
+	// When the proxy is instantiated, the stop channel is nil;
+	// therefore, the proxy is not running
+	if pe.stop == nil {
+		return false
+	}
+
+	// The channel is only closed when the proxy stops
+	select {
+	case <-pe.stop:
+		return false
+	default:
+		return true
+	}
+}
+
+// Mark the proxy as running with the listener.
+// Returns the channel closed when the proxy stops
+func (pe *AbstractProxy) begin(listener interface{ Close() error }) (stop chan struct{}, err error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if pe.running() {
+		err = fmt.Errorf("proxy already running")
+		return
+	}
+
+	stop = make(chan struct{})
+	pe.stop = stop
+	pe.listener = listener
+	return
+}
+
+// Mark the proxy as stopped and close its listener, so it stops accepting clients
+func (pe *AbstractProxy) end() (err error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if !pe.running() {
+		err = fmt.Errorf("proxy not running")
+		return
+	}
+
+	close(pe.stop)
+	pe.listener.Close()
+	return
 }
 
 // Function to stop the proxy from runing
 func (pe *AbstractProxy) Stop() (err error) {
 	// Stop the proxy if it is still alive
-	if pe.GetStatus() == globals.RunningStatus {
-		close(pe.stop)
-		pe.listener.Close()
-		// Wait for all the connections and the server to stop
-		pe.wg.Wait()
+	if err = pe.end(); err != nil {
 		return
 	}
 
-	err = fmt.Errorf("proxy not running")
+	// Wait for all the connections and the server to stop
+	pe.wg.Wait()
+	pe.notify(events.StoppedChange)
 	return
 }
 
 // Simple function to check if the proxy is running
 func (pe *AbstractProxy) GetStatus() (alive globals.Status) {
-	// When the proxy is instantiated, the stop channel is nil;
-	// therefore, the proxy is not running
-	if pe.stop == nil {
-		return
-	}
+	pe.mu.RLock()
+	defer pe.mu.RUnlock()
 
-	// [7/4/2022] NOTE: The logic of this block is difficult to read.
-	// However, the select block will only give the default value when there is nothing
-	// to read from the channel while the channel is still open.
-	// When the channel is closed, the first case is not blocked, so we can not
-	// read "anything else" from the channel
-	select {
-	// Return if the channel is closed
-	case <-pe.stop:
-	// Return if the channel is open
-	default:
+	if pe.running() {
 		alive = globals.RunningStatus
 	}
-
 	return
 }
 
@@ -103,6 +218,18 @@ func (pe *AbstractProxy) GetID() string {
 	return pe.id.String()
 }
 
+// Set the ID, used to restore a proxy with the same ID.
+// It must be set before the proxy is registered in a manager
+func (pe *AbstractProxy) SetID(id string) (err error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return
+	}
+
+	pe.id = uid
+	return
+}
+
 // Set the port
 // NOTE: use the ValidatePort before assigning
 func (pe *AbstractProxy) SafeSetPort(port int) (p int, err error) {
@@ -111,44 +238,222 @@ func (pe *AbstractProxy) SafeSetPort(port int) (p int, err error) {
 		return
 	}
 
-	pe.port = p
+	pe.SetPort(p)
 	return
 }
 
 // Set the port
 // NOTE: use the ValidatePort before assigning
 func (pe *AbstractProxy) SetPort(port int) int {
+	pe.mu.Lock()
 	pe.port = port
-	return pe.port
+	pe.mu.Unlock()
+
+	pe.notify(events.UpdatedChange)
+	return port
 }
 
 // Returns the proxy port
 func (pe *AbstractProxy) GetPort() int {
+	pe.mu.RLock()
+	defer pe.mu.RUnlock()
+
 	return pe.port
 }
 
-// Set the service based on the list of registered services
+// Set the service based on the list of registered services.
+// The connections accepted from now on are relayed to the new service
 func (pe *AbstractProxy) SetService(service services.Service) services.Service {
+	pe.mu.Lock()
 	pe.service = service
-	return pe.service
+	pe.mu.Unlock()
+
+	pe.notify(events.UpdatedChange)
+	return service
 }
 
 // Returns the service
 func (pe *AbstractProxy) GetService() services.Service {
+	pe.mu.RLock()
+	defer pe.mu.RUnlock()
+
 	return pe.service
 }
 
+// Returns the chain of middlewares of the proxy
+func (pe *AbstractProxy) GetMiddlewares() MiddlewareManager {
+	return pe.middlewares
+}
+
+// Apply the global middlewares and the middlewares of the proxy to a flow
+func (pe *AbstractProxy) applyMiddlewares(flow *Flow) (Action, error) {
+	return applyChains(flow, pe.globalMiddlewares, pe.middlewares)
+}
+
+// Returns the sessions of the proxy, active and recently closed
+func (pe *AbstractProxy) GetSessions() []*Session {
+	return pe.sessions.GetAll()
+}
+
+// Returns a session by its ID
+func (pe *AbstractProxy) GetSession(id string) (session *Session, err error) {
+	session, ok := pe.sessions.Get(id)
+	if !ok {
+		err = fmt.Errorf("session not found")
+	}
+	return
+}
+
+// Returns whether the proxy captures the sessions into transcripts
+func (pe *AbstractProxy) IsCapturing() bool {
+	return atomic.LoadInt32(&pe.capture) == 1
+}
+
+// Enable or disable the capture of the sessions.
+// The change applies to the sessions started afterwards
+func (pe *AbstractProxy) SetCapture(capture bool) {
+	var value int32
+	if capture {
+		value = 1
+	}
+	atomic.StoreInt32(&pe.capture, value)
+	pe.notify(events.UpdatedChange)
+}
+
+// Returns whether the traffic of the proxy is written in pcapng files
+func (pe *AbstractProxy) IsPcapEnabled() bool {
+	return pe.getPcap() != nil
+}
+
+// Enable or disable writing the traffic of the proxy in pcapng files.
+// The files are rotated using the size and age set in the globals
+func (pe *AbstractProxy) SetPcap(enabled bool) (err error) {
+	changed, err := pe.setPcap(enabled)
+	if changed {
+		pe.notify(events.UpdatedChange)
+	}
+	return
+}
+
+// Open or close the recorder of the traffic, returning whether it changed
+func (pe *AbstractProxy) setPcap(enabled bool) (changed bool, err error) {
+	pe.mu.Lock()
+	defer pe.mu.Unlock()
+
+	if !enabled {
+		if pe.pcapRecorder != nil {
+			err = pe.pcapRecorder.Close()
+			pe.pcapRecorder = nil
+			changed = true
+		}
+		return
+	}
+
+	if pe.pcapRecorder != nil {
+		return
+	}
+
+	maxSize, err := strconv.ParseInt(globals.PcapMaxSize, 10, 64)
+	if err != nil {
+		return
+	}
+
+	maxAge, err := time.ParseDuration(globals.PcapMaxAge)
+	if err != nil {
+		return
+	}
+
+	pe.pcapRecorder, err = pcap.NewRecorder(pe.pcapDir(), maxSize, maxAge)
+	changed = err == nil
+	return
+}
+
+// Returns the pcapng files written by the proxy
+func (pe *AbstractProxy) GetPcapFiles() ([]pcap.File, error) {
+	return pcap.Files(pe.pcapDir())
+}
+
+// Returns the path to a pcapng file written by the proxy
+func (pe *AbstractProxy) GetPcapFile(name string) (string, error) {
+	return pcap.FilePath(pe.pcapDir(), name)
+}
+
+// Returns the recorder of the traffic, nil if disabled
+func (pe *AbstractProxy) getPcap() *pcap.Recorder {
+	pe.mu.RLock()
+	defer pe.mu.RUnlock()
+
+	return pe.pcapRecorder
+}
+
+// Directory in where the pcapng files of the proxy are stored
+func (pe *AbstractProxy) pcapDir() string {
+	return filepath.Join(globals.PcapDir, pe.GetID())
+}
+
 // Returns the service
 func (pe *AbstractProxy) GetNetwork() globals.Network {
 	return pe.network
 }
 
+// Publish an event of a new session with the proxy
+func (pe *AbstractProxy) emitConnection(session *Session, local net.Addr) {
+	event := events.NewEvent(session.GetClient(), local, &events.Connection{})
+	event.ProxyID = pe.GetID()
+	event.SessionID = session.GetID()
+
+	location := session.GetLocation()
+	event.Country = location.Country
+	event.ASN = location.ASN
+	event.ASOrg = location.ASOrg
+
+	if service := pe.GetService(); service != nil {
+		event.ServiceID = service.GetID()
+		event.Service = service.GetName()
+		event.Protocol = strings.ToLower(service.GetName())
+	}
+
+	pe.emitter.Emit(event)
+}
+
+// Create a recorder for the session when the proxy is capturing.
+// Returns nil if the proxy is not capturing or the transcript could not be created
+func (pe *AbstractProxy) newRecorder(session *Session, service net.Addr) (recorder *capture.Recorder) {
+	if !pe.IsCapturing() {
+		return
+	}
+
+	header := capture.Header{
+		ProxyID:   pe.GetID(),
+		SessionID: session.GetID(),
+		Network:   pe.GetNetwork().String(),
+		Client:    session.GetClient().String(),
+		Timestamp: session.GetStart(),
+	}
+	if service != nil {
+		header.Service = service.String()
+	}
+
+	recorder, err := capture.NewRecorder(filepath.Join(globals.CaptureDir, pe.GetID()), header)
+	if err != nil {
+		lr.Log.Error().Err(err).Str("proxy", pe.GetID()).Msg("Could not create the transcript of the session")
+	}
+	return
+}
+
 func NewAbstractProxy(port int, network globals.Network) (ab *AbstractProxy) {
 	ab = &AbstractProxy{
-		id:          uuid.New(),
-		port:        port,
-		network:     network,
-		middlewares: Middlewares,
+		id:                uuid.New(),
+		port:              port,
+		network:           network,
+		globalMiddlewares: Middlewares,
+		middlewares:       NewMiddlewareManager(),
+		emitter:           events.Events,
+		sessions:          NewSessionTable(),
+		downPolicy:        DownPolicy{Action: RejectAction},
+		conns:             make(map[net.Conn]struct{}),
+		limiter:           NewLimiter(),
+		access:            NewAccessList(),
 	}
 	return
 }
@@ -160,6 +465,8 @@ func NewProxyEndpoint(port int, network globals.Network) (pe Proxy, err error) {
 		pe, err = NewTCPProxy(port)
 	case globals.UDP:
 		pe, err = NewUDPProxy(port)
+	default:
+		err = fmt.Errorf("network not supported")
 	}
 
 	return
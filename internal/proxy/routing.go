@@ -0,0 +1,349 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/riotpot/internal/services"
+)
+
+const (
+	// Name of the routing middleware in the chain of a proxy
+	RouterName = "router"
+	// Priority of the routing middleware. It runs after the middlewares that filter the connections
+	RouterPriority = 100
+	// Time waited for the first bytes of the client when a rule needs them
+	RouterPeekTimeout = 500 * time.Millisecond
+	// Time after which the visits of a client are forgotten
+	visitsTTL = 24 * time.Hour
+)
+
+// Window of time of the day. When From is later than To, the window wraps midnight
+type TimeWindow struct {
+	// Time elapsed since midnight
+	From time.Duration
+	To   time.Duration
+}
+
+// Returns whether the time is inside of the window
+func (w TimeWindow) Contains(t time.Time) bool {
+	midnight := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+	elapsed := t.Sub(midnight)
+
+	if w.From <= w.To {
+		return elapsed >= w.From && elapsed < w.To
+	}
+	return elapsed >= w.From || elapsed < w.To
+}
+
+func (w TimeWindow) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return format(w.From) + "-" + format(w.To)
+}
+
+// Parse a window of time in the format "HH:MM-HH:MM"
+func ParseTimeWindow(window string) (w TimeWindow, err error) {
+	parts := strings.Split(window, "-")
+	if len(parts) != 2 {
+		err = fmt.Errorf("invalid time window %q", window)
+		return
+	}
+
+	var bounds [2]time.Duration
+	for i, part := range parts {
+		t, e := time.Parse("15:04", strings.TrimSpace(part))
+		if e != nil {
+			err = fmt.Errorf("invalid time window %q", window)
+			return
+		}
+		bounds[i] = time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	}
+
+	w = TimeWindow{From: bounds[0], To: bounds[1]}
+	return
+}
+
+// Parse a list of networks in CIDR notation. Single IPs are accepted as well
+func ParseNetworks(values []string) (networks []*net.IPNet, err error) {
+	for _, value := range values {
+		if !strings.Contains(value, "/") {
+			ip := net.ParseIP(value)
+			if ip == nil {
+				err = fmt.Errorf("invalid IP %q", value)
+				return
+			}
+
+			bits := 32
+			if ip.To4() == nil {
+				bits = 128
+			}
+			value = fmt.Sprintf("%s/%d", value, bits)
+		}
+
+		_, network, e := net.ParseCIDR(value)
+		if e != nil {
+			err = e
+			return
+		}
+		networks = append(networks, network)
+	}
+
+	return
+}
+
+// Returns the IP of a TCP or UDP address, nil for other addresses
+func addrIP(addr net.Addr) net.IP {
+	switch a := addr.(type) {
+	case *net.TCPAddr:
+		return a.IP
+	case *net.UDPAddr:
+		return a.IP
+	}
+	return nil
+}
+
+// Rule to route the flows to a service.
+// Every condition set must be met, the conditions left empty match every flow
+type RoutingRule struct {
+	// Unique name of the rule
+	Name string
+	// Networks of the clients
+	Sources []*net.IPNet
+	// First bytes sent by the client
+	Prefix []byte
+	// Time of the day of the connection
+	Window *TimeWindow
+	// Minimum number of previous visits of the client
+	MinVisits int
+	// Service the flows are routed to
+	Service services.Service
+}
+
+// Returns whether the flow of a client matches the rule
+func (r *RoutingRule) match(ip net.IP, peeked []byte, visits int, now time.Time) bool {
+	if len(r.Sources) > 0 {
+		found := false
+		for _, network := range r.Sources {
+			if ip != nil && network.Contains(ip) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+
+	if len(r.Prefix) > 0 && !strings.HasPrefix(string(peeked), string(r.Prefix)) {
+		return false
+	}
+
+	if r.Window != nil && !r.Window.Contains(now) {
+		return false
+	}
+
+	return visits >= r.MinVisits
+}
+
+// Visits of a client
+type visit struct {
+	count int
+	last  time.Time
+}
+
+// Middleware that routes the flows among several services.
+// The rules are evaluated in order, and the flow is redirected to the service of the first match.
+// The flows that match no rule continue with the service of the proxy
+type Router struct {
+	mu sync.RWMutex
+
+	name  string
+	rules []*RoutingRule
+
+	// Visits of each client IP
+	visits map[string]*visit
+	pruned time.Time
+}
+
+func (r *Router) GetName() string {
+	return r.name
+}
+
+// Count a visit of the client, returning the number of previous visits
+func (r *Router) visit(ip string, now time.Time) (previous int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	v, ok := r.visits[ip]
+	if !ok || now.Sub(v.last) > visitsTTL {
+		v = &visit{}
+		r.visits[ip] = v
+	}
+
+	previous = v.count
+	v.count++
+	v.last = now
+
+	// Forget the clients not seen for a while, at most once per minute
+	if now.Sub(r.pruned) > time.Minute {
+		for key, v := range r.visits {
+			if now.Sub(v.last) > visitsTTL {
+				delete(r.visits, key)
+			}
+		}
+		r.pruned = now
+	}
+
+	return
+}
+
+// Returns the number of visits of the client IP
+func (r *Router) GetVisits(ip string) int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if v, ok := r.visits[ip]; ok && time.Since(v.last) <= visitsTTL {
+		return v.count
+	}
+	return 0
+}
+
+// Number of bytes of the client needed by the rules
+func (r *Router) prefixLength() (n int) {
+	for _, rule := range r.rules {
+		if len(rule.Prefix) > n {
+			n = len(rule.Prefix)
+		}
+	}
+	return
+}
+
+func (r *Router) Handle(flow *Flow) (action Action, err error) {
+	now := time.Now()
+
+	ip := addrIP(flow.Conn.RemoteAddr())
+	visits := r.visit(ip.String(), now)
+
+	r.mu.RLock()
+	rules := make([]*RoutingRule, len(r.rules))
+	copy(rules, r.rules)
+	n := r.prefixLength()
+	r.mu.RUnlock()
+
+	// Peek the first bytes of the client only if there are rules that need them
+	var peeked []byte
+	if n > 0 {
+		conn := NewPeekConn(flow.Conn)
+		flow.Conn = conn
+
+		if peeked, err = conn.Peek(n, RouterPeekTimeout); err != nil {
+			return
+		}
+	}
+
+	for _, rule := range rules {
+		if rule.match(ip, peeked, visits, now) {
+			flow.Service = rule.Service
+			action = Redirect
+			return
+		}
+	}
+
+	action = Allow
+	return
+}
+
+// Add a rule at the end of the list
+func (r *Router) AddRule(rule RoutingRule) (err error) {
+	if rule.Name == "" {
+		err = fmt.Errorf("rule without name")
+		return
+	}
+
+	if rule.Service == nil {
+		err = fmt.Errorf("service not set")
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, rl := range r.rules {
+		if rl.Name == rule.Name {
+			err = fmt.Errorf("rule already registered")
+			return
+		}
+	}
+
+	r.rules = append(r.rules, &rule)
+	return
+}
+
+func (r *Router) RemoveRule(name string) (err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for ind, rule := range r.rules {
+		if rule.Name == name {
+			r.rules = append(r.rules[:ind], r.rules[ind+1:]...)
+			return
+		}
+	}
+
+	err = fmt.Errorf("rule not found")
+	return
+}
+
+// Returns the rules, in the order in which they are evaluated
+func (r *Router) GetRules() (rules []RoutingRule) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	rules = make([]RoutingRule, 0, len(r.rules))
+	for _, rule := range r.rules {
+		rules = append(rules, *rule)
+	}
+	return
+}
+
+func NewRouter(name string) *Router {
+	return &Router{
+		name:   name,
+		rules:  make([]*RoutingRule, 0),
+		visits: make(map[string]*visit),
+	}
+}
+
+// Returns the routing middleware of the proxy, nil if it does not have any
+func LookupRouter(pe Proxy) (router *Router, err error) {
+	item, e := pe.GetMiddlewares().GetMiddleware(RouterName)
+	if e != nil {
+		return
+	}
+
+	router, ok := item.Middleware.(*Router)
+	if !ok {
+		err = fmt.Errorf("middleware %s is not a router", RouterName)
+	}
+	return
+}
+
+// Returns the routing middleware of the proxy, registering a new one if it does not have any
+func GetRouter(pe Proxy) (router *Router, err error) {
+	if router, err = LookupRouter(pe); router != nil || err != nil {
+		return
+	}
+
+	// Another router may be registered in the meantime, use whichever is in the chain
+	pe.GetMiddlewares().Register(NewRouter(RouterName), RouterPriority)
+
+	if router, err = LookupRouter(pe); router == nil && err == nil {
+		err = fmt.Errorf("middleware %s not registered", RouterName)
+	}
+	return
+}
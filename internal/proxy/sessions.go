@@ -0,0 +1,336 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/geoip"
+)
+
+const (
+	// Number of closed sessions kept in the table of each proxy
+	sessionsHistory = 100
+)
+
+// Reasons for a session to be closed
+const (
+	// The client closed the connection
+	ClientClosedReason = "client closed"
+	// The service closed the connection
+	ServiceClosedReason = "service closed"
+	// The proxy could not reach the service
+	DialFailedReason = "dial failed"
+	// The connection was rejected before reaching the service
+	RejectedReason = "rejected"
+	// The proxy was stopped
+	ProxyStoppedReason = "proxy stopped"
+	// The session did not exchange messages for too long
+	IdleTimeoutReason = "idle timeout"
+	// The service was down and the client got the banner of the proxy instead
+	BannerReason = "banner"
+	// The session was open for longer than allowed by the limits of the proxy
+	DurationLimitReason = "duration limit"
+	// The session relayed more bytes than allowed by the limits of the proxy
+	BytesLimitReason = "bytes limit"
+)
+
+var (
+	// Index of the active sessions by the local address of the connection to the service.
+	// Services see the proxy as the client, this index is used to find out who is the real client
+	upstreams sync.Map
+)
+
+func init() {
+	// Attribute the events published by the services to the session and client behind the proxy
+	events.Events.Enrich(func(event *events.Event) {
+		if event.ProxyID != "" || event.RemoteAddr == "" {
+			return
+		}
+
+		value, ok := upstreams.Load(event.RemoteAddr)
+		if !ok {
+			return
+		}
+
+		session := value.(*Session)
+		event.ProxyID = session.GetProxyID()
+		event.SessionID = session.GetID()
+		event.RemoteAddr = session.GetClient().String()
+	})
+}
+
+// Flow of messages between a client and a service through a proxy
+type Session struct {
+	mu sync.RWMutex
+
+	id      uuid.UUID
+	proxyID string
+
+	// Address of the client
+	client net.Addr
+	// Country and autonomous system of the client
+	location geoip.Location
+	// Local address of the connection to the service
+	upstream net.Addr
+
+	start time.Time
+	end   time.Time
+
+	// Bytes received from the client, and sent to it
+	bytesIn  int64
+	bytesOut int64
+
+	closeReason string
+
+	// Attempts to reach the services, in order
+	attempts []Attempt
+}
+
+// Attempt of the proxy to reach a service for a session
+type Attempt struct {
+	ServiceID string
+	Service   string
+	Time      time.Time
+	// Time taken to connect or fail
+	Duration time.Duration
+	// Reason of the failure, empty if the service answered
+	Error string
+}
+
+func (s *Session) GetID() string {
+	return s.id.String()
+}
+
+func (s *Session) GetProxyID() string {
+	return s.proxyID
+}
+
+func (s *Session) GetClient() net.Addr {
+	return s.client
+}
+
+// Returns the country and autonomous system of the client, empty without GeoIP databases
+func (s *Session) GetLocation() geoip.Location {
+	return s.location
+}
+
+func (s *Session) GetStart() time.Time {
+	return s.start
+}
+
+// Returns the time in where the session was closed, zero if it is still active
+func (s *Session) GetEnd() time.Time {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.end
+}
+
+func (s *Session) GetBytesIn() int64 {
+	return atomic.LoadInt64(&s.bytesIn)
+}
+
+func (s *Session) GetBytesOut() int64 {
+	return atomic.LoadInt64(&s.bytesOut)
+}
+
+func (s *Session) GetCloseReason() string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.closeReason
+}
+
+func (s *Session) IsActive() bool {
+	return s.GetEnd().IsZero()
+}
+
+// Add to the number of bytes received from the client
+func (s *Session) AddBytesIn(n int) {
+	atomic.AddInt64(&s.bytesIn, int64(n))
+}
+
+// Add to the number of bytes sent to the client
+func (s *Session) AddBytesOut(n int) {
+	atomic.AddInt64(&s.bytesOut, int64(n))
+}
+
+// Record an attempt to reach a service
+func (s *Session) AddAttempt(attempt Attempt) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attempts = append(s.attempts, attempt)
+}
+
+// Returns the attempts to reach the services, in order
+func (s *Session) GetAttempts() []Attempt {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]Attempt{}, s.attempts...)
+}
+
+// Returns the attempt of the service that served the session, if any answered
+func (s *Session) GetServedBy() (attempt Attempt, ok bool) {
+	for _, attempt = range s.GetAttempts() {
+		if attempt.Error == "" {
+			return attempt, true
+		}
+	}
+	return Attempt{}, false
+}
+
+// Set the local address of the connection to the service
+func (s *Session) SetUpstream(addr net.Addr) {
+	s.mu.Lock()
+	s.upstream = addr
+	s.mu.Unlock()
+
+	upstreams.Store(addr.String(), s)
+}
+
+// Set the reason to close the session. Only the first reason is kept
+func (s *Session) SetCloseReason(reason string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closeReason == "" {
+		s.closeReason = reason
+	}
+}
+
+// Close the session with a reason, if it did not have one already
+func (s *Session) Close(reason string) {
+	s.SetCloseReason(reason)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.end.IsZero() {
+		return
+	}
+	s.end = time.Now()
+
+	if s.upstream != nil {
+		upstreams.Delete(s.upstream.String())
+	}
+}
+
+func NewSession(proxyID string, client net.Addr) *Session {
+	return &Session{
+		id:       uuid.New(),
+		proxyID:  proxyID,
+		client:   client,
+		location: geoip.GeoIP.Locate(addrIP(client)),
+		start:    time.Now(),
+	}
+}
+
+// Table of sessions of a proxy.
+// It contains the active sessions, and a number of the latest closed
+type SessionTable struct {
+	mu       sync.RWMutex
+	sessions map[string]*Session
+}
+
+// Create a new session for the client and add it to the table
+func (st *SessionTable) New(proxyID string, client net.Addr) (session *Session) {
+	session = NewSession(proxyID, client)
+
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	st.sessions[session.GetID()] = session
+	st.prune()
+	return
+}
+
+// Remove the oldest closed sessions exceeding the history size
+func (st *SessionTable) prune() {
+	closed := []*Session{}
+	for _, session := range st.sessions {
+		if !session.IsActive() {
+			closed = append(closed, session)
+		}
+	}
+
+	if len(closed) <= sessionsHistory {
+		return
+	}
+
+	sort.Slice(closed, func(i, j int) bool {
+		return closed[i].GetEnd().Before(closed[j].GetEnd())
+	})
+
+	for _, session := range closed[:len(closed)-sessionsHistory] {
+		delete(st.sessions, session.GetID())
+	}
+}
+
+func (st *SessionTable) Get(id string) (session *Session, ok bool) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	session, ok = st.sessions[id]
+	return
+}
+
+// Returns all the sessions in the table, sorted by their start time
+func (st *SessionTable) GetAll() (sessions []*Session) {
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+
+	sessions = make([]*Session, 0, len(st.sessions))
+	for _, session := range st.sessions {
+		sessions = append(sessions, session)
+	}
+
+	sort.Slice(sessions, func(i, j int) bool {
+		return sessions[i].GetStart().Before(sessions[j].GetStart())
+	})
+	return
+}
+
+// Returns the active sessions
+func (st *SessionTable) GetActive() (sessions []*Session) {
+	for _, session := range st.GetAll() {
+		if session.IsActive() {
+			sessions = append(sessions, session)
+		}
+	}
+	return
+}
+
+// Close all the active sessions with the given reason
+func (st *SessionTable) CloseAll(reason string) {
+	for _, session := range st.GetActive() {
+		session.Close(reason)
+	}
+}
+
+func NewSessionTable() *SessionTable {
+	return &SessionTable{
+		sessions: make(map[string]*Session),
+	}
+}
+
+// Writer that passes the bytes written to a list of observers
+type observingWriter struct {
+	writer    io.Writer
+	observers []func(p []byte)
+}
+
+func (ow *observingWriter) Write(p []byte) (n int, err error) {
+	n, err = ow.writer.Write(p)
+	for _, observe := range ow.observers {
+		observe(p[:n])
+	}
+	return
+}
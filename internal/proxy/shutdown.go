@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+)
+
+// Keep track of connections being relayed, so they can be closed when draining the proxy times out.
+// Returns the function to forget them once they are closed
+func (pe *AbstractProxy) track(conns ...net.Conn) (untrack func()) {
+	pe.connsMu.Lock()
+	for _, conn := range conns {
+		pe.conns[conn] = struct{}{}
+	}
+	pe.connsMu.Unlock()
+
+	return func() {
+		pe.connsMu.Lock()
+		for _, conn := range conns {
+			delete(pe.conns, conn)
+		}
+		pe.connsMu.Unlock()
+	}
+}
+
+// Close the connections being relayed
+func (pe *AbstractProxy) closeConns() {
+	pe.connsMu.Lock()
+	defer pe.connsMu.Unlock()
+
+	for conn := range pe.conns {
+		conn.Close()
+	}
+}
+
+// Stop accepting connections and wait for the active sessions to finish for up to the timeout.
+// The sessions still open afterwards are closed
+func (pe *AbstractProxy) Shutdown(timeout time.Duration) (err error) {
+	if err = pe.end(); err != nil {
+		return
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		pe.wg.Wait()
+		close(drained)
+	}()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-drained:
+	case <-timer.C:
+		pe.sessions.CloseAll(ProxyStoppedReason)
+		pe.closeConns()
+		<-drained
+	}
+
+	pe.notify(events.StoppedChange)
+	return
+}
+
+// Stop taking new clients and keep relaying the datagrams of the current ones until their sessions
+// end (i.e., they are idle) or the timeout expires. The replies are sent to the clients through the
+// listener, so it is closed last, along with the sessions still open
+func (udpProxy *UDPProxy) Shutdown(timeout time.Duration) (err error) {
+	if udpProxy.GetStatus() != globals.RunningStatus {
+		err = fmt.Errorf("proxy not running")
+		return
+	}
+
+	idle := make(chan struct{})
+
+	udpProxy.clientsMu.Lock()
+	udpProxy.draining = true
+	if len(udpProxy.clients) == 0 {
+		close(idle)
+	} else {
+		udpProxy.idle = idle
+	}
+	udpProxy.clientsMu.Unlock()
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	select {
+	case <-idle:
+	case <-timer.C:
+	}
+
+	err = udpProxy.Stop()
+
+	udpProxy.clientsMu.Lock()
+	udpProxy.draining = false
+	udpProxy.idle = nil
+	udpProxy.clientsMu.Unlock()
+	return
+}
+
+// Shutdown every running proxy at once, waiting for their sessions to finish for up to the timeout
+func (pm *ProxyManagerItem) Shutdown(timeout time.Duration) (errs []error) {
+	var (
+		mu sync.Mutex
+		wg sync.WaitGroup
+	)
+
+	for _, pe := range pm.GetProxies() {
+		if pe.GetStatus() != globals.RunningStatus {
+			continue
+		}
+
+		wg.Add(1)
+		go func(pe Proxy) {
+			defer wg.Done()
+
+			if err := pe.Shutdown(timeout); err != nil {
+				mu.Lock()
+				errs = append(errs, fmt.Errorf("proxy %s: %w", pe.GetID(), err))
+				mu.Unlock()
+			}
+		}(pe)
+	}
+
+	wg.Wait()
+	return
+}
@@ -0,0 +1,276 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/riotpot/internal/services"
+)
+
+const (
+	// Name of the sniffing middleware in the chain of a proxy
+	SnifferName = "sniffer"
+	// Priority of the sniffing middleware. It runs before the router, so the rules can still change the service
+	SnifferPriority = 90
+	// Time waited for the first bytes of the client. Clients that wait for the server to speak first
+	// (e.g., telnet) are relayed to the service of the proxy after it
+	SnifferPeekTimeout = 1 * time.Second
+	// Maximum number of bytes peeked to detect the protocol
+	sniffLength = 16
+)
+
+// Protocols detected by the sniffer
+const (
+	SSHProtocol    = "ssh"
+	HTTPProtocol   = "http"
+	TLSProtocol    = "tls"
+	MQTTProtocol   = "mqtt"
+	ModbusProtocol = "modbus"
+	TelnetProtocol = "telnet"
+)
+
+var (
+	// Protocols that can be detected
+	Protocols = []string{SSHProtocol, HTTPProtocol, TLSProtocol, MQTTProtocol, ModbusProtocol, TelnetProtocol}
+
+	// Methods and prefaces of HTTP requests
+	httpPrefixes = [][]byte{
+		[]byte("GET "), []byte("POST "), []byte("PUT "), []byte("HEAD "), []byte("DELETE "),
+		[]byte("OPTIONS "), []byte("PATCH "), []byte("CONNECT "), []byte("TRACE "), []byte("PRI * HTTP/2"),
+	}
+)
+
+// Returns whether the data may still become the prefix, or already starts with it
+func hasPrefix(data []byte, prefix []byte) (match bool, more bool) {
+	if len(data) < len(prefix) {
+		return false, bytes.HasPrefix(prefix, data)
+	}
+	return bytes.HasPrefix(data, prefix), false
+}
+
+// Detect the protocol from the first bytes sent by a client.
+// Returns the protocol, or an empty string and whether more bytes could change the result
+func DetectProtocol(data []byte) (protocol string, more bool) {
+	if len(data) == 0 {
+		return "", true
+	}
+
+	// SSH identification string
+	if match, m := hasPrefix(data, []byte("SSH-")); match {
+		return SSHProtocol, false
+	} else if m {
+		more = true
+	}
+
+	for _, prefix := range httpPrefixes {
+		if match, m := hasPrefix(data, prefix); match {
+			return HTTPProtocol, false
+		} else if m {
+			more = true
+		}
+	}
+
+	switch data[0] {
+	// TLS handshake record with a ClientHello
+	case 0x16:
+		if len(data) < 6 {
+			return "", true
+		}
+		if data[1] == 0x03 && data[2] <= 0x04 && data[5] == 0x01 {
+			return TLSProtocol, false
+		}
+
+	// MQTT CONNECT packet, the protocol name follows the remaining length (1 to 4 bytes)
+	case 0x10:
+		i := 1
+		for i < len(data) && i < 4 && data[i]&0x80 != 0 {
+			i++
+		}
+		if i >= len(data) {
+			return "", true
+		}
+
+		for _, name := range [][]byte{[]byte("\x00\x04MQTT"), []byte("\x00\x06MQIsdp")} {
+			if match, m := hasPrefix(data[i+1:], name); match {
+				return MQTTProtocol, false
+			} else if m {
+				more = true
+			}
+		}
+
+	// Telnet negotiation (IAC)
+	case 0xff:
+		return TelnetProtocol, false
+	}
+
+	// Modbus TCP application header (MBAP) and the function code
+	if len(data) < 8 {
+		return "", true
+	}
+	length := binary.BigEndian.Uint16(data[4:6])
+	if data[2] == 0 && data[3] == 0 && length >= 2 && length <= 254 && data[7] > 0 && data[7] < 0x80 {
+		return ModbusProtocol, false
+	}
+
+	return "", more
+}
+
+// Middleware that detects the protocol of the connections, and sets the service of the protocol
+// in the flow. Connections of unknown protocols continue with the service of the proxy
+type Sniffer struct {
+	mu sync.RWMutex
+
+	name     string
+	services map[string]services.Service
+	timeout  time.Duration
+}
+
+func (s *Sniffer) GetName() string {
+	return s.name
+}
+
+func (s *Sniffer) Handle(flow *Flow) (action Action, err error) {
+	// There is no need to wait for the client without services to choose from
+	if len(s.GetProtocols()) == 0 {
+		action = Allow
+		return
+	}
+
+	conn := NewPeekConn(flow.Conn)
+	flow.Conn = conn
+
+	peeked, err := conn.PeekUntil(sniffLength, s.GetTimeout(), func(peeked []byte) bool {
+		_, more := DetectProtocol(peeked)
+		return !more
+	})
+	if err != nil {
+		return
+	}
+
+	// Continue with the rest of middlewares, which may still change the service
+	protocol, _ := DetectProtocol(peeked)
+	if service, ok := s.GetService(protocol); ok {
+		flow.Service = service
+	}
+
+	action = Allow
+	return
+}
+
+// Set the service of a protocol
+func (s *Sniffer) SetService(protocol string, service services.Service) (err error) {
+	known := false
+	for _, p := range Protocols {
+		known = known || p == protocol
+	}
+	if !known {
+		err = fmt.Errorf("unknown protocol %s", protocol)
+		return
+	}
+
+	if service == nil {
+		err = fmt.Errorf("service not set")
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.services[protocol] = service
+	return
+}
+
+func (s *Sniffer) RemoveService(protocol string) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.services[protocol]; !ok {
+		err = fmt.Errorf("protocol not found")
+		return
+	}
+
+	delete(s.services, protocol)
+	return
+}
+
+func (s *Sniffer) GetService(protocol string) (service services.Service, ok bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	service, ok = s.services[protocol]
+	return
+}
+
+// Returns the protocols with a service, sorted by name
+func (s *Sniffer) GetProtocols() (protocols []string) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	protocols = make([]string, 0, len(s.services))
+	for protocol := range s.services {
+		protocols = append(protocols, protocol)
+	}
+	sort.Strings(protocols)
+	return
+}
+
+func (s *Sniffer) GetTimeout() time.Duration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return s.timeout
+}
+
+// Set the time waited for the first bytes of the client
+func (s *Sniffer) SetTimeout(timeout time.Duration) (err error) {
+	if timeout <= 0 {
+		return fmt.Errorf("the timeout of the sniffer must be positive")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.timeout = timeout
+	return
+}
+
+func NewSniffer(name string) *Sniffer {
+	return &Sniffer{
+		name:     name,
+		services: make(map[string]services.Service),
+		timeout:  SnifferPeekTimeout,
+	}
+}
+
+// Returns the sniffing middleware of the proxy, nil if it does not have any
+func LookupSniffer(pe Proxy) (sniffer *Sniffer, err error) {
+	item, e := pe.GetMiddlewares().GetMiddleware(SnifferName)
+	if e != nil {
+		return
+	}
+
+	sniffer, ok := item.Middleware.(*Sniffer)
+	if !ok {
+		err = fmt.Errorf("middleware %s is not a sniffer", SnifferName)
+	}
+	return
+}
+
+// Returns the sniffing middleware of the proxy, registering a new one if it does not have any
+func GetSniffer(pe Proxy) (sniffer *Sniffer, err error) {
+	if sniffer, err = LookupSniffer(pe); sniffer != nil || err != nil {
+		return
+	}
+
+	// Another sniffer may be registered in the meantime, use whichever is in the chain
+	pe.GetMiddlewares().Register(NewSniffer(SnifferName), SnifferPriority)
+
+	if sniffer, err = LookupSniffer(pe); sniffer == nil && err == nil {
+		err = fmt.Errorf("middleware %s not registered", SnifferName)
+	}
+	return
+}
@@ -7,15 +7,17 @@ import (
 	"sync"
 	"time"
 
+	"github.com/riotpot/internal/capture"
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	lr "github.com/riotpot/internal/logger"
+	"github.com/riotpot/internal/pcap"
 )
 
 // Implementation of a TCP proxy
 
 type TCPProxy struct {
 	*AbstractProxy
-	listener net.Listener
 }
 
 // Start listening for connections
@@ -26,15 +28,22 @@ func (tcpProxy *TCPProxy) Start() (err error) {
 		return
 	}
 
-	// Get the listener or create a new one
-	listener, err := tcpProxy.GetListener()
+	if tcpProxy.GetStatus() == globals.RunningStatus {
+		err = fmt.Errorf("proxy already running")
+		return
+	}
 
+	listener, err := tcpProxy.NewListener()
 	if err != nil {
 		return
 	}
 
-	// Create a channel to stop the proxy
-	tcpProxy.stop = make(chan struct{})
+	// Get the channel closed when the proxy stops
+	stop, err := tcpProxy.begin(listener)
+	if err != nil {
+		listener.Close()
+		return
+	}
 
 	// Add a waiting task
 	tcpProxy.wg.Add(1)
@@ -50,76 +59,167 @@ func (tcpProxy *TCPProxy) Start() (err error) {
 			if err != nil {
 				return
 			}
-			defer client.Close()
 
-			// Apply the middlewares to the connection before dialing the server
-			_, err = tcpProxy.middlewares.Apply(client)
-			if err != nil {
-				return
+			// Drop or tarpit the sources denied by the access lists, they are not relayed nor recorded
+			if action, delay, denied := tcpProxy.checkAccess(client.RemoteAddr()); denied {
+				if action != TarpitAccess {
+					client.Close()
+					continue
+				}
+
+				tcpProxy.wg.Add(1)
+				go func() {
+					defer tcpProxy.wg.Done()
+					tarpit(client, delay, stop)
+				}()
+				continue
 			}
 
-			// Get a connection to the server for each new connection with the client
-			server, servErr := net.DialTimeout(globals.TCP.String(), tcpProxy.service.GetAddress(), 1*time.Second)
-
-			// If there was an error, close the connection to the server and return
-			if servErr != nil {
-				return
+			// Enforce the limits before spending anything else on the connection
+			release, ok := tcpProxy.admit(client.RemoteAddr())
+			if !ok {
+				client.Close()
+				continue
 			}
-			defer server.Close()
 
 			// Add a waiting task
 			tcpProxy.wg.Add(1)
 
+			// Serve each connection on its own, so the middlewares do not block the listener
 			go func() {
-				// Handle the connection between the client and the server
-				// NOTE: The handlers will defer the connections
-				tcpProxy.handle(client, server)
-
-				// Finish the task
-				tcpProxy.wg.Done()
+				defer tcpProxy.wg.Done()
+				defer release()
+				tcpProxy.serve(client)
 			}()
 		}
 	}()
 
+	tcpProxy.notify(events.StartedChange)
 	return
 }
 
+// Apply the middlewares to a new connection and relay it to the service
+func (tcpProxy *TCPProxy) serve(client net.Conn) {
+	defer client.Close()
+	defer tcpProxy.track(client)()
+
+	// Track the flow of the connection in a new session
+	session := tcpProxy.sessions.New(tcpProxy.GetID(), client.RemoteAddr())
+	flow := NewFlow(client, tcpProxy, session)
+
+	// Count the connection while it is open
+	flow.metrics = newConnMetrics(tcpProxy)
+	defer flow.metrics.close()
+
+	// Apply the middlewares to the connection before dialing the server
+	action, err := tcpProxy.applyMiddlewares(flow)
+	if err != nil {
+		lr.Log.Warn().Err(err).Str("proxy", tcpProxy.GetID()).Msg("Connection rejected by a middleware")
+	}
+	if action == Deny {
+		session.Close(RejectedReason)
+		return
+	}
+
+	// Publish the connection
+	tcpProxy.emitConnection(session, client.LocalAddr())
+
+	if flow.Service == nil {
+		session.Close(DialFailedReason)
+		return
+	}
+
+	// Get a connection to the server for each new connection with the client,
+	// applying the down policy of the proxy if it can not be reached
+	server, reason := tcpProxy.dialService(flow)
+	if server == nil {
+		session.Close(reason)
+		return
+	}
+	defer server.Close()
+	defer tcpProxy.track(server)()
+	defer flow.metrics.relay(flow.Service.GetName())()
+
+	// Keep the address used to reach the service, to attribute its events to the session
+	session.SetUpstream(server.LocalAddr())
+
+	// Handle the connection between the client and the server
+	tcpProxy.handle(flow, server)
+}
+
+// Returns the listener of the running proxy, or a new one
 func (tcpProxy *TCPProxy) GetListener() (listener net.Listener, err error) {
-	listener = tcpProxy.listener
+	tcpProxy.mu.RLock()
+	if tcpProxy.running() {
+		listener, _ = tcpProxy.AbstractProxy.listener.(net.Listener)
+	}
+	tcpProxy.mu.RUnlock()
 
-	// Get the listener only
-	if listener == nil || tcpProxy.GetStatus() != globals.RunningStatus {
+	if listener == nil {
 		listener, err = tcpProxy.NewListener()
-		if err != nil {
-			return
-		}
-		tcpProxy.listener = listener
 	}
-
 	return
 }
 
+// Listen on the port of the proxy
 func (tcpProxy *TCPProxy) NewListener() (listener net.Listener, err error) {
-	listener, err = net.Listen(tcpProxy.GetNetwork().String(), fmt.Sprintf(":%d", tcpProxy.GetPort()))
-	tcpProxy.AbstractProxy.listener = listener
-	return
+	return net.Listen(tcpProxy.GetNetwork().String(), fmt.Sprintf(":%d", tcpProxy.GetPort()))
 }
 
-// TCP synchronous tunnel that forwards requests from source to destination and back
-func (tcpProxy *TCPProxy) handle(from net.Conn, to net.Conn) {
+// TCP synchronous tunnel that forwards requests from the client of the flow to the server and back
+func (tcpProxy *TCPProxy) handle(flow *Flow, to net.Conn) {
+	from := flow.Conn
+	session := flow.Session
+
 	// Create the waiting group for the connections so they can answer the each other
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	handler := func(source net.Conn, dest net.Conn) {
+	// Observers of the bytes relayed in each direction
+	inbound := append([]func(p []byte){func(p []byte) { session.AddBytesIn(len(p)) }}, flow.observe(true)...)
+	outbound := append([]func(p []byte){func(p []byte) { session.AddBytesOut(len(p)) }}, flow.observe(false)...)
+
+	// Close the session when it exceeds the maximum duration or bytes
+	limit, done := tcpProxy.limitSession(flow, to)
+	defer done()
+	if limit != nil {
+		inbound = append(inbound, limit)
+		outbound = append(outbound, limit)
+	}
+
+	// Tee both directions into a transcript when the proxy is capturing
+	if recorder := tcpProxy.newRecorder(session, to.RemoteAddr()); recorder != nil {
+		defer recorder.Close()
+		inbound = append(inbound, recorder.Observer(capture.Input))
+		outbound = append(outbound, recorder.Observer(capture.Output))
+	}
+
+	// Synthesize the packets of the connection with the client when writing pcapng files
+	if recorder := tcpProxy.getPcap(); recorder != nil {
+		stream := pcap.NewTCPStream(from.RemoteAddr(), from.LocalAddr())
+		recorder.Write(session.GetStart(), stream.Open()...)
+
+		inbound = append(inbound, func(p []byte) { recorder.Write(time.Now(), stream.Data(true, p)...) })
+		outbound = append(outbound, func(p []byte) { recorder.Write(time.Now(), stream.Data(false, p)...) })
+
+		defer func() {
+			fromClient := session.GetCloseReason() != ServiceClosedReason
+			recorder.Write(time.Now(), stream.Close(fromClient)...)
+		}()
+	}
+
+	handler := func(source net.Conn, dest net.Conn, observers []func(p []byte), reason string) {
 		defer wg.Done()
 
-		// Write the content from the source to the destination
-		_, err := io.Copy(dest, source)
+		// Write the content from the source to the destination, observing the bytes relayed
+		_, err := io.Copy(&observingWriter{writer: dest, observers: observers}, source)
 		if err != nil {
 			lr.Log.Warn().Err(err).Msg("Could not copy from source to destination")
 		}
 
+		// The first side to finish determines why the session is closed
+		session.SetCloseReason(reason)
+
 		// Close the connection to the source
 		if err := source.Close(); err != nil {
 			lr.Log.Warn().Err(err)
@@ -127,7 +227,8 @@ func (tcpProxy *TCPProxy) handle(from net.Conn, to net.Conn) {
 
 		// Attempt to close the writter. This may not always work
 		// Another solution is to just call `Close()` on the writter
-		if d, ok := dest.(*net.TCPConn); ok {
+		// Connections wrapped by the middlewares may also implement it
+		if d, ok := dest.(interface{ CloseWrite() error }); ok {
 			if err := d.CloseWrite(); err != nil {
 				lr.Log.Warn().Err(err)
 			}
@@ -138,11 +239,12 @@ func (tcpProxy *TCPProxy) handle(from net.Conn, to net.Conn) {
 	// Start the workers
 	// TODO: [7/3/2022] Check somewhere if the connection is still alive from the source and destination
 	// Otherwise there is no need to wait
-	go handler(from, to)
-	go handler(to, from)
+	go handler(from, to, inbound, ClientClosedReason)
+	go handler(to, from, outbound, ServiceClosedReason)
 
 	// Wait until the forwarding is done
 	wg.Wait()
+	session.Close(ClientClosedReason)
 }
 
 func NewTCPProxy(port int) (proxy *TCPProxy, err error) {
@@ -1,19 +1,49 @@
 package proxy
 
 import (
+	"errors"
 	"fmt"
 	"net"
+	"os"
 	"sync"
+	"sync/atomic"
+	"time"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	lr "github.com/riotpot/internal/logger"
+	"github.com/riotpot/internal/pcap"
 )
 
+const (
+	// Time after which the session of a client that exchanged no datagrams is closed
+	UDPIdleTimeout = 60 * time.Second
+	// Number of datagrams of a client queued before they are relayed. The rest are dropped
+	udpQueueSize = 64
+	// Maximum size of a UDP datagram
+	udpBufferSize = 64 * 1024
+)
+
+// Implementation of a UDP proxy.
+// The datagrams of each client address are relayed to the service through a socket of its own,
+// and the replies received on that socket are sent back to the client (i.e., NAT-style)
+
 type UDPProxy struct {
 	*AbstractProxy
-	listener *net.UDPConn
+
+	// Connections of the clients relayed, by their address
+	clientsMu sync.Mutex
+	clients   map[string]*udpConn
+	// Whether the proxy is shutting down, the datagrams of new clients are dropped meanwhile
+	draining bool
+	// Closed once the last client is removed while draining
+	idle chan struct{}
+
+	// Idle timeout of the sessions, in nanoseconds
+	idleTimeout int64
 }
 
+// Start listening for datagrams
 func (udpProxy *UDPProxy) Start() (err error) {
 	// Check if the service is set
 	if udpProxy.GetService() == nil {
@@ -21,121 +51,417 @@ func (udpProxy *UDPProxy) Start() (err error) {
 		return
 	}
 
-	// Get the listener or create a new one
-	client, err := udpProxy.GetListener()
+	if udpProxy.GetStatus() == globals.RunningStatus {
+		err = fmt.Errorf("proxy already running")
+		return
+	}
+
+	listener, err := udpProxy.NewListener()
 	if err != nil {
 		return
 	}
-	defer client.Close()
 
-	// Create a channel to stop the proxy
-	udpProxy.stop = make(chan struct{})
+	if _, err = udpProxy.begin(listener); err != nil {
+		listener.Close()
+		return
+	}
 
 	// Add a waiting task
 	udpProxy.wg.Add(1)
 
-	srvAddr := net.UDPAddr{
-		Port: udpProxy.service.GetPort(),
-	}
+	go func() {
+		defer udpProxy.wg.Done()
 
-	for {
-		// Get a connection to the server for each new connection with the client
-		server, servErr := net.DialUDP(globals.UDP.String(), nil, &srvAddr)
-		// If there was an error, close the connection to the server and return
-		if servErr != nil {
-			return
-		}
-		defer server.Close()
+		buf := make([]byte, udpBufferSize)
+		for {
+			n, addr, err := listener.ReadFromUDP(buf)
+			if err != nil {
+				// There is no need to continue if the proxy is not running
+				if errors.Is(err, net.ErrClosed) || udpProxy.GetStatus() != globals.RunningStatus {
+					return
+				}
+				lr.Log.Warn().Err(err).Str("proxy", udpProxy.GetID()).Msg("Could not read from the client")
+				continue
+			}
 
-		go func() {
-			// TODO: Handle the middlewares! they only accept TCP connections
-			// Apply the middlewares to the connection
-			//udpProxy.middlewares.Apply(listener)
+			conn, isNew := udpProxy.getClient(listener, addr)
+			if conn == nil {
+				if udpProxy.GetStatus() != globals.RunningStatus {
+					return
+				}
+				// The proxy is draining the current clients
+				continue
+			}
 
-			// Handle the connection between the client and the server
-			// NOTE: The handlers will defer the connections
-			udpProxy.handle(client, server)
+			if isNew {
+				// Drop the datagrams of the sources denied by the access lists, they can not be tarpitted
+				if _, _, denied := udpProxy.checkAccess(addr); denied {
+					udpProxy.removeClient(conn)
+					conn.Close()
+					continue
+				}
 
-			// Finish the task
-			udpProxy.wg.Done()
-		}()
-	}
+				// Enforce the limits before spending anything else on the client,
+				// its next datagram is admitted again
+				release, ok := udpProxy.admit(addr)
+				if !ok {
+					udpProxy.removeClient(conn)
+					conn.Close()
+					continue
+				}
+
+				// Add a waiting task
+				udpProxy.wg.Add(1)
+
+				// Serve each client on its own, so the middlewares do not block the listener
+				go func() {
+					defer udpProxy.wg.Done()
+					defer release()
+					udpProxy.serve(conn)
+				}()
+			}
+
+			datagram := make([]byte, n)
+			copy(datagram, buf[:n])
+			conn.push(datagram)
+		}
+	}()
+
+	udpProxy.notify(events.StartedChange)
+	return
 }
 
 // Function to stop the proxy from runing
 func (udpProxy *UDPProxy) Stop() (err error) {
 	// Stop the proxy if it is still alive
-	if udpProxy.GetStatus() != globals.StoppedStatus {
-		close(udpProxy.stop)
-		udpProxy.listener.Close()
-		// Wait for all the connections and the server to stop
-		udpProxy.wg.Wait()
+	if err = udpProxy.end(); err != nil {
 		return
 	}
 
-	err = fmt.Errorf("proxy not running")
+	// Close the sessions of the clients, otherwise they would wait until the idle timeout
+	udpProxy.sessions.CloseAll(ProxyStoppedReason)
+
+	udpProxy.clientsMu.Lock()
+	for _, conn := range udpProxy.clients {
+		conn.Close()
+	}
+	udpProxy.clientsMu.Unlock()
+
+	// Wait for all the clients and the listener to stop
+	udpProxy.wg.Wait()
+
+	udpProxy.notify(events.StoppedChange)
 	return
 }
 
-// Get or create a new listener
+// Returns the listener of the running proxy, or a new one
 func (udpProxy *UDPProxy) GetListener() (listener *net.UDPConn, err error) {
-	listener = udpProxy.listener
+	udpProxy.mu.RLock()
+	if udpProxy.running() {
+		listener, _ = udpProxy.AbstractProxy.listener.(*net.UDPConn)
+	}
+	udpProxy.mu.RUnlock()
 
-	// Check if there is a listener
-	if listener == nil || udpProxy.GetStatus() != globals.RunningStatus {
-		// Get the address of the UDP server
-		addr := net.UDPAddr{
-			Port: udpProxy.service.GetPort(),
-		}
+	if listener == nil {
+		listener, err = udpProxy.NewListener()
+	}
+	return
+}
 
-		listener, err = net.ListenUDP(globals.UDP.String(), &addr)
-		if err != nil {
-			return
-		}
-		udpProxy.listener = listener
-		udpProxy.AbstractProxy.listener = listener
+// Listen on the port of the proxy
+func (udpProxy *UDPProxy) NewListener() (listener *net.UDPConn, err error) {
+	addr := net.UDPAddr{
+		Port: udpProxy.GetPort(),
 	}
 
+	return net.ListenUDP(udpProxy.GetNetwork().String(), &addr)
+}
+
+// Returns the idle timeout of the sessions
+func (udpProxy *UDPProxy) GetIdleTimeout() time.Duration {
+	return time.Duration(atomic.LoadInt64(&udpProxy.idleTimeout))
+}
+
+// Set the time after which the session of a client that exchanged no datagrams is closed
+func (udpProxy *UDPProxy) SetIdleTimeout(timeout time.Duration) {
+	atomic.StoreInt64(&udpProxy.idleTimeout, int64(timeout))
+}
+
+// Get the connection of a client, or create a new one.
+// Returns nil if the proxy is not running
+func (udpProxy *UDPProxy) getClient(listener *net.UDPConn, addr *net.UDPAddr) (conn *udpConn, isNew bool) {
+	udpProxy.clientsMu.Lock()
+	defer udpProxy.clientsMu.Unlock()
+
+	if udpProxy.GetStatus() != globals.RunningStatus {
+		return
+	}
+
+	conn, ok := udpProxy.clients[addr.String()]
+	if !ok && udpProxy.draining {
+		return
+	}
+	if !ok {
+		conn = newUDPConn(listener, addr)
+		udpProxy.clients[addr.String()] = conn
+		isNew = true
+	}
 	return
 }
 
-// TODO: Test this function
-// UDP asynchronous tunnel
-func (udpProxy *UDPProxy) handle(client *net.UDPConn, server *net.UDPConn) {
-	var buf [2 << 10]byte
-	var wg sync.WaitGroup
-	wg.Add(2)
+// Remove the connection of a client, the next datagram of the client starts a new session
+func (udpProxy *UDPProxy) removeClient(conn *udpConn) {
+	udpProxy.clientsMu.Lock()
+	defer udpProxy.clientsMu.Unlock()
 
-	// Function to copy messages from one pipe to the other
-	var handle = func(from *net.UDPConn, to *net.UDPConn) {
-		n, addr, err := from.ReadFrom(buf[0:])
-		if err != nil {
-			lr.Log.Warn().Err(err)
-		}
+	if udpProxy.clients[conn.client.String()] == conn {
+		delete(udpProxy.clients, conn.client.String())
+	}
 
-		_, err = to.WriteTo(buf[:n], addr)
-		if err != nil {
-			lr.Log.Warn().Err(err)
-		}
+	if udpProxy.idle != nil && len(udpProxy.clients) == 0 {
+		close(udpProxy.idle)
+		udpProxy.idle = nil
 	}
+}
 
+// Apply the middlewares to a new client and relay its datagrams to the service
+func (udpProxy *UDPProxy) serve(client *udpConn) {
+	defer udpProxy.removeClient(client)
 	defer client.Close()
+
+	// Track the flow of the client in a new session
+	session := udpProxy.sessions.New(udpProxy.GetID(), client.RemoteAddr())
+	flow := NewFlow(client, udpProxy, session)
+
+	// Count the connection while it is open
+	flow.metrics = newConnMetrics(udpProxy)
+	defer flow.metrics.close()
+
+	// Apply the middlewares to the client before dialing the server
+	action, err := udpProxy.applyMiddlewares(flow)
+	if err != nil {
+		lr.Log.Warn().Err(err).Str("proxy", udpProxy.GetID()).Msg("Connection rejected by a middleware")
+	}
+	if action == Deny {
+		session.Close(RejectedReason)
+		return
+	}
+
+	// Publish the connection
+	udpProxy.emitConnection(session, client.LocalAddr())
+
+	if flow.Service == nil {
+		session.Close(DialFailedReason)
+		return
+	}
+
+	// Get a connection to the server for each new connection with the client,
+	// applying the down policy of the proxy if it can not be reached
+	server, reason := udpProxy.dialService(flow)
+	if server == nil {
+		session.Close(reason)
+		return
+	}
 	defer server.Close()
+	defer flow.metrics.relay(flow.Service.GetName())()
+
+	// Keep the address used to reach the service, to attribute its events to the session
+	session.SetUpstream(server.LocalAddr())
+
+	// Handle the datagrams between the client and the server
+	udpProxy.handle(flow, server)
+}
+
+// UDP tunnel that relays the datagrams of the client of the flow to the server and back,
+// until either side fails or the flow is idle for too long
+func (udpProxy *UDPProxy) handle(flow *Flow, to net.Conn) {
+	from := flow.Conn
+	session := flow.Session
+
+	var wg sync.WaitGroup
+	wg.Add(2)
+
+	// Time of the last datagram relayed in any direction, in nanoseconds
+	last := time.Now().UnixNano()
+
+	// Observers of the datagrams relayed in each direction
+	inbound := append([]func(p []byte){func(p []byte) { session.AddBytesIn(len(p)) }}, flow.observe(true)...)
+	outbound := append([]func(p []byte){func(p []byte) { session.AddBytesOut(len(p)) }}, flow.observe(false)...)
+
+	// Close the session when it exceeds the maximum duration or bytes
+	limit, done := udpProxy.limitSession(flow, to)
+	defer done()
+	if limit != nil {
+		inbound = append(inbound, limit)
+		outbound = append(outbound, limit)
+	}
+
+	// Synthesize the packets of the datagrams when writing pcapng files
+	if recorder := udpProxy.getPcap(); recorder != nil {
+		inbound = append(inbound, func(p []byte) {
+			recorder.Write(time.Now(), pcap.UDPDatagram(from.RemoteAddr(), from.LocalAddr(), true, p))
+		})
+		outbound = append(outbound, func(p []byte) {
+			recorder.Write(time.Now(), pcap.UDPDatagram(from.LocalAddr(), from.RemoteAddr(), false, p))
+		})
+	}
+
+	handler := func(source net.Conn, dest net.Conn, observers []func(p []byte), reason string) {
+		defer wg.Done()
 
-	go handle(client, server)
-	go handle(server, client)
+		writer := &observingWriter{writer: dest, observers: observers}
+		buf := make([]byte, udpBufferSize)
+
+		for {
+			// Wake up when the flow would be idle for too long
+			idle := udpProxy.GetIdleTimeout()
+			source.SetReadDeadline(time.Unix(0, atomic.LoadInt64(&last)).Add(idle))
+
+			n, err := source.Read(buf)
+			if n > 0 {
+				atomic.StoreInt64(&last, time.Now().UnixNano())
+				if _, err := writer.Write(buf[:n]); err != nil {
+					lr.Log.Warn().Err(err).Msg("Could not relay the datagram")
+				}
+			}
+
+			if err == nil {
+				continue
+			}
+
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				// The other direction may have relayed a datagram in the meantime
+				if time.Since(time.Unix(0, atomic.LoadInt64(&last))) < udpProxy.GetIdleTimeout() {
+					continue
+				}
+				reason = IdleTimeoutReason
+			}
+			break
+		}
+
+		// The first side to finish determines why the session is closed
+		session.SetCloseReason(reason)
+
+		// Close both sides, so the other direction stops as well
+		source.Close()
+		dest.Close()
+	}
+
+	go handler(from, to, inbound, ClientClosedReason)
+	go handler(to, from, outbound, ServiceClosedReason)
 
 	// Wait until the forwarding is done
 	wg.Wait()
+	session.Close(ClientClosedReason)
 }
 
 func NewUDPProxy(port int) (proxy *UDPProxy, err error) {
 	// Create a new proxy
 	proxy = &UDPProxy{
 		AbstractProxy: NewAbstractProxy(port, globals.UDP),
+		clients:       make(map[string]*udpConn),
+		idleTimeout:   int64(UDPIdleTimeout),
 	}
 
 	// Set the port
 	proxy.SetPort(port)
 	return
 }
+
+// Connection with a UDP client, built from the datagrams received by the listener of the proxy.
+// The replies are written to the client through the same listener
+type udpConn struct {
+	listener *net.UDPConn
+	client   *net.UDPAddr
+
+	// Datagrams received from the client and not read yet
+	in        chan []byte
+	closed    chan struct{}
+	closeOnce sync.Once
+
+	mu       sync.Mutex
+	deadline time.Time
+}
+
+// Queue a datagram of the client, it is dropped if the queue is full
+func (c *udpConn) push(datagram []byte) {
+	select {
+	case c.in <- datagram:
+	default:
+	}
+}
+
+// Read the next datagram of the client
+func (c *udpConn) Read(p []byte) (n int, err error) {
+	c.mu.Lock()
+	deadline := c.deadline
+	c.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if !deadline.IsZero() {
+		timer := time.NewTimer(time.Until(deadline))
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	select {
+	case datagram := <-c.in:
+		n = copy(p, datagram)
+	case <-c.closed:
+		err = net.ErrClosed
+	case <-timeout:
+		err = os.ErrDeadlineExceeded
+	}
+	return
+}
+
+// Send a datagram to the client
+func (c *udpConn) Write(p []byte) (n int, err error) {
+	select {
+	case <-c.closed:
+		err = net.ErrClosed
+		return
+	default:
+	}
+
+	return c.listener.WriteToUDP(p, c.client)
+}
+
+func (c *udpConn) Close() error {
+	c.closeOnce.Do(func() { close(c.closed) })
+	return nil
+}
+
+func (c *udpConn) LocalAddr() net.Addr {
+	return c.listener.LocalAddr()
+}
+
+func (c *udpConn) RemoteAddr() net.Addr {
+	return c.client
+}
+
+func (c *udpConn) SetDeadline(t time.Time) error {
+	return c.SetReadDeadline(t)
+}
+
+func (c *udpConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.deadline = t
+	return nil
+}
+
+// Writes do not block, the deadline is ignored
+func (c *udpConn) SetWriteDeadline(t time.Time) error {
+	return nil
+}
+
+func newUDPConn(listener *net.UDPConn, client *net.UDPAddr) *udpConn {
+	return &udpConn{
+		listener: listener,
+		client:   client,
+		in:       make(chan []byte, udpQueueSize),
+		closed:   make(chan struct{}),
+	}
+}
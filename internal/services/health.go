@@ -0,0 +1,182 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+)
+
+var (
+	// Health checker of the services registered in the manager
+	HealthChecks = NewHealthChecker(Services, 2*time.Second)
+)
+
+type Health string
+
+// Health of a service
+const (
+	// The service was not checked yet, e.g. plugins are not checked
+	UnknownHealth Health = "unknown"
+	// The service answered the last probe
+	UpHealth Health = "up"
+	// The service could not be reached in the last probe
+	DownHealth Health = "down"
+)
+
+// Result of the last probe of a service
+type HealthStatus struct {
+	Health Health    `json:"status"`
+	Time   time.Time `json:"checked,omitempty"`
+	// Error of the probe, when the service is down
+	Error string `json:"error,omitempty"`
+}
+
+// Checker that probes the external services periodically, i.e. the services that are not plugins.
+// TCP services are up when they accept a connection, and UDP services unless the host
+// refuses the datagrams sent to the port (i.e. ICMP port unreachable)
+type HealthChecker struct {
+	mu sync.RWMutex
+	// Last status of the services by their ID
+	status map[string]HealthStatus
+
+	// Manager of the services checked
+	manager ServiceManager
+	// Time to wait for the services to answer
+	timeout time.Duration
+	// Notifier of the changes of health
+	changes events.Notifier
+}
+
+// Returns the last status of the service
+func (hc *HealthChecker) GetHealth(id string) HealthStatus {
+	hc.mu.RLock()
+	defer hc.mu.RUnlock()
+
+	status, ok := hc.status[id]
+	if !ok {
+		status = HealthStatus{Health: UnknownHealth}
+	}
+	return status
+}
+
+// Set the time to wait for the services to answer
+func (hc *HealthChecker) SetTimeout(timeout time.Duration) {
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	hc.timeout = timeout
+}
+
+// Returns whether the last probe found the service down
+func (hc *HealthChecker) IsDown(id string) bool {
+	return hc.GetHealth(id).Health == DownHealth
+}
+
+// Probe a service and keep its status
+func (hc *HealthChecker) Check(service Service) (status HealthStatus) {
+	status = HealthStatus{Health: UpHealth, Time: time.Now()}
+	if err := hc.probe(service); err != nil {
+		status.Health = DownHealth
+		status.Error = err.Error()
+	}
+
+	hc.mu.Lock()
+	previous, ok := hc.status[service.GetID()]
+	hc.status[service.GetID()] = status
+	hc.mu.Unlock()
+
+	// Notify when the health changes
+	if !ok || previous.Health != status.Health {
+		hc.changes.Notify(events.NewChange(events.UpdatedChange, events.ServiceResource, service.GetID()))
+	}
+	return
+}
+
+// Probe every external service, and forget the status of the services deleted
+func (hc *HealthChecker) CheckAll() {
+	registered := map[string]bool{}
+
+	var wg sync.WaitGroup
+	for _, service := range hc.manager.GetServices() {
+		if _, ok := service.(PluginService); ok {
+			continue
+		}
+		registered[service.GetID()] = true
+
+		wg.Add(1)
+		go func(service Service) {
+			defer wg.Done()
+			hc.Check(service)
+		}(service)
+	}
+	wg.Wait()
+
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+
+	for id := range hc.status {
+		if !registered[id] {
+			delete(hc.status, id)
+		}
+	}
+}
+
+// Probe the services every interval until the channel is closed
+func (hc *HealthChecker) Run(interval time.Duration, stop <-chan struct{}) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		hc.CheckAll()
+
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
+
+// Returns an error if the service can not be reached
+func (hc *HealthChecker) probe(service Service) (err error) {
+	hc.mu.RLock()
+	timeout := hc.timeout
+	hc.mu.RUnlock()
+
+	conn, err := net.DialTimeout(service.GetNetwork().String(), service.GetAddress(), timeout)
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	if service.GetNetwork() != globals.UDP {
+		return
+	}
+
+	// Send an empty datagram, the host answers with an ICMP error if nothing listens in the port.
+	// Services that do not answer at all are considered up
+	if _, err = conn.Write([]byte{}); err != nil {
+		return
+	}
+
+	conn.SetReadDeadline(time.Now().Add(timeout))
+	_, err = conn.Read(make([]byte, 1))
+	if errors.Is(err, os.ErrDeadlineExceeded) {
+		err = nil
+	}
+	return
+}
+
+func NewHealthChecker(manager ServiceManager, timeout time.Duration) *HealthChecker {
+	return &HealthChecker{
+		status:  make(map[string]HealthStatus),
+		manager: manager,
+		timeout: timeout,
+		changes: events.Changes,
+	}
+}
@@ -4,17 +4,29 @@ This package contains implementations of the services manager
 package services
 
 import (
+	"errors"
 	"fmt"
+	"strings"
+	"sync"
+	"time"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	lr "github.com/riotpot/internal/logger"
-	"golang.org/x/exp/slices"
 )
 
 var (
 	Services = NewServiceManager()
 )
 
+var (
+	// The service is referenced elsewhere, e.g., in the failover chain of a proxy
+	ErrServiceInUse = errors.New("service in use")
+)
+
+// Function that returns the references to a service that keep it from being deleted
+type ReferencesFunc func(id string) []string
+
 func RemovableService(service Service) (isRemovable bool) {
 	// Add here the interfaces of services that should not be removable
 	switch service.(type) {
@@ -32,8 +44,13 @@ type ServiceManager interface {
 
 	CreateService(name string, port int, network globals.Network, host string, interaction globals.Interaction) (Service, error)
 
-	// Delete a service
+	// Register a service created elsewhere, validating its name and address
+	RegisterService(service Service) (Service, error)
+
+	// Delete a service, unless it is referenced
 	DeleteService(id string) (err error)
+	// Register a function that returns the references to the services
+	AddReferences(references ReferencesFunc)
 
 	// Get the list of services by their name
 	GetServices() []Service
@@ -46,116 +63,204 @@ type ServiceManager interface {
 
 	// Start the plugin services
 	Start(ids ...string) ([]Service, []error)
+	// Stop the plugin services
+	Stop(ids ...string) ([]Service, []error)
+	// Stop the plugin services if they are running, and start them again
+	Restart(ids ...string) ([]Service, []error)
+	// Stop every running plugin service, waiting for them for up to the timeout
+	Shutdown(timeout time.Duration) []error
 }
 
 type ServiceManagerItem struct {
 	ServiceManager
 
-	// Set of services registered
-	services []Service
+	mu sync.RWMutex
+	// Set of services registered by their ID
+	services map[string]Service
+	// IDs of the services, in the order in which they were registered
+	order []string
+
+	// Emitter injected into the services to publish their events
+	emitter events.Emitter
+	// Notifier of the changes of the services
+	changes events.Notifier
+	// Functions that return the references to the services
+	references []ReferencesFunc
 }
 
-// Add a service to the services map if it did not exist
-func (se *ServiceManagerItem) AddServices(services ...Service) (serv []Service, err error) {
-	// Returns a list of ID strings
-	getServicesIDs := func(services []Service) (servs []string) {
-		for _, service := range services {
-			servs = append(servs, service.GetID())
-		}
-		return
+// Add a service to the registry. Must be called with the lock held
+func (se *ServiceManagerItem) add(service Service) {
+	service.SetEmitter(se.emitter)
+	if n, ok := service.(notifiable); ok {
+		n.setNotifier(se.changes)
 	}
 
-	// Convert the registered services into a simple array
-	registeredIDs := getServicesIDs(se.GetServices())
+	se.services[service.GetID()] = service
+	se.order = append(se.order, service.GetID())
+}
 
-	// Iterate the slice of services provided and add them to the services map
-	for _, service := range services {
-		serviceID := service.GetID()
+// Notify a change of a service
+func (se *ServiceManagerItem) notify(kind events.ChangeKind, id string) {
+	se.changes.Notify(events.NewChange(kind, events.ServiceResource, id))
+}
 
+// Add a service to the services map if it did not exist
+func (se *ServiceManagerItem) AddServices(services ...Service) (serv []Service, err error) {
+	se.mu.Lock()
+	for _, service := range services {
 		// Check whether the service is registered, and if not, add it to the list
-		if !slices.Contains(registeredIDs, serviceID) {
+		if _, ok := se.services[service.GetID()]; !ok {
+			se.add(service)
 			serv = append(serv, service)
 		}
 	}
+	se.mu.Unlock()
 
-	// Add the services to the registered services array
-	se.services = append(se.services, serv...)
+	for _, service := range serv {
+		se.notify(events.CreatedChange, service.GetID())
+	}
 
 	return
 }
 
 // Creates a new service and register it in the manager
 func (se *ServiceManagerItem) CreateService(name string, port int, network globals.Network, host string, interaction globals.Interaction) (s Service, err error) {
-	// Iterate the services to determine whether the
-	for _, service := range se.GetServices() {
+	return se.RegisterService(NewService(name, port, network, host, interaction))
+}
+
+// Register a service if its ID, name and address are not taken
+func (se *ServiceManagerItem) RegisterService(service Service) (s Service, err error) {
+	se.mu.Lock()
+
+	if _, ok := se.services[service.GetID()]; ok {
+		se.mu.Unlock()
+		err = fmt.Errorf("service already registered")
+		return
+	}
+
+	// Iterate the services to determine whether the name or the address are taken
+	for _, registered := range se.services {
 		// Validate the name
-		if service.GetName() == name {
+		if registered.GetName() == service.GetName() {
+			se.mu.Unlock()
 			err = fmt.Errorf("service name already taken")
 			return
 		}
 
 		// Validate the address
-		if service.GetPort() == port && service.GetNetwork() == network && service.GetHost() == host {
+		if registered.GetPort() == service.GetPort() && registered.GetNetwork() == service.GetNetwork() && registered.GetHost() == service.GetHost() {
+			se.mu.Unlock()
 			err = fmt.Errorf("service address already taken")
 			return
 		}
 	}
 
-	// Create the new service
-	s = NewService(name, port, network, host, interaction)
+	se.add(service)
+	se.mu.Unlock()
 
-	// Append the new service to the list
-	se.services = append(se.services, s)
+	se.notify(events.CreatedChange, service.GetID())
+	s = service
 	return
 }
 
 // Remove a service from the list of registered
 func (se *ServiceManagerItem) DeleteService(id string) (err error) {
-	// Get all the services
-	services := se.GetServices()
-
-	for ind, service := range services {
+	se.mu.Lock()
 
-		// Check if the service id is equal to the one received
-		if service.GetID() == id {
-
-			if service.IsLocked() {
-				// If it was not found by this point, return an error
-				err = fmt.Errorf("service locked")
-				return
-			}
+	service, ok := se.services[id]
+	if !ok {
+		se.mu.Unlock()
+		// If it was not found by this point, return an error
+		err = fmt.Errorf("service not found")
+		return
+	}
 
-			// Remove it from the slice by replacing it with the last item from the slice,
-			// and reducing the slice by 1 element
-			lastInd := len(services) - 1
+	if service.IsLocked() {
+		se.mu.Unlock()
+		err = fmt.Errorf("service locked")
+		return
+	}
 
-			services[ind] = services[lastInd]
-			se.services = services[:lastInd]
+	// The references are checked with the lock held, so the service can not be referenced
+	// through the registry while it is being deleted
+	references := []string{}
+	for _, refs := range se.references {
+		references = append(references, refs(id)...)
+	}
+	if len(references) > 0 {
+		se.mu.Unlock()
+		err = fmt.Errorf("%w: referenced by %s", ErrServiceInUse, strings.Join(references, ", "))
+		return
+	}
 
-			return
+	delete(se.services, id)
+	for ind, sid := range se.order {
+		if sid == id {
+			se.order = append(se.order[:ind], se.order[ind+1:]...)
+			break
 		}
 	}
+	se.mu.Unlock()
 
-	// If it was not found by this point, return an error
-	err = fmt.Errorf("service not found")
+	se.notify(events.DeletedChange, id)
 	return
 }
 
-// Get services by name from the list of registered services
-func (se *ServiceManagerItem) GetServices() []Service {
-	return se.services
+// Register a function that returns the references to a service, checked before deleting it.
+// The function must not call the manager
+func (se *ServiceManagerItem) AddReferences(references ReferencesFunc) {
+	se.mu.Lock()
+	defer se.mu.Unlock()
+
+	se.references = append(se.references, references)
 }
 
-func (se *ServiceManagerItem) GetService(id string) (ret Service, err error) {
+// Returns the services registered, in the order in which they were registered
+func (se *ServiceManagerItem) GetServices() (services []Service) {
+	se.mu.RLock()
+	defer se.mu.RUnlock()
+
+	services = make([]Service, 0, len(se.order))
+	for _, id := range se.order {
+		services = append(services, se.services[id])
+	}
+	return
+}
+
+// Returns the IDs of the plugin services registered
+func (se *ServiceManagerItem) GetPluginIDs() (ids []string) {
 	for _, service := range se.GetServices() {
-		if service.GetID() == id {
-			ret = service
-			return
+		if _, ok := service.(PluginService); ok {
+			ids = append(ids, service.GetID())
 		}
 	}
+	return
+}
+
+func (se *ServiceManagerItem) GetService(id string) (ret Service, err error) {
+	se.mu.RLock()
+	defer se.mu.RUnlock()
 
-	// If it was not found by this point, return an error
-	err = fmt.Errorf("service not found")
+	ret, ok := se.services[id]
+	if !ok {
+		// If it was not found by this point, return an error
+		err = fmt.Errorf("service not found")
+	}
+	return
+}
+
+// Returns the plugin service by ID
+func (se *ServiceManagerItem) getPlugin(id string) (plugin PluginService, err error) {
+	serv, err := se.GetService(id)
+	if err != nil {
+		return
+	}
+
+	plugin, ok := serv.(PluginService)
+	// If the service is not a plugin return an error
+	if !ok {
+		err = fmt.Errorf("service %s can not be started or stopped", serv.GetName())
+	}
 	return
 }
 
@@ -163,22 +268,103 @@ func (se *ServiceManagerItem) GetService(id string) (ret Service, err error) {
 // Returns both arrays of errors and the started services
 func (se *ServiceManagerItem) Start(ids ...string) (servs []Service, err []error) {
 	for _, id := range ids {
-		serv, e := se.GetService(id)
+		plugin, e := se.getPlugin(id)
 		if e != nil {
 			err = append(err, e)
+			continue
 		}
 
-		i, ok := serv.(PluginService)
-		// If the service is not a plugin return an error
-		if !ok {
-			err = append(err, fmt.Errorf("service %s can not be started", serv.GetName()))
+		// Run the service
+		if e := plugin.launch(plugin.Run); e != nil {
+			err = append(err, e)
+			continue
 		}
 
-		// Run the service
-		go i.Run()
+		lr.Log.Log().Msg(fmt.Sprintf("Service %s started", plugin.GetName()))
+		se.notify(events.StartedChange, id)
+		servs = append(servs, plugin)
+	}
+
+	return
+}
+
+// Stop each of the given Plugin Services by ID, waiting for them to close their listener.
+// Returns both arrays of errors and the stopped services
+func (se *ServiceManagerItem) Stop(ids ...string) (servs []Service, err []error) {
+	for _, id := range ids {
+		plugin, e := se.getPlugin(id)
+		if e != nil {
+			err = append(err, e)
+			continue
+		}
 
-		lr.Log.Log().Msg(fmt.Sprintf("Service %s started", serv.GetName()))
-		servs = append(servs, serv)
+		if e := plugin.Stop(); e != nil {
+			err = append(err, e)
+			continue
+		}
+
+		lr.Log.Log().Msg(fmt.Sprintf("Service %s stopped", plugin.GetName()))
+		se.notify(events.StoppedChange, id)
+		servs = append(servs, plugin)
+	}
+
+	return
+}
+
+// Restart each of the given Plugin Services by ID, e.g. to listen in a new address.
+// The services stopped are started as well
+func (se *ServiceManagerItem) Restart(ids ...string) (servs []Service, err []error) {
+	for _, id := range ids {
+		plugin, e := se.getPlugin(id)
+		if e != nil {
+			err = append(err, e)
+			continue
+		}
+
+		if plugin.GetStatus() == globals.RunningStatus {
+			if _, errs := se.Stop(id); len(errs) > 0 {
+				err = append(err, errs...)
+				continue
+			}
+		}
+
+		started, errs := se.Start(id)
+		err = append(err, errs...)
+		servs = append(servs, started...)
+	}
+
+	return
+}
+
+// Stop every running plugin service at once.
+// The plugins that do not return from their run loop within the timeout are left behind
+func (se *ServiceManagerItem) Shutdown(timeout time.Duration) (errs []error) {
+	running := []string{}
+	for _, id := range se.GetPluginIDs() {
+		if plugin, err := se.getPlugin(id); err == nil && plugin.GetStatus() == globals.RunningStatus {
+			running = append(running, id)
+		}
+	}
+
+	stopped := make(chan []error, len(running))
+	for _, id := range running {
+		go func(id string) {
+			_, errs := se.Stop(id)
+			stopped <- errs
+		}(id)
+	}
+
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+
+	for range running {
+		select {
+		case e := <-stopped:
+			errs = append(errs, e...)
+		case <-timer.C:
+			errs = append(errs, fmt.Errorf("timed out waiting for the plugins to stop"))
+			return
+		}
 	}
 
 	return
@@ -188,7 +374,10 @@ func (se *ServiceManagerItem) Start(ids ...string) (servs []Service, err []error
 func NewServiceManager() (manager ServiceManager) {
 	// Initialise the manager
 	manager = &ServiceManagerItem{
-		services: []Service{},
+		services: make(map[string]Service),
+		order:    make([]string, 0),
+		emitter:  events.Events,
+		changes:  events.Changes,
 	}
 
 	return
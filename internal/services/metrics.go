@@ -0,0 +1,14 @@
+package services
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/riotpot/internal/metrics"
+)
+
+// Metrics of the services, labelled by the name of the service
+var (
+	authAttempts = metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "riotpot_service_auth_attempts_total",
+		Help: "Number of authentication attempts observed by the service",
+	}, []string{"service"})
+)
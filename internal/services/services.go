@@ -3,10 +3,16 @@
 package services
 
 import (
+	"context"
 	"fmt"
+	"net"
+	"strings"
+	"sync"
 
 	"github.com/google/uuid"
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
+	lr "github.com/riotpot/internal/logger"
 	"github.com/riotpot/internal/validators"
 )
 
@@ -29,6 +35,12 @@ type Service interface {
 	SetName(name string)
 	SetHost(host string)
 	SetLocked(locked bool) (bool, error)
+
+	// Events
+	GetEmitter() events.Emitter
+	SetEmitter(emitter events.Emitter)
+	// Publish an event observed by the service in a connection
+	Emit(remote net.Addr, local net.Addr, payload events.Payload)
 }
 
 // Implements a mixin service that can be used as a base for any other service `struct` type.
@@ -43,14 +55,50 @@ type AbstractService struct {
 	host        string
 	locked      bool
 	interaction globals.Interaction
+
+	// Emitter used to publish the events observed
+	emitter events.Emitter
+
+	mu sync.RWMutex
+	// Notifier of the changes, set when the service is registered in a manager
+	notifier events.Notifier
+}
+
+// Services that notify their changes once registered in a manager
+type notifiable interface {
+	setNotifier(notifier events.Notifier)
+}
+
+func (as *AbstractService) setNotifier(notifier events.Notifier) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.notifier = notifier
+}
+
+// Notify that the service was updated
+func (as *AbstractService) notifyUpdate() {
+	as.mu.RLock()
+	notifier := as.notifier
+	as.mu.RUnlock()
+
+	if notifier != nil {
+		notifier.Notify(events.NewChange(events.UpdatedChange, events.ServiceResource, as.GetID()))
+	}
 }
 
 // Getters
 func (as *AbstractService) GetID() string {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
 	return as.id.String()
 }
 
 func (as *AbstractService) GetName() string {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
 	return as.name
 }
 
@@ -63,18 +111,30 @@ func (as *AbstractService) GetInteraction() globals.Interaction {
 }
 
 func (as *AbstractService) GetPort() int {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
 	return as.port
 }
 
 func (as *AbstractService) GetHost() string {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
 	return as.host
 }
 
 func (as *AbstractService) GetAddress() string {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
 	return fmt.Sprintf("%s:%d", as.host, as.port)
 }
 
 func (as *AbstractService) IsLocked() bool {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
 	return as.locked
 }
 
@@ -85,34 +145,184 @@ func (as *AbstractService) SetPort(port int) (p int, err error) {
 		return
 	}
 
-	p = port
+	as.mu.Lock()
 	as.port = port
+	as.mu.Unlock()
+
+	p = port
+	as.notifyUpdate()
 	return
 }
 
 func (as *AbstractService) SetName(name string) {
+	as.mu.Lock()
 	as.name = name
+	as.mu.Unlock()
+
+	as.notifyUpdate()
 }
 
 func (as *AbstractService) SetHost(host string) {
+	as.mu.Lock()
 	as.host = host
+	as.mu.Unlock()
+
+	as.notifyUpdate()
+}
+
+// Set the ID, used to restore a service with the same ID.
+// It must be set before the service is registered in a manager
+func (as *AbstractService) SetID(id string) (err error) {
+	uid, err := uuid.Parse(id)
+	if err != nil {
+		return
+	}
+
+	as.mu.Lock()
+	as.id = uid
+	as.mu.Unlock()
+	return
 }
 
 func (as *AbstractService) SetLocked(locked bool) (bool, error) {
+	as.mu.Lock()
 	as.locked = locked
-	return as.locked, nil
+	as.mu.Unlock()
+
+	as.notifyUpdate()
+	return locked, nil
+}
+
+// Events
+func (as *AbstractService) GetEmitter() events.Emitter {
+	as.mu.RLock()
+	defer as.mu.RUnlock()
+
+	return as.emitter
+}
+
+func (as *AbstractService) SetEmitter(emitter events.Emitter) {
+	as.mu.Lock()
+	defer as.mu.Unlock()
+
+	as.emitter = emitter
+}
+
+// Publish an event including the information about the service.
+// The event is dropped if there is no emitter set
+func (as *AbstractService) Emit(remote net.Addr, local net.Addr, payload events.Payload) {
+	// Count the authentication attempts, even if the events are not published
+	if payload.Kind() == events.CredentialKind {
+		authAttempts.WithLabelValues(as.GetName()).Inc()
+	}
+
+	emitter := as.GetEmitter()
+	if emitter == nil {
+		return
+	}
+
+	event := events.NewEvent(remote, local, payload)
+	event.ServiceID = as.GetID()
+	event.Service = as.GetName()
+	event.Protocol = strings.ToLower(as.GetName())
+
+	emitter.Emit(event)
 }
 
 // Implementation of a plugin-based service
 // These services are stored localy as binary files that are mounted into the
-// application as symbols that can be called
+// application as symbols that can be called.
+// Plugins must embed the `PluginServiceItem` given by `NewPluginService`, which keeps track of the run loop.
+// The interface can not be implemented otherwise, see the migration notes in `docs/plugin.template`
 type PluginService interface {
-	Run() error
+	Service
+
+	// Run the service until the context is cancelled, closing its listener
+	Run(ctx context.Context) error
+	// Stop the service, waiting for the run loop to return
+	Stop() error
+	// Returns whether the service is running
+	GetStatus() globals.Status
+
+	// Launch the run loop of the service in the background
+	launch(run func(ctx context.Context) error) error
 }
 
 type PluginServiceItem struct {
-	PluginService
 	service *AbstractService
+
+	mu sync.Mutex
+	// Cancels the context of the run loop
+	cancel context.CancelFunc
+	// Closed when the run loop returns
+	done chan struct{}
+}
+
+func (aps *PluginServiceItem) launch(run func(ctx context.Context) error) (err error) {
+	aps.mu.Lock()
+	defer aps.mu.Unlock()
+
+	if aps.running() {
+		err = fmt.Errorf("service already running")
+		return
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	aps.cancel, aps.done = cancel, done
+
+	go func() {
+		defer close(done)
+		defer cancel()
+
+		if err := run(ctx); err != nil && ctx.Err() == nil {
+			lr.Log.Error().Err(err).Str("service", aps.GetName()).Msg("Service stopped")
+		}
+	}()
+
+	return
+}
+
+// Stop the service, waiting for the run loop to return
+func (aps *PluginServiceItem) Stop() (err error) {
+	aps.mu.Lock()
+	if !aps.running() {
+		aps.mu.Unlock()
+		err = fmt.Errorf("service not running")
+		return
+	}
+
+	aps.cancel()
+	done := aps.done
+	aps.mu.Unlock()
+
+	<-done
+	return
+}
+
+// Returns whether the run loop of the service is running
+func (aps *PluginServiceItem) GetStatus() (status globals.Status) {
+	aps.mu.Lock()
+	defer aps.mu.Unlock()
+
+	if aps.running() {
+		status = globals.RunningStatus
+	}
+	return
+}
+
+// Whether the run loop was launched and did not return yet. The mutex must be held
+func (aps *PluginServiceItem) running() bool {
+	if aps.done == nil {
+		return false
+	}
+
+	select {
+	case <-aps.done:
+		return false
+	default:
+		return true
+	}
 }
 
 func (aps *PluginServiceItem) GetID() string {
@@ -163,6 +373,22 @@ func (aps *PluginServiceItem) SetLocked(locked bool) (bool, error) {
 	return true, fmt.Errorf("the lock status of this service can not change")
 }
 
+func (aps *PluginServiceItem) GetEmitter() events.Emitter {
+	return aps.service.GetEmitter()
+}
+
+func (aps *PluginServiceItem) SetEmitter(emitter events.Emitter) {
+	aps.service.SetEmitter(emitter)
+}
+
+func (aps *PluginServiceItem) setNotifier(notifier events.Notifier) {
+	aps.service.setNotifier(notifier)
+}
+
+func (aps *PluginServiceItem) Emit(remote net.Addr, local net.Addr, payload events.Payload) {
+	aps.service.Emit(remote, local, payload)
+}
+
 func NewService(name string, port int, network globals.Network, host string, interaction globals.Interaction) *AbstractService {
 	return &AbstractService{
 		id:          uuid.New(),
@@ -175,7 +401,7 @@ func NewService(name string, port int, network globals.Network, host string, int
 }
 
 // Simple constructor for plugin services
-func NewPluginService(name string, port int, network globals.Network) Service {
+func NewPluginService(name string, port int, network globals.Network) *PluginServiceItem {
 	return &PluginServiceItem{
 		service: NewService(name, port, network, "localhost", globals.Low),
 	}
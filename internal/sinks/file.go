@@ -0,0 +1,169 @@
+package sinks
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Sink writing the entries in a JSON-lines file, one document per line.
+// The file is rotated by size and age: the current file is renamed with the time of the
+// rotation and a new one is opened, keeping only a number of rotated files
+type FileSink struct {
+	mu sync.Mutex
+
+	path string
+	// Rotate the file after reaching the size (bytes) or age. Zero disables the rotation
+	maxSize int64
+	maxAge  time.Duration
+	// Number of rotated files kept. Zero keeps all of them
+	maxFiles int
+
+	file   *os.File
+	size   int64
+	opened time.Time
+	closed bool
+}
+
+// Open the file, appending to it if it exists
+func (fs *FileSink) open() (err error) {
+	if err = os.MkdirAll(filepath.Dir(fs.path), 0755); err != nil {
+		return
+	}
+
+	file, err := os.OpenFile(fs.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0640)
+	if err != nil {
+		return
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return
+	}
+
+	fs.file = file
+	fs.size = info.Size()
+	fs.opened = time.Now()
+	return
+}
+
+// Rename the file and open a new one when the limits are reached
+func (fs *FileSink) rotate() (err error) {
+	full := fs.maxSize > 0 && fs.size >= fs.maxSize
+	old := fs.maxAge > 0 && time.Since(fs.opened) >= fs.maxAge
+	if (!full && !old) || fs.size == 0 {
+		return
+	}
+
+	fs.file.Close()
+	fs.file = nil
+
+	rotated := fmt.Sprintf("%s.%s", fs.path, time.Now().UTC().Format("20060102T150405.000000000"))
+	renamed := os.Rename(fs.path, rotated)
+	if renamed == nil {
+		fs.prune()
+	}
+
+	// Keep writing in the same file when it could not be renamed
+	if err = fs.open(); err == nil {
+		err = renamed
+	}
+	return
+}
+
+// Remove the oldest rotated files exceeding the number kept
+func (fs *FileSink) prune() {
+	if fs.maxFiles <= 0 {
+		return
+	}
+
+	rotated := fs.RotatedFiles()
+	if len(rotated) <= fs.maxFiles {
+		return
+	}
+
+	for _, path := range rotated[:len(rotated)-fs.maxFiles] {
+		if err := os.Remove(path); err != nil {
+			report.Warn().Err(err).Str("path", path).Msg("Could not remove the rotated file")
+		}
+	}
+}
+
+// Returns the paths to the rotated files, from the oldest to the newest
+func (fs *FileSink) RotatedFiles() (paths []string) {
+	matches, _ := filepath.Glob(fs.path + ".*")
+	for _, path := range matches {
+		// Skip the files of other sinks sharing the prefix
+		if !strings.HasPrefix(filepath.Base(path), filepath.Base(fs.path)+".2") {
+			continue
+		}
+		paths = append(paths, path)
+	}
+
+	sort.Strings(paths)
+	return
+}
+
+func (fs *FileSink) Write(entry Entry) (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return fmt.Errorf("sink closed")
+	}
+
+	if fs.file == nil {
+		if err = fs.open(); err != nil {
+			return
+		}
+	}
+	if err = fs.rotate(); err != nil {
+		report.Warn().Err(err).Str("path", fs.path).Msg("Could not rotate the file")
+		if fs.file == nil {
+			return
+		}
+	}
+
+	line := make([]byte, 0, len(entry.Data)+1)
+	n, err := fs.file.Write(append(append(line, entry.Data...), '\n'))
+	fs.size += int64(n)
+	return
+}
+
+func (fs *FileSink) Close() (err error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if fs.closed {
+		return
+	}
+	fs.closed = true
+
+	if fs.file != nil {
+		err = fs.file.Close()
+	}
+	return
+}
+
+// Create a sink writing in the file, rotated by size (bytes) and age
+func NewFileSink(path string, maxSize int64, maxAge time.Duration, maxFiles int) (fs *FileSink, err error) {
+	if path == "" {
+		err = fmt.Errorf("the path of the file is required")
+		return
+	}
+
+	fs = &FileSink{
+		path:     path,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		maxFiles: maxFiles,
+	}
+
+	err = fs.open()
+	return
+}
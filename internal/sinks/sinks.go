@@ -0,0 +1,267 @@
+/*
+This package ships the attack events and the logs of the daemon to external destinations:
+rotating JSON-lines files, syslog servers and HTTP webhooks
+*/
+package sinks
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/rs/zerolog"
+)
+
+var (
+	// Sinks used by the application, subscribed to the events and the logs once configured
+	Sinks = NewManager()
+
+	// Logger of the failures of the sinks. The daemon logs may be shipped by the sinks
+	// themselves, so the failures are only written to the standard error
+	report = zerolog.New(os.Stderr).With().Timestamp().Str("component", "sinks").Logger()
+)
+
+const (
+	// Kind of the entries with the logs of the daemon
+	LogKind = "log"
+)
+
+// Severity of an entry, following syslog
+type Severity int
+
+const (
+	Emergency Severity = iota
+	Alert
+	Critical
+	Error
+	Warning
+	Notice
+	Informational
+	Debug
+)
+
+// Entry shipped to the sinks: an attack event or a line of the logs
+type Entry struct {
+	// Kind of the event, or `log` for the logs of the daemon
+	Kind     string
+	Time     time.Time
+	Severity Severity
+	// JSON document
+	Data []byte
+}
+
+// Create an entry with an attack event
+func NewEventEntry(event *events.Event) (entry Entry, err error) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		return
+	}
+
+	severity := Notice
+	switch event.Kind {
+	case events.CredentialKind, events.CommandKind:
+		severity = Warning
+	}
+
+	entry = Entry{
+		Kind:     string(event.Kind),
+		Time:     event.Timestamp,
+		Severity: severity,
+		Data:     data,
+	}
+	return
+}
+
+// Create an entry with a line of the logs, written as JSON by zerolog
+func NewLogEntry(line []byte) Entry {
+	var fields struct {
+		Level string `json:"level"`
+	}
+	json.Unmarshal(line, &fields)
+
+	severity := Informational
+	switch fields.Level {
+	case zerolog.DebugLevel.String(), zerolog.TraceLevel.String():
+		severity = Debug
+	case zerolog.WarnLevel.String():
+		severity = Warning
+	case zerolog.ErrorLevel.String():
+		severity = Error
+	case zerolog.FatalLevel.String():
+		severity = Critical
+	case zerolog.PanicLevel.String():
+		severity = Emergency
+	}
+
+	return Entry{
+		Kind:     LogKind,
+		Time:     time.Now(),
+		Severity: severity,
+		Data:     line,
+	}
+}
+
+// Destination of the entries
+type Sink interface {
+	// Ship an entry. Sinks buffering the entries may send it later
+	Write(entry Entry) error
+	// Send the entries buffered and release the resources of the sink
+	Close() error
+}
+
+// Sink registered in the manager, with the kinds of entries it receives
+type SinkItem struct {
+	Name string
+	Sink Sink
+	// Kinds of entries shipped to the sink. Every attack event when empty
+	Kinds []string
+}
+
+// Whether the sink receives the entries of the kind
+func (si *SinkItem) Accepts(kind string) bool {
+	if len(si.Kinds) == 0 {
+		return kind != LogKind
+	}
+
+	for _, k := range si.Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
+
+// Manager of the sinks. It is an emitter of the events bus and the writer of the logs
+type Manager struct {
+	mu     sync.RWMutex
+	sinks  []*SinkItem
+	closed bool
+}
+
+// Register a sink receiving the given kinds of entries
+func (m *Manager) Add(name string, sink Sink, kinds ...string) (err error) {
+	for _, kind := range kinds {
+		if err = ValidateKind(kind); err != nil {
+			return
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	for _, item := range m.sinks {
+		if item.Name == name {
+			return fmt.Errorf("sink %s already registered", name)
+		}
+	}
+
+	m.sinks = append(m.sinks, &SinkItem{Name: name, Sink: sink, Kinds: kinds})
+	return
+}
+
+// Returns the sinks registered
+func (m *Manager) GetSinks() []*SinkItem {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return append([]*SinkItem{}, m.sinks...)
+}
+
+// Whether a sink receives the entries of the kind
+func (m *Manager) accepts(kind string) bool {
+	for _, item := range m.GetSinks() {
+		if item.Accepts(kind) {
+			return true
+		}
+	}
+	return false
+}
+
+// Ship an entry to the sinks accepting its kind
+func (m *Manager) write(entry Entry) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.closed {
+		return
+	}
+
+	for _, item := range m.sinks {
+		if !item.Accepts(entry.Kind) {
+			continue
+		}
+
+		if err := item.Sink.Write(entry); err != nil {
+			report.Warn().Err(err).Str("sink", item.Name).Msg("Could not ship the entry")
+		}
+	}
+}
+
+// Ship an attack event
+func (m *Manager) Emit(event *events.Event) {
+	if !m.accepts(string(event.Kind)) {
+		return
+	}
+
+	entry, err := NewEventEntry(event)
+	if err != nil {
+		report.Warn().Err(err).Msg("Could not encode the event")
+		return
+	}
+
+	m.write(entry)
+}
+
+// Ship a line of the logs
+func (m *Manager) Write(p []byte) (n int, err error) {
+	n = len(p)
+	if !m.accepts(LogKind) {
+		return
+	}
+
+	// The logger reuses the buffer once the line is written
+	line := make([]byte, len(p))
+	copy(line, p)
+	if len(line) > 0 && line[len(line)-1] == '\n' {
+		line = line[:len(line)-1]
+	}
+
+	m.write(NewLogEntry(line))
+	return
+}
+
+// Close every sink, sending the entries they buffered. The later entries are dropped
+func (m *Manager) Close() (err error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.closed {
+		return
+	}
+	m.closed = true
+
+	for _, item := range m.sinks {
+		if e := item.Sink.Close(); e != nil {
+			err = fmt.Errorf("sink %s: %w", item.Name, e)
+			report.Warn().Err(e).Str("sink", item.Name).Msg("Could not close the sink")
+		}
+	}
+	return
+}
+
+// Check the kind of entries is known
+func ValidateKind(kind string) (err error) {
+	switch kind {
+	case LogKind, string(events.ConnectionKind), string(events.CredentialKind), string(events.CommandKind), string(events.MessageKind):
+	default:
+		err = fmt.Errorf("unknown kind of entries: %s", kind)
+	}
+	return
+}
+
+func NewManager() *Manager {
+	return &Manager{}
+}
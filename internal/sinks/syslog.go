@@ -0,0 +1,147 @@
+package sinks
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// Name of the application in the syslog messages
+	syslogApp = "riotpot"
+	// Time to wait for the server to take a message
+	syslogTimeout = 5 * time.Second
+)
+
+// Facilities of the syslog messages by name
+var facilities = map[string]int{
+	"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5, "lpr": 6, "news": 7,
+	"uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11, "ntp": 12, "security": 13, "console": 14,
+	"local0": 16, "local1": 17, "local2": 18, "local3": 19, "local4": 20, "local5": 21, "local6": 22, "local7": 23,
+}
+
+// Returns the code of a syslog facility, local0 by default
+func ParseFacility(name string) (facility int, err error) {
+	if name == "" {
+		name = "local0"
+	}
+
+	facility, ok := facilities[name]
+	if !ok {
+		err = fmt.Errorf("unknown syslog facility: %s", name)
+	}
+	return
+}
+
+// Sink sending the entries to a syslog server in RFC 5424 messages, over UDP or TCP.
+// The message ID is the kind of the entry, and the message its JSON document.
+// Over TCP, the messages are framed with their length (RFC 6587), and the connection
+// is opened again when it fails
+type SyslogSink struct {
+	mu sync.Mutex
+
+	network  string
+	address  string
+	facility int
+	hostname string
+
+	conn   net.Conn
+	closed bool
+}
+
+// Format the entry as an RFC 5424 message
+func (ss *SyslogSink) format(entry Entry) []byte {
+	priority := ss.facility*8 + int(entry.Severity)
+	header := fmt.Sprintf("<%d>1 %s %s %s %d %s - ",
+		priority,
+		entry.Time.UTC().Format(time.RFC3339Nano),
+		ss.hostname,
+		syslogApp,
+		os.Getpid(),
+		entry.Kind,
+	)
+
+	return append([]byte(header), entry.Data...)
+}
+
+func (ss *SyslogSink) Write(entry Entry) (err error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.closed {
+		return fmt.Errorf("sink closed")
+	}
+
+	message := ss.format(entry)
+	if ss.network == "tcp" {
+		message = append([]byte(strconv.Itoa(len(message))+" "), message...)
+	}
+
+	// Try again once with a new connection, the server may have closed the previous one
+	for attempt := 0; attempt < 2; attempt++ {
+		if ss.conn == nil {
+			if ss.conn, err = net.DialTimeout(ss.network, ss.address, syslogTimeout); err != nil {
+				ss.conn = nil
+				return
+			}
+		}
+
+		ss.conn.SetWriteDeadline(time.Now().Add(syslogTimeout))
+		if _, err = ss.conn.Write(message); err == nil {
+			return
+		}
+
+		ss.conn.Close()
+		ss.conn = nil
+	}
+
+	return
+}
+
+func (ss *SyslogSink) Close() (err error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+
+	if ss.closed {
+		return
+	}
+	ss.closed = true
+
+	if ss.conn != nil {
+		err = ss.conn.Close()
+	}
+	return
+}
+
+// Create a sink sending the entries to the syslog server in the address
+func NewSyslogSink(network string, address string, facility string) (ss *SyslogSink, err error) {
+	if network != "udp" && network != "tcp" {
+		err = fmt.Errorf("network not supported: %s", network)
+		return
+	}
+	if address == "" {
+		err = fmt.Errorf("the address of the syslog server is required")
+		return
+	}
+
+	code, err := ParseFacility(facility)
+	if err != nil {
+		return
+	}
+
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "-"
+	}
+
+	ss = &SyslogSink{
+		network:  network,
+		address:  address,
+		facility: code,
+		hostname: hostname,
+	}
+	return ss, nil
+}
@@ -0,0 +1,230 @@
+package sinks
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// Options of a webhook sink. The fields left empty take the default values
+type WebhookOptions struct {
+	// Number of entries sent in each request, 100 by default
+	BatchSize int
+	// Time to wait for a batch to fill before sending it, 5s by default
+	Interval time.Duration
+	// Attempts to send a batch after the first one fails, 3 by default
+	Retries int
+	// Time to wait before the first retry, doubled in each of them. 1s by default
+	Backoff time.Duration
+	// Time to wait for each request, 10s by default
+	Timeout time.Duration
+	// Maximum number of entries waiting to be sent, the oldest are dropped. 10000 by default
+	MaxQueue int
+	// Headers of the requests, e.g. the authorization of the endpoint
+	Headers map[string]string
+}
+
+// Fill the options left empty with the default values
+func (wo *WebhookOptions) defaults() {
+	if wo.BatchSize <= 0 {
+		wo.BatchSize = 100
+	}
+	if wo.Interval <= 0 {
+		wo.Interval = 5 * time.Second
+	}
+	if wo.Retries < 0 {
+		wo.Retries = 0
+	} else if wo.Retries == 0 {
+		wo.Retries = 3
+	}
+	if wo.Backoff <= 0 {
+		wo.Backoff = time.Second
+	}
+	if wo.Timeout <= 0 {
+		wo.Timeout = 10 * time.Second
+	}
+	if wo.MaxQueue <= 0 {
+		wo.MaxQueue = 10000
+	}
+}
+
+// Sink posting the entries to an HTTP endpoint in batches, as a JSON array of documents.
+// The batches are sent when they are full or every interval, and retried when the
+// request fails or the endpoint answers with a server error (5xx) or 429
+type WebhookSink struct {
+	url     string
+	options WebhookOptions
+	client  *http.Client
+
+	mu sync.Mutex
+	// Documents waiting to be sent
+	queue   [][]byte
+	dropped int
+	closed  bool
+
+	// Signals a full batch, stops the loop and is closed once the loop returns
+	full chan struct{}
+	stop chan struct{}
+	done chan struct{}
+}
+
+func (ws *WebhookSink) Write(entry Entry) (err error) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	if ws.closed {
+		return fmt.Errorf("sink closed")
+	}
+
+	if len(ws.queue) >= ws.options.MaxQueue {
+		ws.queue = ws.queue[1:]
+		ws.dropped++
+	}
+	ws.queue = append(ws.queue, entry.Data)
+
+	if len(ws.queue) >= ws.options.BatchSize {
+		select {
+		case ws.full <- struct{}{}:
+		default:
+		}
+	}
+	return
+}
+
+// Returns the number of entries dropped because the queue was full
+func (ws *WebhookSink) GetDropped() int {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	return ws.dropped
+}
+
+// Take the next batch from the queue
+func (ws *WebhookSink) next() (batch [][]byte) {
+	ws.mu.Lock()
+	defer ws.mu.Unlock()
+
+	n := len(ws.queue)
+	if n > ws.options.BatchSize {
+		n = ws.options.BatchSize
+	}
+
+	batch = ws.queue[:n:n]
+	ws.queue = ws.queue[n:]
+	return
+}
+
+// Send every batch in the queue
+func (ws *WebhookSink) flush() {
+	for {
+		batch := ws.next()
+		if len(batch) == 0 {
+			return
+		}
+
+		if err := ws.send(batch); err != nil {
+			report.Warn().Err(err).Str("url", ws.url).Int("entries", len(batch)).Msg("Could not send the batch to the webhook, dropping it")
+		}
+	}
+}
+
+// Post a batch, retrying when it fails
+func (ws *WebhookSink) send(batch [][]byte) (err error) {
+	body := append([]byte{'['}, bytes.Join(batch, []byte{','})...)
+	body = append(body, ']')
+
+	backoff := ws.options.Backoff
+	for attempt := 0; ; attempt++ {
+		retry := false
+		if retry, err = ws.post(body); err == nil || !retry || attempt >= ws.options.Retries {
+			return
+		}
+
+		time.Sleep(backoff)
+		backoff *= 2
+	}
+}
+
+// Post the body, returning whether it can be retried when it fails
+func (ws *WebhookSink) post(body []byte) (retry bool, err error) {
+	req, err := http.NewRequest(http.MethodPost, ws.url, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range ws.options.Headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := ws.client.Do(req)
+	if err != nil {
+		retry = true
+		return
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		err = fmt.Errorf("webhook answered %s", resp.Status)
+		retry = resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests
+	}
+	return
+}
+
+// Send the batches when they are full or every interval, until the sink is closed
+func (ws *WebhookSink) loop() {
+	defer close(ws.done)
+
+	ticker := time.NewTicker(ws.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ws.full:
+		case <-ticker.C:
+		case <-ws.stop:
+			ws.flush()
+			return
+		}
+
+		ws.flush()
+	}
+}
+
+// Send the entries waiting and stop the sink
+func (ws *WebhookSink) Close() (err error) {
+	ws.mu.Lock()
+	if ws.closed {
+		ws.mu.Unlock()
+		return
+	}
+	ws.closed = true
+	ws.mu.Unlock()
+
+	close(ws.stop)
+	<-ws.done
+	return
+}
+
+// Create a sink posting the entries to the URL
+func NewWebhookSink(url string, options WebhookOptions) (ws *WebhookSink, err error) {
+	if url == "" {
+		err = fmt.Errorf("the URL of the webhook is required")
+		return
+	}
+	options.defaults()
+
+	ws = &WebhookSink{
+		url:     url,
+		options: options,
+		client:  &http.Client{Timeout: options.Timeout},
+		full:    make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	go ws.loop()
+	return
+}
@@ -0,0 +1,123 @@
+package store
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	// Bucket in where the records are stored
+	recordsBucket = []byte("records")
+)
+
+// Implementation of an embedded store using bbolt.
+// The records are stored as JSON values in a single bucket. The keys start with the
+// timestamp of the record, so the bucket can be iterated in chronological order
+type BoltStore struct {
+	db *bolt.DB
+}
+
+// Returns the key of the record: timestamp in nanoseconds followed by the ID
+func (bs *BoltStore) key(record *Record) []byte {
+	key := make([]byte, 8, 8+len(record.ID))
+	binary.BigEndian.PutUint64(key, uint64(record.Timestamp.UnixNano()))
+	return append(key, record.ID...)
+}
+
+// Save the records. Concurrent calls are written in the same transaction
+func (bs *BoltStore) Save(records ...*Record) (err error) {
+	return bs.db.Batch(func(tx *bolt.Tx) error {
+		bucket := tx.Bucket(recordsBucket)
+
+		for _, record := range records {
+			value, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+
+			if err := bucket.Put(bs.key(record), value); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (bs *BoltStore) Query(filter Filter) (records []*Record, err error) {
+	records = []*Record{}
+
+	err = bs.db.View(func(tx *bolt.Tx) error {
+		cursor := tx.Bucket(recordsBucket).Cursor()
+
+		// Place the cursor at the newest record allowed by the filter
+		var k, v []byte
+		if filter.Until.IsZero() {
+			k, v = cursor.Last()
+		} else {
+			until := make([]byte, 8)
+			binary.BigEndian.PutUint64(until, uint64(filter.Until.UnixNano()+1))
+
+			// Seek returns the next key after the one given, so move back once
+			if k, _ = cursor.Seek(until); k == nil {
+				k, v = cursor.Last()
+			} else {
+				k, v = cursor.Prev()
+			}
+		}
+
+		// Iterate backwards, from the newest to the oldest record
+		for ; k != nil; k, v = cursor.Prev() {
+			ts := time.Unix(0, int64(binary.BigEndian.Uint64(k[:8])))
+			if !filter.Since.IsZero() && ts.Before(filter.Since) {
+				break
+			}
+
+			record := &Record{}
+			if err := json.Unmarshal(v, record); err != nil {
+				return err
+			}
+
+			if !filter.Match(record) {
+				continue
+			}
+
+			records = append(records, record)
+			if filter.Limit > 0 && len(records) >= filter.Limit {
+				break
+			}
+		}
+
+		return nil
+	})
+
+	return
+}
+
+func (bs *BoltStore) Close() error {
+	return bs.db.Close()
+}
+
+// Create a new embedded store in the given path
+func NewBoltStore(path string) (bs *BoltStore, err error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 1 * time.Second})
+	if err != nil {
+		return
+	}
+
+	// Create the bucket if it does not exist yet
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(recordsBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return
+	}
+
+	bs = &BoltStore{db: db}
+	return
+}
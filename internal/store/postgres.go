@@ -0,0 +1,231 @@
+package store
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+
+	_ "github.com/lib/pq"
+)
+
+const (
+	// Statement to create the table of records
+	createRecordsTable = `
+	CREATE TABLE IF NOT EXISTS records (
+		id          TEXT PRIMARY KEY,
+		timestamp   TIMESTAMPTZ NOT NULL,
+		kind        TEXT NOT NULL,
+		proxy_id    TEXT,
+		session_id  TEXT,
+		service_id  TEXT,
+		service     TEXT,
+		remote_addr TEXT,
+		local_addr  TEXT,
+		network     TEXT,
+		protocol    TEXT,
+		data        JSONB
+	);
+	CREATE INDEX IF NOT EXISTS records_timestamp_idx ON records (timestamp);
+	ALTER TABLE records ADD COLUMN IF NOT EXISTS country TEXT;
+	ALTER TABLE records ADD COLUMN IF NOT EXISTS asn BIGINT;
+	ALTER TABLE records ADD COLUMN IF NOT EXISTS as_org TEXT;
+	`
+
+	insertRecord = `
+	INSERT INTO records (id, timestamp, kind, proxy_id, session_id, service_id, service, remote_addr, local_addr, network, protocol, country, asn, as_org, data)
+	VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15)
+	`
+
+	selectRecords = `
+	SELECT id, timestamp, kind, proxy_id, session_id, service_id, service, remote_addr, local_addr, network, protocol,
+		COALESCE(country, ''), COALESCE(asn, 0), COALESCE(as_org, ''), data
+	FROM records
+	`
+)
+
+// Returns the connection string to the postgres database using the globals.
+// The credentials are escaped, so they may contain any character
+func PostgresDSN() string {
+	dsn := url.URL{
+		Scheme:   "postgres",
+		User:     url.UserPassword(globals.DbUsername, globals.DbPassword),
+		Host:     net.JoinHostPort(globals.DbHost, globals.DbPort),
+		Path:     globals.DbName,
+		RawQuery: "sslmode=disable",
+	}
+	return dsn.String()
+}
+
+// Implementation of a store using a postgres database server
+type PostgresStore struct {
+	db *sql.DB
+}
+
+func (ps *PostgresStore) Save(records ...*Record) (err error) {
+	tx, err := ps.db.Begin()
+	if err != nil {
+		return
+	}
+
+	for _, record := range records {
+		data, err := json.Marshal(record.Data)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+
+		_, err = tx.Exec(
+			insertRecord,
+			record.ID,
+			record.Timestamp,
+			string(record.Kind),
+			record.ProxyID,
+			record.SessionID,
+			record.ServiceID,
+			record.Service,
+			record.RemoteAddr,
+			record.LocalAddr,
+			record.Network,
+			record.Protocol,
+			record.Country,
+			int64(record.ASN),
+			record.ASOrg,
+			data,
+		)
+		if err != nil {
+			tx.Rollback()
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func (ps *PostgresStore) Query(filter Filter) (records []*Record, err error) {
+	var (
+		conditions []string
+		args       []interface{}
+	)
+
+	// Add a condition to the query with its argument
+	where := func(condition string, arg interface{}) {
+		args = append(args, arg)
+		conditions = append(conditions, fmt.Sprintf(condition, len(args)))
+	}
+
+	if filter.Kind != "" {
+		where("kind = $%d", string(filter.Kind))
+	}
+	if filter.ProxyID != "" {
+		where("proxy_id = $%d", filter.ProxyID)
+	}
+	if filter.ServiceID != "" {
+		where("service_id = $%d", filter.ServiceID)
+	}
+	if filter.RemoteAddr != "" {
+		where("remote_addr = $%d", filter.RemoteAddr)
+	}
+	if filter.Country != "" {
+		where("country = $%d", filter.Country)
+	}
+	if filter.ASN != 0 {
+		where("asn = $%d", int64(filter.ASN))
+	}
+	if !filter.Since.IsZero() {
+		where("timestamp >= $%d", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		where("timestamp <= $%d", filter.Until)
+	}
+
+	query := selectRecords
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += " ORDER BY timestamp DESC"
+	if filter.Limit > 0 {
+		query += fmt.Sprintf(" LIMIT %d", filter.Limit)
+	}
+
+	rows, err := ps.db.Query(query, args...)
+	if err != nil {
+		return
+	}
+	defer rows.Close()
+
+	records = []*Record{}
+	for rows.Next() {
+		var (
+			record Record
+			kind   string
+			asn    int64
+			data   []byte
+		)
+
+		err = rows.Scan(
+			&record.ID,
+			&record.Timestamp,
+			&kind,
+			&record.ProxyID,
+			&record.SessionID,
+			&record.ServiceID,
+			&record.Service,
+			&record.RemoteAddr,
+			&record.LocalAddr,
+			&record.Network,
+			&record.Protocol,
+			&record.Country,
+			&asn,
+			&record.ASOrg,
+			&data,
+		)
+		if err != nil {
+			return
+		}
+
+		record.Kind = events.Kind(kind)
+		record.ASN = uint(asn)
+		if len(data) > 0 {
+			if err = json.Unmarshal(data, &record.Data); err != nil {
+				return
+			}
+		}
+
+		records = append(records, &record)
+	}
+
+	err = rows.Err()
+	return
+}
+
+func (ps *PostgresStore) Close() error {
+	return ps.db.Close()
+}
+
+// Create a new store connected to a postgres database
+func NewPostgresStore(dsn string) (ps *PostgresStore, err error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return
+	}
+
+	// Check the connection and create the table of records
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return
+	}
+
+	if _, err = db.Exec(createRecordsTable); err != nil {
+		db.Close()
+		return
+	}
+
+	ps = &PostgresStore{db: db}
+	return
+}
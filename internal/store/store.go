@@ -0,0 +1,289 @@
+/*
+This package implements a persistent store for the events observed by RIoTPot.
+The store is backed by a pluggable backend, which can be an embedded database file (default)
+or a remote database server.
+*/
+package store
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+	lr "github.com/riotpot/internal/logger"
+)
+
+var (
+	// Instance of the store used by the application to persist the records
+	Records = NewStoreManager()
+)
+
+type Backend int8
+
+// Store backends
+const (
+	// Embedded database stored in a file
+	BoltBackend Backend = iota
+	// Postgres database server
+	PostgresBackend
+
+	// Value for the embedded backend
+	BoltBackendValue = "bolt"
+	// Value for the postgres backend
+	PostgresBackendValue = "postgres"
+)
+
+func (b Backend) String() string {
+	switch b {
+	case BoltBackend:
+		return BoltBackendValue
+	case PostgresBackend:
+		return PostgresBackendValue
+	}
+
+	return strconv.Itoa(int(b))
+}
+
+func ParseBackend(backend string) (bk Backend, err error) {
+	switch backend {
+	case BoltBackend.String():
+		return BoltBackend, nil
+	case PostgresBackend.String():
+		return PostgresBackend, nil
+	}
+
+	// Attempt to convert the backend into an integer
+	i, err := strconv.Atoi(backend)
+	if err != nil {
+		return
+	}
+
+	return Backend(i), nil
+}
+
+// Record of an event stored in the database
+type Record struct {
+	ID        string      `json:"id"`
+	Timestamp time.Time   `json:"timestamp"`
+	Kind      events.Kind `json:"kind"`
+	// Proxy, session and service that observed the event
+	ProxyID   string `json:"proxy_id,omitempty"`
+	SessionID string `json:"session_id,omitempty"`
+	ServiceID string `json:"service_id,omitempty"`
+	Service   string `json:"service,omitempty"`
+	// Addresses of the connection
+	RemoteAddr string `json:"remote_addr,omitempty"`
+	LocalAddr  string `json:"local_addr,omitempty"`
+	Network    string `json:"network,omitempty"`
+	Protocol   string `json:"protocol,omitempty"`
+	// Country (ISO code) and autonomous system of the client
+	Country string `json:"country,omitempty"`
+	ASN     uint   `json:"asn,omitempty"`
+	ASOrg   string `json:"as_org,omitempty"`
+	// Payload of the event, its keys depend on the kind of event
+	Data map[string]interface{} `json:"data,omitempty"`
+}
+
+// Create a new record from an event
+func NewRecord(event *events.Event) (record *Record, err error) {
+	record = &Record{
+		ID:         event.ID,
+		Timestamp:  event.Timestamp,
+		Kind:       event.Kind,
+		ProxyID:    event.ProxyID,
+		SessionID:  event.SessionID,
+		ServiceID:  event.ServiceID,
+		Service:    event.Service,
+		RemoteAddr: event.RemoteAddr,
+		LocalAddr:  event.LocalAddr,
+		Network:    event.Network,
+		Protocol:   event.Protocol,
+		Country:    event.Country,
+		ASN:        event.ASN,
+		ASOrg:      event.ASOrg,
+	}
+
+	if event.Payload == nil {
+		return
+	}
+
+	// Convert the payload into a map of values
+	payload, err := json.Marshal(event.Payload)
+	if err != nil {
+		return
+	}
+
+	err = json.Unmarshal(payload, &record.Data)
+	return
+}
+
+// Filter used to query the records
+// Empty fields are not used to filter
+type Filter struct {
+	Kind       events.Kind
+	ProxyID    string
+	ServiceID  string
+	RemoteAddr string
+	// Country (ISO code) and autonomous system of the client
+	Country string
+	ASN     uint
+	Since   time.Time
+	Until   time.Time
+	// Maximum number of records returned
+	Limit int
+}
+
+// Returns whether the record matches the filter
+func (f Filter) Match(record *Record) bool {
+	switch {
+	case f.Kind != "" && record.Kind != f.Kind,
+		f.ProxyID != "" && record.ProxyID != f.ProxyID,
+		f.ServiceID != "" && record.ServiceID != f.ServiceID,
+		f.RemoteAddr != "" && record.RemoteAddr != f.RemoteAddr,
+		f.Country != "" && record.Country != f.Country,
+		f.ASN != 0 && record.ASN != f.ASN,
+		!f.Since.IsZero() && record.Timestamp.Before(f.Since),
+		!f.Until.IsZero() && record.Timestamp.After(f.Until):
+		return false
+	}
+
+	return true
+}
+
+// Interface implemented by every store backend
+type Store interface {
+	// Save one or more records
+	Save(records ...*Record) error
+	// Get the records matching the filter, the newest first
+	Query(filter Filter) ([]*Record, error)
+	// Close the connection to the backend
+	Close() error
+}
+
+// Interface for the store manager
+type StoreManager interface {
+	Store
+	events.Emitter
+
+	// Open the backend used to persist the records
+	Open(backend Backend) error
+	// Whether there is a backend open
+	IsOpen() bool
+}
+
+// Simple implementation of the store manager.
+// Records saved before the backend is open are dropped.
+type StoreManagerItem struct {
+	StoreManager
+
+	mu sync.RWMutex
+	// Backend in use
+	backend Store
+}
+
+// Open the backend, closing the previous one if any
+func (sm *StoreManagerItem) Open(backend Backend) (err error) {
+	var st Store
+
+	switch backend {
+	case BoltBackend:
+		st, err = NewBoltStore(globals.DbPath)
+	case PostgresBackend:
+		st, err = NewPostgresStore(PostgresDSN())
+	default:
+		err = fmt.Errorf("unknown backend %s", backend)
+	}
+
+	if err != nil {
+		return
+	}
+
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.backend != nil {
+		sm.backend.Close()
+	}
+	sm.backend = st
+
+	return
+}
+
+func (sm *StoreManagerItem) IsOpen() bool {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	return sm.backend != nil
+}
+
+// Save the records in the backend.
+// The ID and timestamp are set if they were empty
+func (sm *StoreManagerItem) Save(records ...*Record) (err error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	// Drop the records if there is nowhere to save them
+	if sm.backend == nil {
+		return
+	}
+
+	for _, record := range records {
+		if record.ID == "" {
+			record.ID = uuid.NewString()
+		}
+
+		if record.Timestamp.IsZero() {
+			record.Timestamp = time.Now()
+		}
+	}
+
+	return sm.backend.Save(records...)
+}
+
+// Save the events published
+func (sm *StoreManagerItem) Emit(event *events.Event) {
+	record, err := NewRecord(event)
+	if err != nil {
+		lr.Log.Warn().Err(err).Msg("Could not convert the event into a record")
+		return
+	}
+
+	if err := sm.Save(record); err != nil {
+		lr.Log.Warn().Err(err).Msg("Could not save the event")
+	}
+}
+
+func (sm *StoreManagerItem) Query(filter Filter) (records []*Record, err error) {
+	sm.mu.RLock()
+	defer sm.mu.RUnlock()
+
+	if sm.backend == nil {
+		err = fmt.Errorf("store not open")
+		return
+	}
+
+	return sm.backend.Query(filter)
+}
+
+func (sm *StoreManagerItem) Close() (err error) {
+	sm.mu.Lock()
+	defer sm.mu.Unlock()
+
+	if sm.backend == nil {
+		return
+	}
+
+	err = sm.backend.Close()
+	sm.backend = nil
+	return
+}
+
+// Constructor for the store manager
+func NewStoreManager() *StoreManagerItem {
+	return &StoreManagerItem{}
+}
@@ -57,6 +57,9 @@ type shell struct {
 
 	comm [][]interface{}
 
+	// Function called with every command introduced in the shell
+	OnCommand func(command string)
+
 	RspChan  chan []byte
 	doneChan chan error
 
@@ -112,12 +115,20 @@ func (s *shell) terminal() {
 			break
 		}
 
-		// send the response to the channel of responses
-		s.RspChan <- lineBytes
+		// send the response to the channel of responses, unless nobody is reading it
+		select {
+		case s.RspChan <- lineBytes:
+		default:
+		}
 		line := string(lineBytes)
 		// remove the line endings to compare the strings to regular commands
 		line = strings.TrimRight(line, "\r\n")
 
+		// notify the command introduced
+		if s.OnCommand != nil && line != "" {
+			s.OnCommand(line)
+		}
+
 		s.commands(line)
 	}
 
@@ -7,17 +7,21 @@ package main
 
 import (
 	"bytes"
+	"context"
 	"fmt"
+	"io"
 	"math/rand"
 	"regexp"
 	"strconv"
 	"strings"
 	"time"
 
-	coap "github.com/plgd-dev/go-coap/v2"
 	"github.com/plgd-dev/go-coap/v2/message"
 	"github.com/plgd-dev/go-coap/v2/message/codes"
 	"github.com/plgd-dev/go-coap/v2/mux"
+	coapNet "github.com/plgd-dev/go-coap/v2/net"
+	"github.com/plgd-dev/go-coap/v2/udp"
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	"github.com/riotpot/internal/logger"
 	"github.com/riotpot/internal/services"
@@ -49,11 +53,11 @@ func Coapd() services.Service {
 }
 
 type Coap struct {
-	services.Service
+	*services.PluginServiceItem
 	Profile Profile
 }
 
-func (c *Coap) Run() (err error) {
+func (c *Coap) Run(ctx context.Context) (err error) {
 
 	r := mux.NewRouter()
 
@@ -66,8 +70,15 @@ func (c *Coap) Run() (err error) {
 	r.DefaultHandleFunc(c.observeHandler)
 
 	// Run the server listening on the given port and using the defined
-	// lvl4 layer protocol.
-	err = coap.ListenAndServe(c.GetNetwork().String(), c.GetAddress(), r)
+	// lvl4 layer protocol, until the service is stopped.
+	listener, err := coapNet.NewListenUDP(c.GetNetwork().String(), c.GetAddress())
+	if err != nil {
+		return
+	}
+	defer listener.Close()
+
+	server := udp.NewServer(udp.WithMux(r), udp.WithContext(ctx))
+	err = server.Serve(listener)
 
 	return
 }
@@ -358,9 +369,26 @@ func (c *Coap) periodicTransmitter(cc mux.Client, token []byte, topic Topic) {
 	}
 }
 
+// Publish an event with the request made by the client
 func (c *Coap) save(w mux.ResponseWriter, r *mux.Message) {
-	// rmtAddr := w.Client().RemoteAddr()
-	// path :=
+	path, _ := r.Options.Path()
+
+	request := &events.CoAPRequest{
+		Code: r.Code.String(),
+		Path: path,
+	}
+
+	// Read the payload and rewind it, so the handlers can read it again
+	if r.Body != nil {
+		payload, err := io.ReadAll(r.Body)
+		if err != nil {
+			logger.Log.Error().Err(err).Msg("Could not read the payload")
+		}
+		r.Body.Seek(0, io.SeekStart)
+		request.Payload = payload
+	}
+
+	c.Emit(w.Client().RemoteAddr(), nil, request)
 }
 
 // Filter a list of topics based on the query string included and the flag
@@ -2,10 +2,11 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"net"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
-	"github.com/riotpot/internal/logger"
 	"github.com/riotpot/internal/services"
 )
 
@@ -31,13 +32,21 @@ func Echod() services.Service {
 
 type Echo struct {
 	// Anonymous fields from the mixin
-	services.Service
+	*services.PluginServiceItem
 }
 
-func (e *Echo) Run() (err error) {
+func (e *Echo) Run(ctx context.Context) (err error) {
 	// start a service in the `echo` port
 	listener, err := net.Listen(e.GetNetwork().String(), e.GetAddress())
-	logger.Log.Error().Err(err)
+	if err != nil {
+		return
+	}
+
+	// Close the listener when the service is stopped
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
 
 	// build a channel stack to receive connections to the service
 	conn := make(chan net.Conn)
@@ -52,6 +61,9 @@ func (e *Echo) Run() (err error) {
 // Open the service and listen for connections
 // inspired on https://gist.github.com/paulsmith/775764#file-echo-go
 func (e *Echo) serve(ch chan net.Conn, listener net.Listener) {
+	// stop handling connections once the listener is closed
+	defer close(ch)
+
 	// open an infinite loop to receive connections
 	for {
 		// Accept the client connection
@@ -68,15 +80,10 @@ func (e *Echo) serve(ch chan net.Conn, listener net.Listener) {
 
 // Handle the pool of connections to the service
 func (e *Echo) handlePool(ch chan net.Conn) {
-	// open an infinite loop to handle the connections
-	for {
-		// while the `stop` channel remains empty, continue handling
-		// new connections.
-		select {
-		case conn := <-ch:
-			// use one goroutine per connection.
-			go e.handleConn(conn)
-		}
+	// handle the connections until the channel is closed
+	for conn := range ch {
+		// use one goroutine per connection.
+		go e.handleConn(conn)
 	}
 }
 
@@ -92,6 +99,9 @@ func (e *Echo) handleConn(conn net.Conn) {
 			break
 		}
 
+		// publish the message received
+		e.Emit(conn.RemoteAddr(), conn.LocalAddr(), &events.Raw{Data: msg})
+
 		// Respond with the same message
 		conn.Write(msg)
 	}
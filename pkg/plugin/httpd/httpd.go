@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
-	lr "github.com/riotpot/internal/logger"
 	"github.com/riotpot/internal/services"
 )
 
@@ -31,10 +33,10 @@ func Httpd() services.Service {
 
 type Http struct {
 	// Anonymous fields from the mixin
-	services.Service
+	*services.PluginServiceItem
 }
 
-func (h *Http) Run() (err error) {
+func (h *Http) Run(ctx context.Context) (err error) {
 	mux := http.NewServeMux()
 	mux.Handle("/", http.HandlerFunc(h.valid))
 
@@ -43,15 +45,17 @@ func (h *Http) Run() (err error) {
 		Handler: mux,
 	}
 
-	go h.serve(srv)
+	// Close the server when the service is stopped
+	go func() {
+		<-ctx.Done()
+		srv.Close()
+	}()
 
-	return
-}
-
-func (h *Http) serve(srv *http.Server) {
-	if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		lr.Log.Fatal().Err(err)
+	if err = srv.ListenAndServe(); err == http.ErrServerClosed {
+		err = nil
 	}
+
+	return
 }
 
 // This function handles connections made to a valid path
@@ -97,6 +101,8 @@ func (h *Http) valid(w http.ResponseWriter, req *http.Request) {
 	</html>
 	`
 
+	h.emit(req)
+
 	if req.Method == http.MethodPost {
 		errormessage := `
 		<div class="alert alert-danger">
@@ -110,3 +116,24 @@ func (h *Http) valid(w http.ResponseWriter, req *http.Request) {
 
 	fmt.Fprint(w, response)
 }
+
+// Publish an event with the request received, and the credentials introduced
+// in the login form
+func (h *Http) emit(req *http.Request) {
+	remote, _ := net.ResolveTCPAddr(network.String(), req.RemoteAddr)
+	local, _ := req.Context().Value(http.LocalAddrContextKey).(net.Addr)
+
+	h.Emit(remote, local, &events.HTTPRequest{
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		UserAgent: req.UserAgent(),
+	})
+
+	if req.Method == http.MethodPost {
+		h.Emit(remote, local, &events.Credentials{
+			Username: req.PostFormValue("username"),
+			Password: req.PostFormValue("password"),
+			Client:   req.UserAgent(),
+		})
+	}
+}
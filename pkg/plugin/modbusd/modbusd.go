@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	"github.com/riotpot/internal/logger"
 	"github.com/riotpot/internal/services"
@@ -43,15 +45,23 @@ func Modbusd() services.Service {
 }
 
 type Modbus struct {
-	services.Service
+	*services.PluginServiceItem
 	handler modbusone.ProtocolHandler
 }
 
-func (m *Modbus) Run() (err error) {
+func (m *Modbus) Run(ctx context.Context) (err error) {
 
-	// start a service in the `echo` port
+	// start a service in the `modbus` port
 	listener, err := net.Listen(m.GetNetwork().String(), m.GetAddress())
-	logger.Log.Error().Err(err)
+	if err != nil {
+		return
+	}
+
+	// Close the listener when the service is stopped
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
 
 	// build a channel stack to receive connections to the service
 	conn := make(chan net.Conn)
@@ -117,6 +127,9 @@ func (m *Modbus) handleSession(conn net.Conn) {
 
 			fc := p.GetFunctionCode()
 
+			// publish the request received
+			m.emit(conn, p)
+
 			// initialize the data. It will be filled with the information
 			// in the payload.
 			var data []byte
@@ -148,6 +161,25 @@ func (m *Modbus) handleSession(conn net.Conn) {
 	}
 }
 
+// Publish an event with the request received, including the values written
+func (m *Modbus) emit(conn net.Conn, p modbusone.PDU) {
+	fc := p.GetFunctionCode()
+	quantity, _ := p.GetRequestCount()
+
+	request := &events.ModbusRequest{
+		Function: uint8(fc),
+		Write:    fc.IsWriteToServer(),
+		Address:  p.GetAddress(),
+		Quantity: quantity,
+	}
+
+	if request.Write {
+		request.Values, _ = p.GetRequestValues()
+	}
+
+	m.Emit(conn.RemoteAddr(), conn.LocalAddr(), request)
+}
+
 // Simple handler for the Modbus functions.
 // We will send adequate responses for each of them, however, we will store
 // any information comming to the honeypot in the process.
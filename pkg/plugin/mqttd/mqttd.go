@@ -2,11 +2,12 @@
 package main
 
 import (
+	"context"
 	"net"
 	"sync"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
-	"github.com/riotpot/internal/logger"
 	"github.com/riotpot/internal/services"
 )
 
@@ -32,14 +33,22 @@ func Mqttd() services.Service {
 }
 
 type Mqtt struct {
-	services.Service
+	*services.PluginServiceItem
 	wg sync.WaitGroup
 }
 
-func (m *Mqtt) Run() (err error) {
+func (m *Mqtt) Run(ctx context.Context) (err error) {
 	// start a service in the `mqtt` port
 	listener, err := net.Listen(m.GetNetwork().String(), m.GetAddress())
-	logger.Log.Error().Err(err)
+	if err != nil {
+		return
+	}
+
+	// Close the listener when the service is stopped
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
 
 	// build a channel stack to receive connections to the service
 	conn := make(chan net.Conn)
@@ -59,6 +68,8 @@ func (m *Mqtt) Run() (err error) {
 // websockets!!
 func (m *Mqtt) serve(ch chan net.Conn, listener net.Listener) {
 	defer m.wg.Done()
+	// stop handling connections once the listener is closed
+	defer close(ch)
 
 	// open an infinite loop to receive connections
 	for {
@@ -75,15 +86,10 @@ func (m *Mqtt) serve(ch chan net.Conn, listener net.Listener) {
 }
 
 func (m *Mqtt) handlePool(ch chan net.Conn) {
-	// open an infinite loop to handle the connections
-	for {
-		// while the `stop` channel remains empty, continue handling
-		// new connections.
-		select {
-		case conn := <-ch:
-			// use one goroutine per connection.
-			go m.handleConn(conn)
-		}
+	// handle the connections until the channel is closed
+	for conn := range ch {
+		// use one goroutine per connection.
+		go m.handleConn(conn)
 	}
 }
 
@@ -104,8 +110,31 @@ func (m *Mqtt) handleConn(conn net.Conn) {
 			return
 		}
 
+		// publish the packet received
+		m.emit(conn, packet)
+
 		// respond to the message
 		s.Answer(*packet, &conn)
 	}
 
 }
+
+// Publish an event with the packet received. The credentials of connection packets
+// are published on their own
+func (m *Mqtt) emit(conn net.Conn, packet *Packet) {
+	if packet.FixedHeader.TypeStr() == "CONNECT" && (packet.Username != "" || packet.Password != "") {
+		m.Emit(conn.RemoteAddr(), conn.LocalAddr(), &events.Credentials{
+			Username: packet.Username,
+			Password: packet.Password,
+			Client:   packet.ClientId,
+		})
+	}
+
+	m.Emit(conn.RemoteAddr(), conn.LocalAddr(), &events.MQTTPacket{
+		Type:     packet.FixedHeader.TypeStr(),
+		ClientID: packet.ClientId,
+		Topic:    packet.TopicName,
+		Topics:   packet.Topics,
+		Data:     packet.Data,
+	})
+}
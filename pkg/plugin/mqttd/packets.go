@@ -2,7 +2,6 @@ package main
 
 import (
 	"bytes"
-	"net"
 )
 
 func NewPacket(fx *FixedHeader) (p *Packet) {
@@ -23,10 +22,8 @@ type Packet struct {
 	ReturnCode                                                                    uint8
 }
 
-// Decode or Unmarshall the connection packet
-func (p *Packet) Decode(conn *net.Conn) {
-	buf := make([]byte, p.FixedHeader.RemainingLength)
-
+// Decode or Unmarshall the connection packet from the bytes after the fixed header
+func (p *Packet) Decode(buf []byte) {
 	// get the type of the message as a string
 	t := p.FixedHeader.TypeStr()
 
@@ -59,9 +59,17 @@ func (s *Session) Read(conn net.Conn) (packet *Packet) {
 		panic("mismatch between remaining length of the packet and the rest of the packet")
 	}
 
+	// Drop malformed packets that can not be decoded
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Log.Warn().Msgf("malformed packet from %s", s.remote)
+			packet = nil
+		}
+	}()
+
 	// read the packet based on the fixed header
 	packet = NewPacket(f_header)
-	packet.Decode(&conn)
+	packet.Decode(b[:n])
 
 	if len(packet.Topics) > 0 {
 		s.subscribe(packet.Topics, packet.Topics_qos)
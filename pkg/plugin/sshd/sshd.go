@@ -1,11 +1,13 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"io"
 	"net"
 	"sync"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	"github.com/riotpot/internal/logger"
 	"github.com/riotpot/internal/plugins"
@@ -36,19 +38,19 @@ func Sshd() services.Service {
 	pem := pKey.GetPEM()
 
 	return &SSH{
-		Service:    mx,
-		wg:         sync.WaitGroup{},
-		privateKey: pem,
+		PluginServiceItem: mx,
+		wg:                sync.WaitGroup{},
+		privateKey:        pem,
 	}
 }
 
 type SSH struct {
-	services.Service
+	*services.PluginServiceItem
 	wg         sync.WaitGroup
 	privateKey []byte
 }
 
-func (s *SSH) Run() (err error) {
+func (s *SSH) Run(ctx context.Context) (err error) {
 
 	// Preload the configuration for the ssh server
 	config := &ssh.ServerConfig{
@@ -65,13 +67,25 @@ func (s *SSH) Run() (err error) {
 	}
 	defer listener.Close()
 
+	// Close the listener when the service is stopped
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
 	// build a channel stack to receive connections to the service
-	s.serve(listener, config)
+	s.serve(ctx, listener, config)
 	return
 }
 
 // Function to authenticate the user into the app
 func (s *SSH) auth(c ssh.ConnMetadata, pass []byte) (perms *ssh.Permissions, err error) {
+	s.Emit(c.RemoteAddr(), c.LocalAddr(), &events.Credentials{
+		Username: c.User(),
+		Password: string(pass),
+		Client:   string(c.ClientVersion()),
+	})
+
 	// Currently we don't really care about the credentials
 	// any user will have a successful login, as long as the user
 	// uses some credentials at all.
@@ -83,12 +97,16 @@ func (s *SSH) auth(c ssh.ConnMetadata, pass []byte) (perms *ssh.Permissions, err
 	return
 }
 
-func (s *SSH) serve(listener net.Listener, config *ssh.ServerConfig) {
+func (s *SSH) serve(ctx context.Context, listener net.Listener, config *ssh.ServerConfig) {
 	// open an infinite loop to receive connections
 	for {
 		// Accept the client connection
 		client, err := listener.Accept()
 		if err != nil {
+			// the listener was closed when the service stopped
+			if ctx.Err() != nil {
+				return
+			}
 			logger.Log.Error().Err(err)
 			continue
 		}
@@ -170,6 +188,12 @@ func (s *SSH) oob(sshItem SSHConn, requests <-chan *ssh.Request, conn ssh.Channe
 func (s *SSH) attachShell(sshItem SSHConn, conn ssh.Channel) (err error) {
 	// load a unix-like fake shell
 	shell := shell.New(sshItem.User, "ubuntu")
+	shell.OnCommand = func(command string) {
+		s.Emit(sshItem.remoteAddr, sshItem.localAddr, &events.Command{
+			Username: sshItem.User,
+			Input:    command,
+		})
+	}
 
 	f, err := pty.StartFaker(shell)
 	if err != nil {
@@ -219,6 +243,9 @@ type SSHConn struct {
 	// Request only
 	RequestType string
 	Payload     []byte
+
+	remoteAddr net.Addr
+	localAddr  net.Addr
 }
 
 type SSHAuth struct {
@@ -237,5 +264,7 @@ func NewSshConn(conn *ssh.ServerConn) SSHConn {
 		Msg:           "",
 		RequestType:   "",
 		Payload:       []byte{},
+		remoteAddr:    conn.RemoteAddr(),
+		localAddr:     conn.LocalAddr(),
 	}
 }
@@ -2,9 +2,12 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"io/ioutil"
 	"net"
+	"strings"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	"github.com/riotpot/internal/logger"
 	"github.com/riotpot/internal/services"
@@ -31,20 +34,28 @@ func Telnetd() services.Service {
 	}
 
 	return &Telnet{
-		Service: mx,
-		banner:  content,
+		PluginServiceItem: mx,
+		banner:            content,
 	}
 }
 
 type Telnet struct {
-	services.Service
+	*services.PluginServiceItem
 	banner []byte
 }
 
-func (t *Telnet) Run() (err error) {
+func (t *Telnet) Run(ctx context.Context) (err error) {
 	// start a service in the `telnet` port
 	listener, err := net.Listen(t.GetNetwork().String(), t.GetAddress())
-	logger.Log.Error().Err(err)
+	if err != nil {
+		return
+	}
+
+	// Close the listener when the service is stopped
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
 
 	// build a channel stack to receive connections to the service
 	conn := make(chan net.Conn)
@@ -57,6 +68,9 @@ func (t *Telnet) Run() (err error) {
 }
 
 func (t *Telnet) serve(ch chan net.Conn, listener net.Listener) {
+	// stop handling connections once the listener is closed
+	defer close(ch)
+
 	// open an infinite loop to receive connections
 	for {
 		// Accept the client connection
@@ -91,10 +105,15 @@ func (t *Telnet) handleConn(conn net.Conn) {
 // This method shows the welcome message to the telnet
 // service, and prompts for authentication.
 func (t *Telnet) sendAuth(conn net.Conn, br *bufio.Reader) {
-	t.respond(string(t.banner), conn, br)
+	user, _ := t.respond(string(t.banner), conn, br)
 
 	pass := `Password: `
-	t.respond(pass, conn, br)
+	password, _ := t.respond(pass, conn, br)
+
+	t.Emit(conn.RemoteAddr(), conn.LocalAddr(), &events.Credentials{
+		Username: strings.TrimRight(string(user), "\r\n"),
+		Password: strings.TrimRight(string(password), "\r\n"),
+	})
 }
 
 // Offers a telnet shell-like experience in where
@@ -104,6 +123,12 @@ func (t *Telnet) telnetShell(conn net.Conn, br *bufio.Reader) {
 	// load a unix-like fake shell
 	shell := shell.New("root", "ubuntu")
 	shell.SetIo(conn)
+	shell.OnCommand = func(command string) {
+		t.Emit(conn.RemoteAddr(), conn.LocalAddr(), &events.Command{
+			Username: "root",
+			Input:    command,
+		})
+	}
 	shell.Start()
 }
 
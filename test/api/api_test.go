@@ -6,10 +6,13 @@ import (
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
 	"github.com/stretchr/testify/assert"
 
 	apiProxy "github.com/riotpot/api/proxy"
@@ -91,3 +94,65 @@ func TestApiService(t *testing.T) {
 	json.Unmarshal(response, outputGet)
 	assert.Equal(t, 1, len(*outputGet))
 }
+
+// Test that reading the routing rules and the sniffer of a proxy does not register them in it
+func TestApiProxyMiddlewares(t *testing.T) {
+	assert := assert.New(t)
+
+	pe, err := proxy.Proxies.CreateProxy(globals.TCP, 18139)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Proxies.DeleteProxy(pe.GetID())
+
+	router := SetupRouter()
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/api/proxies/"+pe.GetID()+"/routes", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.JSONEq("[]", w.Body.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/proxies/"+pe.GetID()+"/routes/web", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	found, err := proxy.LookupRouter(pe)
+	assert.Nil(err)
+	assert.Nil(found)
+
+	// The sniffer has the default settings until it is changed
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("GET", "/api/proxies/"+pe.GetID()+"/sniffer", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), proxy.SnifferPeekTimeout.String())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("DELETE", "/api/proxies/"+pe.GetID()+"/sniffer/http", nil)
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusNotFound, w.Code)
+
+	assert.Empty(pe.GetMiddlewares().GetMiddlewares())
+
+	// The timeout must be positive
+	for _, timeout := range []string{"0s", "-1s"} {
+		w = httptest.NewRecorder()
+		req, _ = http.NewRequest("PATCH", "/api/proxies/"+pe.GetID()+"/sniffer", strings.NewReader(`{"timeout": "`+timeout+`"}`))
+		router.ServeHTTP(w, req)
+		assert.Equal(http.StatusBadRequest, w.Code, timeout)
+	}
+	assert.Empty(pe.GetMiddlewares().GetMiddlewares())
+
+	w = httptest.NewRecorder()
+	req, _ = http.NewRequest("PATCH", "/api/proxies/"+pe.GetID()+"/sniffer", strings.NewReader(`{"timeout": "1s"}`))
+	router.ServeHTTP(w, req)
+	assert.Equal(http.StatusOK, w.Code)
+
+	sniffer, err := proxy.LookupSniffer(pe)
+	assert.Nil(err)
+	if assert.NotNil(sniffer) {
+		assert.Equal(time.Second, sniffer.GetTimeout())
+	}
+}
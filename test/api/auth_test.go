@@ -0,0 +1,187 @@
+package api
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/api"
+	"github.com/riotpot/internal/auth"
+	"github.com/riotpot/internal/globals"
+	"github.com/stretchr/testify/assert"
+
+	apiAuth "github.com/riotpot/api/auth"
+	apiMetrics "github.com/riotpot/api/metrics"
+	apiMiddleware "github.com/riotpot/api/middleware"
+)
+
+// Send a request to the router with a token, returns the status of the response
+func request(router *gin.Engine, method string, path string, body interface{}, token string) *httptest.ResponseRecorder {
+	data, _ := json.Marshal(body)
+	req, _ := http.NewRequest(method, path, bytes.NewBuffer(data))
+	req.Header.Set("Content-Type", "application/json")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	return w
+}
+
+func TestApiAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	router := gin.Default()
+	group := router.Group("/api/")
+	apiAuth.AuthRouter.AddToGroup(group)
+	apiMiddleware.MiddlewaresRouter.AddToGroup(group)
+
+	// The API is open until a key or user is added
+	assert.Equal(http.StatusOK, request(router, "GET", "/api/middlewares/", nil, "").Code)
+
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(auth.Auth.AddKey("reader", "read-key", auth.ReadRole))
+	defer auth.Auth.RemoveKey("read-key")
+	assert.Nil(auth.Auth.AddUser("admin", hash, auth.AdminRole))
+	defer auth.Auth.RemoveUser("admin")
+
+	patch := map[string]interface{}{"enabled": true}
+
+	assert.Equal(http.StatusUnauthorized, request(router, "GET", "/api/middlewares/", nil, "").Code)
+	assert.Equal(http.StatusUnauthorized, request(router, "GET", "/api/middlewares/", nil, "wrong").Code)
+	assert.Equal(http.StatusOK, request(router, "GET", "/api/middlewares/", nil, "read-key").Code)
+	assert.Equal(http.StatusForbidden, request(router, "PATCH", "/api/middlewares/router", patch, "read-key").Code)
+
+	// Log in with the user
+	login := map[string]string{"username": "admin", "password": "wrong"}
+	assert.Equal(http.StatusUnauthorized, request(router, "POST", "/api/auth/login", login, "").Code)
+
+	login["password"] = "secret"
+	w := request(router, "POST", "/api/auth/login", login, "")
+	assert.Equal(http.StatusOK, w.Code)
+
+	session := &apiAuth.GetSession{}
+	assert.Nil(json.Unmarshal(w.Body.Bytes(), session))
+	assert.Equal(auth.AdminRole, session.Role)
+
+	w = request(router, "GET", "/api/auth/me", nil, session.Token)
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), `"name":"admin"`)
+
+	assert.NotEqual(http.StatusForbidden, request(router, "PATCH", "/api/middlewares/router", patch, session.Token).Code)
+
+	// The token is not valid after logging out
+	assert.Equal(http.StatusOK, request(router, "POST", "/api/auth/logout", nil, session.Token).Code)
+	assert.Equal(http.StatusUnauthorized, request(router, "GET", "/api/auth/me", nil, session.Token).Code)
+}
+
+// Test that the token is only accepted in the query of the event streams, and redacted from the logs
+func TestApiQueryToken(t *testing.T) {
+	assert := assert.New(t)
+
+	router := gin.New()
+	group := router.Group("/api/")
+	apiMiddleware.MiddlewaresRouter.AddToGroup(group)
+	group.Handle("GET", "stream/", api.AuthorizeQuery(auth.ReadRole), func(ctx *gin.Context) {
+		ctx.Status(http.StatusOK)
+	})
+
+	assert.Nil(auth.Auth.AddKey("reader", "read-key", auth.ReadRole))
+	defer auth.Auth.RemoveKey("read-key")
+
+	assert.Equal(http.StatusUnauthorized, request(router, "GET", "/api/middlewares/?token=read-key", nil, "").Code)
+	assert.Equal(http.StatusOK, request(router, "GET", "/api/stream/?token=read-key", nil, "").Code)
+	assert.Equal(http.StatusUnauthorized, request(router, "GET", "/api/stream/?token=wrong", nil, "").Code)
+
+	assert.Equal("/api/stream/?kind=change&token=REDACTED", api.RedactToken("/api/stream/?token=read-key&kind=change"))
+	assert.Equal("/api/records/?kind=credential", api.RedactToken("/api/records/?kind=credential"))
+	assert.Equal("/api/proxies/", api.RedactToken("/api/proxies/"))
+
+	line := api.LogFormatter(gin.LogFormatterParams{Method: "GET", StatusCode: 200, Path: "/api/stream/?token=read-key"})
+	assert.NotContains(line, "read-key")
+}
+
+// Test that the clients failing to log in too many times have to wait
+func TestApiLoginBackoff(t *testing.T) {
+	assert := assert.New(t)
+
+	router := gin.New()
+	group := router.Group("/api/")
+	apiAuth.AuthRouter.AddToGroup(group)
+
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(auth.Auth.AddUser("backoff", hash, auth.AdminRole))
+	defer auth.Auth.RemoveUser("backoff")
+
+	login := func(address string, password string) *httptest.ResponseRecorder {
+		data, _ := json.Marshal(map[string]string{"username": "backoff", "password": password})
+		req, _ := http.NewRequest("POST", "/api/auth/login", bytes.NewBuffer(data))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = address
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	for i := 0; i < 4; i++ {
+		assert.Equal(http.StatusUnauthorized, login("192.0.2.10:4000", "wrong").Code)
+	}
+
+	// The failures are forgotten once the client logs in
+	assert.Equal(http.StatusOK, login("192.0.2.10:4000", "secret").Code)
+
+	for i := 0; i < 5; i++ {
+		assert.Equal(http.StatusUnauthorized, login("192.0.2.10:4000", "wrong").Code)
+	}
+
+	// Even the right password is rejected while the client waits
+	w := login("192.0.2.10:4001", "secret")
+	assert.Equal(http.StatusTooManyRequests, w.Code)
+	assert.Equal("1", w.Header().Get("Retry-After"))
+
+	// Other clients are not affected
+	assert.Equal(http.StatusOK, login("192.0.2.11:4000", "secret").Code)
+
+	// The wait doubles with every failure after it
+	time.Sleep(auth.Auth.GetBackoff("192.0.2.10"))
+	assert.Equal(http.StatusUnauthorized, login("192.0.2.10:4000", "wrong").Code)
+	assert.Greater(auth.Auth.GetBackoff("192.0.2.10"), time.Second)
+}
+
+// Test that Prometheus can scrape the metrics with the scrape token instead of the credentials of the API
+func TestApiMetricsToken(t *testing.T) {
+	assert := assert.New(t)
+
+	router := gin.New()
+	apiMetrics.MetricsRouter.AddToGroup(&router.RouterGroup)
+
+	assert.Nil(auth.Auth.AddKey("reader", "read-key", auth.ReadRole))
+	defer auth.Auth.RemoveKey("read-key")
+
+	// Without a scrape token, only the clients of the API
+	assert.Equal(http.StatusUnauthorized, request(router, "GET", "/metrics", nil, "").Code)
+	assert.Equal(http.StatusUnauthorized, request(router, "GET", "/metrics", nil, "scrape-token").Code)
+	assert.Equal(http.StatusOK, request(router, "GET", "/metrics", nil, "read-key").Code)
+
+	globals.MetricsToken = "scrape-token"
+	defer func() { globals.MetricsToken = "" }()
+
+	w := request(router, "GET", "/metrics", nil, "scrape-token")
+	assert.Equal(http.StatusOK, w.Code)
+	assert.Contains(w.Body.String(), "# TYPE go_goroutines gauge")
+	assert.Equal(http.StatusUnauthorized, request(router, "GET", "/metrics", nil, "wrong").Code)
+	assert.Equal(http.StatusOK, request(router, "GET", "/metrics", nil, "read-key").Code)
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/riotpot/internal/events"
+	"github.com/stretchr/testify/assert"
+
+	apiStream "github.com/riotpot/api/stream"
+)
+
+// Read the next server-sent event, returning its name and data
+func readEvent(t *testing.T, reader *bufio.Reader) (name string, data string) {
+	for {
+		line, err := reader.ReadString('\n')
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		line = strings.TrimRight(line, "\n")
+		switch {
+		case line == "" && name != "":
+			return
+		case strings.HasPrefix(line, "event:"):
+			name = strings.TrimSpace(strings.TrimPrefix(line, "event:"))
+		case strings.HasPrefix(line, "data:"):
+			data = strings.TrimSpace(strings.TrimPrefix(line, "data:"))
+		}
+	}
+}
+
+func TestApiStream(t *testing.T) {
+	assert := assert.New(t)
+
+	router := gin.Default()
+	apiStream.StreamRouter.AddToGroup(router.Group("/api/"))
+
+	server := httptest.NewServer(router)
+	defer server.Close()
+
+	client := &http.Client{Timeout: 5 * time.Second}
+	res, err := client.Get(server.URL + "/api/stream/?kind=change&kind=credential")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal("text/event-stream", res.Header.Get("Content-Type"))
+
+	// The events filtered out are not sent
+	events.Events.Emit(events.NewEvent(nil, nil, &events.Command{Input: "ls"}))
+	events.Changes.Notify(events.NewChange(events.StartedChange, events.ProxyResource, "proxy-id"))
+	events.Events.Emit(events.NewEvent(nil, nil, &events.Credentials{Username: "root", Password: "root"}))
+
+	reader := bufio.NewReader(res.Body)
+
+	name, data := readEvent(t, reader)
+	assert.Equal(apiStream.ChangeEvent, name)
+
+	change := &events.Change{}
+	assert.Nil(json.Unmarshal([]byte(data), change))
+	assert.Equal(events.StartedChange, change.Kind)
+	assert.Equal("proxy-id", change.ResourceID)
+
+	name, data = readEvent(t, reader)
+	assert.Equal(string(events.CredentialKind), name)
+	assert.Contains(data, `"username":"root"`)
+}
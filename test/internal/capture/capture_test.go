@@ -0,0 +1,139 @@
+package capture
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/capture"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Start a server that answers with the messages it receives
+func echoServer(t *testing.T, address string) net.Listener {
+	l, err := net.Listen("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	return l
+}
+
+// Test that the frames written by a recorder are loaded back
+func TestTranscript(t *testing.T) {
+	assert := assert.New(t)
+
+	recorder, err := capture.NewRecorder(t.TempDir(), capture.Header{SessionID: "session", Network: "tcp"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	recorder.Write(capture.Input, []byte("ping"))
+	recorder.Write(capture.Output, []byte{0x00, 0xff})
+	recorder.Close()
+
+	transcript, err := capture.Load(recorder.GetPath())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(capture.Version, transcript.Header.Version)
+	assert.Equal("session", transcript.Header.SessionID)
+	assert.Equal(2, len(transcript.Frames))
+	assert.Equal(capture.Input, transcript.Frames[0].Direction)
+	assert.Equal([]byte("ping"), transcript.Frames[0].Data)
+	assert.Equal(capture.Output, transcript.Frames[1].Direction)
+	assert.Equal([]byte{0x00, 0xff}, transcript.Frames[1].Data)
+	assert.LessOrEqual(transcript.Frames[0].Offset, transcript.Frames[1].Offset)
+}
+
+// Test that a proxy captures its sessions, and that they can be replayed
+func TestProxyCaptureReplay(t *testing.T) {
+	assert := assert.New(t)
+
+	message := "Hi there!"
+	globals.CaptureDir = t.TempDir()
+
+	l := echoServer(t, "localhost:18083")
+	defer l.Close()
+
+	pr, err := proxy.NewProxyEndpoint(18082, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pr.SetService(services.NewService("echo", 18083, globals.TCP, "localhost", globals.Low))
+	pr.SetCapture(true)
+
+	if err := pr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Stop()
+
+	// Exchange the message through the proxy
+	conn, err := net.Dial("tcp", "localhost:18082")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprint(conn, message)
+	buf := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	assert.Eventually(func() bool {
+		sessions := pr.GetSessions()
+		return len(sessions) == 1 && !sessions[0].IsActive()
+	}, time.Second, 10*time.Millisecond)
+
+	// The session was captured in the directory of the proxy
+	paths, err := filepath.Glob(filepath.Join(globals.CaptureDir, pr.GetID(), "*"+capture.Extension))
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, len(paths))
+
+	transcript, err := capture.Load(paths[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Equal(pr.GetSessions()[0].GetID(), transcript.Header.SessionID)
+	assert.Equal(conn.LocalAddr().String(), transcript.Header.Client)
+	assert.Equal(2, len(transcript.Frames))
+	assert.Equal(capture.Input, transcript.Frames[0].Direction)
+	assert.Equal(message, string(transcript.Frames[0].Data))
+
+	// Replay the client stream against the service directly
+	var output bytes.Buffer
+	err = capture.Replay(transcript, capture.ReplayOptions{
+		Address: "localhost:18083",
+		Timeout: 200 * time.Millisecond,
+		Output:  &output,
+	})
+	assert.Nil(err)
+	assert.Equal(message, output.String())
+}
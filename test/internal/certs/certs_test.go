@@ -0,0 +1,88 @@
+package certs
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/riotpot/internal/certs"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the self-signed certificates, reused between restarts
+func TestSelfSigned(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	cert, key, err := certs.SelfSigned(dir, []string{"localhost", "127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := os.ReadFile(cert)
+	assert.Nil(err)
+
+	// The certificate is not generated again
+	_, _, err = certs.SelfSigned(dir, []string{"localhost", "127.0.0.1"})
+	assert.Nil(err)
+	second, err := os.ReadFile(cert)
+	assert.Nil(err)
+	assert.Equal(first, second)
+
+	info, err := os.Stat(key)
+	assert.Nil(err)
+	assert.Equal(os.FileMode(0600), info.Mode().Perm())
+
+	// Both the certificate and the key are required
+	_, err = certs.NewTLSConfig(certs.Options{Cert: cert})
+	assert.NotNil(err)
+}
+
+// Test a server using the TLS configuration, with and without mutual TLS
+func TestTLSConfig(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	config, err := certs.NewTLSConfig(certs.Options{Dir: dir, Hosts: []string{"127.0.0.1"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(tls.NoClientCert, config.ClientAuth)
+
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = config
+	server.StartTLS()
+	defer server.Close()
+
+	// Trust the self-signed certificate
+	data, err := os.ReadFile(dir + "/" + certs.SelfSignedCert)
+	assert.Nil(err)
+	pool := x509.NewCertPool()
+	assert.True(pool.AppendCertsFromPEM(data))
+
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	res, err := client.Get(server.URL)
+	if assert.Nil(err) {
+		res.Body.Close()
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+
+	// The clients without a certificate are rejected with mutual TLS
+	config, err = certs.NewTLSConfig(certs.Options{Dir: dir, ClientCA: dir + "/" + certs.SelfSignedCert})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(tls.RequireAndVerifyClientCert, config.ClientAuth)
+
+	mutual := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	mutual.TLS = config
+	mutual.StartTLS()
+	defer mutual.Close()
+
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}}}
+	_, err = client.Get(mutual.URL)
+	assert.NotNil(err)
+}
@@ -0,0 +1,55 @@
+package config
+
+import (
+	"testing"
+
+	"github.com/riotpot/internal/auth"
+	"github.com/riotpot/internal/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyAuth(t *testing.T) {
+	assert := assert.New(t)
+
+	hash, err := auth.HashPassword("secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := config.Parse([]byte(`
+api:
+  auth:
+    session_ttl: 1h
+    keys:
+      - name: prometheus
+        key: scrape-key
+      - name: invalid
+        key: other-key
+        role: root
+    users:
+      - username: admin
+        password: "` + hash + `"
+        role: admin
+      - username: plain
+        password: secret
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	authenticator := auth.NewAuthenticator(0)
+	errs := config.ApplyAuth(cfg.API.Auth, authenticator)
+	// The invalid role and the password that is not hashed
+	assert.Len(errs, 2)
+
+	principal, err := authenticator.Authenticate("scrape-key")
+	assert.Nil(err)
+	assert.Equal(auth.ReadRole, principal.Role)
+
+	session, err := authenticator.Login("admin", "secret", "127.0.0.1")
+	assert.Nil(err)
+	assert.Equal(auth.AdminRole, session.Principal.Role)
+
+	_, err = authenticator.Login("plain", "secret", "127.0.0.1")
+	assert.Equal(auth.ErrInvalidCredentials, err)
+}
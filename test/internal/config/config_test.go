@@ -0,0 +1,254 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/config"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/pcap"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+const configFile = `
+logging:
+  level: info
+plugins: false
+pcap:
+  max_files: 10
+  retention: 24h0m0s
+services:
+  - name: ssh-high
+    host: localhost
+    port: 18101
+    network: tcp
+  - name: http-high
+    host: localhost
+    port: 18102
+    network: tcp
+    interaction: low
+proxies:
+  - port: 18100
+    network: tcp
+    service: ssh-high
+    running: true
+    failover:
+      - http-high
+    limits:
+      max_sessions: 100
+      max_per_source: 10
+      window: 1m0s
+      max_duration: 10m0s
+    access:
+      allow:
+        - 10.1.2.3
+      deny:
+        - 10.0.0.0/8
+      action: tarpit
+      tarpit_delay: 30s
+    routes:
+      - name: web
+        prefix: "GET "
+        service: http-high
+    sniffer:
+      timeout: 200ms
+      services:
+        http: http-high
+    middlewares:
+      - name: router
+        priority: 5
+`
+
+// Test the parsing of a configuration file
+func TestParse(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg, err := config.Parse([]byte(configFile))
+	assert.Nil(err)
+	assert.Equal("info", cfg.Logging.Level)
+	assert.False(*cfg.Plugins)
+	assert.Nil(cfg.API)
+	assert.Len(cfg.Services, 2)
+	assert.Len(cfg.Proxies, 1)
+	assert.Equal("http-high", cfg.Proxies[0].Sniffer.Services["http"])
+	assert.Equal(5, *cfg.Proxies[0].Middlewares[0].Priority)
+
+	// Typos are not ignored
+	_, err = config.Parse([]byte("proxis: []"))
+	assert.NotNil(err)
+
+	// An empty file is valid
+	cfg, err = config.Parse([]byte(""))
+	assert.Nil(err)
+	assert.NotNil(cfg)
+}
+
+// Test that the configuration is loaded into the managers and exported back
+func TestApplyExport(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg, err := config.Parse([]byte(configFile))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Empty(config.Apply(cfg))
+	defer pcap.GlobalRetention.SetRetention(pcap.Retention{})
+	assert.Equal(pcap.Retention{MaxFiles: 10, MaxAge: 24 * time.Hour}, pcap.GlobalRetention.GetRetention())
+
+	pe, err := proxy.Proxies.GetProxyFromParams(globals.TCP, 18100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pe.Stop()
+
+	assert.Equal(globals.RunningStatus, pe.GetStatus())
+	assert.Equal("ssh-high", pe.GetService().GetName())
+	if assert.Len(pe.GetFailover(), 1) {
+		assert.Equal("http-high", pe.GetFailover()[0].GetName())
+	}
+	assert.Equal(proxy.Limits{MaxSessions: 100, MaxPerSource: 10, Window: time.Minute, MaxDuration: 10 * time.Minute}, pe.GetLimits())
+
+	access := pe.GetAccess()
+	assert.Equal(proxy.TarpitAccess, access.Action)
+	assert.Equal(30*time.Second, access.TarpitDelay)
+	if assert.Len(access.Deny, 1) && assert.Len(access.Allow, 1) {
+		assert.Equal("10.0.0.0/8", access.Deny[0].String())
+		assert.Equal("10.1.2.3/32", access.Allow[0].String())
+	}
+
+	router, err := proxy.GetRouter(pe)
+	assert.Nil(err)
+	assert.Len(router.GetRules(), 1)
+
+	item, err := pe.GetMiddlewares().GetMiddleware(proxy.RouterName)
+	assert.Nil(err)
+	assert.Equal(5, item.Priority)
+
+	// Applying the configuration again does not duplicate anything
+	assert.Empty(config.Apply(cfg))
+	assert.Len(proxy.Proxies.GetProxies(), 1)
+	assert.Len(router.GetRules(), 1)
+
+	// The export contains the same services and proxies
+	exported := config.Export()
+	assert.Len(exported.Services, 2)
+	assert.Len(exported.Proxies, 1)
+
+	p := exported.Proxies[0]
+	assert.Equal(18100, p.Port)
+	assert.Equal("tcp", p.Network)
+	assert.Equal("ssh-high", p.Service)
+	assert.True(p.Running)
+	assert.Equal([]string{"http-high"}, p.Failover)
+	assert.Equal(&config.Limits{MaxSessions: 100, MaxPerSource: 10, Window: "1m0s", MaxDuration: "10m0s"}, p.Limits)
+	assert.Nil(exported.Limits)
+	assert.Equal(&config.Access{Allow: []string{"10.1.2.3/32"}, Deny: []string{"10.0.0.0/8"}, Action: "tarpit", TarpitDelay: "30s"}, p.Access)
+	assert.Nil(exported.Access)
+	assert.Equal(&config.Pcap{MaxFiles: 10, Retention: "24h0m0s"}, exported.Pcap)
+	assert.Equal([]config.Route{{Name: "web", Prefix: "GET ", Service: "http-high"}}, p.Routes)
+	assert.Equal("200ms", p.Sniffer.Timeout)
+	assert.Equal(map[string]string{"http": "http-high"}, p.Sniffer.Services)
+
+	// The export can be parsed again
+	data, err := exported.Marshal()
+	assert.Nil(err)
+
+	parsed, err := config.Parse(data)
+	assert.Nil(err)
+	assert.Equal(exported.Proxies, parsed.Proxies)
+	assert.Equal(exported.Services, parsed.Services)
+}
+
+const stateFile = `
+services:
+  - id: 6a1f1d1e-8f4e-4c36-9a43-2f0d5a3b9c01
+    name: coap-high
+    host: localhost
+    port: 18104
+    network: udp
+proxies:
+  - id: 0b7e2a90-2c1d-4f5e-8d6a-1e3c4b5a6d02
+    port: 18105
+    network: udp
+    service: coap-high
+    running: true
+`
+
+// Test that the state is restored with the same IDs, and saved only when it changes
+func TestState(t *testing.T) {
+	assert := assert.New(t)
+
+	path := filepath.Join(t.TempDir(), "riotpot.state.yaml")
+	state := config.NewState(path)
+
+	// There is nothing to restore the first time
+	assert.Empty(state.Restore())
+
+	if err := os.WriteFile(path, []byte(stateFile), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(state.Restore())
+
+	service, err := services.Services.GetService("6a1f1d1e-8f4e-4c36-9a43-2f0d5a3b9c01")
+	assert.Nil(err)
+	assert.Equal("coap-high", service.GetName())
+
+	pe, err := proxy.Proxies.GetProxy("0b7e2a90-2c1d-4f5e-8d6a-1e3c4b5a6d02")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pe.Stop()
+
+	assert.Equal(globals.RunningStatus, pe.GetStatus())
+	assert.Equal(service, pe.GetService())
+
+	// The state saved contains the restored proxy
+	assert.Nil(state.Save())
+	saved, err := config.Load(path)
+	assert.Nil(err)
+
+	found := false
+	for _, p := range saved.Proxies {
+		if p.ID == pe.GetID() {
+			found = true
+			assert.True(p.Running)
+			assert.Equal("coap-high", p.Service)
+		}
+	}
+	assert.True(found)
+
+	// The file is not written again while the state does not change
+	assert.Nil(os.Remove(path))
+	assert.Nil(state.Save())
+	assert.NoFileExists(path)
+
+	pe.Stop()
+	assert.Nil(state.Save())
+	assert.FileExists(path)
+
+	// The proxies recorded as stopped are stopped, and the services keep their address
+	assert.Nil(pe.Start())
+	changed := strings.Replace(strings.Replace(stateFile, "running: true", "running: false", 1), "port: 18104", "port: 18106", 1)
+	if err := os.WriteFile(path, []byte(changed), 0644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Empty(state.Restore())
+
+	assert.Equal(globals.StoppedStatus, pe.GetStatus())
+	assert.Equal(18106, service.GetPort())
+	assert.Same(service, pe.GetService())
+
+	named := 0
+	for _, s := range services.Services.GetServices() {
+		if s.GetName() == "coap-high" {
+			named++
+		}
+	}
+	assert.Equal(1, named)
+}
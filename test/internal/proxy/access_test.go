@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the sources allowed and denied by an access list
+func TestAccessList(t *testing.T) {
+	assert := assert.New(t)
+
+	list := proxy.NewAccessList()
+	assert.NotNil(list.SetAccess(proxy.AccessRules{Action: "reject"}))
+	assert.NotNil(list.SetAccess(proxy.AccessRules{TarpitDelay: -time.Second}))
+
+	// Every source is allowed without rules
+	_, denied := list.Check(net.ParseIP("10.0.0.1"))
+	assert.False(denied)
+
+	deny, _ := proxy.ParseNetworks([]string{"10.0.0.0/8", "2001:db8::/32"})
+	allow, _ := proxy.ParseNetworks([]string{"10.1.2.3"})
+	assert.Nil(list.SetAccess(proxy.AccessRules{Allow: allow, Deny: deny}))
+	assert.Equal(proxy.DropAccess, list.GetAccess().Action)
+
+	action, denied := list.Check(net.ParseIP("10.0.0.1"))
+	assert.True(denied)
+	assert.Equal(proxy.DropAccess, action)
+	_, denied = list.Check(net.ParseIP("2001:db8::1"))
+	assert.True(denied)
+
+	// The allowed sources take precedence over the denied networks
+	_, denied = list.Check(net.ParseIP("10.1.2.3"))
+	assert.False(denied)
+	_, denied = list.Check(net.ParseIP("192.168.0.1"))
+	assert.False(denied)
+
+	// The tarpits hold the connections for a minute by default
+	assert.Nil(list.SetAccess(proxy.AccessRules{Deny: deny, Action: proxy.TarpitAccess}))
+	assert.Equal(time.Minute, list.GetAccess().TarpitDelay)
+	action, denied = list.Check(net.ParseIP("10.0.0.1"))
+	assert.True(denied)
+	assert.Equal(proxy.TarpitAccess, action)
+}
+
+// Test that the proxy drops and tarpits the denied sources before reaching the service
+func TestAccess(t *testing.T) {
+	assert := assert.New(t)
+
+	service := services.NewService("access", 18138, globals.TCP, "127.0.0.1", globals.High)
+
+	listener, err := net.Listen("tcp", service.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	pe, err := proxy.NewProxyEndpoint(18137, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe.SetService(service)
+	assert.Nil(pe.Start())
+	defer pe.Stop()
+
+	localhost, _ := proxy.ParseNetworks([]string{"127.0.0.0/8"})
+
+	// Dropped by the access list of the proxy
+	assert.Nil(pe.SetAccess(proxy.AccessRules{Deny: localhost}))
+
+	conn, ok := echoes(t, "127.0.0.1:18137")
+	assert.False(ok)
+	conn.Close()
+
+	// Unless the source is allowed
+	allowed, _ := proxy.ParseNetworks([]string{"127.0.0.1"})
+	assert.Nil(pe.SetAccess(proxy.AccessRules{Allow: allowed, Deny: localhost}))
+
+	conn, ok = echoes(t, "127.0.0.1:18137")
+	assert.True(ok)
+	conn.Close()
+
+	// Tarpitted by the global access list: the connection stays open without answers
+	assert.Nil(pe.SetAccess(proxy.AccessRules{}))
+	assert.Nil(proxy.GlobalAccess.SetAccess(proxy.AccessRules{Deny: localhost, Action: proxy.TarpitAccess, TarpitDelay: 300 * time.Millisecond}))
+	defer proxy.GlobalAccess.SetAccess(proxy.AccessRules{})
+
+	conn, ok = echoes(t, "127.0.0.1:18137")
+	assert.False(ok)
+
+	// Closed once the delay passes
+	start := time.Now()
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.Equal(io.EOF, err)
+	assert.Less(time.Since(start), time.Second)
+	conn.Close()
+
+	// The denied connections are not recorded as sessions
+	assert.Len(pe.GetSessions(), 1)
+}
@@ -0,0 +1,91 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the proxy dials the failover chain in order when its service is down
+func TestFailover(t *testing.T) {
+	assert := assert.New(t)
+
+	primary := services.NewService("primary", 18120, globals.TCP, "127.0.0.1", globals.High)
+	secondary := services.NewService("secondary", 18121, globals.TCP, "127.0.0.1", globals.High)
+	tertiary := services.NewService("tertiary", 18122, globals.TCP, "127.0.0.1", globals.High)
+
+	// Only the last service of the chain answers
+	listener, err := net.Listen("tcp", tertiary.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	pe, err := proxy.NewProxyEndpoint(18119, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe.SetService(primary)
+
+	udp := services.NewService("udp", 18123, globals.UDP, "127.0.0.1", globals.High)
+	assert.NotNil(pe.SetFailover([]services.Service{udp}))
+	assert.NotNil(pe.SetFailover([]services.Service{secondary, secondary}))
+	assert.Nil(pe.SetFailover([]services.Service{secondary, tertiary}))
+	assert.Len(pe.GetFailover(), 2)
+
+	if err := pe.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pe.Stop()
+
+	conn, err := net.Dial("tcp", "127.0.0.1:18119")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(err)
+	assert.Equal("hello", string(buf))
+
+	sessions := pe.GetSessions()
+	if !assert.Len(sessions, 1) {
+		return
+	}
+
+	attempts := sessions[0].GetAttempts()
+	if assert.Len(attempts, 3) {
+		assert.Equal("primary", attempts[0].Service)
+		assert.NotEmpty(attempts[0].Error)
+		assert.Equal("secondary", attempts[1].Service)
+		assert.NotEmpty(attempts[1].Error)
+		assert.Equal("tertiary", attempts[2].Service)
+		assert.Empty(attempts[2].Error)
+	}
+
+	served, ok := sessions[0].GetServedBy()
+	assert.True(ok)
+	assert.Equal(tertiary.GetID(), served.ServiceID)
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the behaviour of a proxy when its service is down
+func TestDownPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	down, err := services.Services.CreateService("down", 18117, globals.TCP, "127.0.0.1", globals.High)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fallback, err := services.Services.CreateService("fallback", 18118, globals.TCP, "127.0.0.1", globals.High)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Echo server of the fallback service
+	listener, err := net.Listen("tcp", fallback.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	pe, err := proxy.NewProxyEndpoint(18116, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe.SetService(down)
+	if err := pe.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pe.Stop()
+
+	assert.Equal(proxy.RejectAction, pe.GetDownPolicy().Action)
+	assert.NotNil(pe.SetDownPolicy(proxy.DownPolicy{Action: proxy.FallbackAction, Fallback: "unknown"}))
+
+	// The fallback service must use the network of the proxy
+	udp, err := services.Services.CreateService("fallback-udp", 18161, globals.UDP, "127.0.0.1", globals.High)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer services.Services.DeleteService(udp.GetID())
+	assert.NotNil(pe.SetDownPolicy(proxy.DownPolicy{Action: proxy.FallbackAction, Fallback: udp.GetID()}))
+	assert.Equal(proxy.RejectAction, pe.GetDownPolicy().Action)
+
+	// The client gets the banner
+	assert.Nil(pe.SetDownPolicy(proxy.DownPolicy{Action: proxy.BannerAction, Banner: "SSH-2.0-OpenSSH_8.9\r\n"}))
+
+	conn, err := net.Dial("tcp", "127.0.0.1:18116")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	banner, err := io.ReadAll(conn)
+	conn.Close()
+	assert.Nil(err)
+	assert.Equal("SSH-2.0-OpenSSH_8.9\r\n", string(banner))
+
+	// The client is relayed to the fallback service
+	assert.Nil(pe.SetDownPolicy(proxy.DownPolicy{Action: proxy.FallbackAction, Fallback: fallback.GetID()}))
+
+	conn, err = net.Dial("tcp", "127.0.0.1:18116")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(err)
+	assert.Equal("hello", string(buf))
+}
@@ -0,0 +1,241 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the sessions open and the connections per source admitted by a limiter
+func TestLimiter(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter := proxy.NewLimiter()
+	assert.NotNil(limiter.SetLimits(proxy.Limits{MaxSessions: -1}))
+	assert.NotNil(limiter.SetLimits(proxy.Limits{MaxPerSource: 1}))
+
+	// Sessions open at the same time
+	assert.Nil(limiter.SetLimits(proxy.Limits{MaxSessions: 2}))
+
+	first, _, _ := limiter.Admit("10.0.0.1")
+	second, _, _ := limiter.Admit("10.0.0.2")
+	assert.NotNil(first)
+	assert.NotNil(second)
+
+	// The rejection is only reported the first time the limit is reached
+	release, limit, report := limiter.Admit("10.0.0.3")
+	assert.Nil(release)
+	assert.Equal(proxy.SessionsLimit, limit)
+	assert.True(report)
+	_, _, report = limiter.Admit("10.0.0.3")
+	assert.False(report)
+
+	first()
+	first()
+	assert.Equal(1, limiter.GetActive())
+	release, _, _ = limiter.Admit("10.0.0.3")
+	assert.NotNil(release)
+	release()
+	second()
+
+	// Connections of each source within the window
+	assert.Nil(limiter.SetLimits(proxy.Limits{MaxPerSource: 2, Window: 100 * time.Millisecond}))
+
+	for i := 0; i < 2; i++ {
+		release, _, _ = limiter.Admit("10.0.0.1")
+		assert.NotNil(release)
+		release()
+	}
+
+	release, limit, report = limiter.Admit("10.0.0.1")
+	assert.Nil(release)
+	assert.Equal(proxy.RateLimit, limit)
+	assert.True(report)
+
+	release, _, _ = limiter.Admit("10.0.0.2")
+	assert.NotNil(release)
+
+	time.Sleep(120 * time.Millisecond)
+	release, _, _ = limiter.Admit("10.0.0.1")
+	assert.NotNil(release)
+}
+
+// Dial the proxy and check whether the service echoes the message
+func echoes(t *testing.T, address string) (conn net.Conn, ok bool) {
+	conn, err := net.Dial("tcp", address)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.SetDeadline(time.Now().Add(time.Second))
+	conn.Write([]byte("hello"))
+
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	conn.SetDeadline(time.Time{})
+	return conn, err == nil
+}
+
+// Test that the proxy enforces its limits and the global ones
+func TestLimits(t *testing.T) {
+	assert := assert.New(t)
+
+	service := services.NewService("limits", 18136, globals.TCP, "127.0.0.1", globals.High)
+
+	listener, err := net.Listen("tcp", service.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	pe, err := proxy.NewProxyEndpoint(18135, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe.SetService(service)
+	assert.Nil(pe.Start())
+	defer pe.Stop()
+
+	// A single session at a time
+	assert.Nil(pe.SetLimits(proxy.Limits{MaxSessions: 1}))
+
+	first, ok := echoes(t, "127.0.0.1:18135")
+	assert.True(ok)
+	second, ok := echoes(t, "127.0.0.1:18135")
+	assert.False(ok)
+	second.Close()
+
+	// The rejected connection did not reach the service
+	assert.Len(pe.GetSessions(), 1)
+
+	first.Close()
+	assert.Eventually(func() bool {
+		conn, ok := echoes(t, "127.0.0.1:18135")
+		conn.Close()
+		return ok
+	}, time.Second, 20*time.Millisecond)
+
+	// Sessions closed after the maximum duration
+	assert.Nil(pe.SetLimits(proxy.Limits{MaxDuration: 100 * time.Millisecond}))
+
+	conn, ok := echoes(t, "127.0.0.1:18135")
+	assert.True(ok)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(err)
+	conn.Close()
+
+	// Sessions closed after relaying the maximum bytes
+	assert.Nil(pe.SetLimits(proxy.Limits{MaxBytes: 8}))
+
+	conn, ok = echoes(t, "127.0.0.1:18135")
+	assert.True(ok)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.NotNil(err)
+	conn.Close()
+
+	reasons := map[string]bool{}
+	assert.Eventually(func() bool {
+		for _, session := range pe.GetSessions() {
+			reasons[session.GetCloseReason()] = true
+		}
+		return reasons[proxy.DurationLimitReason] && reasons[proxy.BytesLimitReason]
+	}, time.Second, 20*time.Millisecond)
+
+	// A single connection per source, shared by all the proxies
+	assert.Nil(pe.SetLimits(proxy.Limits{}))
+	assert.Nil(proxy.GlobalLimiter.SetLimits(proxy.Limits{MaxPerSource: 1, Window: time.Hour}))
+	defer proxy.GlobalLimiter.SetLimits(proxy.Limits{})
+
+	conn, ok = echoes(t, "127.0.0.1:18135")
+	assert.True(ok)
+	conn.Close()
+	conn, ok = echoes(t, "127.0.0.1:18135")
+	assert.False(ok)
+	conn.Close()
+}
+
+// Test that the connections rejected by the limits of the proxy do not count in the global limits
+func TestLimitsRollback(t *testing.T) {
+	assert := assert.New(t)
+
+	service := services.NewService("rollback", 18153, globals.TCP, "127.0.0.1", globals.High)
+
+	listener, err := net.Listen("tcp", service.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	pe, err := proxy.NewProxyEndpoint(18154, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe.SetService(service)
+	assert.Nil(pe.Start())
+	defer pe.Stop()
+
+	// Two connections per source globally, a single session at a time in the proxy
+	assert.Nil(proxy.GlobalLimiter.SetLimits(proxy.Limits{MaxPerSource: 2, Window: time.Hour}))
+	defer proxy.GlobalLimiter.SetLimits(proxy.Limits{})
+	assert.Nil(pe.SetLimits(proxy.Limits{MaxSessions: 1}))
+
+	first, ok := echoes(t, "127.0.0.1:18154")
+	assert.True(ok)
+
+	// Admitted globally, rejected by the proxy
+	second, ok := echoes(t, "127.0.0.1:18154")
+	assert.False(ok)
+	second.Close()
+
+	first.Close()
+	assert.Eventually(func() bool {
+		return proxy.GlobalLimiter.GetActive() == 0
+	}, time.Second, 20*time.Millisecond)
+
+	// The rejected connection did not use the second connection of the source
+	third, ok := echoes(t, "127.0.0.1:18154")
+	assert.True(ok)
+	third.Close()
+
+	assert.Eventually(func() bool {
+		return proxy.GlobalLimiter.GetActive() == 0
+	}, time.Second, 20*time.Millisecond)
+
+	fourth, ok := echoes(t, "127.0.0.1:18154")
+	assert.False(ok)
+	fourth.Close()
+}
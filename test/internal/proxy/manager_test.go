@@ -0,0 +1,93 @@
+package proxy
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test that the proxies are registered once when created concurrently
+func TestProxyManagerConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	manager := proxy.NewProxyManager()
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	created := 0
+
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := manager.CreateProxy(globals.TCP, 18108); err == nil {
+				mu.Lock()
+				created++
+				mu.Unlock()
+			}
+			manager.GetProxies()
+		}()
+	}
+	wg.Wait()
+
+	assert.Equal(1, created)
+	assert.Len(manager.GetProxies(), 1)
+
+	_, err := manager.CreateProxy(globals.Network(9), 18109)
+	assert.NotNil(err)
+}
+
+// Test the changes notified through the lifecycle of a proxy
+func TestProxyManagerChanges(t *testing.T) {
+	assert := assert.New(t)
+	manager := proxy.NewProxyManager()
+
+	var mu sync.Mutex
+	changes := map[events.Resource][]events.ChangeKind{}
+	unsubscribe := events.Changes.Subscribe(events.NotifierFunc(func(change *events.Change) {
+		mu.Lock()
+		defer mu.Unlock()
+		changes[change.Resource] = append(changes[change.Resource], change.Kind)
+	}))
+	defer unsubscribe()
+
+	service, err := services.Services.CreateService("changes", 18107, globals.TCP, "localhost", globals.Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pe, err := manager.CreateProxy(globals.TCP, 18106)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pe.SetService(service)
+	assert.Nil(pe.Start())
+	assert.Nil(pe.Stop())
+	assert.Nil(manager.DeleteProxy(pe.GetID()))
+
+	_, err = manager.GetProxy(pe.GetID())
+	assert.NotNil(err)
+	assert.NotNil(manager.DeleteProxy(pe.GetID()))
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal([]events.ChangeKind{
+		events.CreatedChange,
+		events.UpdatedChange,
+		events.StartedChange,
+		events.StoppedChange,
+		events.DeletedChange,
+	}, changes[events.ProxyResource])
+
+	// The service of the proxy is deleted with it
+	assert.Equal([]events.ChangeKind{
+		events.CreatedChange,
+		events.DeletedChange,
+	}, changes[events.ServiceResource])
+}
@@ -0,0 +1,102 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/metrics"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Returns the metrics exposed
+func scrape(t *testing.T) string {
+	var b strings.Builder
+	if err := metrics.Write(&b); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// Test the metrics of the connections relayed by a proxy
+func TestProxyMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	service, err := services.Services.CreateService("metrics", 18111, globals.TCP, "localhost", globals.Low)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pe, err := proxy.Proxies.CreateProxy(globals.TCP, 18110)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer proxy.Proxies.DeleteProxy(pe.GetID())
+
+	pe.SetService(service)
+	if err := pe.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	labels := fmt.Sprintf(`network="tcp",port="18110",proxy="%s"`, pe.GetID())
+	assert.Contains(scrape(t), fmt.Sprintf(`riotpot_proxy_up{%s,service="metrics"} 1`, labels))
+
+	// The service is not listening yet
+	conn, err := net.Dial("tcp", "localhost:18110")
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.ReadAll(conn)
+	conn.Close()
+
+	// Echo server
+	listener, err := net.Listen("tcp", service.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		server, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer server.Close()
+		io.Copy(server, server)
+	}()
+
+	conn, err = net.Dial("tcp", "localhost:18110")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(err)
+
+	output := scrape(t)
+	assert.Contains(output, fmt.Sprintf(`riotpot_proxy_connections_active{%s} 1`, labels))
+	assert.Contains(output, `riotpot_service_connections_active{service="metrics"} 1`)
+	conn.Close()
+
+	// Wait for the proxy to close the connection
+	time.Sleep(100 * time.Millisecond)
+
+	output = scrape(t)
+	assert.Contains(output, fmt.Sprintf(`riotpot_proxy_connections_total{%s} 2`, labels))
+	assert.Contains(output, fmt.Sprintf(`riotpot_proxy_connections_active{%s} 0`, labels))
+	assert.Contains(output, fmt.Sprintf(`riotpot_proxy_dial_failures_total{%s,service="metrics"} 1`, labels))
+	assert.Contains(output, fmt.Sprintf(`riotpot_proxy_bytes_total{direction="in",%s} 5`, labels))
+	assert.Contains(output, fmt.Sprintf(`riotpot_proxy_bytes_total{direction="out",%s} 5`, labels))
+	assert.Contains(output, `riotpot_service_connections_total{service="metrics"} 1`)
+
+	pe.Stop()
+	assert.Contains(scrape(t), fmt.Sprintf(`riotpot_proxy_up{%s,service="metrics"} 0`, labels))
+}
@@ -0,0 +1,349 @@
+package proxy
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Middleware built from a function, observing the bytes of the flows
+type testMiddleware struct {
+	name   string
+	handle func(flow *proxy.Flow) (proxy.Action, error)
+
+	mu       sync.Mutex
+	observed bytes.Buffer
+}
+
+func (m *testMiddleware) GetName() string {
+	return m.name
+}
+
+func (m *testMiddleware) Handle(flow *proxy.Flow) (proxy.Action, error) {
+	return m.handle(flow)
+}
+
+func (m *testMiddleware) Observe(flow *proxy.Flow, fromClient bool, p []byte) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if fromClient {
+		m.observed.Write(p)
+	}
+}
+
+func newTestMiddleware(name string, action proxy.Action) *testMiddleware {
+	return &testMiddleware{
+		name:   name,
+		handle: func(flow *proxy.Flow) (proxy.Action, error) { return action, nil },
+	}
+}
+
+// Connection that replaces what the client sends with uppercase letters
+type upperConn struct {
+	net.Conn
+}
+
+func (c *upperConn) Read(p []byte) (n int, err error) {
+	n, err = c.Conn.Read(p)
+	copy(p, bytes.ToUpper(p[:n]))
+	return
+}
+
+// Start a server that answers with a prefix and the messages it receives
+func prefixServer(t *testing.T, port int, prefix string) net.Listener {
+	l, err := net.Listen("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+
+			go func() {
+				defer conn.Close()
+				buf := make([]byte, 1024)
+				n, err := conn.Read(buf)
+				if err != nil {
+					return
+				}
+				conn.Write(append([]byte(prefix), buf[:n]...))
+			}()
+		}
+	}()
+
+	return l
+}
+
+// Send a message through the proxy and return the answer
+func exchange(t *testing.T, port int, message string) string {
+	conn, err := net.Dial("tcp", fmt.Sprintf("localhost:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	fmt.Fprint(conn, message)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	answer, _ := io.ReadAll(conn)
+	return string(answer)
+}
+
+// Test the registration, order and state of the middlewares in a chain
+func TestMiddlewareChain(t *testing.T) {
+	assert := assert.New(t)
+	chain := proxy.NewMiddlewareManager()
+
+	chain.Register(newTestMiddleware("second", proxy.Allow), 10)
+	chain.Register(newTestMiddleware("first", proxy.Allow), 0)
+	_, err := chain.Register(newTestMiddleware("first", proxy.Allow), 5)
+	assert.NotNil(err)
+
+	items := chain.GetMiddlewares()
+	assert.Equal(2, len(items))
+	assert.Equal("first", items[0].Middleware.GetName())
+	assert.Equal("second", items[1].Middleware.GetName())
+
+	assert.Nil(chain.SetPriority("second", -1))
+	assert.Nil(chain.SetEnabled("first", false))
+	items = chain.GetMiddlewares()
+	assert.Equal("second", items[0].Middleware.GetName())
+	assert.False(items[1].Enabled)
+
+	assert.Nil(chain.Unregister("second"))
+	assert.NotNil(chain.Unregister("second"))
+	assert.Equal(1, len(chain.GetMiddlewares()))
+}
+
+// Test that the proxy applies its middlewares to the connections
+func TestMiddlewarePipeline(t *testing.T) {
+	assert := assert.New(t)
+
+	main := prefixServer(t, 18087, "main:")
+	defer main.Close()
+	other := prefixServer(t, 18088, "other:")
+	defer other.Close()
+
+	pr, err := proxy.NewProxyEndpoint(18086, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetService(services.NewService("main", 18087, globals.TCP, "localhost", globals.Low))
+
+	// Wrap the connection of the client and observe the bytes
+	wrapper := newTestMiddleware("wrapper", proxy.Allow)
+	wrapper.handle = func(flow *proxy.Flow) (proxy.Action, error) {
+		flow.Conn = &upperConn{Conn: flow.Conn}
+		return proxy.Allow, nil
+	}
+	pr.GetMiddlewares().Register(wrapper, 0)
+
+	// Deny every connection, after the wrapper
+	deny := newTestMiddleware("deny", proxy.Deny)
+	pr.GetMiddlewares().Register(deny, 20)
+
+	// Redirect the connections to another service, disabled for now
+	redirect := newTestMiddleware("redirect", proxy.Redirect)
+	redirect.handle = func(flow *proxy.Flow) (proxy.Action, error) {
+		flow.Service = services.NewService("other", 18088, globals.TCP, "localhost", globals.Low)
+		return proxy.Redirect, nil
+	}
+	pr.GetMiddlewares().Register(redirect, 10)
+	pr.GetMiddlewares().SetEnabled("redirect", false)
+
+	if err := pr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Stop()
+
+	// Denied connections are closed without an answer
+	assert.Equal("", exchange(t, 18086, "hello"))
+	assert.Eventually(func() bool {
+		sessions := pr.GetSessions()
+		return len(sessions) == 1 && sessions[0].GetCloseReason() == proxy.RejectedReason
+	}, time.Second, 10*time.Millisecond)
+
+	// Without the deny middleware the connection reaches the service through the wrapper
+	pr.GetMiddlewares().SetEnabled("deny", false)
+	assert.Equal("main:HELLO", exchange(t, 18086, "hello"))
+	assert.Equal("HELLO", wrapper.observed.String())
+
+	// The redirect skips the rest of middlewares
+	pr.GetMiddlewares().SetEnabled("deny", true)
+	pr.GetMiddlewares().SetEnabled("redirect", true)
+	assert.Equal("other:HELLO", exchange(t, 18086, "hello"))
+	assert.Equal("", deny.observed.String())
+}
+
+// Test the conditions of the routing rules
+func TestRoutingConditions(t *testing.T) {
+	assert := assert.New(t)
+
+	window, err := proxy.ParseTimeWindow("22:00-06:00")
+	assert.Nil(err)
+	assert.True(window.Contains(time.Date(2023, 1, 1, 23, 0, 0, 0, time.UTC)))
+	assert.True(window.Contains(time.Date(2023, 1, 1, 5, 59, 0, 0, time.UTC)))
+	assert.False(window.Contains(time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC)))
+	assert.Equal("22:00-06:00", window.String())
+
+	_, err = proxy.ParseTimeWindow("22:00")
+	assert.NotNil(err)
+
+	networks, err := proxy.ParseNetworks([]string{"10.0.0.0/8", "192.168.1.1", "::1"})
+	assert.Nil(err)
+	assert.Equal(3, len(networks))
+	assert.Equal("192.168.1.1/32", networks[1].String())
+	assert.True(networks[0].Contains(net.ParseIP("10.1.2.3")))
+
+	_, err = proxy.ParseNetworks([]string{"not an ip"})
+	assert.NotNil(err)
+}
+
+// Test that the router selects the service of the flows using its rules
+func TestRouting(t *testing.T) {
+	assert := assert.New(t)
+
+	low := prefixServer(t, 18090, "low:")
+	defer low.Close()
+	high := prefixServer(t, 18091, "high:")
+	defer high.Close()
+
+	pr, err := proxy.NewProxyEndpoint(18089, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetService(services.NewService("low", 18090, globals.TCP, "localhost", globals.Low))
+	highService := services.NewService("high", 18091, globals.TCP, "localhost", globals.High)
+
+	// The router is not registered until it is requested
+	router, err := proxy.LookupRouter(pr)
+	assert.Nil(err)
+	assert.Nil(router)
+
+	router, err = proxy.GetRouter(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The same router is returned once registered
+	again, _ := proxy.GetRouter(pr)
+	assert.Same(router, again)
+
+	outside, _ := proxy.ParseNetworks([]string{"203.0.113.0/24"})
+	assert.Nil(router.AddRule(proxy.RoutingRule{Name: "outside", Sources: outside, Service: highService}))
+	assert.Nil(router.AddRule(proxy.RoutingRule{Name: "admin", Prefix: []byte("ADMIN"), Service: highService}))
+	assert.Nil(router.AddRule(proxy.RoutingRule{Name: "repeat", MinVisits: 2, Service: highService}))
+	assert.NotNil(router.AddRule(proxy.RoutingRule{Name: "repeat", Service: highService}))
+	assert.NotNil(router.AddRule(proxy.RoutingRule{Name: "nowhere"}))
+
+	if err := pr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Stop()
+
+	// First visit, no rule matches
+	assert.Equal("low:hello", exchange(t, 18089, "hello"))
+	// The payload matches a prefix, and it is still relayed in full
+	assert.Equal("high:ADMIN login", exchange(t, 18089, "ADMIN login"))
+	// Third visit, the client is escalated
+	assert.Equal("high:hello", exchange(t, 18089, "hello"))
+	assert.Equal(3, router.GetVisits("127.0.0.1"))
+
+	// Without the rules the client stays in the service of the proxy
+	assert.Nil(router.RemoveRule("repeat"))
+	assert.Equal("low:hello", exchange(t, 18089, "hello"))
+	assert.Equal(2, len(router.GetRules()))
+}
+
+// Test the detection of the protocols from the first bytes of the clients
+func TestDetectProtocol(t *testing.T) {
+	assert := assert.New(t)
+
+	cases := []struct {
+		data     []byte
+		protocol string
+		more     bool
+	}{
+		{[]byte("SSH-2.0-OpenSSH_8.9\r\n"), proxy.SSHProtocol, false},
+		{[]byte("SS"), "", true},
+		{[]byte("GET / HTTP/1.1\r\n"), proxy.HTTPProtocol, false},
+		{[]byte("OPTI"), "", true},
+		{[]byte{0x16, 0x03, 0x01, 0x02, 0x00, 0x01, 0x00}, proxy.TLSProtocol, false},
+		{[]byte("\x10\x14\x00\x04MQTT\x04\x02\x00\x3c"), proxy.MQTTProtocol, false},
+		{[]byte("\x10\x14\x00\x06MQIsdp"), proxy.MQTTProtocol, false},
+		{[]byte("\x10\x14\x00\x04MQ"), "", true},
+		{[]byte{0x00, 0x01, 0x00, 0x00, 0x00, 0x06, 0x01, 0x03, 0x00, 0x00, 0x00, 0x02}, proxy.ModbusProtocol, false},
+		{[]byte{0xff, 0xfd, 0x18}, proxy.TelnetProtocol, false},
+		{[]byte("hello world, this is not a protocol"), "", false},
+	}
+
+	for _, c := range cases {
+		protocol, more := proxy.DetectProtocol(c.data)
+		assert.Equal(c.protocol, protocol, "%q", c.data)
+		assert.Equal(c.more, more, "%q", c.data)
+	}
+}
+
+// Test that the sniffer relays each protocol to its service on the same port
+func TestSniffing(t *testing.T) {
+	assert := assert.New(t)
+
+	fallback := prefixServer(t, 18093, "fallback:")
+	defer fallback.Close()
+	ssh := prefixServer(t, 18094, "ssh:")
+	defer ssh.Close()
+	http := prefixServer(t, 18095, "http:")
+	defer http.Close()
+
+	pr, err := proxy.NewProxyEndpoint(18092, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetService(services.NewService("fallback", 18093, globals.TCP, "localhost", globals.Low))
+
+	sniffer, err := proxy.GetSniffer(pr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.NotNil(sniffer.SetTimeout(0))
+	assert.Nil(sniffer.SetTimeout(200 * time.Millisecond))
+	assert.Nil(sniffer.SetService(proxy.SSHProtocol, services.NewService("ssh", 18094, globals.TCP, "localhost", globals.Low)))
+	assert.Nil(sniffer.SetService(proxy.HTTPProtocol, services.NewService("http", 18095, globals.TCP, "localhost", globals.Low)))
+	assert.NotNil(sniffer.SetService("gopher", services.NewService("gopher", 70, globals.TCP, "localhost", globals.Low)))
+	assert.Equal([]string{proxy.HTTPProtocol, proxy.SSHProtocol}, sniffer.GetProtocols())
+
+	if err := pr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Stop()
+
+	assert.Equal("ssh:SSH-2.0-client\r\n", exchange(t, 18092, "SSH-2.0-client\r\n"))
+	assert.Equal("http:GET / HTTP/1.0\r\n\r\n", exchange(t, 18092, "GET / HTTP/1.0\r\n\r\n"))
+	assert.Equal("fallback:\xff\xfd\x18", exchange(t, 18092, "\xff\xfd\x18"))
+
+	// Clients waiting for the server to speak first reach the service of the proxy after the timeout
+	conn, err := net.Dial("tcp", "localhost:18092")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	time.Sleep(300 * time.Millisecond)
+	fmt.Fprint(conn, "late")
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	answer, _ := io.ReadAll(conn)
+	assert.Equal("fallback:late", string(answer))
+}
@@ -2,10 +2,13 @@ package proxy
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net"
 	"testing"
+	"time"
 
+	"github.com/riotpot/internal/events"
 	"github.com/riotpot/internal/globals"
 	"github.com/riotpot/internal/proxy"
 	"github.com/riotpot/internal/services"
@@ -189,3 +192,152 @@ func TestDeleteProxy(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+// Test that the proxy tracks the sessions and attributes the events of the service to them
+func TestProxySessions(t *testing.T) {
+	assert := assert.New(t)
+
+	// Message to send
+	message := "Hi there!"
+
+	// Instantiate the proxy
+	pr, err := proxy.NewProxyEndpoint(18080, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	service := services.NewService("echo", 18081, network, "localhost", globals.Low)
+	pr.SetService(service)
+
+	// Collect the events published by the service
+	received := make(chan *events.Event, 1)
+	service.SetEmitter(events.Events)
+	unsubscribe := events.Events.Subscribe(events.EmitterFunc(func(event *events.Event) {
+		if event.Kind == events.MessageKind {
+			received <- event
+		}
+	}))
+	defer unsubscribe()
+
+	// Start a server that publishes the message received and answers with it
+	l, err := net.Listen(network.String(), service.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		buf := make([]byte, len(message))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+
+		service.Emit(conn.RemoteAddr(), conn.LocalAddr(), &events.Raw{Data: buf})
+		conn.Write(buf)
+	}()
+
+	if err := pr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Stop()
+
+	// Connect to the proxy and exchange the message
+	conn, err := net.Dial(network.String(), "localhost:18080")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fmt.Fprint(conn, message)
+	buf := make([]byte, len(message))
+	if _, err := io.ReadFull(conn, buf); err != nil {
+		t.Fatal(err)
+	}
+
+	// The event of the service is attributed to the client of the session
+	event := <-received
+	sessions := pr.GetSessions()
+	assert.Equal(1, len(sessions))
+	assert.Equal(sessions[0].GetID(), event.SessionID)
+	assert.Equal(pr.GetID(), event.ProxyID)
+	assert.Equal(conn.LocalAddr().String(), event.RemoteAddr)
+
+	// Close the connection and wait for the session to finish
+	conn.Close()
+	assert.Eventually(func() bool { return !sessions[0].IsActive() }, time.Second, 10*time.Millisecond)
+
+	session := sessions[0]
+	assert.Equal(int64(len(message)), session.GetBytesIn())
+	assert.Equal(int64(len(message)), session.GetBytesOut())
+	assert.NotEmpty(session.GetCloseReason())
+}
+
+// Test that the service can be changed while the proxy relays connections.
+// Run with -race to check the accesses to the fields of the proxy
+func TestProxySetServiceRunning(t *testing.T) {
+	assert := assert.New(t)
+
+	first := prefixServer(t, 18140, "first:")
+	defer first.Close()
+	second := prefixServer(t, 18141, "second:")
+	defer second.Close()
+
+	firstService := services.NewService("first", 18140, network, "localhost", globals.Low)
+	secondService := services.NewService("second", 18141, network, "localhost", globals.Low)
+
+	pr, err := proxy.NewProxyEndpoint(18142, network)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetService(firstService)
+
+	if err := pr.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer pr.Stop()
+
+	// The proxy can not be started twice
+	assert.NotNil(pr.Start())
+
+	done := make(chan struct{})
+	switched := make(chan struct{})
+	go func() {
+		defer close(switched)
+		for i := 0; ; i++ {
+			select {
+			case <-done:
+				return
+			default:
+			}
+
+			if i%2 == 0 {
+				pr.SetService(secondService)
+			} else {
+				pr.SetService(firstService)
+			}
+			pr.GetStatus()
+			pr.SetPort(pr.GetPort())
+		}
+	}()
+
+	for i := 0; i < 50; i++ {
+		answer := exchange(t, 18142, "hello")
+		assert.Contains([]string{"first:hello", "second:hello"}, answer)
+	}
+
+	close(done)
+	<-switched
+
+	// The connections accepted afterwards are relayed to the service set last
+	pr.SetService(secondService)
+	assert.Equal("second:hello", exchange(t, 18142, "hello"))
+
+	assert.Nil(pr.Stop())
+	assert.NotNil(pr.Stop())
+	assert.Equal(globals.StoppedStatus, pr.GetStatus())
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Register a service and a proxy, removed once the test finishes
+func referenced(t *testing.T, name string, port int) (service services.Service, pe proxy.Proxy) {
+	service, err := services.Services.CreateService(name, port, globals.TCP, "127.0.0.1", globals.High)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pe, err = proxy.Proxies.CreateProxy(globals.TCP, port+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { proxy.Proxies.DeleteProxy(pe.GetID()) })
+	return
+}
+
+// Assert the service can not be deleted while it is referenced
+func assertInUse(t *testing.T, service services.Service, reference string) {
+	err := services.Services.DeleteService(service.GetID())
+	assert.True(t, errors.Is(err, services.ErrServiceInUse))
+	if assert.NotNil(t, err) {
+		assert.Contains(t, err.Error(), reference)
+	}
+
+	_, err = services.Services.GetService(service.GetID())
+	assert.Nil(t, err)
+}
+
+// Test that the services in the failover chain of a proxy can not be deleted
+func TestDeleteServiceFailover(t *testing.T) {
+	assert := assert.New(t)
+
+	service, pe := referenced(t, "failover-reference", 18143)
+	assert.Nil(pe.SetFailover([]services.Service{service}))
+	assertInUse(t, service, "proxy 18144/tcp (failover)")
+
+	assert.Nil(pe.SetFailover([]services.Service{}))
+	assert.Nil(services.Services.DeleteService(service.GetID()))
+}
+
+// Test that the services of the routing rules of a proxy can not be deleted
+func TestDeleteServiceRouting(t *testing.T) {
+	assert := assert.New(t)
+
+	service, pe := referenced(t, "routing-reference", 18145)
+	router, err := proxy.GetRouter(pe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(router.AddRule(proxy.RoutingRule{Name: "scanners", Service: service}))
+	assertInUse(t, service, "proxy 18146/tcp (routing rule scanners)")
+
+	assert.Nil(router.RemoveRule("scanners"))
+	assert.Nil(services.Services.DeleteService(service.GetID()))
+}
+
+// Test that the services targeted by the sniffer of a proxy can not be deleted
+func TestDeleteServiceSniffer(t *testing.T) {
+	assert := assert.New(t)
+
+	service, pe := referenced(t, "sniffer-reference", 18147)
+	sniffer, err := proxy.GetSniffer(pe)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Nil(sniffer.SetService(proxy.HTTPProtocol, service))
+	assertInUse(t, service, "proxy 18148/tcp (sniffer http)")
+
+	assert.Nil(sniffer.RemoveService(proxy.HTTPProtocol))
+	assert.Nil(services.Services.DeleteService(service.GetID()))
+}
+
+// Test that the fallback service of the down policy of a proxy can not be deleted
+func TestDeleteServiceFallback(t *testing.T) {
+	assert := assert.New(t)
+
+	service, pe := referenced(t, "fallback-reference", 18149)
+	assert.Nil(pe.SetDownPolicy(proxy.DownPolicy{Action: proxy.FallbackAction, Fallback: service.GetID()}))
+	assertInUse(t, service, "proxy 18150/tcp (fallback)")
+
+	assert.Nil(pe.SetDownPolicy(proxy.DownPolicy{Action: proxy.RejectAction}))
+	assert.Nil(services.Services.DeleteService(service.GetID()))
+}
+
+// Test that the service served by a proxy can only be deleted along with the proxy
+func TestDeleteServiceProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	service, pe := referenced(t, "proxy-reference", 18159)
+	pe.SetService(service)
+	assertInUse(t, service, "proxy 18160/tcp (service)")
+
+	assert.Nil(proxy.Proxies.DeleteProxy(pe.GetID()))
+	_, err := services.Services.GetService(service.GetID())
+	assert.NotNil(err)
+}
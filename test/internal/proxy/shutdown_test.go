@@ -0,0 +1,154 @@
+package proxy
+
+import (
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the sessions are drained on shutdown, and closed once the timeout expires
+func TestShutdown(t *testing.T) {
+	assert := assert.New(t)
+
+	service := services.NewService("shutdown", 18131, globals.TCP, "127.0.0.1", globals.High)
+
+	listener, err := net.Listen("tcp", service.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				io.Copy(conn, conn)
+			}()
+		}
+	}()
+
+	pe, err := proxy.NewProxyEndpoint(18130, globals.TCP)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pe.SetService(service)
+
+	// Nothing to drain
+	assert.Nil(pe.Start())
+	start := time.Now()
+	assert.Nil(pe.Shutdown(time.Second))
+	assert.Less(time.Since(start), 500*time.Millisecond)
+	assert.Equal(globals.StoppedStatus, pe.GetStatus())
+	assert.NotNil(pe.Shutdown(time.Second))
+
+	// A session that does not finish in time
+	assert.Nil(pe.Start())
+
+	conn, err := net.Dial("tcp", "127.0.0.1:18130")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	conn.Write([]byte("hello"))
+	buf := make([]byte, 5)
+	_, err = io.ReadFull(conn, buf)
+	assert.Nil(err)
+
+	start = time.Now()
+	assert.Nil(pe.Shutdown(200 * time.Millisecond))
+	assert.GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+
+	// The client is disconnected
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	_, err = conn.Read(buf)
+	assert.Equal(io.EOF, err)
+
+	sessions := pe.GetSessions()
+	if assert.Len(sessions, 1) {
+		assert.Equal(proxy.ProxyStoppedReason, sessions[0].GetCloseReason())
+	}
+}
+
+// Test the UDP clients are relayed until they are idle on shutdown, and the new ones are dropped
+func TestUDPShutdown(t *testing.T) {
+	assert := assert.New(t)
+
+	server := udpPrefixServer(t, 18151, "echo:")
+	defer server.Close()
+
+	pr, err := proxy.NewUDPProxy(18152)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetService(services.NewService("echo", 18151, globals.UDP, "127.0.0.1", globals.Low))
+	pr.SetIdleTimeout(300 * time.Millisecond)
+
+	// Nothing to drain
+	assert.Nil(pr.Start())
+	start := time.Now()
+	assert.Nil(pr.Shutdown(time.Second))
+	assert.Less(time.Since(start), 200*time.Millisecond)
+	assert.NotNil(pr.Shutdown(time.Second))
+
+	assert.Nil(pr.Start())
+
+	first, err := net.Dial("udp", "127.0.0.1:18152")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+	assert.Equal("echo:one", udpExchange(t, first, "one"))
+
+	done := make(chan error)
+	start = time.Now()
+	go func() {
+		done <- pr.Shutdown(5 * time.Second)
+	}()
+	time.Sleep(100 * time.Millisecond)
+
+	// The current client is still relayed while draining, the new ones are not
+	assert.Equal("echo:two", udpExchange(t, first, "two"))
+
+	second, err := net.Dial("udp", "127.0.0.1:18152")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+	assert.Equal("", udpExchange(t, second, "three"))
+
+	// Stopped once the client is idle
+	assert.Nil(<-done)
+	assert.Less(time.Since(start), 5*time.Second)
+	assert.Equal(globals.StoppedStatus, pr.GetStatus())
+
+	sessions := pr.GetSessions()
+	if assert.Len(sessions, 1) {
+		assert.Equal(proxy.IdleTimeoutReason, sessions[0].GetCloseReason())
+	}
+
+	// The sessions still open when the timeout expires are closed
+	pr.SetIdleTimeout(10 * time.Second)
+	assert.Nil(pr.Start())
+	assert.Equal("echo:four", udpExchange(t, first, "four"))
+
+	start = time.Now()
+	assert.Nil(pr.Shutdown(200 * time.Millisecond))
+	assert.GreaterOrEqual(time.Since(start), 200*time.Millisecond)
+	assert.Less(time.Since(start), 2*time.Second)
+
+	sessions = pr.GetSessions()
+	if assert.Len(sessions, 2) {
+		assert.Equal(proxy.ProxyStoppedReason, sessions[1].GetCloseReason())
+	}
+}
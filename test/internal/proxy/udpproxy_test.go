@@ -0,0 +1,111 @@
+package proxy
+
+import (
+	"fmt"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/proxy"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Start a UDP server that answers each datagram with a prefix and the datagram received
+func udpPrefixServer(t *testing.T, port int, prefix string) net.PacketConn {
+	conn, err := net.ListenPacket("udp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	go func() {
+		buf := make([]byte, 1024)
+		for {
+			n, addr, err := conn.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			conn.WriteTo(append([]byte(prefix), buf[:n]...), addr)
+		}
+	}()
+
+	return conn
+}
+
+// Send a datagram through the proxy and return the answer
+func udpExchange(t *testing.T, conn net.Conn, message string) string {
+	if _, err := conn.Write([]byte(message)); err != nil {
+		t.Fatal(err)
+	}
+
+	buf := make([]byte, 1024)
+	conn.SetReadDeadline(time.Now().Add(time.Second))
+	n, _ := conn.Read(buf)
+	return string(buf[:n])
+}
+
+// Test that the datagrams of each client are relayed to the service and the replies routed back
+func TestUDPProxy(t *testing.T) {
+	assert := assert.New(t)
+
+	server := udpPrefixServer(t, 18097, "echo:")
+	defer server.Close()
+
+	pr, err := proxy.NewUDPProxy(18096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pr.SetService(services.NewService("echo", 18097, globals.UDP, "127.0.0.1", globals.Low))
+	pr.SetIdleTimeout(300 * time.Millisecond)
+
+	if err := pr.Start(); err != nil {
+		t.Fatal(err)
+	}
+
+	first, err := net.Dial("udp", "127.0.0.1:18096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	second, err := net.Dial("udp", "127.0.0.1:18096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer second.Close()
+
+	// Each client receives the replies to its own datagrams, in the same session
+	assert.Equal("echo:one", udpExchange(t, first, "one"))
+	assert.Equal("echo:two", udpExchange(t, second, "two"))
+	assert.Equal("echo:three", udpExchange(t, first, "three"))
+	assert.Len(pr.GetSessions(), 2)
+
+	// The sessions are closed once they are idle
+	time.Sleep(600 * time.Millisecond)
+	for _, session := range pr.GetSessions() {
+		assert.False(session.IsActive())
+		assert.Equal(proxy.IdleTimeoutReason, session.GetCloseReason())
+	}
+
+	// The next datagram of a client starts a new session
+	assert.Equal("echo:four", udpExchange(t, first, "four"))
+	assert.Len(pr.GetSessions(), 3)
+
+	// The middlewares are applied to the clients as well
+	pr.GetMiddlewares().Register(newTestMiddleware("deny", proxy.Deny), 0)
+
+	third, err := net.Dial("udp", "127.0.0.1:18096")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer third.Close()
+	assert.Equal("", udpExchange(t, third, "five"))
+
+	// Stopping the proxy closes the active sessions
+	assert.Nil(pr.Stop())
+	for _, session := range pr.GetSessions() {
+		assert.False(session.IsActive())
+	}
+	assert.Equal(globals.StoppedStatus, pr.GetStatus())
+}
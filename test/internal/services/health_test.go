@@ -0,0 +1,43 @@
+package test_services
+
+import (
+	"net"
+	"testing"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test the probes of the TCP and UDP services
+func TestHealthChecks(t *testing.T) {
+	assert := assert.New(t)
+
+	tcp := services.NewService("health-tcp", 18113, globals.TCP, "127.0.0.1", globals.High)
+	udp := services.NewService("health-udp", 18114, globals.UDP, "127.0.0.1", globals.High)
+
+	// Nothing is listening yet
+	assert.Equal(services.DownHealth, services.HealthChecks.Check(tcp).Health)
+	assert.Equal(services.DownHealth, services.HealthChecks.Check(udp).Health)
+	assert.True(services.HealthChecks.IsDown(tcp.GetID()))
+
+	listener, err := net.Listen("tcp", tcp.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer listener.Close()
+
+	conn, err := net.ListenPacket("udp", udp.GetAddress())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+
+	assert.Equal(services.UpHealth, services.HealthChecks.Check(tcp).Health)
+	assert.Equal(services.UpHealth, services.HealthChecks.Check(udp).Health)
+	assert.False(services.HealthChecks.IsDown(tcp.GetID()))
+
+	// Services never checked
+	other := services.NewService("health-other", 18115, globals.TCP, "127.0.0.1", globals.High)
+	assert.Equal(services.UnknownHealth, services.HealthChecks.GetHealth(other.GetID()).Health)
+}
@@ -0,0 +1,94 @@
+package test_services
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/services"
+	"github.com/stretchr/testify/assert"
+)
+
+// Plugin accepting connections until it is stopped
+type listenerPlugin struct {
+	*services.PluginServiceItem
+}
+
+func (lp *listenerPlugin) Run(ctx context.Context) (err error) {
+	listener, err := net.Listen(lp.GetNetwork().String(), lp.GetAddress())
+	if err != nil {
+		return
+	}
+
+	go func() {
+		<-ctx.Done()
+		listener.Close()
+	}()
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return nil
+		}
+		conn.Close()
+	}
+}
+
+// Test the plugins can be stopped, restarted and moved to another port
+func TestPluginLifecycle(t *testing.T) {
+	assert := assert.New(t)
+
+	manager := services.NewServiceManager()
+
+	plugin := &listenerPlugin{services.NewPluginService("lifecycle", 18124, globals.TCP)}
+	if _, err := manager.AddServices(plugin); err != nil {
+		t.Fatal(err)
+	}
+
+	dial := func(port string) error {
+		conn, err := net.DialTimeout("tcp", "localhost:"+port, time.Second)
+		if err == nil {
+			conn.Close()
+		}
+		return err
+	}
+
+	assert.Equal(globals.StoppedStatus, plugin.GetStatus())
+
+	_, errs := manager.Start(plugin.GetID())
+	assert.Empty(errs)
+	assert.Equal(globals.RunningStatus, plugin.GetStatus())
+	assert.Eventually(func() bool { return dial("18124") == nil }, time.Second, 10*time.Millisecond)
+
+	// A running plugin can not be started again
+	_, errs = manager.Start(plugin.GetID())
+	assert.NotEmpty(errs)
+
+	_, errs = manager.Stop(plugin.GetID())
+	assert.Empty(errs)
+	assert.Equal(globals.StoppedStatus, plugin.GetStatus())
+	assert.NotNil(dial("18124"))
+
+	// Stopping twice fails
+	_, errs = manager.Stop(plugin.GetID())
+	assert.NotEmpty(errs)
+
+	// Start the plugin again in another port
+	plugin.SetPort(18125)
+
+	_, errs = manager.Restart(plugin.GetID())
+	assert.Empty(errs)
+	assert.Equal(globals.RunningStatus, plugin.GetStatus())
+	assert.Eventually(func() bool { return dial("18125") == nil }, time.Second, 10*time.Millisecond)
+	assert.NotNil(dial("18124"))
+
+	_, errs = manager.Stop(plugin.GetID())
+	assert.Empty(errs)
+
+	// External services have no lifecycle
+	external, _ := manager.CreateService("lifecycle-external", 18126, globals.TCP, "localhost", globals.High)
+	_, errs = manager.Stop(external.GetID())
+	assert.NotEmpty(errs)
+}
@@ -4,11 +4,16 @@ import (
 	"bytes"
 	"fmt"
 	"net"
+	"strings"
+	"sync"
 	"testing"
 
 	"context"
 	"time"
 
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/metrics"
 	"github.com/riotpot/internal/services"
 	"github.com/stretchr/testify/assert"
 
@@ -127,3 +132,49 @@ func TestNetServiceRunning(t *testing.T) {
 		}
 	}
 }
+
+// Test that the authentication attempts of the services are counted
+func TestServiceAuthAttempts(t *testing.T) {
+	service := services.NewService("auth-metrics", 18112, globals.TCP, "localhost", globals.Low)
+	service.Emit(nil, nil, &events.Credentials{Username: "root", Password: "root"})
+	service.Emit(nil, nil, &events.Command{Input: "ls"})
+	service.Emit(nil, nil, &events.Credentials{Username: "admin", Password: "admin"})
+
+	var b strings.Builder
+	assert.Nil(t, metrics.Write(&b))
+	assert.Contains(t, b.String(), `riotpot_service_auth_attempts_total{service="auth-metrics"} 2`)
+}
+
+// Test that the fields of a service can be changed while they are read, e.g. by the proxies
+func TestServiceConcurrency(t *testing.T) {
+	assert := assert.New(t)
+	manager := services.NewServiceManager()
+
+	service, err := manager.CreateService("concurrent", 18155, globals.TCP, "localhost", globals.High)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			service.SetPort(18156 + i%2)
+			service.SetHost("127.0.0.1")
+			service.SetName(fmt.Sprintf("concurrent-%d", i))
+			service.SetLocked(i%2 == 0)
+		}(i)
+		go func() {
+			defer wg.Done()
+			service.GetAddress()
+			service.GetName()
+			service.IsLocked()
+			manager.CreateService("other", 18158, globals.TCP, "localhost", globals.High)
+		}()
+	}
+	wg.Wait()
+
+	assert.Contains([]int{18156, 18157}, service.GetPort())
+	assert.Equal("127.0.0.1", service.GetHost())
+}
@@ -0,0 +1,193 @@
+package sinks
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/sinks"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// Sink keeping the entries in memory
+type memorySink struct {
+	mu      sync.Mutex
+	entries []sinks.Entry
+}
+
+func (ms *memorySink) Write(entry sinks.Entry) error {
+	ms.mu.Lock()
+	defer ms.mu.Unlock()
+
+	ms.entries = append(ms.entries, entry)
+	return nil
+}
+
+func (ms *memorySink) Close() error {
+	return nil
+}
+
+// Test that the entries are only shipped to the sinks accepting their kind
+func TestManager(t *testing.T) {
+	manager := sinks.NewManager()
+
+	all, credentials, logs := &memorySink{}, &memorySink{}, &memorySink{}
+	require.NoError(t, manager.Add("all", all))
+	require.NoError(t, manager.Add("credentials", credentials, string(events.CredentialKind)))
+	require.NoError(t, manager.Add("logs", logs, sinks.LogKind))
+
+	assert.Error(t, manager.Add("all", &memorySink{}))
+	assert.Error(t, manager.Add("unknown", &memorySink{}, "unknown"))
+
+	manager.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+	manager.Emit(events.NewEvent(nil, nil, &events.Credentials{Username: "root", Password: "toor"}))
+	manager.Write([]byte(`{"level":"error","message":"failed"}` + "\n"))
+
+	assert.Equal(t, 2, len(all.entries))
+	require.Equal(t, 1, len(credentials.entries))
+	assert.Equal(t, sinks.Warning, credentials.entries[0].Severity)
+	assert.Contains(t, string(credentials.entries[0].Data), `"toor"`)
+
+	require.Equal(t, 1, len(logs.entries))
+	assert.Equal(t, sinks.Error, logs.entries[0].Severity)
+	assert.Equal(t, `{"level":"error","message":"failed"}`, string(logs.entries[0].Data))
+
+	// The entries are dropped once closed
+	assert.NoError(t, manager.Close())
+	manager.Emit(events.NewEvent(nil, nil, &events.Connection{}))
+	assert.Equal(t, 2, len(all.entries))
+}
+
+// Test that the file is rotated by size, keeping only the newest files
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+
+	sink, err := sinks.NewFileSink(path, 20, 0, 2)
+	require.NoError(t, err)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, sink.Write(sinks.Entry{Data: []byte(fmt.Sprintf(`{"entry":%d,"padding":"x"}`, i))}))
+	}
+	require.NoError(t, sink.Close())
+
+	rotated := sink.RotatedFiles()
+	require.Equal(t, 2, len(rotated))
+
+	// Each document fills a file, the oldest rotated files are removed
+	expected := []string{rotated[0], rotated[1], path}
+	for i, p := range expected {
+		data, err := os.ReadFile(p)
+		require.NoError(t, err)
+		assert.Equal(t, fmt.Sprintf(`{"entry":%d,"padding":"x"}`+"\n", i+2), string(data))
+	}
+
+	assert.Error(t, sink.Write(sinks.Entry{Data: []byte(`{}`)}))
+}
+
+// Test that the entries are sent to the syslog server in RFC 5424 format
+func TestSyslogSink(t *testing.T) {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:18132")
+	require.NoError(t, err)
+	defer conn.Close()
+
+	sink, err := sinks.NewSyslogSink("udp", "127.0.0.1:18132", "auth")
+	require.NoError(t, err)
+	defer sink.Close()
+
+	_, err = sinks.NewSyslogSink("udp", "127.0.0.1:18132", "unknown")
+	assert.Error(t, err)
+
+	entry, err := sinks.NewEventEntry(events.NewEvent(nil, nil, &events.Command{Input: "uname -a"}))
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(entry))
+
+	buf := make([]byte, 2048)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	n, _, err := conn.ReadFrom(buf)
+	require.NoError(t, err)
+
+	// Facility auth (4) and severity warning (4)
+	message := string(buf[:n])
+	assert.True(t, strings.HasPrefix(message, "<36>1 "), message)
+	assert.Contains(t, message, " riotpot ")
+	assert.Contains(t, message, " command - ")
+	assert.True(t, strings.HasSuffix(message, string(entry.Data)), message)
+}
+
+// Test that the entries are posted in batches, retrying when the endpoint fails
+func TestWebhookSink(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		requests int
+		batches  [][]json.RawMessage
+	)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+
+		requests++
+		assert.Equal(t, "secret", r.Header.Get("Authorization"))
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+
+		// The first request fails
+		if requests == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+
+		var batch []json.RawMessage
+		assert.NoError(t, json.NewDecoder(bufio.NewReader(r.Body)).Decode(&batch))
+		batches = append(batches, batch)
+	}))
+	defer server.Close()
+
+	sink, err := sinks.NewWebhookSink(server.URL, sinks.WebhookOptions{
+		BatchSize: 2,
+		Interval:  time.Hour,
+		Retries:   1,
+		Backoff:   10 * time.Millisecond,
+		Headers:   map[string]string{"Authorization": "secret"},
+	})
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		require.NoError(t, sink.Write(sinks.Entry{Data: []byte(fmt.Sprintf(`{"entry":%d}`, i))}))
+	}
+
+	// The full batch is sent right away, after a retry
+	assert.Eventually(t, func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return len(batches) == 1
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// The incomplete batch waits for the interval, and is sent on close
+	require.NoError(t, sink.Write(sinks.Entry{Data: []byte(`{"entry":2}`)}))
+	time.Sleep(50 * time.Millisecond)
+
+	mu.Lock()
+	assert.Equal(t, 1, len(batches))
+	mu.Unlock()
+
+	require.NoError(t, sink.Close())
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	assert.Equal(t, 3, requests)
+	require.Equal(t, 2, len(batches))
+	assert.Equal(t, 2, len(batches[0]))
+	assert.Equal(t, `{"entry":2}`, string(batches[1][0]))
+}
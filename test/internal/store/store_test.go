@@ -0,0 +1,104 @@
+package store
+
+import (
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/riotpot/internal/events"
+	"github.com/riotpot/internal/globals"
+	"github.com/riotpot/internal/store"
+	"github.com/stretchr/testify/assert"
+)
+
+// Test to save and query records from the embedded store
+func TestBoltStore(t *testing.T) {
+	assert := assert.New(t)
+
+	st, err := store.NewBoltStore(filepath.Join(t.TempDir(), "riotpot.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer st.Close()
+
+	now := time.Now()
+	records := []*store.Record{
+		{ID: "1", Timestamp: now.Add(-2 * time.Minute), Kind: events.ConnectionKind, RemoteAddr: "10.0.0.1:1234"},
+		{ID: "2", Timestamp: now.Add(-1 * time.Minute), Kind: events.CredentialKind, RemoteAddr: "10.0.0.1:1234", Data: map[string]interface{}{"username": "root"}},
+		{ID: "3", Timestamp: now, Kind: events.CommandKind, RemoteAddr: "10.0.0.2:1234", Country: "DE", ASN: 64500, ASOrg: "Example Networks"},
+	}
+
+	err = st.Save(records...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// All the records, the newest first
+	ret, err := st.Query(store.Filter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(3, len(ret))
+	assert.Equal("3", ret[0].ID)
+	assert.Equal("root", ret[1].Data["username"])
+
+	// Filter by kind
+	ret, _ = st.Query(store.Filter{Kind: events.CredentialKind})
+	assert.Equal(1, len(ret))
+
+	// Filter by remote address and limit
+	ret, _ = st.Query(store.Filter{RemoteAddr: "10.0.0.1:1234", Limit: 1})
+	assert.Equal(1, len(ret))
+	assert.Equal("2", ret[0].ID)
+
+	// Filter by country and autonomous system
+	ret, _ = st.Query(store.Filter{Country: "DE", ASN: 64500})
+	assert.Equal(1, len(ret))
+	assert.Equal("Example Networks", ret[0].ASOrg)
+	ret, _ = st.Query(store.Filter{ASN: 64501})
+	assert.Equal(0, len(ret))
+
+	// Filter by time
+	ret, _ = st.Query(store.Filter{Since: now.Add(-90 * time.Second), Until: now.Add(-30 * time.Second)})
+	assert.Equal(1, len(ret))
+	assert.Equal("2", ret[0].ID)
+}
+
+// Test that records saved without a backend are dropped
+func TestStoreManagerClosed(t *testing.T) {
+	manager := store.NewStoreManager()
+
+	err := manager.Save(&store.Record{Kind: events.ConnectionKind})
+	assert.Nil(t, err)
+
+	_, err = manager.Query(store.Filter{})
+	assert.NotNil(t, err)
+}
+
+// Test that the credentials of the database are escaped in the connection string
+func TestPostgresDSN(t *testing.T) {
+	assert := assert.New(t)
+
+	username, password, host := globals.DbUsername, globals.DbPassword, globals.DbHost
+	defer func() {
+		globals.DbUsername, globals.DbPassword, globals.DbHost = username, password, host
+	}()
+
+	globals.DbUsername = "riot@pot"
+	globals.DbPassword = "p@ss:w/rd?#%"
+	globals.DbHost = "::1"
+
+	dsn, err := url.Parse(store.PostgresDSN())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pass, _ := dsn.User.Password()
+	assert.Equal("riot@pot", dsn.User.Username())
+	assert.Equal("p@ss:w/rd?#%", pass)
+	assert.Equal("::1", dsn.Hostname())
+	assert.Equal(globals.DbPort, dsn.Port())
+	assert.Equal("/"+globals.DbName, dsn.Path)
+	assert.Equal("disable", dsn.Query().Get("sslmode"))
+}
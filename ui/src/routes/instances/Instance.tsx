@@ -3,6 +3,8 @@ import { useRecoilValue } from "recoil";
 import Title from "../../components/title/Title";
 import { instance } from "../../recoil/atoms/instances";
 import InstanceServicesTable from "./InstanceTable";
+import InstanceLogin from "./InstanceLogin";
+import InstanceActivity from "./InstanceActivity";
 
 import "./Instances.scss";
 import { Row } from "react-bootstrap";
@@ -23,8 +25,10 @@ const Instance = () => {
           );
         }
       })()}
+      <InstanceLogin />
       <React.Suspense fallback="Loading...">
         <InstanceServicesTable />
+        <InstanceActivity />
       </React.Suspense>
     </main>
   );
@@ -1,8 +1,90 @@
 import { InteractionOptions, NetworkOptions } from "../../constants/globals";
 import { Service } from "../../recoil/atoms/services";
 
+// Reach the instances with the same scheme the UI was served, i.e. https when the API serves TLS
+const scheme = window.location.protocol === "https:" ? "https://" : "http://";
+
+// Key of the session token of an instance in the local storage
+const tokenKey = (host: string) => "riotpot-token-" + host;
+
+export const getToken = (host: string) => localStorage.getItem(tokenKey(host));
+
+// Headers to authenticate the requests to an instance, if there is a session
+export const authHeaders = (host: string): { [key: string]: string } => {
+  const token = getToken(host);
+  return token ? { Authorization: "Bearer " + token } : {};
+};
+
+// Open the live feed of the instance, receiving the events with the given names.
+// The event sources can not set headers, so the token is sent in the query, the only route accepting it
+export const openStream = (host: string, kinds: string[]) => {
+  const params = new URLSearchParams();
+  kinds.forEach((kind) => params.append("kind", kind));
+
+  const token = getToken(host);
+  if (token) params.append("token", token);
+
+  return new EventSource(scheme + host + "/api/stream/?" + params.toString());
+};
+
+// Log in the instance and keep the session token
+export const login = async (
+  host: string,
+  username: string,
+  password: string
+) => {
+  return await fetch(scheme + host + "/api/auth/login", {
+    method: "POST",
+    body: JSON.stringify({
+      username: username,
+      password: password,
+    }),
+    headers: {
+      "Content-type": "application/json; charset=UTF-8",
+    },
+  })
+    .then((response) => response.json())
+    .then((data) => {
+      if ("token" in data) {
+        localStorage.setItem(tokenKey(host), data["token"]);
+      }
+      return data;
+    })
+    .catch((error) => {
+      return error;
+    });
+};
+
+// Close the session in the instance and forget the token
+export const logout = async (host: string) => {
+  const headers = authHeaders(host);
+  localStorage.removeItem(tokenKey(host));
+
+  return await fetch(scheme + host + "/api/auth/logout", {
+    method: "POST",
+    headers: headers,
+  })
+    .then((response) => response.json())
+    .catch((error) => {
+      return error;
+    });
+};
+
+// Returns the client authenticated in the instance, and whether the instance requires authentication
+export const fetchMe = async (host: string) => {
+  return await fetch(scheme + host + "/api/auth/me", {
+    headers: authHeaders(host),
+  })
+    .then((response) => response.json())
+    .catch((error) => {
+      return error;
+    });
+};
+
 export const fetchProxy = async (host: string) => {
-  return await fetch("http://" + host + "/api/proxies/")
+  return await fetch(scheme + host + "/api/proxies/", {
+    headers: authHeaders(host),
+  })
     .then((response) => response.json())
     // Map the content of the response
     .then((data) =>
@@ -36,7 +118,7 @@ export const fetchProxy = async (host: string) => {
 };
 
 export const patchService = async (host: string, service: Service) => {
-  return await fetch("http://" + host + "/api/services/" + service.id + "/", {
+  return await fetch(scheme + host + "/api/services/" + service.id + "/", {
     method: "POST",
     body: JSON.stringify({
       name: service.name,
@@ -45,6 +127,7 @@ export const patchService = async (host: string, service: Service) => {
     }),
     headers: {
       "Content-type": "application/json; charset=UTF-8",
+      ...authHeaders(host),
     },
   })
     .then((response) => response.json())
@@ -75,13 +158,14 @@ export const changeProxyPort = async (
   proxyID: string,
   port: number
 ) => {
-  return await fetch("http://" + host + "/api/proxies/" + proxyID + "/port", {
+  return await fetch(scheme + host + "/api/proxies/" + proxyID + "/port", {
     method: "POST",
     body: JSON.stringify({
       port: port,
     }),
     headers: {
       "Content-type": "application/json; charset=UTF-8",
+      ...authHeaders(host),
     },
   })
     .then((response) => response.json())
@@ -95,13 +179,14 @@ export const changeProxyStatus = async (
   id: string,
   status: string
 ) => {
-  return await fetch("http://" + host + "/api/proxies/" + id + "/status", {
+  return await fetch(scheme + host + "/api/proxies/" + id + "/status", {
     method: "POST",
     body: JSON.stringify({
       status: status,
     }),
     headers: {
       "Content-type": "application/json; charset=UTF-8",
+      ...authHeaders(host),
     },
   })
     .then((response) => response.json())
@@ -125,8 +210,9 @@ export const addFromProfile = async (host: string, services: Service[]) => {
 };
 
 export const deleteProxyService = async (host: string, proxyID: string) => {
-  return await fetch("http://" + host + "/api/proxies/" + proxyID + "/", {
+  return await fetch(scheme + host + "/api/proxies/" + proxyID + "/", {
     method: "DELETE",
+    headers: authHeaders(host),
   })
     .then((response) => response.json())
     .catch((error) => {
@@ -135,7 +221,7 @@ export const deleteProxyService = async (host: string, proxyID: string) => {
 };
 
 export const addProxyService = async (host: string, service: Service) => {
-  return await fetch("http://" + host + "/api/services/new/", {
+  return await fetch(scheme + host + "/api/services/new/", {
     method: "POST",
     body: JSON.stringify({
       name: service.name,
@@ -146,6 +232,7 @@ export const addProxyService = async (host: string, service: Service) => {
     }),
     headers: {
       "Content-type": "application/json; charset=UTF-8",
+      ...authHeaders(host),
     },
   })
     .then((response) => response.json())
@@ -0,0 +1,106 @@
+import { useEffect, useState } from "react";
+import { Badge } from "react-bootstrap";
+import { useSetRecoilState } from "recoil";
+import { Table, TableRow } from "../../components/table/Table";
+import {
+  DefaultInstanceProxy,
+  GetInstanceAddress,
+  proxies,
+} from "../../recoil/atoms/instances";
+import { fetchProxy, openStream } from "./InstanceAPI";
+
+// Attack event published in the live feed of an instance
+export type ActivityEvent = {
+  id: string;
+  timestamp: string;
+  kind: string;
+  service?: string;
+  remote_addr?: string;
+  protocol?: string;
+  // Location of the client, when the instance has GeoIP databases
+  country?: string;
+  asn?: number;
+  as_org?: string;
+};
+
+// Attack events shown, the older ones are dropped
+const maxEvents = 50;
+
+// Names of the attack events received from the live feed
+const attackKinds = ["connection", "credential", "command"];
+
+// Row with an attack event
+const InstanceActivityRow = ({ event }: { event: ActivityEvent }) => {
+  const cells = [
+    <small key={0}>{new Date(event.timestamp).toLocaleTimeString()}</small>,
+    <Badge key={1} bg="secondary">
+      {event.kind}
+    </Badge>,
+    <span key={2}>{event.remote_addr}</span>,
+    <span key={3}>{event.service || event.protocol}</span>,
+    <span key={4}>{event.country}</span>,
+    <span key={5} title={event.as_org}>
+      {event.asn ? `AS${event.asn}` : ""}
+    </span>,
+  ];
+
+  return <TableRow cells={cells} />;
+};
+
+// Live feed of the attacks observed by the instance.
+// The proxies are loaded again whenever the instance changes them
+const InstanceActivity = () => {
+  const address = GetInstanceAddress();
+  const setProxies = useSetRecoilState(proxies);
+
+  const [activity, setActivity] = useState<ActivityEvent[]>([]);
+  const [connected, setConnected] = useState(false);
+
+  useEffect(() => {
+    const stream = openStream(address, [...attackKinds, "change"]);
+
+    const onEvent = (message: MessageEvent) => {
+      const event = JSON.parse(message.data) as ActivityEvent;
+      setActivity((prev) => [event, ...prev].slice(0, maxEvents));
+    };
+    attackKinds.forEach((kind) => stream.addEventListener(kind, onEvent));
+
+    stream.addEventListener("change", (message: MessageEvent) => {
+      const change = JSON.parse(message.data);
+      if (change.resource !== "proxy") return;
+
+      fetchProxy(address).then((response) => {
+        if (response.error || !Array.isArray(response)) return;
+        setProxies(
+          response.map((proxy: any) => ({ ...DefaultInstanceProxy, ...proxy }))
+        );
+      });
+    });
+
+    // The browser reconnects on its own when the stream is interrupted
+    stream.onopen = () => setConnected(true);
+    stream.onerror = () => setConnected(false);
+
+    return () => stream.close();
+  }, [address, setProxies]);
+
+  const rows = activity.map((event: ActivityEvent) => (
+    <InstanceActivityRow key={event.id} event={event} />
+  ));
+
+  const data = {
+    headers: [
+      `${activity.length} Events`,
+      "",
+      connected ? "Live" : "Disconnected",
+      "",
+      "Country",
+      "ASN",
+    ],
+    rows: [],
+  };
+
+  return <Table data={data} rows={rows}></Table>;
+};
+
+export default InstanceActivity;
@@ -0,0 +1,88 @@
+import { FormEvent, useEffect, useState } from "react";
+import { Button, Form, Row } from "react-bootstrap";
+import { useToast } from "../../components/toast/Toast";
+import { GetInstanceAddress } from "../../recoil/atoms/instances";
+import { ErrorToastVariant } from "../../recoil/atoms/toast";
+import { fetchMe, login, logout } from "./InstanceAPI";
+
+type Me = {
+  name: string;
+  role: string;
+  enabled: boolean;
+};
+
+// Login form of the instance, shown when the instance requires authentication.
+// Once logged in, it shows the user and a button to log out
+const InstanceLogin = () => {
+  const address = GetInstanceAddress();
+  const { showToast } = useToast();
+
+  // Client authenticated, undefined until the instance answers, null when logged out
+  const [me, setMe] = useState<Me | null | undefined>(undefined);
+
+  useEffect(() => {
+    fetchMe(address).then((data) => {
+      setMe(data && "role" in data ? data : null);
+    });
+  }, [address]);
+
+  const onSubmit = (event: FormEvent<HTMLFormElement>) => {
+    event.preventDefault();
+    const form = event.currentTarget;
+    const username = (form.elements.namedItem("username") as HTMLInputElement)
+      .value;
+    const password = (form.elements.namedItem("password") as HTMLInputElement)
+      .value;
+
+    login(address, username, password).then((data) => {
+      if (data.error) {
+        showToast(data.error, ErrorToastVariant);
+        return;
+      }
+
+      // Load the instance again with the new session
+      window.location.reload();
+    });
+  };
+
+  const onLogout = () => {
+    logout(address).then(() => window.location.reload());
+  };
+
+  // Nothing to show while loading, or if the instance is open
+  if (me === undefined || (me && !me.enabled)) {
+    return null;
+  }
+
+  if (me) {
+    return (
+      <Row className="mb-3">
+        <small>
+          Logged in as <b>{me.name}</b> ({me.role}){" "}
+          <Button variant="link" size="sm" onClick={onLogout}>
+            Log out
+          </Button>
+        </small>
+      </Row>
+    );
+  }
+
+  return (
+    <Form className="mb-3" onSubmit={onSubmit}>
+      <h5>Login</h5>
+      <Form.Group className="mb-3" controlId="formLoginUsername">
+        <Form.Label>Username</Form.Label>
+        <Form.Control name="username" type="text" required />
+      </Form.Group>
+      <Form.Group className="mb-3" controlId="formLoginPassword">
+        <Form.Label>Password</Form.Label>
+        <Form.Control name="password" type="password" required />
+      </Form.Group>
+      <Button variant="primary" type="submit">
+        Login
+      </Button>
+    </Form>
+  );
+};
+
+export default InstanceLogin;